@@ -5,18 +5,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
-	"strings"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/opiproject/gospdk/spdk"
 
 	"github.com/opiproject/opi-spdk-bridge/pkg/backend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/config"
 	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/health"
 	"github.com/opiproject/opi-spdk-bridge/pkg/kvm"
 	"github.com/opiproject/opi-spdk-bridge/pkg/middleend"
 	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
@@ -26,6 +31,7 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 
 	"github.com/philippgille/gokv"
@@ -37,90 +43,217 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 )
 
-func splitBusesBySeparator(str string) []string {
-	if str != "" {
-		return strings.Split(str, ":")
+func newKvmVirtioBlkTransport(virtioBlkTransport, ctrlrDir string) frontend.VirtioBlkTransport {
+	if virtioBlkTransport == "vfio-user" {
+		return kvm.NewVirtioBlkVfiouserTransport(ctrlrDir)
 	}
-	return []string{}
+	return kvm.NewVirtioBlkVhostUserTransport()
 }
 
-func main() {
-	var grpcPort int
-	flag.IntVar(&grpcPort, "grpc_port", 50051, "The gRPC server port")
-
-	var httpPort int
-	flag.IntVar(&httpPort, "http_port", 8082, "The HTTP server port")
-
-	var spdkAddress string
-	flag.StringVar(&spdkAddress, "spdk_addr", "/var/tmp/spdk.sock", "Points to SPDK unix socket/tcp socket to interact with")
-
-	var useKvm bool
-	flag.BoolVar(&useKvm, "kvm", false, "Automates interaction with QEMU to plug/unplug SPDK devices")
+// restoreNvmeAnaStates applies ANA states persisted before the restart to
+// SPDK listeners
+func restoreNvmeAnaStates(frontendServer *frontend.Server) {
+	if !frontendServer.Nvme.AnaReporting {
+		return
+	}
+	if err := frontendServer.RestoreNvmeAnaStates(context.Background()); err != nil {
+		log.Printf("ANA states are not restored on startup: %v", err)
+	}
+}
 
-	var qmpAddress string
-	flag.StringVar(&qmpAddress, "qmp_addr", "127.0.0.1:5555", "Points to QMP unix socket/tcp socket to interact with. Valid only with -kvm option")
+func newKvmServer(frontendServer *frontend.Server, cfg *config.Kvm) *kvm.Server {
+	var kvmServer *kvm.Server
+	switch kvm.Hypervisor(cfg.Hypervisor) {
+	case kvm.HypervisorCloudHypervisor:
+		kvmServer = kvm.NewServerWithVM(frontendServer, kvm.VMConfig{
+			ID:         kvm.DefaultVMID,
+			PortID:     0,
+			Hypervisor: kvm.HypervisorCloudHypervisor,
+			APISocket:  cfg.ChAPISocket,
+			CtrlrDir:   cfg.CtrlrDir,
+			Buses:      cfg.Buses,
+		})
+	case kvm.HypervisorLibvirt:
+		kvmServer = kvm.NewServerWithVM(frontendServer, kvm.VMConfig{
+			ID:         kvm.DefaultVMID,
+			PortID:     0,
+			Hypervisor: kvm.HypervisorLibvirt,
+			APISocket:  cfg.LibvirtSocket,
+			Domain:     cfg.LibvirtDomain,
+			CtrlrDir:   cfg.CtrlrDir,
+			Buses:      cfg.Buses,
+		})
+	default:
+		kvmServer = kvm.NewServer(frontendServer, cfg.QmpAddress, cfg.CtrlrDir, cfg.Buses)
+	}
+	kvmServer.SetTimeouts(cfg.Timeout, cfg.PollDevicePresenceStep)
+	return kvmServer
+}
 
-	var ctrlrDir string
-	flag.StringVar(&ctrlrDir, "ctrlr_dir", "", "Directory with created SPDK device unix sockets (-S option in SPDK). Valid only with -kvm option")
+// dependencies of the bridge services reported by health checks
+const (
+	dependencySpdk  = "spdk"
+	dependencyStore = "store"
+	dependencyVM    = "vm"
+)
 
-	var busesStr string
-	flag.StringVar(&busesStr, "buses", "", "QEMU PCI buses IDs separated by `:` to attach Nvme/virtio-blk devices on. e.g. \"pci.opi.0:pci.opi.1\". Valid only with -kvm option")
+// exit codes of the bridge
+const (
+	exitOK            = 0
+	exitFailure       = 1
+	exitInvalidConfig = 2
+)
 
-	var tlsFiles string
-	flag.StringVar(&tlsFiles, "tls", "", "TLS files in server_cert:server_key:ca_cert format.")
+func main() {
+	os.Exit(run())
+}
 
-	var redisAddress string
-	flag.StringVar(&redisAddress, "redis_addr", "127.0.0.1:6379", "Redis address in ip_address:port format")
+// run starts the servers and serves until SIGTERM or SIGINT is received or a
+// server fails. In-flight calls are drained on shutdown until the deadline.
+func run() int {
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], os.LookupEnv)
+	if err != nil {
+		log.Printf("Failed to load configuration: %v", err)
+		return exitInvalidConfig
+	}
+	utils.SetPaginationLimits(cfg.Pagination.DefaultPageSize, cfg.Pagination.MaxPageSize)
 
-	flag.Parse()
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stopSignals()
 
 	// Create KV store for persistence
 	options := redis.DefaultOptions
-	options.Address = redisAddress
+	options.Address = cfg.RedisAddress
 	options.Codec = utils.ProtoCodec{}
 	store, err := redis.NewClient(options)
 	if err != nil {
-		log.Panic(err)
+		log.Printf("Failed to create store: %v", err)
+		return exitFailure
 	}
 	defer func(store gokv.Store) {
-		err := store.Close()
-		if err != nil {
-			log.Panic(err)
+		if err := store.Close(); err != nil {
+			log.Printf("Failed to close store: %v", err)
 		}
 	}(store)
 
-	go runGatewayServer(grpcPort, httpPort)
-	runGrpcServer(grpcPort, useKvm, store, spdkAddress, qmpAddress, ctrlrDir, busesStr, tlsFiles)
-}
-
-func runGrpcServer(grpcPort int, useKvm bool, store gokv.Store, spdkAddress, qmpAddress, ctrlrDir, busesStr, tlsFiles string) {
-	tp := utils.InitTracerProvider("opi-spdk-bridge")
+	tp := utils.InitTracerProviderWithOptions("opi-spdk-bridge", utils.TracerOptions{
+		Endpoint:      cfg.Tracing.OtlpEndpoint,
+		Insecure:      cfg.Tracing.OtlpInsecure,
+		SamplingRatio: cfg.Tracing.SamplingRatio,
+	})
 	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Panicf("Tracer Provider Shutdown: %v", err)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Printf("Tracer Provider Shutdown: %v", err)
 		}
 	}()
 
-	buses := splitBusesBySeparator(busesStr)
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	grpcServer, extensionRoutes, closeGrpcServer, err := newGrpcServer(cfg, store, checker)
+	if err != nil {
+		log.Printf("Failed to create gRPC server: %v", err)
+		return exitFailure
+	}
+	defer closeGrpcServer()
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", grpcPort))
+	gatewayCtx, cancelGateway := context.WithCancel(context.Background())
+	defer cancelGateway()
+	gatewayServer, err := newGatewayServer(gatewayCtx, cfg.GrpcPort, cfg.HTTPPort, cfg.Gateway, checker, extensionRoutes)
 	if err != nil {
-		log.Panicf("failed to listen: %v", err)
+		log.Printf("Failed to create HTTP gateway server: %v", err)
+		return exitFailure
 	}
 
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GrpcPort))
+	if err != nil {
+		log.Printf("failed to listen: %v", err)
+		return exitFailure
+	}
+	httpListener, err := net.Listen("tcp", gatewayServer.Addr)
+	if err != nil {
+		_ = grpcListener.Close()
+		log.Printf("failed to listen: %v", err)
+		return exitFailure
+	}
+
+	healthCtx, stopHealthChecks := context.WithCancel(context.Background())
+	defer stopHealthChecks()
+	checker.CheckNow(healthCtx)
+	go checker.Run(healthCtx, cfg.Health.CheckInterval)
+
+	serveErrs := make(chan error, 2)
+	go func() {
+		log.Printf("gRPC server listening at %v", grpcListener.Addr())
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			serveErrs <- fmt.Errorf("gRPC server: %w", err)
+		}
+	}()
+	go func() {
+		log.Printf("HTTP Server listening at %v", cfg.HTTPPort)
+		if err := gatewayServer.Serve(httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErrs <- fmt.Errorf("HTTP gateway server: %w", err)
+		}
+	}()
+
+	code := exitOK
+	select {
+	case <-signals.Done():
+		log.Println("Shutdown signal received, draining in-flight calls")
+	case err := <-serveErrs:
+		log.Printf("Server failed: %v", err)
+		code = exitFailure
+	}
+	stopSignals()
+	checker.Shutdown()
+	stopHealthChecks()
+
+	if err := shutdownServers(cfg.ShutdownTimeout, grpcServer, gatewayServer); err != nil {
+		log.Printf("Servers are not drained gracefully: %v", err)
+		code = exitFailure
+	}
+	log.Println("Servers are stopped")
+	return code
+}
+
+// shutdownServers stops accepting new requests and waits for in-flight calls
+// of the HTTP gateway and then of the gRPC server to complete
+func shutdownServers(timeout time.Duration, grpcServer *grpc.Server, gatewayServer *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	gatewayErr := gatewayServer.Shutdown(ctx)
+	if gatewayErr != nil {
+		_ = gatewayServer.Close()
+	}
+	if err := utils.StopGrpcServer(ctx, grpcServer); err != nil {
+		return fmt.Errorf("gRPC server: %w", err)
+	}
+	if gatewayErr != nil {
+		return fmt.Errorf("HTTP gateway server: %w", gatewayErr)
+	}
+	return nil
+}
+
+// newGrpcServer creates gRPC server with all services registered. Serving
+// status of the services is reported by checker based on SPDK, store and VM
+// availability. Returned routes serve APIs of the same services which are not
+// in opi-api yet. Returned function closes connections to hypervisors after
+// the server is stopped.
+func newGrpcServer(cfg *config.Config, store gokv.Store, checker *health.Checker) (*grpc.Server, []utils.ExtensionRoute, func(), error) {
+	var err error
+	closeServer := func() {}
+
 	var serverOptions []grpc.ServerOption
-	if tlsFiles == "" {
+	if cfg.TLSFiles() == "" {
 		log.Println("TLS files are not specified. Use insecure connection.")
 	} else {
-		log.Println("Use TLS certificate files:", tlsFiles)
-		config, err := utils.ParseTLSFiles(tlsFiles)
-		if err != nil {
-			log.Panic("Failed to parse string with tls paths:", err)
-		}
-		log.Println("TLS config:", config)
+		log.Println("Use TLS certificate files:", cfg.TLSFiles())
+		tlsConfig := cfg.TLSConfig()
+		log.Println("TLS config:", tlsConfig)
 		var option grpc.ServerOption
-		if option, err = utils.SetupTLSCredentials(config); err != nil {
-			log.Panic("Failed to setup TLS:", err)
+		if option, err = utils.SetupTLSCredentials(tlsConfig); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to setup TLS: %w", err)
 		}
 		serverOptions = append(serverOptions, option)
 	}
@@ -136,23 +269,77 @@ func runGrpcServer(grpcPort int, useKvm bool, store gokv.Store, spdkAddress, qmp
 				),
 			)),
 	)
+	if cfg.Frontend.NvmeReservationDir != "" {
+		if err := frontend.PrepareReservationDir(cfg.Frontend.NvmeReservationDir); err != nil {
+			return nil, nil, nil, err
+		}
+	}
 	s := grpc.NewServer(serverOptions...)
 
-	jsonRPC := spdk.NewClient(spdkAddress)
-	backendServer := backend.NewServer(jsonRPC, store)
-	middleendServer := middleend.NewServer(jsonRPC, store)
+	jsonRPC := spdk.NewClient(cfg.SpdkAddress)
+	checker.AddDependency(dependencySpdk, health.Spdk(cfg.SpdkAddress))
+	checker.AddDependency(dependencyStore, health.Store(store))
+	frontendDependencies := []string{dependencySpdk, dependencyStore}
+	backendServer := backend.NewCustomizedServer(jsonRPC, store, cfg.Backend.NvmeReconnectPolicy())
+	if err := backendServer.ApplyNvmeOptions(context.Background()); err != nil {
+		log.Printf("bdev_nvme options are not set on startup, retried on the first NvmePath: %v", err)
+	}
+	middleendServer := middleend.NewCustomizedServer(jsonRPC, store, cfg.Middleend.TweakMode)
+	tcpOptions := cfg.Frontend.NvmfTCP.TransportOptions()
+	var routes []utils.ExtensionRoute
 
-	if useKvm {
+	if cfg.Kvm.Enabled {
 		log.Println("Creating KVM server.")
 		frontendServer := frontend.NewCustomizedServer(jsonRPC,
 			store,
 			map[pb.NvmeTransportType]frontend.NvmeTransport{
-				pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP:  frontend.NewNvmeTCPTransport(jsonRPC),
-				pb.NvmeTransportType_NVME_TRANSPORT_TYPE_PCIE: kvm.NewNvmeVfiouserTransport(ctrlrDir, jsonRPC),
+				pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP:  frontend.NewNvmeTCPTransportWithOptions(jsonRPC, tcpOptions),
+				pb.NvmeTransportType_NVME_TRANSPORT_TYPE_PCIE: kvm.NewNvmeVfiouserTransport(cfg.Kvm.CtrlrDir, jsonRPC),
 			},
-			frontend.NewVhostUserBlkTransport(),
+			newKvmVirtioBlkTransport(cfg.Frontend.VirtioBlkTransport, cfg.Kvm.CtrlrDir),
 		)
-		kvmServer := kvm.NewServer(frontendServer, qmpAddress, ctrlrDir, buses)
+		frontendServer.Nvme.AnaReporting = cfg.Frontend.NvmeAnaReporting
+		frontendServer.Nvme.ReservationDir = cfg.Frontend.NvmeReservationDir
+		frontendServer.Nvme.ReservationRPCs = cfg.Frontend.NvmeReservationRPCs
+		frontendServer.Nvme.DhchapDigests = cfg.Frontend.NvmeDhchapDigests
+		frontendServer.Nvme.DhchapDhGroups = cfg.Frontend.NvmeDhchapDhGroups
+		restoreNvmeAnaStates(frontendServer)
+		kvmServer := newKvmServer(frontendServer, &cfg.Kvm)
+		routes = append(routes, kvmServer.ExtensionRoutes()...)
+		closeServer = func() {
+			if err := kvmServer.Close(); err != nil {
+				log.Printf("Failed to close VM connections: %v", err)
+			}
+		}
+		for i := range cfg.Kvm.VMs {
+			if err := kvmServer.RegisterVM(cfg.Kvm.VMs[i].VMConfig(cfg.Kvm.CtrlrDir)); err != nil {
+				closeServer()
+				return nil, nil, nil, fmt.Errorf("failed to register VM %v: %w", cfg.Kvm.VMs[i].ID, err)
+			}
+		}
+		if err := kvmServer.ResumePendingOperations(); err != nil {
+			for _, op := range kvmServer.ListPendingOperations() {
+				log.Printf("Pending %v of %v %v, completed steps %v: %v",
+					op.Operation, op.Object, op.Name, op.CompletedSteps, op.Error)
+			}
+		}
+		if reconciled, err := kvmServer.Reconcile(context.Background(), &kvm.ReconcileRequest{}); err != nil {
+			log.Printf("VM devices are not reconciled on startup: %v", err)
+		} else {
+			for _, d := range reconciled.StrayDevices {
+				log.Printf("Kept device %v of VM %v without bridge object, chardev: %v", d.ID, d.VMID, d.Chardev)
+			}
+		}
+		if events, err := kvmServer.SubscribeVMEvents(kvm.DefaultVMID); err == nil {
+			go func() {
+				for e := range events {
+					log.Printf("VM event: %v", e.Type)
+				}
+			}()
+		}
+
+		checker.AddDependency(dependencyVM, func(context.Context) error { return kvmServer.CheckVMs() })
+		frontendDependencies = append(frontendDependencies, dependencyVM)
 
 		pb.RegisterFrontendNvmeServiceServer(s, kvmServer)
 		pb.RegisterFrontendVirtioBlkServiceServer(s, kvmServer)
@@ -161,10 +348,17 @@ func runGrpcServer(grpcPort int, useKvm bool, store gokv.Store, spdkAddress, qmp
 		frontendServer := frontend.NewCustomizedServer(jsonRPC,
 			store,
 			map[pb.NvmeTransportType]frontend.NvmeTransport{
-				pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP: frontend.NewNvmeTCPTransport(jsonRPC),
+				pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP: frontend.NewNvmeTCPTransportWithOptions(jsonRPC, tcpOptions),
 			},
 			frontend.NewVhostUserBlkTransport(),
 		)
+		frontendServer.Nvme.AnaReporting = cfg.Frontend.NvmeAnaReporting
+		frontendServer.Nvme.ReservationDir = cfg.Frontend.NvmeReservationDir
+		frontendServer.Nvme.ReservationRPCs = cfg.Frontend.NvmeReservationRPCs
+		frontendServer.Nvme.DhchapDigests = cfg.Frontend.NvmeDhchapDigests
+		frontendServer.Nvme.DhchapDhGroups = cfg.Frontend.NvmeDhchapDhGroups
+		restoreNvmeAnaStates(frontendServer)
+		routes = append(routes, frontendServer.ExtensionRoutes()...)
 		pb.RegisterFrontendNvmeServiceServer(s, frontendServer)
 		pb.RegisterFrontendVirtioBlkServiceServer(s, frontendServer)
 		pb.RegisterFrontendVirtioScsiServiceServer(s, frontendServer)
@@ -177,59 +371,78 @@ func runGrpcServer(grpcPort int, useKvm bool, store gokv.Store, spdkAddress, qmp
 	pb.RegisterMiddleendEncryptionServiceServer(s, middleendServer)
 	pb.RegisterMiddleendQosVolumeServiceServer(s, middleendServer)
 
+	for _, service := range []string{
+		pb.FrontendNvmeService_ServiceDesc.ServiceName,
+		pb.FrontendVirtioBlkService_ServiceDesc.ServiceName,
+		pb.FrontendVirtioScsiService_ServiceDesc.ServiceName,
+	} {
+		checker.AddService(service, frontendDependencies...)
+	}
+	for _, service := range []string{
+		pb.NvmeRemoteControllerService_ServiceDesc.ServiceName,
+		pb.NullVolumeService_ServiceDesc.ServiceName,
+		pb.MallocVolumeService_ServiceDesc.ServiceName,
+		pb.AioVolumeService_ServiceDesc.ServiceName,
+		pb.MiddleendEncryptionService_ServiceDesc.ServiceName,
+		pb.MiddleendQosVolumeService_ServiceDesc.ServiceName,
+	} {
+		checker.AddService(service, dependencySpdk, dependencyStore)
+	}
+	grpc_health_v1.RegisterHealthServer(s, checker.Server())
+
 	reflection.Register(s)
 
-	log.Printf("gRPC server listening at %v", lis.Addr())
-	if err := s.Serve(lis); err != nil {
-		log.Panicf("failed to serve: %v", err)
-	}
-}
+	routes = append(routes, backendServer.ExtensionRoutes()...)
 
-func runGatewayServer(grpcPort int, httpPort int) {
-	ctx := context.Background()
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	return s, routes, closeServer, nil
+}
 
+// newGatewayServer creates HTTP server proxying calls to gRPC server and
+// serving extension routes and /healthz and /readyz probes. Connections to
+// gRPC server are closed when ctx is done.
+func newGatewayServer(ctx context.Context, grpcPort int, httpPort int, cfg config.Gateway,
+	checker *health.Checker, extensionRoutes []utils.ExtensionRoute) (*http.Server, error) {
 	// Register gRPC server endpoint
 	// Note: Make sure the gRPC server is running properly and accessible
 	mux := runtime.NewServeMux()
 
 	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
 	endpoint := fmt.Sprintf("localhost:%d", grpcPort)
-	registerGatewayHandler(ctx, mux, endpoint, opts, pc.RegisterInventoryServiceHandlerFromEndpoint, "inventory")
-
-	registerGatewayHandler(ctx, mux, endpoint, opts, pb.RegisterAioVolumeServiceHandlerFromEndpoint, "backend aio")
-	registerGatewayHandler(ctx, mux, endpoint, opts, pb.RegisterNullVolumeServiceHandlerFromEndpoint, "backend null")
-	registerGatewayHandler(ctx, mux, endpoint, opts, pb.RegisterMallocVolumeServiceHandlerFromEndpoint, "backend malloc")
-	registerGatewayHandler(ctx, mux, endpoint, opts, pb.RegisterNvmeRemoteControllerServiceHandlerFromEndpoint, "backend nvme")
-
-	registerGatewayHandler(ctx, mux, endpoint, opts, pb.RegisterMiddleendEncryptionServiceHandlerFromEndpoint, "middleend encryption")
-	registerGatewayHandler(ctx, mux, endpoint, opts, pb.RegisterMiddleendQosVolumeServiceHandlerFromEndpoint, "middleend qos")
-
-	registerGatewayHandler(ctx, mux, endpoint, opts, pb.RegisterFrontendVirtioBlkServiceHandlerFromEndpoint, "frontend virtio-blk")
-	registerGatewayHandler(ctx, mux, endpoint, opts, pb.RegisterFrontendVirtioScsiServiceHandlerFromEndpoint, "frontend virtio-scsi")
-	registerGatewayHandler(ctx, mux, endpoint, opts, pb.RegisterFrontendNvmeServiceHandlerFromEndpoint, "frontend nvme")
-
-	// Start HTTP server (and proxy calls to gRPC server endpoint)
-	log.Printf("HTTP Server listening at %v", httpPort)
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", httpPort),
-		Handler:      mux,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	handlers := []gatewayHandler{
+		{pc.RegisterInventoryServiceHandlerFromEndpoint, "inventory"},
+		{pb.RegisterAioVolumeServiceHandlerFromEndpoint, "backend aio"},
+		{pb.RegisterNullVolumeServiceHandlerFromEndpoint, "backend null"},
+		{pb.RegisterMallocVolumeServiceHandlerFromEndpoint, "backend malloc"},
+		{pb.RegisterNvmeRemoteControllerServiceHandlerFromEndpoint, "backend nvme"},
+		{pb.RegisterMiddleendEncryptionServiceHandlerFromEndpoint, "middleend encryption"},
+		{pb.RegisterMiddleendQosVolumeServiceHandlerFromEndpoint, "middleend qos"},
+		{pb.RegisterFrontendVirtioBlkServiceHandlerFromEndpoint, "frontend virtio-blk"},
+		{pb.RegisterFrontendVirtioScsiServiceHandlerFromEndpoint, "frontend virtio-scsi"},
+		{pb.RegisterFrontendNvmeServiceHandlerFromEndpoint, "frontend nvme"},
 	}
-
-	err := server.ListenAndServe()
-	if err != nil {
-		log.Panic("cannot start HTTP gateway server")
+	for _, h := range handlers {
+		if err := h.registerFunc(ctx, mux, endpoint, opts); err != nil {
+			return nil, fmt.Errorf("cannot register %s handler server: %w", h.serviceName, err)
+		}
 	}
+
+	handler := http.NewServeMux()
+	handler.Handle("/healthz", checker.LivenessHandler())
+	handler.Handle("/readyz", checker.ReadinessHandler())
+	utils.RegisterExtensionRoutes(handler, extensionRoutes)
+	// HTTP server proxies other calls to gRPC server endpoint
+	handler.Handle("/", mux)
+	return &http.Server{
+		Addr:         fmt.Sprintf(":%d", httpPort),
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	}, nil
 }
 
 type registerHandlerFunc func(context.Context, *runtime.ServeMux, string, []grpc.DialOption) error
 
-func registerGatewayHandler(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption, registerFunc registerHandlerFunc, serviceName string) {
-	err := registerFunc(ctx, mux, endpoint, opts)
-	if err != nil {
-		log.Panicf("cannot register %s handler server: %v", serviceName, err)
-	}
+type gatewayHandler struct {
+	registerFunc registerHandlerFunc
+	serviceName  string
 }
@@ -7,6 +7,7 @@ package backend
 
 import (
 	"log"
+	"time"
 
 	"github.com/philippgille/gokv"
 
@@ -21,11 +22,38 @@ import (
 // VolumeParameters contains all BackEnd volume related structures
 type VolumeParameters struct {
 	AioVolumes    map[string]*pb.AioVolume
+	UringVolumes  map[string]*UringVolume
+	IscsiVolumes  map[string]*IscsiVolume
 	NullVolumes   map[string]*pb.NullVolume
 	MallocVolumes map[string]*pb.MallocVolume
 
 	NvmeControllers map[string]*pb.NvmeRemoteController
 	NvmePaths       map[string]*pb.NvmePath
+	// dhchapKeys maps NvmeRemoteController name to its DH-HMAC-CHAP secrets
+	dhchapKeys map[string]*utils.DhchapKeys
+	// reconnectPolicies maps NvmeRemoteController name to its own policy
+	reconnectPolicies map[string]NvmeReconnectPolicy
+}
+
+// NvmeReconnectPolicy contains bdev_nvme tunables applied to remote
+// controllers paths. Zero values keep SPDK defaults.
+type NvmeReconnectPolicy struct {
+	// CtrlrLossTimeoutSec is time to keep reconnecting before giving up, -1 for infinite
+	CtrlrLossTimeoutSec int32 `json:"ctrlrLossTimeoutSec"`
+	// ReconnectDelaySec is time between reconnect attempts
+	ReconnectDelaySec int32 `json:"reconnectDelaySec"`
+	// FastIoFailTimeoutSec is time after which I/O fails while reconnecting
+	FastIoFailTimeoutSec int32 `json:"fastIoFailTimeoutSec"`
+	// KeepAliveTimeoutMs is applied once via bdev_nvme_set_options before the first attach
+	KeepAliveTimeoutMs int32 `json:"keepAliveTimeoutMs"`
+	// MultipathSelector is either round_robin or queue_depth, used in active/active mode
+	MultipathSelector string `json:"multipathSelector"`
+	// DhchapDigests are DH-HMAC-CHAP digests offered to remote controllers,
+	// applied once via bdev_nvme_set_options before the first attach
+	DhchapDigests []string `json:"dhchapDigests"`
+	// DhchapDhGroups are DH-HMAC-CHAP DH groups offered to remote controllers,
+	// applied once via bdev_nvme_set_options before the first attach
+	DhchapDhGroups []string `json:"dhchapDhGroups"`
 }
 
 // Server contains backend related OPI services
@@ -40,28 +68,48 @@ type Server struct {
 	Volumes            VolumeParameters
 	Pagination         map[string]int
 	keyToTemporaryFile func(pskKey []byte) (string, error)
+	reconnectPolicy    NvmeReconnectPolicy
+	nvmeOptionsApplied bool
+	resetTimeout       time.Duration
+	resetPollInterval  time.Duration
 }
 
 // NewServer creates initialized instance of BackEnd server communicating
 // with provided jsonRPC
 func NewServer(jsonRPC spdk.JSONRPC, store gokv.Store) *Server {
+	return NewCustomizedServer(jsonRPC, store, NvmeReconnectPolicy{})
+}
+
+// NewCustomizedServer creates initialized instance of BackEnd server
+// applying provided reconnect policy to remote Nvme controllers
+func NewCustomizedServer(jsonRPC spdk.JSONRPC, store gokv.Store, policy NvmeReconnectPolicy) *Server {
 	if jsonRPC == nil {
 		log.Panic("nil for JSONRPC is not allowed")
 	}
 	if store == nil {
 		log.Panic("nil for Store is not allowed")
 	}
+	if err := policy.validate(); err != nil {
+		log.Panicf("invalid reconnect policy: %v", err)
+	}
 	return &Server{
 		rpc:   jsonRPC,
 		store: store,
 		Volumes: VolumeParameters{
-			AioVolumes:      make(map[string]*pb.AioVolume),
-			NullVolumes:     make(map[string]*pb.NullVolume),
-			MallocVolumes:   make(map[string]*pb.MallocVolume),
-			NvmeControllers: make(map[string]*pb.NvmeRemoteController),
-			NvmePaths:       make(map[string]*pb.NvmePath),
+			AioVolumes:        make(map[string]*pb.AioVolume),
+			UringVolumes:      make(map[string]*UringVolume),
+			IscsiVolumes:      make(map[string]*IscsiVolume),
+			NullVolumes:       make(map[string]*pb.NullVolume),
+			MallocVolumes:     make(map[string]*pb.MallocVolume),
+			NvmeControllers:   make(map[string]*pb.NvmeRemoteController),
+			NvmePaths:         make(map[string]*pb.NvmePath),
+			dhchapKeys:        make(map[string]*utils.DhchapKeys),
+			reconnectPolicies: make(map[string]NvmeReconnectPolicy),
 		},
 		Pagination:         make(map[string]int),
 		keyToTemporaryFile: utils.KeyToTemporaryFile,
+		reconnectPolicy:    policy,
+		resetTimeout:       30 * time.Second,
+		resetPollInterval:  100 * time.Millisecond,
 	}
 }
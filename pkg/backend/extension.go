@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package backend implememnts the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"context"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ExtensionRoutes returns backend APIs which opi-api has no messages for
+// yet, served by the HTTP gateway under utils.ExtensionPathPrefix
+func (s *Server) ExtensionRoutes() []utils.ExtensionRoute {
+	return []utils.ExtensionRoute{
+		{Path: "backend/CreateUringVolume", Handler: utils.ExtensionHandler(s.CreateUringVolume)},
+		{Path: "backend/DeleteUringVolume", Handler: utils.ExtensionHandler(s.DeleteUringVolume)},
+		{Path: "backend/UpdateUringVolume", Handler: utils.ExtensionHandler(s.UpdateUringVolume)},
+		{Path: "backend/ListUringVolumes", Handler: utils.ExtensionHandler(s.ListUringVolumes)},
+		{Path: "backend/GetUringVolume", Handler: utils.ExtensionHandler(s.GetUringVolume)},
+		{Path: "backend/StatsUringVolume", Handler: utils.ExtensionHandler(s.StatsUringVolume)},
+		{Path: "backend/CreateNvmeRemoteControllerWithDhchap", Handler: utils.ExtensionHandler(s.createNvmeRemoteControllerWithDhchap)},
+		{Path: "backend/SetNvmeRemoteControllerPolicy", Handler: utils.ExtensionHandler(s.SetNvmeRemoteControllerPolicy)},
+		{Path: "backend/GetNvmeRemoteControllerPolicy", Handler: utils.ExtensionHandler(s.GetNvmeRemoteControllerPolicy)},
+		{Path: "backend/GetNvmePathStatus", Handler: utils.ExtensionHandler(s.GetNvmePathStatus)},
+		{Path: "backend/ResetNvmeRemoteControllerWithStatus", Handler: utils.ExtensionHandler(s.ResetNvmeRemoteControllerWithStatus)},
+		{Path: "backend/CreateIscsiVolume", Handler: utils.ExtensionHandler(s.CreateIscsiVolume)},
+		{Path: "backend/DeleteIscsiVolume", Handler: utils.ExtensionHandler(s.DeleteIscsiVolume)},
+		{Path: "backend/ListIscsiVolumes", Handler: utils.ExtensionHandler(s.ListIscsiVolumes)},
+		{Path: "backend/GetIscsiVolume", Handler: utils.ExtensionHandler(s.GetIscsiVolume)},
+		{Path: "backend/StatsIscsiVolume", Handler: utils.ExtensionHandler(s.StatsIscsiVolume)},
+	}
+}
+
+func (s *Server) createNvmeRemoteControllerWithDhchap(ctx context.Context, in *CreateNvmeRemoteControllerWithDhchapRequest) (*pb.NvmeRemoteController, error) {
+	if in.Request.Message == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing required field: request")
+	}
+	if in.Dhchap == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing required field: dhchap")
+	}
+	return s.CreateNvmeRemoteControllerWithDhchap(ctx, in.Request.Message, in.Dhchap)
+}
@@ -0,0 +1,313 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implememnts the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"sort"
+
+	"github.com/opiproject/gospdk/spdk"
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"github.com/google/uuid"
+	"go.einride.tech/aip/resourceid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// TODO: backend_iscsi.proto in opi-api does not define any messages yet, so
+// the types below are local and the service is served by the HTTP extension
+// API, see ExtensionRoutes, until they land.
+
+// IscsiChap represents CHAP credentials used to log in to an iSCSI target
+type IscsiChap struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// MarshalJSON omits the password, so it is not returned by Get and List
+func (c IscsiChap) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Username string `json:"username"`
+	}{c.Username})
+}
+
+// IscsiVolume represents a remote iSCSI LUN attached as a bdev
+type IscsiVolume struct {
+	Name         string `json:"name"`
+	InitiatorIqn string `json:"initiatorIqn"`
+	// Portals are tried in order, each one in host[:port] form
+	Portals   []string   `json:"portals"`
+	TargetIqn string     `json:"targetIqn"`
+	Lun       int32      `json:"lun"`
+	Chap      *IscsiChap `json:"chap,omitempty"`
+}
+
+// CreateIscsiVolumeRequest represents a request to attach an iSCSI volume
+type CreateIscsiVolumeRequest struct {
+	IscsiVolume   *IscsiVolume `json:"iscsiVolume"`
+	IscsiVolumeID string       `json:"iscsiVolumeId"`
+}
+
+// DeleteIscsiVolumeRequest represents a request to detach an iSCSI volume
+type DeleteIscsiVolumeRequest struct {
+	Name         string `json:"name"`
+	AllowMissing bool   `json:"allowMissing"`
+}
+
+// ListIscsiVolumesRequest represents a request to list iSCSI volumes
+type ListIscsiVolumesRequest struct {
+	PageSize  int32  `json:"pageSize"`
+	PageToken string `json:"pageToken"`
+}
+
+// ListIscsiVolumesResponse represents a list of iSCSI volumes
+type ListIscsiVolumesResponse struct {
+	IscsiVolumes  []*IscsiVolume `json:"iscsiVolumes"`
+	NextPageToken string         `json:"nextPageToken"`
+}
+
+// GetIscsiVolumeRequest represents a request to get an iSCSI volume
+type GetIscsiVolumeRequest struct {
+	Name string `json:"name"`
+}
+
+// StatsIscsiVolumeRequest represents a request to get iSCSI volume stats
+type StatsIscsiVolumeRequest struct {
+	Name string `json:"name"`
+}
+
+// StatsIscsiVolumeResponse represents iSCSI volume stats
+type StatsIscsiVolumeResponse struct {
+	Stats *pb.VolumeStats `json:"stats"`
+}
+
+type bdevIscsiCreateParams struct {
+	Name         string `json:"name"`
+	InitiatorIqn string `json:"initiator_iqn"`
+	URL          string `json:"url"`
+}
+
+type bdevIscsiCreateResult string
+
+type bdevIscsiDeleteParams struct {
+	Name string `json:"name"`
+}
+
+type bdevIscsiDeleteResult bool
+
+func sortIscsiVolumes(volumes []*IscsiVolume) {
+	sort.Slice(volumes, func(i int, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+}
+
+func cloneIscsiVolume(volume *IscsiVolume) *IscsiVolume {
+	clone := *volume
+	clone.Portals = append([]string(nil), volume.Portals...)
+	if volume.Chap != nil {
+		chap := *volume.Chap
+		clone.Chap = &chap
+	}
+	return &clone
+}
+
+// iscsiURL builds libiscsi url in iscsi://[user[:password]@]host[:port]/iqn/lun form.
+// Credentials and iqn are percent-encoded, libiscsi decodes them back.
+func iscsiURL(portal string, volume *IscsiVolume) string {
+	credentials := ""
+	if volume.Chap != nil {
+		credentials = url.UserPassword(volume.Chap.Username, volume.Chap.Password).String() + "@"
+	}
+	return fmt.Sprintf("iscsi://%s%s/%s/%d", credentials, portal, url.PathEscape(volume.TargetIqn), volume.Lun)
+}
+
+// CreateIscsiVolume attaches an iSCSI LUN as a volume
+func (s *Server) CreateIscsiVolume(ctx context.Context, in *CreateIscsiVolumeRequest) (*IscsiVolume, error) {
+	// check input correctness
+	if err := s.validateCreateIscsiVolumeRequest(in); err != nil {
+		return nil, err
+	}
+	// see https://google.aip.dev/133#user-specified-ids
+	resourceID := resourceid.NewSystemGenerated()
+	if in.IscsiVolumeID != "" {
+		log.Printf("client provided the ID of a resource %v, ignoring the name field %v", in.IscsiVolumeID, in.IscsiVolume.Name)
+		resourceID = in.IscsiVolumeID
+	}
+	in.IscsiVolume.Name = utils.ResourceIDToVolumeName(resourceID)
+	// idempotent API when called with same key, should return same object
+	volume, ok := s.Volumes.IscsiVolumes[in.IscsiVolume.Name]
+	if ok {
+		log.Printf("Already existing IscsiVolume with id %v", in.IscsiVolume.Name)
+		return volume, nil
+	}
+	// not found, so create a new one
+	if err := s.createIscsiBdev(ctx, resourceID, in.IscsiVolume); err != nil {
+		return nil, err
+	}
+	response := cloneIscsiVolume(in.IscsiVolume)
+	s.Volumes.IscsiVolumes[in.IscsiVolume.Name] = response
+	return response, nil
+}
+
+// DeleteIscsiVolume detaches an iSCSI volume
+func (s *Server) DeleteIscsiVolume(ctx context.Context, in *DeleteIscsiVolumeRequest) (*emptypb.Empty, error) {
+	// check input correctness
+	if err := s.validateDeleteIscsiVolumeRequest(in); err != nil {
+		return nil, err
+	}
+	// fetch object from the database
+	volume, ok := s.Volumes.IscsiVolumes[in.Name]
+	if !ok {
+		if in.AllowMissing {
+			return &emptypb.Empty{}, nil
+		}
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	params := bdevIscsiDeleteParams{
+		Name: path.Base(volume.Name),
+	}
+	var result bdevIscsiDeleteResult
+	err := s.rpc.Call(ctx, "bdev_iscsi_delete", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not delete iSCSI Dev: %s", params.Name)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	delete(s.Volumes.IscsiVolumes, volume.Name)
+	return &emptypb.Empty{}, nil
+}
+
+// ListIscsiVolumes lists iSCSI volumes
+func (s *Server) ListIscsiVolumes(_ context.Context, in *ListIscsiVolumesRequest) (*ListIscsiVolumesResponse, error) {
+	// check input correctness
+	if in == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing request")
+	}
+	// fetch object from the database
+	size, offset, perr := utils.ExtractPagination(in.PageSize, in.PageToken, s.Pagination)
+	if perr != nil {
+		return nil, perr
+	}
+	Blobarray := []*IscsiVolume{}
+	for _, volume := range s.Volumes.IscsiVolumes {
+		Blobarray = append(Blobarray, cloneIscsiVolume(volume))
+	}
+	sortIscsiVolumes(Blobarray)
+
+	token := ""
+	log.Printf("Limiting result len(%d) to [%d:%d]", len(Blobarray), offset, size)
+	Blobarray, hasMoreElements := utils.LimitPagination(Blobarray, offset, size)
+	if hasMoreElements {
+		token = uuid.New().String()
+		s.Pagination[token] = offset + size
+	}
+	return &ListIscsiVolumesResponse{IscsiVolumes: Blobarray, NextPageToken: token}, nil
+}
+
+// GetIscsiVolume gets an iSCSI volume
+func (s *Server) GetIscsiVolume(ctx context.Context, in *GetIscsiVolumeRequest) (*IscsiVolume, error) {
+	// check input correctness
+	if err := s.validateGetIscsiVolumeRequest(in); err != nil {
+		return nil, err
+	}
+	// fetch object from the database
+	volume, ok := s.Volumes.IscsiVolumes[in.Name]
+	if !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	params := spdk.BdevGetBdevsParams{
+		Name: path.Base(volume.Name),
+	}
+	var result []spdk.BdevGetBdevsResult
+	err := s.rpc.Call(ctx, "bdev_get_bdevs", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if len(result) != 1 {
+		msg := fmt.Sprintf("expecting exactly 1 result, got %d", len(result))
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	return cloneIscsiVolume(volume), nil
+}
+
+// StatsIscsiVolume gets an iSCSI volume stats
+func (s *Server) StatsIscsiVolume(ctx context.Context, in *StatsIscsiVolumeRequest) (*StatsIscsiVolumeResponse, error) {
+	// check input correctness
+	if err := s.validateStatsIscsiVolumeRequest(in); err != nil {
+		return nil, err
+	}
+	// fetch object from the database
+	volume, ok := s.Volumes.IscsiVolumes[in.Name]
+	if !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	params := spdk.BdevGetIostatParams{
+		Name: path.Base(volume.Name),
+	}
+	// See https://mholt.github.io/json-to-go/
+	var result spdk.BdevGetIostatResult
+	err := s.rpc.Call(ctx, "bdev_get_iostat", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if len(result.Bdevs) != 1 {
+		msg := fmt.Sprintf("expecting exactly 1 result, got %d", len(result.Bdevs))
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	return &StatsIscsiVolumeResponse{Stats: &pb.VolumeStats{
+		ReadBytesCount:    int32(result.Bdevs[0].BytesRead),
+		ReadOpsCount:      int32(result.Bdevs[0].NumReadOps),
+		WriteBytesCount:   int32(result.Bdevs[0].BytesWritten),
+		WriteOpsCount:     int32(result.Bdevs[0].NumWriteOps),
+		UnmapBytesCount:   int32(result.Bdevs[0].BytesUnmapped),
+		UnmapOpsCount:     int32(result.Bdevs[0].NumUnmapOps),
+		ReadLatencyTicks:  int32(result.Bdevs[0].ReadLatencyTicks),
+		WriteLatencyTicks: int32(result.Bdevs[0].WriteLatencyTicks),
+		UnmapLatencyTicks: int32(result.Bdevs[0].UnmapLatencyTicks),
+	}}, nil
+}
+
+// createIscsiBdev tries portals one by one until the LUN is attached
+func (s *Server) createIscsiBdev(ctx context.Context, name string, volume *IscsiVolume) error {
+	var err error
+	for _, portal := range volume.Portals {
+		params := bdevIscsiCreateParams{
+			Name:         name,
+			InitiatorIqn: volume.InitiatorIqn,
+			URL:          iscsiURL(portal, volume),
+		}
+		var result bdevIscsiCreateResult
+		err = s.rpc.Call(ctx, "bdev_iscsi_create", &params, &result)
+		if err != nil {
+			// url is not logged since it can carry CHAP secret
+			log.Printf("error: failed to attach %v via portal %v: %v", name, portal, err)
+			continue
+		}
+		log.Printf("Received from SPDK: %v", result)
+		if result == "" {
+			msg := fmt.Sprintf("Could not create iSCSI Dev: %s", name)
+			return status.Errorf(codes.InvalidArgument, msg)
+		}
+		return nil
+	}
+	return status.Errorf(codes.Unavailable, "could not attach %s via any of %d portals: %v",
+		name, len(volume.Portals), err)
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implememnts the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"go.einride.tech/aip/resourceid"
+	"go.einride.tech/aip/resourcename"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) validateCreateIscsiVolumeRequest(in *CreateIscsiVolumeRequest) error {
+	// check required fields
+	if in == nil || in.IscsiVolume == nil {
+		return status.Error(codes.InvalidArgument, "missing required field: iscsi_volume")
+	}
+	if in.IscsiVolume.InitiatorIqn == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: iscsi_volume.initiator_iqn")
+	}
+	if in.IscsiVolume.TargetIqn == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: iscsi_volume.target_iqn")
+	}
+	if len(in.IscsiVolume.Portals) == 0 {
+		return status.Error(codes.InvalidArgument, "missing required field: iscsi_volume.portals")
+	}
+	for _, portal := range in.IscsiVolume.Portals {
+		if portal == "" {
+			return status.Error(codes.InvalidArgument, "empty portal is not allowed")
+		}
+	}
+	if in.IscsiVolume.Lun < 0 {
+		return status.Errorf(codes.InvalidArgument, "negative lun %v is not allowed", in.IscsiVolume.Lun)
+	}
+	if in.IscsiVolume.Chap != nil &&
+		(in.IscsiVolume.Chap.Username == "" || in.IscsiVolume.Chap.Password == "") {
+		return status.Error(codes.InvalidArgument, "chap requires both username and password")
+	}
+	// see https://google.aip.dev/133#user-specified-ids
+	if in.IscsiVolumeID != "" {
+		if err := resourceid.ValidateUserSettable(in.IscsiVolumeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) validateDeleteIscsiVolumeRequest(in *DeleteIscsiVolumeRequest) error {
+	// check required fields
+	if in == nil || in.Name == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: name")
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Name)
+}
+
+func (s *Server) validateGetIscsiVolumeRequest(in *GetIscsiVolumeRequest) error {
+	// check required fields
+	if in == nil || in.Name == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: name")
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Name)
+}
+
+func (s *Server) validateStatsIscsiVolumeRequest(in *StatsIscsiVolumeRequest) error {
+	// check required fields
+	if in == nil || in.Name == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: name")
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Name)
+}
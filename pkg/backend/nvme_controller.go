@@ -7,10 +7,14 @@ package backend
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"path"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/opiproject/gospdk/spdk"
 	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
 	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
 
@@ -30,11 +34,31 @@ func sortNvmeRemoteControllers(controllers []*pb.NvmeRemoteController) {
 }
 
 // CreateNvmeRemoteController creates an Nvme remote controller
-func (s *Server) CreateNvmeRemoteController(_ context.Context, in *pb.CreateNvmeRemoteControllerRequest) (*pb.NvmeRemoteController, error) {
+func (s *Server) CreateNvmeRemoteController(ctx context.Context, in *pb.CreateNvmeRemoteControllerRequest) (*pb.NvmeRemoteController, error) {
+	return s.CreateNvmeRemoteControllerWithDhchap(ctx, in, nil)
+}
+
+// CreateNvmeRemoteControllerWithDhchapRequest is
+// CreateNvmeRemoteControllerRequest with DH-HMAC-CHAP secrets of its paths
+type CreateNvmeRemoteControllerWithDhchapRequest struct {
+	Request utils.ProtoJSON[*pb.CreateNvmeRemoteControllerRequest] `json:"request"`
+	Dhchap  *utils.DhchapConfig                                    `json:"dhchap"`
+}
+
+// CreateNvmeRemoteControllerWithDhchap creates an Nvme remote controller
+// authenticating its paths by DH-HMAC-CHAP. Digests and DH groups are set by
+// NvmeReconnectPolicy for all controllers.
+// TODO: move DH-HMAC-CHAP secrets into NvmeRemoteController once opi-api has them
+func (s *Server) CreateNvmeRemoteControllerWithDhchap(ctx context.Context, in *pb.CreateNvmeRemoteControllerRequest, dhchap *utils.DhchapConfig) (*pb.NvmeRemoteController, error) {
 	// check input correctness
 	if err := s.validateCreateNvmeRemoteControllerRequest(in); err != nil {
 		return nil, err
 	}
+	if dhchap != nil {
+		if err := dhchap.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	// see https://google.aip.dev/133#user-specified-ids
 	resourceID := resourceid.NewSystemGenerated()
 	if in.NvmeRemoteControllerId != "" {
@@ -49,13 +73,21 @@ func (s *Server) CreateNvmeRemoteController(_ context.Context, in *pb.CreateNvme
 		return volume, nil
 	}
 	// not found, so create a new one
+	if dhchap != nil {
+		log.Printf("Notice, DH-HMAC-CHAP is used for controller %v", in.NvmeRemoteController.Name)
+		keys, err := utils.AddDhchapKeys(ctx, s.rpc, utils.DhchapRemoteControllerKeyPrefix+resourceID, dhchap, s.keyToTemporaryFile)
+		if err != nil {
+			return nil, err
+		}
+		s.Volumes.dhchapKeys[in.NvmeRemoteController.Name] = keys
+	}
 	response := utils.ProtoClone(in.NvmeRemoteController)
 	s.Volumes.NvmeControllers[in.NvmeRemoteController.Name] = response
 	return response, nil
 }
 
 // DeleteNvmeRemoteController deletes an Nvme remote controller
-func (s *Server) DeleteNvmeRemoteController(_ context.Context, in *pb.DeleteNvmeRemoteControllerRequest) (*emptypb.Empty, error) {
+func (s *Server) DeleteNvmeRemoteController(ctx context.Context, in *pb.DeleteNvmeRemoteControllerRequest) (*emptypb.Empty, error) {
 	// check input correctness
 	if err := s.validateDeleteNvmeRemoteControllerRequest(in); err != nil {
 		return nil, err
@@ -72,17 +104,133 @@ func (s *Server) DeleteNvmeRemoteController(_ context.Context, in *pb.DeleteNvme
 	if s.numberOfPathsForController(in.Name) > 0 {
 		return nil, status.Error(codes.FailedPrecondition, "NvmePaths exist for controller")
 	}
+	if keys, ok := s.Volumes.dhchapKeys[volume.Name]; ok {
+		if err := utils.RemoveDhchapKeys(ctx, s.rpc, keys); err != nil {
+			return nil, err
+		}
+		delete(s.Volumes.dhchapKeys, volume.Name)
+	}
+	delete(s.Volumes.reconnectPolicies, volume.Name)
 	delete(s.Volumes.NvmeControllers, volume.Name)
 	return &emptypb.Empty{}, nil
 }
 
-// ResetNvmeRemoteController resets an Nvme remote controller
-func (s *Server) ResetNvmeRemoteController(_ context.Context, in *pb.ResetNvmeRemoteControllerRequest) (*emptypb.Empty, error) {
+// NvmePathReset reports SPDK controller state of a NvmePath before and after
+// a reset. States are the ones reported by NvmePathStatus.State.
+type NvmePathReset struct {
+	Name   string `json:"name"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// ResetNvmeRemoteControllerResponse holds state changes of reset NvmePaths
+type ResetNvmeRemoteControllerResponse struct {
+	NvmePaths []NvmePathReset `json:"nvmePaths"`
+}
+
+// ResetNvmeRemoteController resets an Nvme remote controller. Name can be
+// either a controller one to reset all its paths or a NvmePath one to reset
+// only that path.
+func (s *Server) ResetNvmeRemoteController(ctx context.Context, in *pb.ResetNvmeRemoteControllerRequest) (*emptypb.Empty, error) {
+	if _, err := s.ResetNvmeRemoteControllerWithStatus(ctx, in); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ResetNvmeRemoteControllerWithStatus resets an Nvme remote controller like
+// ResetNvmeRemoteController and reports state changes of reset paths, which
+// opi-api has no response message for
+func (s *Server) ResetNvmeRemoteControllerWithStatus(ctx context.Context, in *pb.ResetNvmeRemoteControllerRequest) (*ResetNvmeRemoteControllerResponse, error) {
 	// check input correctness
 	if err := s.validateResetNvmeRemoteControllerRequest(in); err != nil {
 		return nil, err
 	}
-	return &emptypb.Empty{}, nil
+	// fetch object from the database
+	var nvmePath *pb.NvmePath
+	controller, ok := s.Volumes.NvmeControllers[in.Name]
+	if !ok {
+		nvmePath, ok = s.Volumes.NvmePaths[in.Name]
+		if !ok {
+			err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+			return nil, err
+		}
+		if isDiscoveryPath(nvmePath) {
+			err := status.Errorf(codes.FailedPrecondition, "discovery path %s cannot be reset", in.Name)
+			return nil, err
+		}
+		controllerName := utils.ResourceIDToRemoteControllerName(
+			utils.GetRemoteControllerIDFromNvmeRemoteName(in.Name),
+		)
+		controller, ok = s.Volumes.NvmeControllers[controllerName]
+		if !ok {
+			err := status.Errorf(codes.Internal, "unable to find NvmeRemoteController by key %s", controllerName)
+			return nil, err
+		}
+	}
+	controllerID := utils.GetRemoteControllerIDFromNvmeRemoteName(controller.Name)
+
+	before, err := s.getNvmeControllers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params := bdevNvmeResetControllerParams{
+		Name: controllerID,
+	}
+	if nvmePath != nil {
+		cntlid, err := s.nvmePathCntlid(before, controllerID, nvmePath)
+		if err != nil {
+			return nil, err
+		}
+		params.Cntlid = &cntlid
+	}
+	var result bdevNvmeResetControllerResult
+	err = s.rpc.Call(ctx, "bdev_nvme_reset_controller", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not reset Nvme Remote Controller: %s", in.Name)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+
+	after, err := s.waitNvmeControllerEnabled(ctx, controllerID, params.Cntlid)
+	resets := s.nvmePathResets(controller.Name, nvmePath, before, after)
+	for _, reset := range resets {
+		if reset.Before != reset.After {
+			log.Printf("NvmePath %v state changed after reset: %q -> %q", reset.Name, reset.Before, reset.After)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Nvme Remote Controller %v is reset", in.Name)
+	return &ResetNvmeRemoteControllerResponse{NvmePaths: resets}, nil
+}
+
+// nvmePathResets returns states of reset paths before and after the reset.
+// nil nvmePath means all paths of the controller.
+func (s *Server) nvmePathResets(controllerName string, nvmePath *pb.NvmePath,
+	before []spdk.BdevNvmeGetControllerResult, after []spdk.BdevNvmeGetControllerResult) []NvmePathReset {
+	nvmePaths := []*pb.NvmePath{nvmePath}
+	if nvmePath == nil {
+		nvmePaths = nil
+		prefix := controllerName + "/"
+		for _, p := range s.Volumes.NvmePaths {
+			if strings.HasPrefix(p.Name, prefix) && !isDiscoveryPath(p) {
+				nvmePaths = append(nvmePaths, p)
+			}
+		}
+		sort.Slice(nvmePaths, func(i, j int) bool { return nvmePaths[i].Name < nvmePaths[j].Name })
+	}
+	resets := []NvmePathReset{}
+	for _, p := range nvmePaths {
+		_, beforeState := s.mergeNvmePath(p, before)
+		_, afterState := s.mergeNvmePath(p, after)
+		resets = append(resets, NvmePathReset{Name: p.Name, Before: beforeState, After: afterState})
+	}
+	return resets
 }
 
 // UpdateNvmeRemoteController resets an Nvme remote controller
@@ -172,3 +320,87 @@ func (s *Server) StatsNvmeRemoteController(_ context.Context, in *pb.StatsNvmeRe
 	log.Printf("TODO: send name to SPDK and get back stats: %v", name)
 	return &pb.StatsNvmeRemoteControllerResponse{Stats: &pb.VolumeStats{ReadOpsCount: -1, WriteOpsCount: -1}}, nil
 }
+
+type bdevNvmeResetControllerParams struct {
+	Name string `json:"name"`
+	// Cntlid selects a single path to reset, nil resets all paths.
+	// 0 is a valid cntlid e.g. of PCIe controllers.
+	Cntlid *int `json:"cntlid,omitempty"`
+}
+
+type bdevNvmeResetControllerResult bool
+
+func (s *Server) getNvmeControllers(ctx context.Context) ([]spdk.BdevNvmeGetControllerResult, error) {
+	var result []spdk.BdevNvmeGetControllerResult
+	err := s.rpc.Call(ctx, "bdev_nvme_get_controllers", nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	return result, nil
+}
+
+// nvmeControllerStates returns states of SPDK controller paths by cntlid
+func nvmeControllerStates(result []spdk.BdevNvmeGetControllerResult, controllerID string) map[int]string {
+	states := make(map[int]string)
+	for i := range result {
+		if result[i].Name != controllerID {
+			continue
+		}
+		for _, ctrlr := range result[i].Ctrlrs {
+			states[ctrlr.Cntlid] = ctrlr.State
+		}
+	}
+	return states
+}
+
+func (s *Server) nvmePathCntlid(result []spdk.BdevNvmeGetControllerResult, controllerID string, nvmePath *pb.NvmePath) (int, error) {
+	for i := range result {
+		if result[i].Name != controllerID {
+			continue
+		}
+		for _, ctrlr := range result[i].Ctrlrs {
+			if s.nvmePathMatchesTrid(nvmePath, ctrlr.Trid.Trtype, ctrlr.Trid.Traddr, ctrlr.Trid.Trsvcid, ctrlr.Trid.Subnqn) {
+				return ctrlr.Cntlid, nil
+			}
+		}
+	}
+	return 0, status.Errorf(codes.FailedPrecondition, "Nvme Path %s is not attached", nvmePath.Name)
+}
+
+// waitNvmeControllerEnabled polls SPDK until reset paths are enabled again
+// and returns the last polled controllers. nil cntlid means all paths of the
+// controller.
+func (s *Server) waitNvmeControllerEnabled(ctx context.Context, controllerID string, cntlid *int) ([]spdk.BdevNvmeGetControllerResult, error) {
+	deadline := time.Now().Add(s.resetTimeout)
+	for {
+		controllers, err := s.getNvmeControllers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		states := nvmeControllerStates(controllers, controllerID)
+		enabled := len(states) > 0
+		for id, state := range states {
+			if (cntlid == nil || id == *cntlid) && state != "enabled" {
+				enabled = false
+			}
+		}
+		if cntlid != nil {
+			if _, ok := states[*cntlid]; !ok {
+				enabled = false
+			}
+		}
+		if enabled {
+			return controllers, nil
+		}
+		if time.Now().After(deadline) {
+			return controllers, status.Errorf(codes.DeadlineExceeded,
+				"Nvme Remote Controller %s did not come back after reset: %v", controllerID, states)
+		}
+		select {
+		case <-ctx.Done():
+			return controllers, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(s.resetPollInterval):
+		}
+	}
+}
@@ -6,9 +6,13 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 
@@ -120,20 +124,106 @@ func TestBackEnd_CreateNvmeRemoteController(t *testing.T) {
 
 func TestBackEnd_ResetNvmeRemoteController(t *testing.T) {
 	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	ctrlrs := func(state1, state2 string) string {
+		return `{"id":%d,"error":{"code":0,"message":""},"result":[{"name":"opi-nvme8","ctrlrs":[` +
+			`{"state":"` + state1 + `","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"cntlid":1},` +
+			`{"state":"` + state2 + `","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.2","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"cntlid":2}]}]}`
+	}
 	tests := map[string]struct {
 		in      string
 		out     *emptypb.Empty
 		spdk    []string
+		timeout time.Duration
 		errCode codes.Code
 		errMsg  string
 	}{
-		"valid request without SPDK": {
-			in:      testNvmeCtrlID,
-			out:     &emptypb.Empty{},
-			spdk:    []string{},
+		"all paths reset": {
+			in:  testNvmeCtrlName,
+			out: &emptypb.Empty{},
+			spdk: []string{
+				ctrlrs("enabled", "failed"),
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				ctrlrs("resetting", "resetting"),
+				ctrlrs("enabled", "enabled"),
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"single path reset": {
+			in:  testNvmePathName,
+			out: &emptypb.Empty{},
+			spdk: []string{
+				ctrlrs("failed", "failed"),
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				ctrlrs("enabled", "failed"),
+			},
 			errCode: codes.OK,
 			errMsg:  "",
 		},
+		"single path with cntlid 0 reset": {
+			in:  testNvmePathName,
+			out: &emptypb.Empty{},
+			spdk: []string{
+				strings.Replace(ctrlrs("failed", "failed"), `"cntlid":1`, `"cntlid":0`, 1),
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				strings.Replace(ctrlrs("enabled", "failed"), `"cntlid":1`, `"cntlid":0`, 1),
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"controller does not come back": {
+			in:  testNvmeCtrlName,
+			out: nil,
+			spdk: []string{
+				ctrlrs("enabled", "failed"),
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				ctrlrs("enabled", "failed"),
+			},
+			timeout: -time.Second,
+			errCode: codes.DeadlineExceeded,
+			errMsg:  fmt.Sprintf("Nvme Remote Controller %v did not come back after reset: %v", testNvmeCtrlID, map[int]string{1: "enabled", 2: "failed"}),
+		},
+		"valid request with invalid SPDK response": {
+			in:  testNvmeCtrlName,
+			out: nil,
+			spdk: []string{
+				ctrlrs("enabled", "enabled"),
+				`{"id":%d,"error":{"code":0,"message":""},"result":false}`,
+			},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not reset Nvme Remote Controller: %v", testNvmeCtrlName),
+		},
+		"valid request with error code from SPDK response": {
+			in:  testNvmeCtrlName,
+			out: nil,
+			spdk: []string{
+				ctrlrs("enabled", "enabled"),
+				`{"id":%d,"error":{"code":1,"message":"myopierr"}}`,
+			},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_nvme_reset_controller: %v", "json response error: myopierr"),
+		},
+		"path not attached": {
+			in:      testNvmePathName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`},
+			errCode: codes.FailedPrecondition,
+			errMsg:  fmt.Sprintf("Nvme Path %v is not attached", testNvmePathName),
+		},
+		"valid request with unknown key": {
+			in:      utils.ResourceIDToRemoteControllerName("unknown-id"),
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", utils.ResourceIDToRemoteControllerName("unknown-id")),
+		},
+		"malformed name": {
+			in:      "-ABC-DEF",
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("segment '%s': not a valid DNS name", "-ABC-DEF"),
+		},
 	}
 
 	// run tests
@@ -142,6 +232,14 @@ func TestBackEnd_ResetNvmeRemoteController(t *testing.T) {
 			testEnv := createTestEnvironment(tt.spdk)
 			defer testEnv.Close()
 
+			testEnv.opiSpdkServer.resetTimeout = time.Second
+			if tt.timeout != 0 {
+				testEnv.opiSpdkServer.resetTimeout = tt.timeout
+			}
+			testEnv.opiSpdkServer.resetPollInterval = time.Millisecond
+			testEnv.opiSpdkServer.Volumes.NvmeControllers[testNvmeCtrlName] = utils.ProtoClone(&testNvmeCtrlWithName)
+			testEnv.opiSpdkServer.Volumes.NvmePaths[testNvmePathName] = utils.ProtoClone(&testNvmePathWithName)
+
 			request := &pb.ResetNvmeRemoteControllerRequest{Name: tt.in}
 			response, err := testEnv.client.ResetNvmeRemoteController(testEnv.ctx, request)
 
@@ -163,6 +261,98 @@ func TestBackEnd_ResetNvmeRemoteController(t *testing.T) {
 	}
 }
 
+func TestBackEnd_ResetNvmeRemoteControllerWithStatus(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	ctrlrs := func(state1, state2 string) string {
+		return `{"id":%d,"error":{"code":0,"message":""},"result":[{"name":"opi-nvme8","ctrlrs":[` +
+			`{"state":"` + state1 + `","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"cntlid":1},` +
+			`{"state":"` + state2 + `","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.2","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"cntlid":2}]}]}`
+	}
+	secondPath := &pb.NvmePath{
+		Name:   utils.ResourceIDToNvmePathName(testNvmeCtrlID, "second"),
+		Trtype: pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+		Traddr: "127.0.0.2",
+		Fabrics: &pb.FabricsPath{
+			Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
+			Subnqn:  testNvmePath.Fabrics.Subnqn,
+			Trsvcid: 4444,
+		},
+	}
+	tests := map[string]struct {
+		in      string
+		out     *ResetNvmeRemoteControllerResponse
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"all paths reset": {
+			in: testNvmeCtrlName,
+			out: &ResetNvmeRemoteControllerResponse{NvmePaths: []NvmePathReset{
+				{Name: testNvmePathName, Before: "enabled", After: "enabled"},
+				{Name: secondPath.Name, Before: "failed", After: "enabled"},
+			}},
+			spdk: []string{
+				ctrlrs("enabled", "failed"),
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				ctrlrs("enabled", "enabled"),
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"single path reset": {
+			in: secondPath.Name,
+			out: &ResetNvmeRemoteControllerResponse{NvmePaths: []NvmePathReset{
+				{Name: secondPath.Name, Before: "failed", After: "enabled"},
+			}},
+			spdk: []string{
+				ctrlrs("failed", "failed"),
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				ctrlrs("failed", "enabled"),
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"path detached after reset": {
+			in:  testNvmeCtrlName,
+			out: nil,
+			spdk: []string{
+				ctrlrs("enabled", "failed"),
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+			},
+			errCode: codes.DeadlineExceeded,
+			errMsg:  fmt.Sprintf("Nvme Remote Controller %v did not come back after reset: %v", testNvmeCtrlID, map[int]string{}),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.resetTimeout = -time.Second
+			testEnv.opiSpdkServer.resetPollInterval = time.Millisecond
+			testEnv.opiSpdkServer.Volumes.NvmeControllers[testNvmeCtrlName] = utils.ProtoClone(&testNvmeCtrlWithName)
+			testEnv.opiSpdkServer.Volumes.NvmePaths[testNvmePathName] = utils.ProtoClone(&testNvmePathWithName)
+			testEnv.opiSpdkServer.Volumes.NvmePaths[secondPath.Name] = utils.ProtoClone(secondPath)
+
+			request := &pb.ResetNvmeRemoteControllerRequest{Name: tt.in}
+			response, err := testEnv.opiSpdkServer.ResetNvmeRemoteControllerWithStatus(testEnv.ctx, request)
+
+			if !reflect.DeepEqual(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
 func TestBackEnd_ListNvmeRemoteControllers(t *testing.T) {
 	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
 	tests := map[string]struct {
@@ -536,3 +726,162 @@ func TestBackEnd_DeleteNvmeRemoteController(t *testing.T) {
 		})
 	}
 }
+
+func TestBackEnd_CreateNvmeRemoteControllerWithDhchap(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	hostKey := []byte("DHHC-1:00:ia6zGodOr7SGyzRyCq9CqR9pq4W8a8tISgFqvvhv4Bs6hyMl:")
+	ctrlrKey := []byte("DHHC-1:03:MjE4ZTAzNmRlNmZlNDBmNzc0YzY0ZjQ5ZTMyZGM4ODdmMTNjZjdkMWU4OWE0ZDlhOWJmMmZkYmQ4YzY1YjJhN7Xnbw4=:")
+	tests := map[string]struct {
+		dhchap   *utils.DhchapConfig
+		spdk     []string
+		errCode  codes.Code
+		errMsg   string
+		hostKey  string
+		ctrlrKey string
+	}{
+		"unidirectional authentication": {
+			dhchap:   &utils.DhchapConfig{HostKey: hostKey},
+			spdk:     []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode:  codes.OK,
+			errMsg:   "",
+			hostKey:  "rctrl-" + testNvmeCtrlID + "-dhchap-host",
+			ctrlrKey: "",
+		},
+		"bidirectional authentication": {
+			dhchap: &utils.DhchapConfig{HostKey: hostKey, CtrlrKey: ctrlrKey},
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+			},
+			errCode:  codes.OK,
+			errMsg:   "",
+			hostKey:  "rctrl-" + testNvmeCtrlID + "-dhchap-host",
+			ctrlrKey: "rctrl-" + testNvmeCtrlID + "-dhchap-ctrlr",
+		},
+		"controller key rejected by keyring": {
+			dhchap: &utils.DhchapConfig{HostKey: hostKey, CtrlrKey: ctrlrKey},
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":false}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+			},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not add key %s to keyring", "rctrl-"+testNvmeCtrlID+"-dhchap-ctrlr"),
+		},
+		"host key error from keyring": {
+			dhchap:  &utils.DhchapConfig{HostKey: hostKey},
+			spdk:    []string{`{"id":%d,"error":{"code":-17,"message":"File exists"},"result":false}`},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("keyring_file_add_key: %v", "json response error: File exists"),
+		},
+		"missing host key": {
+			dhchap:  &utils.DhchapConfig{CtrlrKey: ctrlrKey},
+			spdk:    []string{},
+			errCode: codes.InvalidArgument,
+			errMsg:  "missing DH-HMAC-CHAP host key",
+		},
+		"not DHHC-1 secret": {
+			dhchap:  &utils.DhchapConfig{HostKey: []byte("secret")},
+			spdk:    []string{},
+			errCode: codes.InvalidArgument,
+			errMsg:  "DH-HMAC-CHAP secret has to be in DHHC-1 format",
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			keyFiles := []string{}
+			origWriteKey := testEnv.opiSpdkServer.keyToTemporaryFile
+			testEnv.opiSpdkServer.keyToTemporaryFile = func(key []byte) (string, error) {
+				file, err := origWriteKey(key)
+				keyFiles = append(keyFiles, file)
+				return file, err
+			}
+
+			request := &pb.CreateNvmeRemoteControllerRequest{
+				NvmeRemoteController:   utils.ProtoClone(&testNvmeCtrl),
+				NvmeRemoteControllerId: testNvmeCtrlID,
+			}
+			_, err := testEnv.opiSpdkServer.CreateNvmeRemoteControllerWithDhchap(testEnv.ctx, request, tt.dhchap)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+
+			keys, ok := testEnv.opiSpdkServer.Volumes.dhchapKeys[testNvmeCtrlName]
+			if ok != (tt.hostKey != "") {
+				t.Fatal("expected keys to be stored:", tt.hostKey != "", "received", ok)
+			}
+			if ok && (keys.HostKey != tt.hostKey || keys.CtrlrKey != tt.ctrlrKey) {
+				t.Error("keys: expected", tt.hostKey, tt.ctrlrKey, "received", keys.HostKey, keys.CtrlrKey)
+			}
+			_, ctrlrExists := testEnv.opiSpdkServer.Volumes.NvmeControllers[testNvmeCtrlName]
+			if ctrlrExists != (tt.errCode == codes.OK) {
+				t.Error("expected controller to be created:", tt.errCode == codes.OK, "received", ctrlrExists)
+			}
+			for _, keyFile := range keyFiles {
+				_, err := os.Stat(keyFile)
+				if exists := err == nil; exists != ok {
+					t.Error("expected key file", keyFile, "to exist:", ok, "received", exists)
+				}
+				_ = os.Remove(keyFile)
+			}
+		})
+	}
+}
+
+func TestBackEnd_DeleteNvmeRemoteControllerWithDhchap(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	testEnv := createTestEnvironment([]string{
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+	})
+	defer testEnv.Close()
+
+	keyFiles := []string{}
+	origWriteKey := testEnv.opiSpdkServer.keyToTemporaryFile
+	testEnv.opiSpdkServer.keyToTemporaryFile = func(key []byte) (string, error) {
+		file, err := origWriteKey(key)
+		keyFiles = append(keyFiles, file)
+		return file, err
+	}
+
+	dhchap := &utils.DhchapConfig{
+		HostKey:  []byte("DHHC-1:00:ia6zGodOr7SGyzRyCq9CqR9pq4W8a8tISgFqvvhv4Bs6hyMl:"),
+		CtrlrKey: []byte("DHHC-1:00:ia6zGodOr7SGyzRyCq9CqR9pq4W8a8tISgFqvvhv4Bs6hyMl:"),
+	}
+	createRequest := &pb.CreateNvmeRemoteControllerRequest{
+		NvmeRemoteController:   utils.ProtoClone(&testNvmeCtrl),
+		NvmeRemoteControllerId: testNvmeCtrlID,
+	}
+	if _, err := testEnv.opiSpdkServer.CreateNvmeRemoteControllerWithDhchap(testEnv.ctx, createRequest, dhchap); err != nil {
+		t.Fatal("expected no error on create, received", err)
+	}
+
+	deleteRequest := &pb.DeleteNvmeRemoteControllerRequest{Name: testNvmeCtrlName}
+	if _, err := testEnv.client.DeleteNvmeRemoteController(testEnv.ctx, deleteRequest); err != nil {
+		t.Fatal("expected no error on delete, received", err)
+	}
+
+	if _, ok := testEnv.opiSpdkServer.Volumes.dhchapKeys[testNvmeCtrlName]; ok {
+		t.Error("expected keys to be removed")
+	}
+	if len(keyFiles) != 2 {
+		t.Error("expected 2 key files, received", len(keyFiles))
+	}
+	for _, keyFile := range keyFiles {
+		if _, err := os.Stat(keyFile); !errors.Is(err, os.ErrNotExist) {
+			t.Error("expected key file", keyFile, "to be removed")
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"go.einride.tech/aip/fieldbehavior"
 	"go.einride.tech/aip/resourceid"
 	"go.einride.tech/aip/resourcename"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
 )
@@ -71,3 +73,27 @@ func (s *Server) validateStatsNvmeRemoteControllerRequest(in *pb.StatsNvmeRemote
 	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
 	return resourcename.Validate(in.Name)
 }
+
+func (s *Server) validateSetNvmeRemoteControllerPolicyRequest(in *SetNvmeRemoteControllerPolicyRequest) error {
+	// check required fields
+	if in == nil || in.Name == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: name")
+	}
+	if in.Policy.KeepAliveTimeoutMs != 0 || len(in.Policy.DhchapDigests) != 0 || len(in.Policy.DhchapDhGroups) != 0 {
+		return status.Error(codes.InvalidArgument, "keep alive timeout and DH-HMAC-CHAP digests and DH groups cannot be set per controller")
+	}
+	if err := in.Policy.validate(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Name)
+}
+
+func (s *Server) validateGetNvmeRemoteControllerPolicyRequest(in *GetNvmeRemoteControllerPolicyRequest) error {
+	// check required fields
+	if in == nil || in.Name == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: name")
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Name)
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implements the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// discoveryNqn is the well-known NQN of NVMe-oF discovery subsystems. NvmePath
+// pointing at it makes SPDK follow the discovery log page and attach/detach
+// subsystems found there on its own.
+const discoveryNqn = "nqn.2014-08.org.nvmexpress.discovery"
+
+type bdevNvmeStartDiscoveryParams struct {
+	Name    string `json:"name"`
+	Trtype  string `json:"trtype"`
+	Traddr  string `json:"traddr"`
+	Adrfam  string `json:"adrfam,omitempty"`
+	Trsvcid string `json:"trsvcid,omitempty"`
+	Hostnqn string `json:"hostnqn,omitempty"`
+}
+
+type bdevNvmeStartDiscoveryResult bool
+
+type bdevNvmeStopDiscoveryParams struct {
+	Name string `json:"name"`
+}
+
+type bdevNvmeStopDiscoveryResult bool
+
+type bdevNvmeTrid struct {
+	Trtype  string `json:"trtype"`
+	Adrfam  string `json:"adrfam"`
+	Traddr  string `json:"traddr"`
+	Trsvcid string `json:"trsvcid"`
+	Subnqn  string `json:"subnqn"`
+}
+
+type bdevNvmeGetDiscoveryInfoResult struct {
+	Name    string       `json:"name"`
+	Trid    bdevNvmeTrid `json:"trid"`
+	Entries []struct {
+		Trid      bdevNvmeTrid `json:"trid"`
+		CtrlrName string       `json:"ctrlr_name"`
+	} `json:"entries"`
+}
+
+func isDiscoveryPath(nvmePath *pb.NvmePath) bool {
+	return nvmePath.GetFabrics().GetSubnqn() == discoveryNqn
+}
+
+func (s *Server) discoveryPathForController(controllerName string) *pb.NvmePath {
+	prefix := controllerName + "/"
+	for _, nvmePath := range s.Volumes.NvmePaths {
+		if strings.HasPrefix(nvmePath.Name, prefix) && isDiscoveryPath(nvmePath) {
+			return nvmePath
+		}
+	}
+	return nil
+}
+
+func (s *Server) startNvmeDiscovery(ctx context.Context, controller *pb.NvmeRemoteController, nvmePath *pb.NvmePath) error {
+	if s.numberOfPathsForController(controller.Name) > 0 {
+		return status.Error(codes.FailedPrecondition, "discovery path cannot be combined with other NvmePaths")
+	}
+	if len(controller.GetTcp().GetPsk()) > 0 {
+		return status.Error(codes.FailedPrecondition, "tls is not supported for discovery")
+	}
+	params := bdevNvmeStartDiscoveryParams{
+		Name:    utils.GetRemoteControllerIDFromNvmeRemoteName(controller.Name),
+		Trtype:  s.opiTransportToSpdk(nvmePath.GetTrtype()),
+		Traddr:  nvmePath.GetTraddr(),
+		Adrfam:  utils.OpiAdressFamilyToSpdk(nvmePath.GetFabrics().GetAdrfam()),
+		Trsvcid: fmt.Sprint(nvmePath.GetFabrics().GetTrsvcid()),
+		Hostnqn: nvmePath.GetFabrics().GetHostnqn(),
+	}
+	var result bdevNvmeStartDiscoveryResult
+	err := s.rpc.Call(ctx, "bdev_nvme_start_discovery", &params, &result)
+	if err != nil {
+		return err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not start discovery: %s", nvmePath.Name)
+		return status.Errorf(codes.InvalidArgument, msg)
+	}
+	return nil
+}
+
+func (s *Server) stopNvmeDiscovery(ctx context.Context, controllerName string, nvmePath *pb.NvmePath) error {
+	params := bdevNvmeStopDiscoveryParams{
+		Name: utils.GetRemoteControllerIDFromNvmeRemoteName(controllerName),
+	}
+	var result bdevNvmeStopDiscoveryResult
+	err := s.rpc.Call(ctx, "bdev_nvme_stop_discovery", &params, &result)
+	if err != nil {
+		return err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not stop discovery: %s", nvmePath.Name)
+		return status.Errorf(codes.InvalidArgument, msg)
+	}
+	return nil
+}
+
+// discoveredNvmePaths reports current discovery log page entries of the
+// controller as NvmePaths. SPDK keeps them in sync with the log page, so
+// subsystems moved between ports show up here without any extra action.
+func (s *Server) discoveredNvmePaths(ctx context.Context, controllerName string) ([]*pb.NvmePath, error) {
+	var result []bdevNvmeGetDiscoveryInfoResult
+	err := s.rpc.Call(ctx, "bdev_nvme_get_discovery_info", nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	controllerID := utils.GetRemoteControllerIDFromNvmeRemoteName(controllerName)
+	paths := []*pb.NvmePath{}
+	for i := range result {
+		if result[i].Name != controllerID {
+			continue
+		}
+		for _, entry := range result[i].Entries {
+			paths = append(paths, spdkTridToNvmePath(
+				utils.ResourceIDToNvmePathName(controllerID, entry.CtrlrName),
+				entry.Trid,
+			))
+		}
+	}
+	return paths, nil
+}
+
+func spdkTridToNvmePath(name string, trid bdevNvmeTrid) *pb.NvmePath {
+	trsvcid, err := strconv.ParseInt(trid.Trsvcid, 10, 64)
+	if err != nil {
+		log.Printf("error: failed to parse trsvcid %v: %v", trid.Trsvcid, err)
+	}
+	return &pb.NvmePath{
+		Name: name,
+		Trtype: pb.NvmeTransportType(
+			pb.NvmeTransportType_value["NVME_TRANSPORT_TYPE_"+strings.ToUpper(trid.Trtype)],
+		),
+		Traddr: trid.Traddr,
+		Fabrics: &pb.FabricsPath{
+			Trsvcid: trsvcid,
+			Subnqn:  trid.Subnqn,
+			Adrfam: pb.NvmeAddressFamily(
+				pb.NvmeAddressFamily_value["NVME_ADDRESS_FAMILY_"+strings.ToUpper(trid.Adrfam)],
+			),
+		},
+	}
+}
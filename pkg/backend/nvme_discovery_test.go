@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implememnts the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+var (
+	testDiscoveryPathID   = "mydiscovery"
+	testDiscoveryPathName = utils.ResourceIDToNvmePathName(testNvmeCtrlID, testDiscoveryPathID)
+	testDiscoveryPath     = pb.NvmePath{
+		Trtype: pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+		Traddr: "127.0.0.1",
+		Fabrics: &pb.FabricsPath{
+			Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
+			Subnqn:  discoveryNqn,
+			Hostnqn: "nqn.2014-08.org.nvmexpress:uuid:feb98abe-d51f-40c8-b348-2753f3571d3c",
+			Trsvcid: 8009,
+		},
+	}
+	testDiscoveryPathWithName = pb.NvmePath{
+		Name:    testDiscoveryPathName,
+		Trtype:  testDiscoveryPath.Trtype,
+		Traddr:  testDiscoveryPath.Traddr,
+		Fabrics: testDiscoveryPath.Fabrics,
+	}
+)
+
+func TestBackEnd_CreateNvmeDiscoveryPath(t *testing.T) {
+	tests := map[string]struct {
+		out        *pb.NvmePath
+		spdk       []string
+		errCode    codes.Code
+		errMsg     string
+		existing   *pb.NvmePath
+		controller *pb.NvmeRemoteController
+	}{
+		"valid request with invalid SPDK response": {
+			out:        nil,
+			spdk:       []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode:    codes.InvalidArgument,
+			errMsg:     fmt.Sprintf("Could not start discovery: %v", testDiscoveryPathName),
+			existing:   nil,
+			controller: &testNvmeCtrlWithName,
+		},
+		"valid request with error code from SPDK response": {
+			out:        nil,
+			spdk:       []string{`{"id":%d,"error":{"code":1,"message":"myopierr"}}`},
+			errCode:    codes.Unknown,
+			errMsg:     fmt.Sprintf("bdev_nvme_start_discovery: %v", "json response error: myopierr"),
+			existing:   nil,
+			controller: &testNvmeCtrlWithName,
+		},
+		"valid request with valid SPDK response": {
+			out:        &testDiscoveryPathWithName,
+			spdk:       []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode:    codes.OK,
+			errMsg:     "",
+			existing:   nil,
+			controller: &testNvmeCtrlWithName,
+		},
+		"controller already has paths": {
+			out:        nil,
+			spdk:       []string{},
+			errCode:    codes.FailedPrecondition,
+			errMsg:     "discovery path cannot be combined with other NvmePaths",
+			existing:   &testNvmePathWithName,
+			controller: &testNvmeCtrlWithName,
+		},
+		"tls controller": {
+			out:      nil,
+			spdk:     []string{},
+			errCode:  codes.FailedPrecondition,
+			errMsg:   "tls is not supported for discovery",
+			existing: nil,
+			controller: &pb.NvmeRemoteController{
+				Name: testNvmeCtrlName,
+				Tcp:  &pb.TcpController{Psk: []byte("NVMeTLSkey-1:01:MDAxMTIyMzM0NDU1NjY3Nzg4OTlhYWJiY2NkZGVlZmZwJEiQ:")},
+			},
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Volumes.NvmeControllers[testNvmeCtrlName] = utils.ProtoClone(tt.controller)
+			if tt.existing != nil {
+				testEnv.opiSpdkServer.Volumes.NvmePaths[tt.existing.Name] = utils.ProtoClone(tt.existing)
+			}
+
+			request := &pb.CreateNvmePathRequest{
+				Parent:     testNvmeCtrlName,
+				NvmePath:   utils.ProtoClone(&testDiscoveryPath),
+				NvmePathId: testDiscoveryPathID,
+			}
+			response, err := testEnv.client.CreateNvmePath(testEnv.ctx, request)
+
+			if !proto.Equal(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+
+			if er, ok := status.FromError(err); ok {
+				if er.Code() != tt.errCode {
+					t.Error("error code: expected", tt.errCode, "received", er.Code())
+				}
+				if er.Message() != tt.errMsg {
+					t.Error("error message: expected", tt.errMsg, "received", er.Message())
+				}
+			} else {
+				t.Error("expected grpc error status")
+			}
+		})
+	}
+}
+
+func TestBackEnd_CreateNvmePathOnDiscoveryController(t *testing.T) {
+	testEnv := createTestEnvironment([]string{})
+	defer testEnv.Close()
+
+	testEnv.opiSpdkServer.Volumes.NvmeControllers[testNvmeCtrlName] = utils.ProtoClone(&testNvmeCtrlWithName)
+	testEnv.opiSpdkServer.Volumes.NvmePaths[testDiscoveryPathName] = utils.ProtoClone(&testDiscoveryPathWithName)
+
+	request := &pb.CreateNvmePathRequest{
+		Parent:     testNvmeCtrlName,
+		NvmePath:   utils.ProtoClone(&testNvmePath),
+		NvmePathId: testNvmePathID,
+	}
+	response, err := testEnv.client.CreateNvmePath(testEnv.ctx, request)
+	if response != nil {
+		t.Error("response: expected nil, received", response)
+	}
+	if er := status.Convert(err); er.Code() != codes.FailedPrecondition {
+		t.Error("error code: expected", codes.FailedPrecondition, "received", er.Code())
+	}
+}
+
+func TestBackEnd_DeleteNvmeDiscoveryPath(t *testing.T) {
+	tests := map[string]struct {
+		out     *emptypb.Empty
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid request with invalid SPDK response": {
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not stop discovery: %v", testDiscoveryPathName),
+		},
+		"valid request with empty SPDK response": {
+			out:     nil,
+			spdk:    []string{""},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_nvme_stop_discovery: %v", "EOF"),
+		},
+		"valid request with valid SPDK response": {
+			out:     &emptypb.Empty{},
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Volumes.NvmeControllers[testNvmeCtrlName] = utils.ProtoClone(&testNvmeCtrlWithName)
+			testEnv.opiSpdkServer.Volumes.NvmePaths[testDiscoveryPathName] = utils.ProtoClone(&testDiscoveryPathWithName)
+
+			request := &pb.DeleteNvmePathRequest{Name: testDiscoveryPathName}
+			response, err := testEnv.client.DeleteNvmePath(testEnv.ctx, request)
+
+			if !proto.Equal(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+
+			if er, ok := status.FromError(err); ok {
+				if er.Code() != tt.errCode {
+					t.Error("error code: expected", tt.errCode, "received", er.Code())
+				}
+				if er.Message() != tt.errMsg {
+					t.Error("error message: expected", tt.errMsg, "received", er.Message())
+				}
+			} else {
+				t.Error("expected grpc error status")
+			}
+
+			_, stillExists := testEnv.opiSpdkServer.Volumes.NvmePaths[testDiscoveryPathName]
+			if stillExists != (tt.errCode != codes.OK) {
+				t.Error("unexpected discovery path presence", stillExists)
+			}
+		})
+	}
+}
+
+func TestBackEnd_ListNvmeDiscoveredPaths(t *testing.T) {
+	discovered := func(ctrlrName, traddr string, trsvcid int64) *pb.NvmePath {
+		return &pb.NvmePath{
+			Name:   utils.ResourceIDToNvmePathName(testNvmeCtrlID, ctrlrName),
+			Trtype: pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+			Traddr: traddr,
+			Fabrics: &pb.FabricsPath{
+				Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
+				Subnqn:  "nqn.2016-06.io.spdk:cnode1",
+				Trsvcid: trsvcid,
+			},
+		}
+	}
+	tests := map[string]struct {
+		out     []*pb.NvmePath
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"discovery info error": {
+			out: nil,
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":1,"message":"myopierr"}}`,
+			},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_nvme_get_discovery_info: %v", "json response error: myopierr"),
+		},
+		"entries of own discovery service only": {
+			out: []*pb.NvmePath{
+				&testDiscoveryPathWithName,
+				discovered("opi-nvme80", "10.0.0.1", 4420),
+				discovered("opi-nvme81", "10.0.0.2", 4421),
+			},
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":[` +
+					`{"name":"opi-nvme8","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"8009","subnqn":"nqn.2014-08.org.nvmexpress.discovery"},"entries":[` +
+					`{"trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"10.0.0.2","trsvcid":"4421","subnqn":"nqn.2016-06.io.spdk:cnode1"},"ctrlr_name":"opi-nvme81"},` +
+					`{"trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"10.0.0.1","trsvcid":"4420","subnqn":"nqn.2016-06.io.spdk:cnode1"},"ctrlr_name":"opi-nvme80"}]},` +
+					`{"name":"other","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.2","trsvcid":"8009","subnqn":"nqn.2014-08.org.nvmexpress.discovery"},"entries":[` +
+					`{"trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"10.0.0.3","trsvcid":"4420","subnqn":"nqn.2016-06.io.spdk:cnode2"},"ctrlr_name":"other0"}]}]}`,
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Volumes.NvmeControllers[testNvmeCtrlName] = utils.ProtoClone(&testNvmeCtrlWithName)
+			testEnv.opiSpdkServer.Volumes.NvmePaths[testDiscoveryPathName] = utils.ProtoClone(&testDiscoveryPathWithName)
+
+			request := &pb.ListNvmePathsRequest{Parent: testNvmeCtrlName}
+			response, err := testEnv.client.ListNvmePaths(testEnv.ctx, request)
+
+			if !utils.EqualProtoSlices(response.GetNvmePaths(), tt.out) {
+				t.Error("response: expected", tt.out, "received", response.GetNvmePaths())
+			}
+
+			if er, ok := status.FromError(err); ok {
+				if er.Code() != tt.errCode {
+					t.Error("error code: expected", tt.errCode, "received", er.Code())
+				}
+				if er.Message() != tt.errMsg {
+					t.Error("error message: expected", tt.errMsg, "received", er.Message())
+				}
+			} else {
+				t.Error("expected grpc error status")
+			}
+		})
+	}
+}
@@ -68,6 +68,22 @@ func (s *Server) CreateNvmePath(ctx context.Context, in *pb.CreateNvmePathReques
 		return nil, err
 	}
 
+	if err := s.applyNvmeOptions(ctx); err != nil {
+		return nil, err
+	}
+	if isDiscoveryPath(in.NvmePath) {
+		if err := s.startNvmeDiscovery(ctx, controller, in.NvmePath); err != nil {
+			return nil, err
+		}
+		response := utils.ProtoClone(in.NvmePath)
+		s.Volumes.NvmePaths[in.NvmePath.Name] = response
+		return response, nil
+	}
+	if s.discoveryPathForController(controller.Name) != nil {
+		err := status.Errorf(codes.FailedPrecondition, "NvmePaths cannot be added to controller with discovery path")
+		return nil, err
+	}
+
 	multipath := ""
 	if numberOfPaths := s.numberOfPathsForController(controller.Name); numberOfPaths > 0 {
 		// set multipath parameter only when at least one path already exists
@@ -87,18 +103,28 @@ func (s *Server) CreateNvmePath(ctx context.Context, in *pb.CreateNvmePathReques
 
 		psk = keyFile
 	}
-	params := spdk.BdevNvmeAttachControllerParams{
-		Name:      utils.GetRemoteControllerIDFromNvmeRemoteName(controller.Name),
-		Trtype:    s.opiTransportToSpdk(in.NvmePath.GetTrtype()),
-		Traddr:    in.NvmePath.GetTraddr(),
-		Adrfam:    utils.OpiAdressFamilyToSpdk(in.NvmePath.GetFabrics().GetAdrfam()),
-		Trsvcid:   fmt.Sprint(in.NvmePath.GetFabrics().GetTrsvcid()),
-		Subnqn:    in.NvmePath.GetFabrics().GetSubnqn(),
-		Hostnqn:   in.NvmePath.GetFabrics().GetHostnqn(),
-		Multipath: multipath,
-		Hdgst:     controller.GetTcp().GetHdgst(),
-		Ddgst:     controller.GetTcp().GetDdgst(),
-		Psk:       psk,
+	policy := s.controllerPolicy(controller.Name)
+	params := bdevNvmeAttachControllerParams{
+		BdevNvmeAttachControllerParams: spdk.BdevNvmeAttachControllerParams{
+			Name:      utils.GetRemoteControllerIDFromNvmeRemoteName(controller.Name),
+			Trtype:    s.opiTransportToSpdk(in.NvmePath.GetTrtype()),
+			Traddr:    in.NvmePath.GetTraddr(),
+			Adrfam:    utils.OpiAdressFamilyToSpdk(in.NvmePath.GetFabrics().GetAdrfam()),
+			Trsvcid:   fmt.Sprint(in.NvmePath.GetFabrics().GetTrsvcid()),
+			Subnqn:    in.NvmePath.GetFabrics().GetSubnqn(),
+			Hostnqn:   in.NvmePath.GetFabrics().GetHostnqn(),
+			Multipath: multipath,
+			Hdgst:     controller.GetTcp().GetHdgst(),
+			Ddgst:     controller.GetTcp().GetDdgst(),
+			Psk:       psk,
+		},
+		CtrlrLossTimeoutSec:  policy.CtrlrLossTimeoutSec,
+		ReconnectDelaySec:    policy.ReconnectDelaySec,
+		FastIoFailTimeoutSec: policy.FastIoFailTimeoutSec,
+	}
+	if keys, ok := s.Volumes.dhchapKeys[controller.Name]; ok {
+		params.DhchapKey = keys.HostKey
+		params.DhchapCtrlrKey = keys.CtrlrKey
 	}
 	var result []spdk.BdevNvmeAttachControllerResult
 	err := s.rpc.Call(ctx, "bdev_nvme_attach_controller", &params, &result)
@@ -107,6 +133,21 @@ func (s *Server) CreateNvmePath(ctx context.Context, in *pb.CreateNvmePathReques
 	}
 	log.Printf("Received from SPDK: %v", result)
 
+	if multipath != "" {
+		// bdevs become multipath ones only when the second path is attached
+		bdevs := make([]string, len(result))
+		for i := range result {
+			bdevs[i] = string(result[i])
+		}
+		if err := s.setMultipathPolicy(ctx, controller, bdevs); err != nil {
+			// do not leave the path attached without the requested policy
+			if derr := s.detachNvmePath(ctx, controller, in.NvmePath); derr != nil {
+				log.Printf("error: failed to detach %v: %v", in.NvmePath.Name, derr)
+			}
+			return nil, err
+		}
+	}
+
 	response := utils.ProtoClone(in.NvmePath)
 	s.Volumes.NvmePaths[in.NvmePath.Name] = response
 	return response, nil
@@ -135,6 +176,25 @@ func (s *Server) DeleteNvmePath(ctx context.Context, in *pb.DeleteNvmePathReques
 		return nil, err
 	}
 
+	if isDiscoveryPath(nvmePath) {
+		if err := s.stopNvmeDiscovery(ctx, controller.Name, nvmePath); err != nil {
+			return nil, err
+		}
+		delete(s.Volumes.NvmePaths, in.Name)
+		return &emptypb.Empty{}, nil
+	}
+
+	if err := s.detachNvmePath(ctx, controller, nvmePath); err != nil {
+		return nil, err
+	}
+
+	delete(s.Volumes.NvmePaths, in.Name)
+
+	return &emptypb.Empty{}, nil
+}
+
+// detachNvmePath detaches path of a remote controller from SPDK
+func (s *Server) detachNvmePath(ctx context.Context, controller *pb.NvmeRemoteController, nvmePath *pb.NvmePath) error {
 	params := spdk.BdevNvmeDetachControllerParams{
 		Name:    utils.GetRemoteControllerIDFromNvmeRemoteName(controller.Name),
 		Trtype:  s.opiTransportToSpdk(nvmePath.GetTrtype()),
@@ -147,17 +207,14 @@ func (s *Server) DeleteNvmePath(ctx context.Context, in *pb.DeleteNvmePathReques
 	var result spdk.BdevNvmeDetachControllerResult
 	err := s.rpc.Call(ctx, "bdev_nvme_detach_controller", &params, &result)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	log.Printf("Received from SPDK: %v", result)
 	if !result {
-		msg := fmt.Sprintf("Could not delete Nvme Path: %s", in.Name)
-		return nil, status.Errorf(codes.InvalidArgument, msg)
+		msg := fmt.Sprintf("Could not delete Nvme Path: %s", nvmePath.Name)
+		return status.Errorf(codes.InvalidArgument, msg)
 	}
-
-	delete(s.Volumes.NvmePaths, in.Name)
-
-	return &emptypb.Empty{}, nil
+	return nil
 }
 
 // UpdateNvmePath updates an Nvme path
@@ -203,19 +260,31 @@ func (s *Server) ListNvmePaths(ctx context.Context, in *pb.ListNvmePathsRequest)
 		return nil, err
 	}
 	log.Printf("Received from SPDK: %v", result)
+	Blobarray := []*pb.NvmePath{}
+	prefix := in.Parent + "/"
+	for _, nvmePath := range s.Volumes.NvmePaths {
+		if !strings.HasPrefix(nvmePath.Name, prefix) {
+			continue
+		}
+		merged, state := s.mergeNvmePath(nvmePath, result)
+		log.Printf("NvmePath %v state: %q", nvmePath.Name, state)
+		Blobarray = append(Blobarray, merged)
+	}
+	if s.discoveryPathForController(in.Parent) != nil {
+		discovered, err := s.discoveredNvmePaths(ctx, in.Parent)
+		if err != nil {
+			return nil, err
+		}
+		Blobarray = append(Blobarray, discovered...)
+	}
+	sortNvmePaths(Blobarray)
 	token := ""
-	log.Printf("Limiting result len(%d) to [%d:%d]", len(result), offset, size)
-	result, hasMoreElements := utils.LimitPagination(result, offset, size)
+	log.Printf("Limiting result len(%d) to [%d:%d]", len(Blobarray), offset, size)
+	Blobarray, hasMoreElements := utils.LimitPagination(Blobarray, offset, size)
 	if hasMoreElements {
 		token = uuid.New().String()
 		s.Pagination[token] = offset + size
 	}
-	Blobarray := make([]*pb.NvmePath, len(result))
-	for i := range result {
-		r := &result[i]
-		Blobarray[i] = &pb.NvmePath{Name: r.Name /* TODO: fill this */}
-	}
-	sortNvmePaths(Blobarray)
 	return &pb.ListNvmePathsResponse{NvmePaths: Blobarray, NextPageToken: token}, nil
 }
 
@@ -231,6 +300,10 @@ func (s *Server) GetNvmePath(ctx context.Context, in *pb.GetNvmePathRequest) (*p
 		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
 		return nil, err
 	}
+	if isDiscoveryPath(path) {
+		// discovery service is not represented by bdev_nvme controller
+		return utils.ProtoClone(path), nil
+	}
 
 	var result []spdk.BdevNvmeGetControllerResult
 	err := s.rpc.Call(ctx, "bdev_nvme_get_controllers", nil, &result)
@@ -239,14 +312,12 @@ func (s *Server) GetNvmePath(ctx context.Context, in *pb.GetNvmePathRequest) (*p
 	}
 	log.Printf("Received from SPDK: %v", result)
 
-	for i := range result {
-		r := &result[i]
-		if r.Name != "" {
-			return &pb.NvmePath{ /* TODO: fill this */ }, nil
-		}
+	merged, state := s.mergeNvmePath(path, result)
+	if state == "" {
+		msg := fmt.Sprintf("Could not find Nvme Path in SPDK: %s", in.Name)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
 	}
-	msg := fmt.Sprintf("Could not find NQN: %s", path.Fabrics.Subnqn)
-	return nil, status.Errorf(codes.InvalidArgument, msg)
+	return merged, nil
 }
 
 // StatsNvmePath gets Nvme path stats
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implements the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/opiproject/gospdk/spdk"
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TODO: NvmePath in opi-api has no status field, so connection state is
+// exposed by GetNvmePathStatus extension call until it is added.
+
+// NvmePathStatus represents live state of a NvmePath reported by SPDK
+type NvmePathStatus struct {
+	// State is SPDK controller state e.g. enabled, resetting, failed, deleting
+	// or empty when SPDK has no controller for the path
+	State string `json:"state"`
+	// AnaState is ANA state of the path namespaces e.g. optimized,
+	// non_optimized, inaccessible or empty when ANA is not reported
+	AnaState string `json:"anaState"`
+}
+
+type bdevNvmeGetBdevsResult struct {
+	Name           string `json:"name"`
+	DriverSpecific struct {
+		Nvme []struct {
+			Trid   bdevNvmeTrid `json:"trid"`
+			NsData struct {
+				AnaState string `json:"ana_state"`
+			} `json:"ns_data"`
+		} `json:"nvme"`
+	} `json:"driver_specific"`
+}
+
+func (s *Server) nvmePathMatchesTrid(nvmePath *pb.NvmePath, trtype, traddr, trsvcid, subnqn string) bool {
+	if !strings.EqualFold(trtype, s.opiTransportToSpdk(nvmePath.GetTrtype())) ||
+		traddr != nvmePath.GetTraddr() {
+		return false
+	}
+	if nvmePath.GetFabrics() == nil {
+		return true
+	}
+	return trsvcid == fmt.Sprint(nvmePath.GetFabrics().GetTrsvcid()) &&
+		subnqn == nvmePath.GetFabrics().GetSubnqn()
+}
+
+// isControllerBdev checks that bdev is a namespace of SPDK Nvme controller
+// with the name, which SPDK names as <controller>n<nsid>
+func isControllerBdev(bdev string, controllerName string) bool {
+	prefix := controllerName + "n"
+	if !strings.HasPrefix(bdev, prefix) {
+		return false
+	}
+	_, err := strconv.ParseUint(strings.TrimPrefix(bdev, prefix), 10, 32)
+	return err == nil
+}
+
+// mergeNvmePath fills stored path spec with live data of matching SPDK
+// controller. Returned state is empty if there is no such controller.
+func (s *Server) mergeNvmePath(nvmePath *pb.NvmePath, controllers []spdk.BdevNvmeGetControllerResult) (*pb.NvmePath, string) {
+	merged := utils.ProtoClone(nvmePath)
+	controllerID := utils.GetRemoteControllerIDFromNvmeRemoteName(nvmePath.Name)
+	for i := range controllers {
+		if controllers[i].Name != controllerID {
+			continue
+		}
+		for _, ctrlr := range controllers[i].Ctrlrs {
+			if !s.nvmePathMatchesTrid(nvmePath, ctrlr.Trid.Trtype, ctrlr.Trid.Traddr, ctrlr.Trid.Trsvcid, ctrlr.Trid.Subnqn) {
+				continue
+			}
+			if merged.Fabrics != nil {
+				if ctrlr.Trid.Adrfam != "" {
+					merged.Fabrics.Adrfam = pb.NvmeAddressFamily(
+						pb.NvmeAddressFamily_value["NVME_ADDRESS_FAMILY_"+strings.ToUpper(ctrlr.Trid.Adrfam)],
+					)
+				}
+				if ctrlr.Host.Nqn != "" {
+					merged.Fabrics.Hostnqn = ctrlr.Host.Nqn
+				}
+				merged.Fabrics.SourceTraddr = ctrlr.Host.Addr
+				if svcid, err := strconv.ParseInt(ctrlr.Host.Svcid, 10, 64); err == nil {
+					merged.Fabrics.SourceTrsvcid = svcid
+				}
+			}
+			return merged, ctrlr.State
+		}
+	}
+	return merged, ""
+}
+
+// GetNvmePathStatus gets connection state of Nvme path
+func (s *Server) GetNvmePathStatus(ctx context.Context, in *pb.GetNvmePathRequest) (*NvmePathStatus, error) {
+	// check input correctness
+	if err := s.validateGetNvmePathRequest(in); err != nil {
+		return nil, err
+	}
+	// fetch object from the database
+	nvmePath, ok := s.Volumes.NvmePaths[in.Name]
+	if !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	if isDiscoveryPath(nvmePath) {
+		err := status.Errorf(codes.FailedPrecondition, "no connection state for discovery path %s", in.Name)
+		return nil, err
+	}
+
+	var controllers []spdk.BdevNvmeGetControllerResult
+	err := s.rpc.Call(ctx, "bdev_nvme_get_controllers", nil, &controllers)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", controllers)
+	_, state := s.mergeNvmePath(nvmePath, controllers)
+	if state == "" {
+		return &NvmePathStatus{}, nil
+	}
+
+	var bdevs []bdevNvmeGetBdevsResult
+	err = s.rpc.Call(ctx, "bdev_get_bdevs", nil, &bdevs)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", bdevs)
+	// mergeNvmePath matched SPDK controller named exactly as the path one
+	controllerName := utils.GetRemoteControllerIDFromNvmeRemoteName(nvmePath.Name)
+	anaState := ""
+	for i := range bdevs {
+		if !isControllerBdev(bdevs[i].Name, controllerName) {
+			continue
+		}
+		for _, ns := range bdevs[i].DriverSpecific.Nvme {
+			if s.nvmePathMatchesTrid(nvmePath, ns.Trid.Trtype, ns.Trid.Traddr, ns.Trid.Trsvcid, ns.Trid.Subnqn) &&
+				ns.NsData.AnaState != "" {
+				anaState = ns.NsData.AnaState
+			}
+		}
+	}
+	return &NvmePathStatus{State: state, AnaState: anaState}, nil
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implememnts the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+func TestBackEnd_GetNvmePathStatus(t *testing.T) {
+	spdkControllers := `{"id":%d,"error":{"code":0,"message":""},"result":[` +
+		`{"name":"opi-nvme8","ctrlrs":[{"state":"resetting","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"cntlid":1,"host":{"nqn":"","addr":"","svcid":""}}]}]}`
+	tests := map[string]struct {
+		in      string
+		out     *NvmePathStatus
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"controller error from SPDK": {
+			in:      testNvmePathName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":1,"message":"myopierr"}}`},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_nvme_get_controllers: %v", "json response error: myopierr"),
+		},
+		"path not attached": {
+			in:      testNvmePathName,
+			out:     &NvmePathStatus{},
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"bdev error from SPDK": {
+			in:      testNvmePathName,
+			out:     nil,
+			spdk:    []string{spdkControllers, `{"id":%d,"error":{"code":1,"message":"myopierr"}}`},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_get_bdevs: %v", "json response error: myopierr"),
+		},
+		"state and ana state": {
+			in:  testNvmePathName,
+			out: &NvmePathStatus{State: "resetting", AnaState: "inaccessible"},
+			spdk: []string{spdkControllers, `{"id":%d,"error":{"code":0,"message":""},"result":[` +
+				`{"name":"Malloc0","driver_specific":{}},` +
+				`{"name":"opi-nvme8nn1","driver_specific":{"nvme":[` +
+				`{"trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"ns_data":{"id":1,"ana_state":"change"}}]}},` +
+				`{"name":"opi-nvme8n1","driver_specific":{"nvme":[` +
+				`{"trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.2","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"ns_data":{"id":1,"ana_state":"optimized"}},` +
+				`{"trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"ns_data":{"id":1,"ana_state":"inaccessible"}}]}}]}`},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"discovery path": {
+			in:      testDiscoveryPathName,
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.FailedPrecondition,
+			errMsg:  fmt.Sprintf("no connection state for discovery path %v", testDiscoveryPathName),
+		},
+		"valid request with unknown key": {
+			in:      "unknown-id",
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", "unknown-id"),
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Volumes.NvmePaths[testNvmePathName] = utils.ProtoClone(&testNvmePathWithName)
+			testEnv.opiSpdkServer.Volumes.NvmePaths[testDiscoveryPathName] = utils.ProtoClone(&testDiscoveryPathWithName)
+
+			request := &pb.GetNvmePathRequest{Name: tt.in}
+			response, err := testEnv.opiSpdkServer.GetNvmePathStatus(testEnv.ctx, request)
+
+			if !reflect.DeepEqual(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkGrpcError(t, err, tt.errCode, tt.errMsg)
+		})
+	}
+}
+
+func TestBackEnd_isControllerBdev(t *testing.T) {
+	tests := map[string]struct {
+		bdev string
+		want bool
+	}{
+		"controller namespace":      {bdev: "an1", want: true},
+		"other controller":          {bdev: "ann1", want: false},
+		"controller with same base": {bdev: "a1", want: false},
+		"no namespace id":           {bdev: "an", want: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := isControllerBdev(tt.bdev, "a"); got != tt.want {
+				t.Error("expected", tt.want, "received", got)
+			}
+		})
+	}
+}
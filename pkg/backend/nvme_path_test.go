@@ -614,6 +614,33 @@ func TestBackEnd_UpdateNvmePath(t *testing.T) {
 
 func TestBackEnd_ListNvmePaths(t *testing.T) {
 	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	testNvmePath2 := &pb.NvmePath{
+		Name:   utils.ResourceIDToNvmePathName(testNvmeCtrlID, "mytest2"),
+		Trtype: pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+		Traddr: "127.0.0.2",
+		Fabrics: &pb.FabricsPath{
+			Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
+			Subnqn:  testNvmePath.Fabrics.Subnqn,
+			Trsvcid: 4444,
+		},
+	}
+	testConnectedNvmePath := &pb.NvmePath{
+		Name:   testNvmePathName,
+		Trtype: testNvmePath.Trtype,
+		Traddr: testNvmePath.Traddr,
+		Fabrics: &pb.FabricsPath{
+			Adrfam:        testNvmePath.Fabrics.Adrfam,
+			Subnqn:        testNvmePath.Fabrics.Subnqn,
+			Hostnqn:       testNvmePath.Fabrics.Hostnqn,
+			Trsvcid:       testNvmePath.Fabrics.Trsvcid,
+			SourceTraddr:  "127.0.0.10",
+			SourceTrsvcid: 34000,
+		},
+	}
+	spdkControllers := `{"id":%d,"error":{"code":0,"message":""},"result":[` +
+		`{"name":"opi-nvme8","ctrlrs":[{"state":"enabled","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"cntlid":1,"host":{"nqn":"nqn.2014-08.org.nvmexpress:uuid:feb98abe-d51f-40c8-b348-2753f3571d3c","addr":"127.0.0.10","svcid":"34000"}}]},` +
+		`{"name":"other","ctrlrs":[{"state":"enabled","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.2","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"cntlid":2,"host":{"nqn":"nqn.2014-08.org.nvmexpress:uuid:other","addr":"127.0.0.11","svcid":"34001"}}]}` +
+		`]}`
 	tests := map[string]struct {
 		in      string
 		out     []*pb.NvmePath
@@ -623,154 +650,96 @@ func TestBackEnd_ListNvmePaths(t *testing.T) {
 		size    int32
 		token   string
 	}{
-		// "valid request with invalid SPDK response": {
-		// 	in: testNvmePathID,
-		// 	out: nil,
-		// 	spdk: []string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`},
-		// 	errCode: codes.InvalidArgument,
-		// 	errMsg: fmt.Sprintf("Could not find any namespaces for NQN: %v", "nqn.2022-09.io.spdk:opi3"),
-		// 	size: 0,
-		// 	token: "",
-		// },
-		// "valid request with invalid marshal SPDK response": {
-		// 	in: testNvmePathID,
-		// 	out: nil,
-		// 	spdk: []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
-		// 	errCode: codes.Unknown,
-		// 	errMsg: fmt.Sprintf("bdev_nvme_get_controllers: %v", "json: cannot unmarshal bool into Go value of type []spdk.BdevGetBdevsResult"),
-		// 	size: 0,
-		// 	token: "",
-		// },
-		// "valid request with empty SPDK response": {
-		// 	in: testNvmePathID,
-		// 	out: nil,
-		// 	spdk: []string{""},
-		// 	errCode: codes.Unknown,
-		// 	errMsg: fmt.Sprintf("bdev_nvme_get_controllers: %v", "EOF"),
-		// 	size: 0,
-		// 	token: "",
-		// },
-		// "valid request with ID mismatch SPDK response": {
-		// 	in: testNvmePathID,
-		// 	out: nil,
-		// 	spdk: []string{`{"id":0,"error":{"code":0,"message":""},"result":[]}`},
-		// 	errCode: codes.Unknown,
-		// 	errMsg: fmt.Sprintf("bdev_nvme_get_controllers: %v", "json response ID mismatch"),
-		// 	size: 0,
-		// 	token: "",
-		// },
-		// "valid request with error code from SPDK response": {
-		// 	in: testNvmePathID,
-		// 	out: nil,
-		// 	spdk: []string{`{"id":%d,"error":{"code":1,"message":"myopierr"}}`},
-		// 	errCode: codes.Unknown,
-		// 	errMsg: fmt.Sprintf("bdev_nvme_get_controllers: %v", "json response error: myopierr"),
-		// 	size: 0,
-		// 	token: "",
-		// },
-		// "valid request with valid SPDK response": {
-		// 	in: testNvmePathID,
-		// 	out: []*pb.NvmePath{
-		// 		{
-		// 			Name:    "Malloc0",
-		// 			Trtype:  pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
-		// 			Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
-		// 			Traddr:  "127.0.0.1",
-		// 			Trsvcid: 4444,
-		// 		},
-		// 		{
-		// 			Name:    "Malloc1",
-		// 			Trtype:  pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
-		// 			Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
-		// 			Traddr:  "127.0.0.1",
-		// 			Trsvcid: 4444,
-		// 		},
-		// 	},
-		// 	spdk: []string{`{"jsonrpc":"2.0","id":%d,"result":[` +
-		// 		`{"name":"Malloc1","aliases":["88112c76-8c49-4395-955a-0d695b1d2099"],"product_name":"Malloc disk","block_size":512,"num_blocks":131072,"uuid":"88112c76-8c49-4395-955a-0d695b1d2099","assigned_rate_limits":{"rw_ios_per_sec":0,"rw_mbytes_per_sec":0,"r_mbytes_per_sec":0,"w_mbytes_per_sec":0},"claimed":false,"zoned":false,"supported_io_types":{"read":true,"write":true,"unmap":true,"write_zeroes":true,"flush":true,"reset":true,"compare":false,"compare_and_write":false,"abort":true,"nvme_admin":false,"nvme_io":false},"driver_specific":{}},` +
-		// 		`{"name":"Malloc0","aliases":["11d3902e-d9bb-49a7-bb27-cd7261ef3217"],"product_name":"Malloc disk","block_size":512,"num_blocks":131072,"uuid":"11d3902e-d9bb-49a7-bb27-cd7261ef3217","assigned_rate_limits":{"rw_ios_per_sec":0,"rw_mbytes_per_sec":0,"r_mbytes_per_sec":0,"w_mbytes_per_sec":0},"claimed":false,"zoned":false,"supported_io_types":{"read":true,"write":true,"unmap":true,"write_zeroes":true,"flush":true,"reset":true,"compare":false,"compare_and_write":false,"abort":true,"nvme_admin":false,"nvme_io":false},"driver_specific":{}}` +
-		// 		`]}`},
-		// 	errCode: codes.OK,
-		// 	errMsg: "",
-		// 	size: 0,
-		// 	token: "",
-		// },
-		// "pagination overflow": {
-		// 	in: testNvmePathID,
-		// 	out: []*pb.NvmePath{
-		// 		{
-		// 			Name:    "Malloc0",
-		// 			Trtype:  pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
-		// 			Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
-		// 			Traddr:  "127.0.0.1",
-		// 			Trsvcid: 4444,
-		// 		},
-		// 		{
-		// 			Name:    "Malloc1",
-		// 			Trtype:  pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
-		// 			Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
-		// 			Traddr:  "127.0.0.1",
-		// 			Trsvcid: 4444,
-		// 		},
-		// 	},
-		// 	spdk: []string{`{"jsonrpc":"2.0","id":%d,"result":[{"name":"Malloc0","aliases":["11d3902e-d9bb-49a7-bb27-cd7261ef3217"],"product_name":"Malloc disk","block_size":512,"num_blocks":131072,"uuid":"11d3902e-d9bb-49a7-bb27-cd7261ef3217","assigned_rate_limits":{"rw_ios_per_sec":0,"rw_mbytes_per_sec":0,"r_mbytes_per_sec":0,"w_mbytes_per_sec":0},"claimed":false,"zoned":false,"supported_io_types":{"read":true,"write":true,"unmap":true,"write_zeroes":true,"flush":true,"reset":true,"compare":false,"compare_and_write":false,"abort":true,"nvme_admin":false,"nvme_io":false},"driver_specific":{}},{"name":"Malloc1","aliases":["88112c76-8c49-4395-955a-0d695b1d2099"],"product_name":"Malloc disk","block_size":512,"num_blocks":131072,"uuid":"88112c76-8c49-4395-955a-0d695b1d2099","assigned_rate_limits":{"rw_ios_per_sec":0,"rw_mbytes_per_sec":0,"r_mbytes_per_sec":0,"w_mbytes_per_sec":0},"claimed":false,"zoned":false,"supported_io_types":{"read":true,"write":true,"unmap":true,"write_zeroes":true,"flush":true,"reset":true,"compare":false,"compare_and_write":false,"abort":true,"nvme_admin":false,"nvme_io":false},"driver_specific":{}}]}`},
-		// 	errCode: codes.OK,
-		// 	errMsg: "",
-		// 	size: 1000,
-		// 	token: "",
-		// },
-		// "pagination negative": {
-		// 	in: testNvmePathID,
-		// 	out: nil,
-		// 	spdk: []string{},
-		// 	errCode: codes.InvalidArgument,
-		// 	errMsg: "negative PageSize is not allowed",
-		// 	size: -10,
-		// 	token: "",
-		// },
-		// "pagination error": {
-		// 	in: testNvmePathID,
-		// 	out: nil,
-		// 	spdk: []string{},
-		// 	errCode: codes.NotFound,
-		// 	errMsg: fmt.Sprintf("unable to find pagination token %s", "unknown-pagination-token"),
-		// 	size: 0,
-		// 	token: "unknown-pagination-token",
-		// },
-		// "pagination": {
-		// 	in: testNvmePathID,
-		// 	out: []*pb.NvmePath{
-		// 		{
-		// 			Name:    "Malloc0",
-		// 			Trtype:  pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
-		// 			Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
-		// 			Traddr:  "127.0.0.1",
-		// 			Trsvcid: 4444,
-		// 		},
-		// 	},
-		// 	spdk: []string{`{"jsonrpc":"2.0","id":%d,"result":[{"name":"Malloc0","aliases":["11d3902e-d9bb-49a7-bb27-cd7261ef3217"],"product_name":"Malloc disk","block_size":512,"num_blocks":131072,"uuid":"11d3902e-d9bb-49a7-bb27-cd7261ef3217","assigned_rate_limits":{"rw_ios_per_sec":0,"rw_mbytes_per_sec":0,"r_mbytes_per_sec":0,"w_mbytes_per_sec":0},"claimed":false,"zoned":false,"supported_io_types":{"read":true,"write":true,"unmap":true,"write_zeroes":true,"flush":true,"reset":true,"compare":false,"compare_and_write":false,"abort":true,"nvme_admin":false,"nvme_io":false},"driver_specific":{}},{"name":"Malloc1","aliases":["88112c76-8c49-4395-955a-0d695b1d2099"],"product_name":"Malloc disk","block_size":512,"num_blocks":131072,"uuid":"88112c76-8c49-4395-955a-0d695b1d2099","assigned_rate_limits":{"rw_ios_per_sec":0,"rw_mbytes_per_sec":0,"r_mbytes_per_sec":0,"w_mbytes_per_sec":0},"claimed":false,"zoned":false,"supported_io_types":{"read":true,"write":true,"unmap":true,"write_zeroes":true,"flush":true,"reset":true,"compare":false,"compare_and_write":false,"abort":true,"nvme_admin":false,"nvme_io":false},"driver_specific":{}}]}`},
-		// 	errCode: codes.OK,
-		// 	errMsg: "",
-		// 	size: 1,
-		// 	token: "",
-		// },
-		// "pagination offset": {
-		// 	in: testNvmePathID,
-		// 	out: []*pb.NvmePath{
-		// 		{
-		// 			Name:    "Malloc1",
-		// 			Trtype:  pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
-		// 			Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
-		// 			Traddr:  "127.0.0.1",
-		// 			Trsvcid: 4444,
-		// 		},
-		// 	},
-		// 	spdk: []string{`{"jsonrpc":"2.0","id":%d,"result":[{"name":"Malloc0","aliases":["11d3902e-d9bb-49a7-bb27-cd7261ef3217"],"product_name":"Malloc disk","block_size":512,"num_blocks":131072,"uuid":"11d3902e-d9bb-49a7-bb27-cd7261ef3217","assigned_rate_limits":{"rw_ios_per_sec":0,"rw_mbytes_per_sec":0,"r_mbytes_per_sec":0,"w_mbytes_per_sec":0},"claimed":false,"zoned":false,"supported_io_types":{"read":true,"write":true,"unmap":true,"write_zeroes":true,"flush":true,"reset":true,"compare":false,"compare_and_write":false,"abort":true,"nvme_admin":false,"nvme_io":false},"driver_specific":{}},{"name":"Malloc1","aliases":["88112c76-8c49-4395-955a-0d695b1d2099"],"product_name":"Malloc disk","block_size":512,"num_blocks":131072,"uuid":"88112c76-8c49-4395-955a-0d695b1d2099","assigned_rate_limits":{"rw_ios_per_sec":0,"rw_mbytes_per_sec":0,"r_mbytes_per_sec":0,"w_mbytes_per_sec":0},"claimed":false,"zoned":false,"supported_io_types":{"read":true,"write":true,"unmap":true,"write_zeroes":true,"flush":true,"reset":true,"compare":false,"compare_and_write":false,"abort":true,"nvme_admin":false,"nvme_io":false},"driver_specific":{}}]}`},
-		// 	errCode: codes.OK,
-		// 	errMsg: "",
-		// 	size: 1,
-		// 	token: "existing-pagination-token",
-		// },
+		"valid request with invalid marshal SPDK response": {
+			in:      testNvmeCtrlName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_nvme_get_controllers: %v", "json: cannot unmarshal bool into Go value of type []spdk.BdevNvmeGetControllerResult"),
+			size:    0,
+			token:   "",
+		},
+		"valid request with empty SPDK response": {
+			in:      testNvmeCtrlName,
+			out:     nil,
+			spdk:    []string{""},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_nvme_get_controllers: %v", "EOF"),
+			size:    0,
+			token:   "",
+		},
+		"valid request with error code from SPDK response": {
+			in:      testNvmeCtrlName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":1,"message":"myopierr"}}`},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_nvme_get_controllers: %v", "json response error: myopierr"),
+			size:    0,
+			token:   "",
+		},
+		"valid request with valid SPDK response": {
+			in:      testNvmeCtrlName,
+			out:     []*pb.NvmePath{testConnectedNvmePath, testNvmePath2},
+			spdk:    []string{spdkControllers},
+			errCode: codes.OK,
+			errMsg:  "",
+			size:    0,
+			token:   "",
+		},
+		"other controller paths are not listed": {
+			in:      utils.ResourceIDToRemoteControllerName("unknown-id"),
+			out:     []*pb.NvmePath{},
+			spdk:    []string{spdkControllers},
+			errCode: codes.OK,
+			errMsg:  "",
+			size:    0,
+			token:   "",
+		},
+		"pagination overflow": {
+			in:      testNvmeCtrlName,
+			out:     []*pb.NvmePath{testConnectedNvmePath, testNvmePath2},
+			spdk:    []string{spdkControllers},
+			errCode: codes.OK,
+			errMsg:  "",
+			size:    1000,
+			token:   "",
+		},
+		"pagination negative": {
+			in:      testNvmeCtrlName,
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.InvalidArgument,
+			errMsg:  "negative PageSize is not allowed",
+			size:    -10,
+			token:   "",
+		},
+		"pagination error": {
+			in:      testNvmeCtrlName,
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find pagination token %s", "unknown-pagination-token"),
+			size:    0,
+			token:   "unknown-pagination-token",
+		},
+		"pagination": {
+			in:      testNvmeCtrlName,
+			out:     []*pb.NvmePath{testConnectedNvmePath},
+			spdk:    []string{spdkControllers},
+			errCode: codes.OK,
+			errMsg:  "",
+			size:    1,
+			token:   "",
+		},
+		"pagination offset": {
+			in:      testNvmeCtrlName,
+			out:     []*pb.NvmePath{testNvmePath2},
+			spdk:    []string{spdkControllers},
+			errCode: codes.OK,
+			errMsg:  "",
+			size:    1,
+			token:   "existing-pagination-token",
+		},
 		"no required field": {
 			in:      "",
 			out:     []*pb.NvmePath{},
@@ -789,6 +758,8 @@ func TestBackEnd_ListNvmePaths(t *testing.T) {
 			defer testEnv.Close()
 
 			testEnv.opiSpdkServer.Pagination["existing-pagination-token"] = 1
+			testEnv.opiSpdkServer.Volumes.NvmePaths[testNvmePathName] = utils.ProtoClone(&testNvmePathWithName)
+			testEnv.opiSpdkServer.Volumes.NvmePaths[testNvmePath2.Name] = utils.ProtoClone(testNvmePath2)
 
 			request := &pb.ListNvmePathsRequest{Parent: tt.in, PageSize: tt.size, PageToken: tt.token}
 			response, err := testEnv.client.ListNvmePaths(testEnv.ctx, request)
@@ -825,13 +796,13 @@ func TestBackEnd_GetNvmePath(t *testing.T) {
 		errCode codes.Code
 		errMsg  string
 	}{
-		// "valid request with invalid SPDK response": {
-		// 	in: testNvmePathName,
-		// 	out: nil,
-		// 	spdk: []string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`},
-		// 	errCode: codes.InvalidArgument,
-		// 	errMsg: fmt.Sprintf("expecting exactly 1 result, got %v", "0"),
-		// },
+		"valid request with invalid SPDK response": {
+			in:      testNvmePathName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not find Nvme Path in SPDK: %v", testNvmePathName),
+		},
 		"valid request with invalid marshal SPDK response": {
 			in:      testNvmePathName,
 			out:     nil,
@@ -860,19 +831,28 @@ func TestBackEnd_GetNvmePath(t *testing.T) {
 			errCode: codes.Unknown,
 			errMsg:  fmt.Sprintf("bdev_nvme_get_controllers: %v", "json response error: myopierr"),
 		},
-		// "valid request with valid SPDK response": {
-		// 	in: testNvmePathName,
-		// 	out: &pb.NvmePath{
-		// 		Name:    "Malloc1",
-		// 		Trtype:  pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
-		// 		Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
-		// 		Traddr:  "127.0.0.1",
-		// 		Trsvcid: 4444,
-		// 	},
-		// 	spdk: []string{`{"jsonrpc":"2.0","id":%d,"result":[{"name":"Malloc1","aliases":["88112c76-8c49-4395-955a-0d695b1d2099"],"product_name":"Malloc disk","block_size":512,"num_blocks":131072,"uuid":"88112c76-8c49-4395-955a-0d695b1d2099","assigned_rate_limits":{"rw_ios_per_sec":0,"rw_mbytes_per_sec":0,"r_mbytes_per_sec":0,"w_mbytes_per_sec":0},"claimed":false,"zoned":false,"supported_io_types":{"read":true,"write":true,"unmap":true,"write_zeroes":true,"flush":true,"reset":true,"compare":false,"compare_and_write":false,"abort":true,"nvme_admin":false,"nvme_io":false},"driver_specific":{}}]}`},
-		// 	errCode: codes.OK,
-		// 	errMsg: "",
-		// },
+		"valid request with valid SPDK response": {
+			in: testNvmePathName,
+			out: &pb.NvmePath{
+				Name:   testNvmePathName,
+				Trtype: testNvmePath.Trtype,
+				Traddr: testNvmePath.Traddr,
+				Fabrics: &pb.FabricsPath{
+					Adrfam:        testNvmePath.Fabrics.Adrfam,
+					Subnqn:        testNvmePath.Fabrics.Subnqn,
+					Hostnqn:       "nqn.2014-08.org.nvmexpress:uuid:live",
+					Trsvcid:       testNvmePath.Fabrics.Trsvcid,
+					SourceTraddr:  "127.0.0.10",
+					SourceTrsvcid: 34000,
+				},
+			},
+			spdk: []string{`{"id":%d,"error":{"code":0,"message":""},"result":[` +
+				`{"name":"opi-nvme8","ctrlrs":[` +
+				`{"state":"failed","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.2","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"cntlid":2,"host":{"nqn":"nqn.2014-08.org.nvmexpress:uuid:other","addr":"127.0.0.11","svcid":"34001"}},` +
+				`{"state":"enabled","trid":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4444","subnqn":"nqn.2016-06.io.spdk:cnode1"},"cntlid":1,"host":{"nqn":"nqn.2014-08.org.nvmexpress:uuid:live","addr":"127.0.0.10","svcid":"34000"}}]}]}`},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
 		"valid request with unknown key": {
 			in:      "unknown-id",
 			out:     nil,
@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implements the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/opiproject/gospdk/spdk"
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type bdevNvmeAttachControllerParams struct {
+	spdk.BdevNvmeAttachControllerParams
+	CtrlrLossTimeoutSec  int32  `json:"ctrlr_loss_timeout_sec,omitempty"`
+	ReconnectDelaySec    int32  `json:"reconnect_delay_sec,omitempty"`
+	FastIoFailTimeoutSec int32  `json:"fast_io_fail_timeout_sec,omitempty"`
+	DhchapKey            string `json:"dhchap_key,omitempty"`
+	DhchapCtrlrKey       string `json:"dhchap_ctrlr_key,omitempty"`
+}
+
+type bdevNvmeSetOptionsParams struct {
+	KeepAliveTimeoutMs int32    `json:"keep_alive_timeout_ms,omitempty"`
+	DhchapDigests      []string `json:"dhchap_digests,omitempty"`
+	DhchapDhgroups     []string `json:"dhchap_dhgroups,omitempty"`
+}
+
+type bdevNvmeSetOptionsResult bool
+
+type bdevNvmeSetMultipathPolicyParams struct {
+	Name     string `json:"name"`
+	Policy   string `json:"policy"`
+	Selector string `json:"selector,omitempty"`
+}
+
+type bdevNvmeSetMultipathPolicyResult bool
+
+// SetNvmeRemoteControllerPolicyRequest represents a request to set reconnect
+// policy of a remote controller
+type SetNvmeRemoteControllerPolicyRequest struct {
+	Name   string              `json:"name"`
+	Policy NvmeReconnectPolicy `json:"policy"`
+}
+
+// GetNvmeRemoteControllerPolicyRequest represents a request to get reconnect
+// policy of a remote controller
+type GetNvmeRemoteControllerPolicyRequest struct {
+	Name string `json:"name"`
+}
+
+func (p NvmeReconnectPolicy) validate() error {
+	switch p.MultipathSelector {
+	case "", "round_robin", "queue_depth":
+	default:
+		return fmt.Errorf("not supported multipath selector: %v", p.MultipathSelector)
+	}
+	if err := utils.ValidateDhchapDigests(p.DhchapDigests); err != nil {
+		return err
+	}
+	if err := utils.ValidateDhchapDhGroups(p.DhchapDhGroups); err != nil {
+		return err
+	}
+	if p.CtrlrLossTimeoutSec < -1 || p.ReconnectDelaySec < 0 ||
+		p.FastIoFailTimeoutSec < 0 || p.KeepAliveTimeoutMs < 0 {
+		return errors.New("negative timeouts are not allowed")
+	}
+	if p.CtrlrLossTimeoutSec == 0 {
+		if p.ReconnectDelaySec != 0 || p.FastIoFailTimeoutSec != 0 {
+			return errors.New("reconnect_delay_sec and fast_io_fail_timeout_sec require ctrlr_loss_timeout_sec")
+		}
+		return nil
+	}
+	if p.ReconnectDelaySec == 0 {
+		return errors.New("ctrlr_loss_timeout_sec requires reconnect_delay_sec")
+	}
+	if p.CtrlrLossTimeoutSec != -1 {
+		if p.ReconnectDelaySec > p.CtrlrLossTimeoutSec {
+			return errors.New("reconnect_delay_sec cannot exceed ctrlr_loss_timeout_sec")
+		}
+		if p.FastIoFailTimeoutSec > p.CtrlrLossTimeoutSec {
+			return errors.New("fast_io_fail_timeout_sec cannot exceed ctrlr_loss_timeout_sec")
+		}
+	}
+	return nil
+}
+
+// ApplyNvmeOptions sets global bdev_nvme options of the server reconnect
+// policy. It is called on startup before any controller is attached. If it
+// fails, e.g. SPDK is not up yet, the options are applied before the next
+// attach.
+func (s *Server) ApplyNvmeOptions(ctx context.Context) error {
+	return s.applyNvmeOptions(ctx)
+}
+
+// applyNvmeOptions sets global bdev_nvme options. SPDK rejects them once a
+// controller exists, e.g. attached before a bridge restart or outside of the
+// bridge, so the options are skipped with a log in that case instead of
+// failing every attach.
+func (s *Server) applyNvmeOptions(ctx context.Context) error {
+	if s.nvmeOptionsApplied {
+		return nil
+	}
+	if s.reconnectPolicy.KeepAliveTimeoutMs == 0 &&
+		len(s.reconnectPolicy.DhchapDigests) == 0 &&
+		len(s.reconnectPolicy.DhchapDhGroups) == 0 {
+		return nil
+	}
+	var controllers []spdk.BdevNvmeGetControllerResult
+	err := s.rpc.Call(ctx, "bdev_nvme_get_controllers", nil, &controllers)
+	if err != nil {
+		return err
+	}
+	if len(controllers) != 0 {
+		log.Printf("bdev_nvme options are not set, SPDK already has %d controllers attached", len(controllers))
+		s.nvmeOptionsApplied = true
+		return nil
+	}
+	params := bdevNvmeSetOptionsParams{
+		KeepAliveTimeoutMs: s.reconnectPolicy.KeepAliveTimeoutMs,
+		DhchapDigests:      s.reconnectPolicy.DhchapDigests,
+		DhchapDhgroups:     s.reconnectPolicy.DhchapDhGroups,
+	}
+	var result bdevNvmeSetOptionsResult
+	err = s.rpc.Call(ctx, "bdev_nvme_set_options", &params, &result)
+	if err != nil {
+		return err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		return status.Errorf(codes.InvalidArgument, "Could not set bdev_nvme options")
+	}
+	s.nvmeOptionsApplied = true
+	return nil
+}
+
+// controllerPolicy returns reconnect policy of a remote controller, which is
+// either set by SetNvmeRemoteControllerPolicy or the server one
+func (s *Server) controllerPolicy(name string) NvmeReconnectPolicy {
+	if policy, ok := s.Volumes.reconnectPolicies[name]; ok {
+		return policy
+	}
+	return s.reconnectPolicy
+}
+
+// SetNvmeRemoteControllerPolicy sets reconnect and multipath policy of a
+// remote controller instead of the server one. Keep alive timeout and
+// DH-HMAC-CHAP digests and DH groups are global bdev_nvme options and cannot
+// be set per controller. The policy is applied on path attach, so it can be
+// set only while the controller has no paths.
+// TODO: move into NvmeRemoteController once opi-api has the fields
+func (s *Server) SetNvmeRemoteControllerPolicy(_ context.Context, in *SetNvmeRemoteControllerPolicyRequest) (*NvmeReconnectPolicy, error) {
+	// check input correctness
+	if err := s.validateSetNvmeRemoteControllerPolicyRequest(in); err != nil {
+		return nil, err
+	}
+	controller, ok := s.Volumes.NvmeControllers[in.Name]
+	if !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	if s.numberOfPathsForController(controller.Name) > 0 {
+		return nil, status.Error(codes.FailedPrecondition, "NvmePaths exist for controller")
+	}
+	policy := in.Policy
+	policy.KeepAliveTimeoutMs = s.reconnectPolicy.KeepAliveTimeoutMs
+	policy.DhchapDigests = s.reconnectPolicy.DhchapDigests
+	policy.DhchapDhGroups = s.reconnectPolicy.DhchapDhGroups
+	s.Volumes.reconnectPolicies[controller.Name] = policy
+	return &policy, nil
+}
+
+// GetNvmeRemoteControllerPolicy gets reconnect and multipath policy applied
+// to paths of a remote controller
+func (s *Server) GetNvmeRemoteControllerPolicy(_ context.Context, in *GetNvmeRemoteControllerPolicyRequest) (*NvmeReconnectPolicy, error) {
+	// check input correctness
+	if err := s.validateGetNvmeRemoteControllerPolicyRequest(in); err != nil {
+		return nil, err
+	}
+	if _, ok := s.Volumes.NvmeControllers[in.Name]; !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	policy := s.controllerPolicy(in.Name)
+	return &policy, nil
+}
+
+// setMultipathPolicy selects active/active or active/passive mode for bdevs
+// exposed by a remote controller according to its Multipath field
+func (s *Server) setMultipathPolicy(ctx context.Context, controller *pb.NvmeRemoteController, bdevs []string) error {
+	policy := ""
+	selector := ""
+	switch controller.Multipath {
+	case pb.NvmeMultipath_NVME_MULTIPATH_MULTIPATH:
+		policy = "active_active"
+		selector = s.controllerPolicy(controller.Name).MultipathSelector
+	case pb.NvmeMultipath_NVME_MULTIPATH_FAILOVER:
+		policy = "active_passive"
+	default:
+		return nil
+	}
+	for _, bdev := range bdevs {
+		params := bdevNvmeSetMultipathPolicyParams{
+			Name:     bdev,
+			Policy:   policy,
+			Selector: selector,
+		}
+		var result bdevNvmeSetMultipathPolicyResult
+		err := s.rpc.Call(ctx, "bdev_nvme_set_multipath_policy", &params, &result)
+		if err != nil {
+			return err
+		}
+		log.Printf("Received from SPDK: %v", result)
+		if !result {
+			msg := fmt.Sprintf("Could not set multipath policy for: %s", bdev)
+			return status.Errorf(codes.InvalidArgument, msg)
+		}
+	}
+	return nil
+}
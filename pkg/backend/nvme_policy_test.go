@@ -0,0 +1,426 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implememnts the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+func TestBackEnd_NvmeReconnectPolicyValidate(t *testing.T) {
+	tests := map[string]struct {
+		policy NvmeReconnectPolicy
+		errMsg string
+	}{
+		"empty policy": {
+			policy: NvmeReconnectPolicy{},
+			errMsg: "",
+		},
+		"valid policy": {
+			policy: NvmeReconnectPolicy{
+				CtrlrLossTimeoutSec:  30,
+				ReconnectDelaySec:    5,
+				FastIoFailTimeoutSec: 10,
+				KeepAliveTimeoutMs:   10000,
+				MultipathSelector:    "queue_depth",
+			},
+			errMsg: "",
+		},
+		"infinite ctrlr loss timeout": {
+			policy: NvmeReconnectPolicy{CtrlrLossTimeoutSec: -1, ReconnectDelaySec: 5},
+			errMsg: "",
+		},
+		"unknown selector": {
+			policy: NvmeReconnectPolicy{MultipathSelector: "random"},
+			errMsg: "not supported multipath selector: random",
+		},
+		"dhchap digests and dh groups": {
+			policy: NvmeReconnectPolicy{DhchapDigests: []string{"sha384", "sha512"}, DhchapDhGroups: []string{"null", "ffdhe4096"}},
+			errMsg: "",
+		},
+		"unknown dhchap digest": {
+			policy: NvmeReconnectPolicy{DhchapDigests: []string{"md5"}},
+			errMsg: "not supported DH-HMAC-CHAP digest: md5",
+		},
+		"unknown dhchap dh group": {
+			policy: NvmeReconnectPolicy{DhchapDhGroups: []string{"ffdhe1024"}},
+			errMsg: "not supported DH-HMAC-CHAP DH group: ffdhe1024",
+		},
+		"negative timeout": {
+			policy: NvmeReconnectPolicy{KeepAliveTimeoutMs: -1},
+			errMsg: "negative timeouts are not allowed",
+		},
+		"reconnect delay without ctrlr loss timeout": {
+			policy: NvmeReconnectPolicy{ReconnectDelaySec: 5},
+			errMsg: "reconnect_delay_sec and fast_io_fail_timeout_sec require ctrlr_loss_timeout_sec",
+		},
+		"ctrlr loss timeout without reconnect delay": {
+			policy: NvmeReconnectPolicy{CtrlrLossTimeoutSec: 30},
+			errMsg: "ctrlr_loss_timeout_sec requires reconnect_delay_sec",
+		},
+		"reconnect delay exceeds ctrlr loss timeout": {
+			policy: NvmeReconnectPolicy{CtrlrLossTimeoutSec: 3, ReconnectDelaySec: 5},
+			errMsg: "reconnect_delay_sec cannot exceed ctrlr_loss_timeout_sec",
+		},
+		"fast io fail exceeds ctrlr loss timeout": {
+			policy: NvmeReconnectPolicy{CtrlrLossTimeoutSec: 10, ReconnectDelaySec: 5, FastIoFailTimeoutSec: 20},
+			errMsg: "fast_io_fail_timeout_sec cannot exceed ctrlr_loss_timeout_sec",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tt.policy.validate()
+			errMsg := ""
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tt.errMsg {
+				t.Error("expected", tt.errMsg, "received", errMsg)
+			}
+		})
+	}
+}
+
+func TestBackEnd_CreateNvmePathWithPolicy(t *testing.T) {
+	secondPath := &pb.NvmePath{
+		Name:   utils.ResourceIDToNvmePathName(testNvmeCtrlID, "existing"),
+		Trtype: pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+		Traddr: "127.0.0.2",
+		Fabrics: &pb.FabricsPath{
+			Adrfam:  pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
+			Subnqn:  testNvmePath.Fabrics.Subnqn,
+			Trsvcid: 4444,
+		},
+	}
+	tests := map[string]struct {
+		out        *pb.NvmePath
+		spdk       []string
+		errCode    codes.Code
+		errMsg     string
+		existing   *pb.NvmePath
+		controller *pb.NvmeRemoteController
+		policy     NvmeReconnectPolicy
+
+		optionsApplied bool
+	}{
+		"keep alive applied before first attach": {
+			out: &testNvmePathWithName,
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":["opi-nvme8n1"]}`,
+			},
+			errCode:        codes.OK,
+			errMsg:         "",
+			existing:       nil,
+			controller:     &testNvmeCtrlWithName,
+			policy:         NvmeReconnectPolicy{KeepAliveTimeoutMs: 10000},
+			optionsApplied: true,
+		},
+		"rejected keep alive fails attach": {
+			out: nil,
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":-1,"message":"Operation not permitted"}}`,
+			},
+			errCode:    codes.Unknown,
+			errMsg:     fmt.Sprintf("bdev_nvme_set_options: %v", "json response error: Operation not permitted"),
+			existing:   nil,
+			controller: &testNvmeCtrlWithName,
+			policy:     NvmeReconnectPolicy{KeepAliveTimeoutMs: 10000},
+		},
+		"options are skipped when controllers already exist": {
+			out: &testNvmePathWithName,
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[{"name":"other","ctrlrs":[]}]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":["opi-nvme8n1"]}`,
+			},
+			errCode:        codes.OK,
+			errMsg:         "",
+			existing:       nil,
+			controller:     &testNvmeCtrlWithName,
+			policy:         NvmeReconnectPolicy{KeepAliveTimeoutMs: 10000},
+			optionsApplied: true,
+		},
+		"dhchap options applied before first attach": {
+			out: &testNvmePathWithName,
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":["opi-nvme8n1"]}`,
+			},
+			errCode:        codes.OK,
+			errMsg:         "",
+			existing:       nil,
+			controller:     &testNvmeCtrlWithName,
+			policy:         NvmeReconnectPolicy{DhchapDigests: []string{"sha512"}, DhchapDhGroups: []string{"ffdhe8192"}},
+			optionsApplied: true,
+		},
+		"first path does not set multipath policy": {
+			out: &testNvmePathWithName,
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":["opi-nvme8n1"]}`,
+			},
+			errCode:    codes.OK,
+			errMsg:     "",
+			existing:   nil,
+			controller: &testNvmeCtrlWithName,
+			policy:     NvmeReconnectPolicy{MultipathSelector: "round_robin"},
+		},
+		"active active on second path": {
+			out: &testNvmePathWithName,
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":["opi-nvme8n1"]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+			},
+			errCode:    codes.OK,
+			errMsg:     "",
+			existing:   secondPath,
+			controller: &testNvmeCtrlWithName,
+			policy:     NvmeReconnectPolicy{MultipathSelector: "round_robin"},
+		},
+		"active passive on second path": {
+			out: &testNvmePathWithName,
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":["opi-nvme8n1"]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+			},
+			errCode:  codes.OK,
+			errMsg:   "",
+			existing: secondPath,
+			controller: &pb.NvmeRemoteController{
+				Name:      testNvmeCtrlName,
+				Tcp:       testNvmeCtrl.Tcp,
+				Multipath: pb.NvmeMultipath_NVME_MULTIPATH_FAILOVER,
+			},
+			policy: NvmeReconnectPolicy{},
+		},
+		"multipath policy rejected": {
+			out: nil,
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":["opi-nvme8n1"]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":false}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+			},
+			errCode:    codes.InvalidArgument,
+			errMsg:     fmt.Sprintf("Could not set multipath policy for: %v", "opi-nvme8n1"),
+			existing:   secondPath,
+			controller: &testNvmeCtrlWithName,
+			policy:     NvmeReconnectPolicy{MultipathSelector: "queue_depth"},
+		},
+		"multipath policy error from SPDK": {
+			out: nil,
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":["opi-nvme8n1"]}`,
+				`{"id":%d,"error":{"code":1,"message":"myopierr"}}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":false}`,
+			},
+			errCode:    codes.Unknown,
+			errMsg:     fmt.Sprintf("bdev_nvme_set_multipath_policy: %v", "json response error: myopierr"),
+			existing:   secondPath,
+			controller: &testNvmeCtrlWithName,
+			policy:     NvmeReconnectPolicy{},
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.reconnectPolicy = tt.policy
+			testEnv.opiSpdkServer.Volumes.NvmeControllers[testNvmeCtrlName] = utils.ProtoClone(tt.controller)
+			if tt.existing != nil {
+				testEnv.opiSpdkServer.Volumes.NvmePaths[tt.existing.Name] = utils.ProtoClone(tt.existing)
+			}
+
+			request := &pb.CreateNvmePathRequest{
+				Parent:     testNvmeCtrlName,
+				NvmePath:   utils.ProtoClone(&testNvmePath),
+				NvmePathId: testNvmePathID,
+			}
+			response, err := testEnv.client.CreateNvmePath(testEnv.ctx, request)
+
+			if !proto.Equal(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			if _, ok := testEnv.opiSpdkServer.Volumes.NvmePaths[testNvmePathName]; ok != (tt.out != nil) {
+				t.Error("expected path stored", tt.out != nil, "received", ok)
+			}
+			if testEnv.opiSpdkServer.nvmeOptionsApplied != tt.optionsApplied {
+				t.Error("expected options applied", tt.optionsApplied, "received", testEnv.opiSpdkServer.nvmeOptionsApplied)
+			}
+
+			if er, ok := status.FromError(err); ok {
+				if er.Code() != tt.errCode {
+					t.Error("error code: expected", tt.errCode, "received", er.Code())
+				}
+				if er.Message() != tt.errMsg {
+					t.Error("error message: expected", tt.errMsg, "received", er.Message())
+				}
+			} else {
+				t.Error("expected grpc error status")
+			}
+		})
+	}
+}
+
+func TestBackEnd_ApplyNvmeOptions(t *testing.T) {
+	tests := map[string]struct {
+		spdk    []string
+		policy  NvmeReconnectPolicy
+		errCode codes.Code
+		errMsg  string
+
+		optionsApplied bool
+	}{
+		"no options to apply": {
+			spdk:    []string{},
+			policy:  NvmeReconnectPolicy{CtrlrLossTimeoutSec: 30, ReconnectDelaySec: 5},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"options applied without controllers": {
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+			},
+			policy:         NvmeReconnectPolicy{KeepAliveTimeoutMs: 10000},
+			errCode:        codes.OK,
+			errMsg:         "",
+			optionsApplied: true,
+		},
+		"options skipped with existing controllers": {
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[{"name":"discovered","ctrlrs":[]}]}`,
+			},
+			policy:         NvmeReconnectPolicy{DhchapDigests: []string{"sha512"}},
+			errCode:        codes.OK,
+			errMsg:         "",
+			optionsApplied: true,
+		},
+		"options rejected by SPDK": {
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":false}`,
+			},
+			policy:  NvmeReconnectPolicy{KeepAliveTimeoutMs: 10000},
+			errCode: codes.InvalidArgument,
+			errMsg:  "Could not set bdev_nvme options",
+		},
+		"error from SPDK": {
+			spdk: []string{
+				`{"id":%d,"error":{"code":1,"message":"myopierr"}}`,
+			},
+			policy:  NvmeReconnectPolicy{KeepAliveTimeoutMs: 10000},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_nvme_get_controllers: %v", "json response error: myopierr"),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.reconnectPolicy = tt.policy
+
+			err := testEnv.opiSpdkServer.ApplyNvmeOptions(testEnv.ctx)
+
+			if testEnv.opiSpdkServer.nvmeOptionsApplied != tt.optionsApplied {
+				t.Error("expected options applied", tt.optionsApplied, "received", testEnv.opiSpdkServer.nvmeOptionsApplied)
+			}
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestBackEnd_SetNvmeRemoteControllerPolicy(t *testing.T) {
+	policy := NvmeReconnectPolicy{CtrlrLossTimeoutSec: 30, ReconnectDelaySec: 5, MultipathSelector: "queue_depth"}
+	tests := map[string]struct {
+		in       *SetNvmeRemoteControllerPolicyRequest
+		out      *NvmeReconnectPolicy
+		existing *pb.NvmePath
+		errCode  codes.Code
+		errMsg   string
+	}{
+		"valid request": {
+			in:      &SetNvmeRemoteControllerPolicyRequest{Name: testNvmeCtrlName, Policy: policy},
+			out:     &NvmeReconnectPolicy{CtrlrLossTimeoutSec: 30, ReconnectDelaySec: 5, MultipathSelector: "queue_depth", KeepAliveTimeoutMs: 10000},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"global option": {
+			in:      &SetNvmeRemoteControllerPolicyRequest{Name: testNvmeCtrlName, Policy: NvmeReconnectPolicy{KeepAliveTimeoutMs: 5000}},
+			out:     nil,
+			errCode: codes.InvalidArgument,
+			errMsg:  "keep alive timeout and DH-HMAC-CHAP digests and DH groups cannot be set per controller",
+		},
+		"invalid policy": {
+			in:      &SetNvmeRemoteControllerPolicyRequest{Name: testNvmeCtrlName, Policy: NvmeReconnectPolicy{CtrlrLossTimeoutSec: 30}},
+			out:     nil,
+			errCode: codes.InvalidArgument,
+			errMsg:  "ctrlr_loss_timeout_sec requires reconnect_delay_sec",
+		},
+		"unknown controller": {
+			in:      &SetNvmeRemoteControllerPolicyRequest{Name: "unknown-id", Policy: policy},
+			out:     nil,
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", "unknown-id"),
+		},
+		"controller with paths": {
+			in:       &SetNvmeRemoteControllerPolicyRequest{Name: testNvmeCtrlName, Policy: policy},
+			out:      nil,
+			existing: &testNvmePathWithName,
+			errCode:  codes.FailedPrecondition,
+			errMsg:   "NvmePaths exist for controller",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment([]string{})
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.reconnectPolicy = NvmeReconnectPolicy{KeepAliveTimeoutMs: 10000}
+			testEnv.opiSpdkServer.Volumes.NvmeControllers[testNvmeCtrlName] = utils.ProtoClone(&testNvmeCtrlWithName)
+			if tt.existing != nil {
+				testEnv.opiSpdkServer.Volumes.NvmePaths[tt.existing.Name] = utils.ProtoClone(tt.existing)
+			}
+
+			response, err := testEnv.opiSpdkServer.SetNvmeRemoteControllerPolicy(testEnv.ctx, tt.in)
+
+			if !reflect.DeepEqual(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkGrpcError(t, err, tt.errCode, tt.errMsg)
+
+			expected := testEnv.opiSpdkServer.reconnectPolicy
+			if tt.out != nil {
+				expected = *tt.out
+			}
+			applied, err := testEnv.opiSpdkServer.GetNvmeRemoteControllerPolicy(testEnv.ctx,
+				&GetNvmeRemoteControllerPolicyRequest{Name: testNvmeCtrlName})
+			if err != nil || !reflect.DeepEqual(*applied, expected) {
+				t.Error("applied policy: expected", expected, "received", applied, err)
+			}
+		})
+	}
+}
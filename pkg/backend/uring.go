@@ -0,0 +1,319 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implememnts the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+
+	"github.com/opiproject/gospdk/spdk"
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"github.com/google/uuid"
+	"go.einride.tech/aip/resourceid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// TODO: opi-api has no io_uring volume messages yet, so the types below mirror
+// AioVolume ones and the service is served by the HTTP extension API, see
+// ExtensionRoutes, until they land.
+
+// UringVolume represents a file or block device exposed as an io_uring bdev
+type UringVolume struct {
+	Name        string `json:"name"`
+	BlockSize   int64  `json:"blockSize"`
+	BlocksCount int64  `json:"blocksCount"`
+	Filename    string `json:"filename"`
+}
+
+// CreateUringVolumeRequest represents a request to create an io_uring volume
+type CreateUringVolumeRequest struct {
+	UringVolume   *UringVolume `json:"uringVolume"`
+	UringVolumeID string       `json:"uringVolumeId"`
+}
+
+// DeleteUringVolumeRequest represents a request to delete an io_uring volume
+type DeleteUringVolumeRequest struct {
+	Name         string `json:"name"`
+	AllowMissing bool   `json:"allowMissing"`
+}
+
+// UpdateUringVolumeRequest represents a request to update an io_uring volume
+type UpdateUringVolumeRequest struct {
+	UringVolume  *UringVolume `json:"uringVolume"`
+	AllowMissing bool         `json:"allowMissing"`
+}
+
+// ListUringVolumesRequest represents a request to list io_uring volumes
+type ListUringVolumesRequest struct {
+	PageSize  int32  `json:"pageSize"`
+	PageToken string `json:"pageToken"`
+}
+
+// ListUringVolumesResponse represents a list of io_uring volumes
+type ListUringVolumesResponse struct {
+	UringVolumes  []*UringVolume `json:"uringVolumes"`
+	NextPageToken string         `json:"nextPageToken"`
+}
+
+// GetUringVolumeRequest represents a request to get an io_uring volume
+type GetUringVolumeRequest struct {
+	Name string `json:"name"`
+}
+
+// StatsUringVolumeRequest represents a request to get io_uring volume stats
+type StatsUringVolumeRequest struct {
+	Name string `json:"name"`
+}
+
+// StatsUringVolumeResponse represents io_uring volume stats
+type StatsUringVolumeResponse struct {
+	Stats *pb.VolumeStats `json:"stats"`
+}
+
+type bdevUringCreateParams struct {
+	Name      string `json:"name"`
+	Filename  string `json:"filename"`
+	BlockSize int    `json:"block_size,omitempty"`
+}
+
+type bdevUringCreateResult string
+
+type bdevUringDeleteParams struct {
+	Name string `json:"name"`
+}
+
+type bdevUringDeleteResult bool
+
+func sortUringVolumes(volumes []*UringVolume) {
+	sort.Slice(volumes, func(i int, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+}
+
+func cloneUringVolume(volume *UringVolume) *UringVolume {
+	clone := *volume
+	return &clone
+}
+
+// CreateUringVolume creates an io_uring volume
+func (s *Server) CreateUringVolume(ctx context.Context, in *CreateUringVolumeRequest) (*UringVolume, error) {
+	// check input correctness
+	if err := s.validateCreateUringVolumeRequest(in); err != nil {
+		return nil, err
+	}
+	// see https://google.aip.dev/133#user-specified-ids
+	resourceID := resourceid.NewSystemGenerated()
+	if in.UringVolumeID != "" {
+		log.Printf("client provided the ID of a resource %v, ignoring the name field %v", in.UringVolumeID, in.UringVolume.Name)
+		resourceID = in.UringVolumeID
+	}
+	in.UringVolume.Name = utils.ResourceIDToVolumeName(resourceID)
+	// idempotent API when called with same key, should return same object
+	volume, ok := s.Volumes.UringVolumes[in.UringVolume.Name]
+	if ok {
+		log.Printf("Already existing UringVolume with id %v", in.UringVolume.Name)
+		return volume, nil
+	}
+	// not found, so create a new one
+	if err := s.createUringBdev(ctx, resourceID, in.UringVolume); err != nil {
+		return nil, err
+	}
+	response := cloneUringVolume(in.UringVolume)
+	s.Volumes.UringVolumes[in.UringVolume.Name] = response
+	return response, nil
+}
+
+// DeleteUringVolume deletes an io_uring volume
+func (s *Server) DeleteUringVolume(ctx context.Context, in *DeleteUringVolumeRequest) (*emptypb.Empty, error) {
+	// check input correctness
+	if err := s.validateDeleteUringVolumeRequest(in); err != nil {
+		return nil, err
+	}
+	// fetch object from the database
+	volume, ok := s.Volumes.UringVolumes[in.Name]
+	if !ok {
+		if in.AllowMissing {
+			return &emptypb.Empty{}, nil
+		}
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	if err := s.deleteUringBdev(ctx, path.Base(volume.Name)); err != nil {
+		return nil, err
+	}
+	delete(s.Volumes.UringVolumes, volume.Name)
+	return &emptypb.Empty{}, nil
+}
+
+// UpdateUringVolume updates an io_uring volume
+func (s *Server) UpdateUringVolume(ctx context.Context, in *UpdateUringVolumeRequest) (*UringVolume, error) {
+	// check input correctness
+	if err := s.validateUpdateUringVolumeRequest(in); err != nil {
+		return nil, err
+	}
+	// fetch object from the database
+	volume, ok := s.Volumes.UringVolumes[in.UringVolume.Name]
+	if !ok {
+		if !in.AllowMissing {
+			err := status.Errorf(codes.NotFound, "unable to find key %s", in.UringVolume.Name)
+			return nil, err
+		}
+		log.Printf("Got AllowMissing, create a new resource, don't return error when resource not found")
+	} else {
+		if err := s.deleteUringBdev(ctx, path.Base(volume.Name)); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.createUringBdev(ctx, path.Base(in.UringVolume.Name), in.UringVolume); err != nil {
+		return nil, err
+	}
+	response := cloneUringVolume(in.UringVolume)
+	s.Volumes.UringVolumes[in.UringVolume.Name] = response
+	return response, nil
+}
+
+// ListUringVolumes lists io_uring volumes
+func (s *Server) ListUringVolumes(_ context.Context, in *ListUringVolumesRequest) (*ListUringVolumesResponse, error) {
+	// check input correctness
+	if in == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing request")
+	}
+	// fetch object from the database
+	size, offset, perr := utils.ExtractPagination(in.PageSize, in.PageToken, s.Pagination)
+	if perr != nil {
+		return nil, perr
+	}
+	Blobarray := []*UringVolume{}
+	for _, volume := range s.Volumes.UringVolumes {
+		Blobarray = append(Blobarray, cloneUringVolume(volume))
+	}
+	sortUringVolumes(Blobarray)
+
+	token := ""
+	log.Printf("Limiting result len(%d) to [%d:%d]", len(Blobarray), offset, size)
+	Blobarray, hasMoreElements := utils.LimitPagination(Blobarray, offset, size)
+	if hasMoreElements {
+		token = uuid.New().String()
+		s.Pagination[token] = offset + size
+	}
+	return &ListUringVolumesResponse{UringVolumes: Blobarray, NextPageToken: token}, nil
+}
+
+// GetUringVolume gets an io_uring volume
+func (s *Server) GetUringVolume(ctx context.Context, in *GetUringVolumeRequest) (*UringVolume, error) {
+	// check input correctness
+	if err := s.validateGetUringVolumeRequest(in); err != nil {
+		return nil, err
+	}
+	// fetch object from the database
+	volume, ok := s.Volumes.UringVolumes[in.Name]
+	if !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	resourceID := path.Base(volume.Name)
+	params := spdk.BdevGetBdevsParams{
+		Name: resourceID,
+	}
+	var result []spdk.BdevGetBdevsResult
+	err := s.rpc.Call(ctx, "bdev_get_bdevs", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if len(result) != 1 {
+		msg := fmt.Sprintf("expecting exactly 1 result, got %d", len(result))
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	return &UringVolume{
+		Name:        volume.Name,
+		BlockSize:   result[0].BlockSize,
+		BlocksCount: result[0].NumBlocks,
+		Filename:    volume.Filename,
+	}, nil
+}
+
+// StatsUringVolume gets an io_uring volume stats
+func (s *Server) StatsUringVolume(ctx context.Context, in *StatsUringVolumeRequest) (*StatsUringVolumeResponse, error) {
+	// check input correctness
+	if err := s.validateStatsUringVolumeRequest(in); err != nil {
+		return nil, err
+	}
+	// fetch object from the database
+	volume, ok := s.Volumes.UringVolumes[in.Name]
+	if !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	resourceID := path.Base(volume.Name)
+	params := spdk.BdevGetIostatParams{
+		Name: resourceID,
+	}
+	// See https://mholt.github.io/json-to-go/
+	var result spdk.BdevGetIostatResult
+	err := s.rpc.Call(ctx, "bdev_get_iostat", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if len(result.Bdevs) != 1 {
+		msg := fmt.Sprintf("expecting exactly 1 result, got %d", len(result.Bdevs))
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	return &StatsUringVolumeResponse{Stats: &pb.VolumeStats{
+		ReadBytesCount:    int32(result.Bdevs[0].BytesRead),
+		ReadOpsCount:      int32(result.Bdevs[0].NumReadOps),
+		WriteBytesCount:   int32(result.Bdevs[0].BytesWritten),
+		WriteOpsCount:     int32(result.Bdevs[0].NumWriteOps),
+		UnmapBytesCount:   int32(result.Bdevs[0].BytesUnmapped),
+		UnmapOpsCount:     int32(result.Bdevs[0].NumUnmapOps),
+		ReadLatencyTicks:  int32(result.Bdevs[0].ReadLatencyTicks),
+		WriteLatencyTicks: int32(result.Bdevs[0].WriteLatencyTicks),
+		UnmapLatencyTicks: int32(result.Bdevs[0].UnmapLatencyTicks),
+	}}, nil
+}
+
+func (s *Server) createUringBdev(ctx context.Context, name string, volume *UringVolume) error {
+	params := bdevUringCreateParams{
+		Name:      name,
+		Filename:  volume.Filename,
+		BlockSize: int(volume.BlockSize),
+	}
+	var result bdevUringCreateResult
+	err := s.rpc.Call(ctx, "bdev_uring_create", &params, &result)
+	if err != nil {
+		return err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if result == "" {
+		msg := fmt.Sprintf("Could not create Uring Dev: %s", params.Name)
+		return status.Errorf(codes.InvalidArgument, msg)
+	}
+	return nil
+}
+
+func (s *Server) deleteUringBdev(ctx context.Context, name string) error {
+	params := bdevUringDeleteParams{
+		Name: name,
+	}
+	var result bdevUringDeleteResult
+	err := s.rpc.Call(ctx, "bdev_uring_delete", &params, &result)
+	if err != nil {
+		return err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not delete Uring Dev: %s", params.Name)
+		return status.Errorf(codes.InvalidArgument, msg)
+	}
+	return nil
+}
@@ -0,0 +1,517 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implememnts the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+var (
+	testUringVolumeID   = "mytest"
+	testUringVolumeName = utils.ResourceIDToVolumeName(testUringVolumeID)
+	testUringVolume     = UringVolume{
+		BlockSize: 512,
+		Filename:  "/dev/nvme0n1",
+	}
+	testUringVolumeWithName = UringVolume{
+		Name:      testUringVolumeName,
+		BlockSize: testUringVolume.BlockSize,
+		Filename:  testUringVolume.Filename,
+	}
+)
+
+func checkGrpcError(t *testing.T, err error, errCode codes.Code, errMsg string) {
+	t.Helper()
+	er := status.Convert(err)
+	if er.Code() != errCode {
+		t.Error("error code: expected", errCode, "received", er.Code())
+	}
+	if er.Message() != errMsg {
+		t.Error("error message: expected", errMsg, "received", er.Message())
+	}
+}
+
+func TestBackEnd_CreateUringVolume(t *testing.T) {
+	tests := map[string]struct {
+		id      string
+		in      *UringVolume
+		out     *UringVolume
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+		exist   bool
+	}{
+		"illegal resource_id": {
+			id:      "CapitalLettersNotAllowed",
+			in:      &testUringVolume,
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("user-settable ID must only contain lowercase, numbers and hyphens (%v)", "got: 'C' in position 0"),
+			exist:   false,
+		},
+		"valid request with invalid SPDK response": {
+			id:      testUringVolumeID,
+			in:      &testUringVolume,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":""}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not create Uring Dev: %v", testUringVolumeID),
+			exist:   false,
+		},
+		"valid request with empty SPDK response": {
+			id:      testUringVolumeID,
+			in:      &testUringVolume,
+			out:     nil,
+			spdk:    []string{""},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_uring_create: %v", "EOF"),
+			exist:   false,
+		},
+		"valid request with error code from SPDK response": {
+			id:      testUringVolumeID,
+			in:      &testUringVolume,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":1,"message":"myopierr"},"result":""}`},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_uring_create: %v", "json response error: myopierr"),
+			exist:   false,
+		},
+		"valid request with valid SPDK response": {
+			id:      testUringVolumeID,
+			in:      &testUringVolume,
+			out:     &testUringVolumeWithName,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":"mytest"}`},
+			errCode: codes.OK,
+			errMsg:  "",
+			exist:   false,
+		},
+		"already exists": {
+			id:      testUringVolumeID,
+			in:      &testUringVolume,
+			out:     &testUringVolumeWithName,
+			spdk:    []string{},
+			errCode: codes.OK,
+			errMsg:  "",
+			exist:   true,
+		},
+		"no required field": {
+			id:      testUringVolumeID,
+			in:      nil,
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.InvalidArgument,
+			errMsg:  "missing required field: uring_volume",
+			exist:   false,
+		},
+		"no filename": {
+			id:      testUringVolumeID,
+			in:      &UringVolume{BlockSize: 512},
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.InvalidArgument,
+			errMsg:  "missing required field: uring_volume.filename",
+			exist:   false,
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			if tt.exist {
+				testEnv.opiSpdkServer.Volumes.UringVolumes[testUringVolumeName] = cloneUringVolume(&testUringVolumeWithName)
+			}
+			var in *UringVolume
+			if tt.in != nil {
+				in = cloneUringVolume(tt.in)
+			}
+
+			request := &CreateUringVolumeRequest{UringVolume: in, UringVolumeID: tt.id}
+			response, err := testEnv.opiSpdkServer.CreateUringVolume(testEnv.ctx, request)
+
+			if !reflect.DeepEqual(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkGrpcError(t, err, tt.errCode, tt.errMsg)
+		})
+	}
+}
+
+func TestBackEnd_UpdateUringVolume(t *testing.T) {
+	tests := map[string]struct {
+		in      *UringVolume
+		out     *UringVolume
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+		missing bool
+	}{
+		"delete fails": {
+			in:      &testUringVolumeWithName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not delete Uring Dev: %s", testUringVolumeID),
+			missing: false,
+		},
+		"delete ok create fails": {
+			in:      &testUringVolumeWithName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`, `{"id":%d,"error":{"code":0,"message":""},"result":""}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not create Uring Dev: %v", testUringVolumeID),
+			missing: false,
+		},
+		"valid request with valid SPDK response": {
+			in:      &testUringVolumeWithName,
+			out:     &testUringVolumeWithName,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`, `{"id":%d,"error":{"code":0,"message":""},"result":"mytest"}`},
+			errCode: codes.OK,
+			errMsg:  "",
+			missing: false,
+		},
+		"valid request with unknown key": {
+			in:      &UringVolume{Name: utils.ResourceIDToVolumeName("unknown-id"), Filename: "/dev/nvme0n1"},
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", utils.ResourceIDToVolumeName("unknown-id")),
+			missing: false,
+		},
+		"unknown key with missing allowed": {
+			in:      &UringVolume{Name: utils.ResourceIDToVolumeName("unknown-id"), Filename: "/dev/nvme0n1"},
+			out:     &UringVolume{Name: utils.ResourceIDToVolumeName("unknown-id"), Filename: "/dev/nvme0n1"},
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":"unknown-id"}`},
+			errCode: codes.OK,
+			errMsg:  "",
+			missing: true,
+		},
+		"malformed name": {
+			in:      &UringVolume{Name: "-ABC-DEF", Filename: testUringVolume.Filename},
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("segment '%s': not a valid DNS name", "-ABC-DEF"),
+			missing: false,
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Volumes.UringVolumes[testUringVolumeName] = cloneUringVolume(&testUringVolumeWithName)
+
+			request := &UpdateUringVolumeRequest{UringVolume: cloneUringVolume(tt.in), AllowMissing: tt.missing}
+			response, err := testEnv.opiSpdkServer.UpdateUringVolume(testEnv.ctx, request)
+
+			if !reflect.DeepEqual(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkGrpcError(t, err, tt.errCode, tt.errMsg)
+		})
+	}
+}
+
+func TestBackEnd_ListUringVolumes(t *testing.T) {
+	testUringVolume2 := UringVolume{Name: utils.ResourceIDToVolumeName("mytest2"), Filename: "/dev/nvme1n1"}
+	tests := map[string]struct {
+		out     []*UringVolume
+		errCode codes.Code
+		errMsg  string
+		size    int32
+		token   string
+	}{
+		"valid request": {
+			out:     []*UringVolume{&testUringVolumeWithName, &testUringVolume2},
+			errCode: codes.OK,
+			errMsg:  "",
+			size:    0,
+			token:   "",
+		},
+		"pagination": {
+			out:     []*UringVolume{&testUringVolumeWithName},
+			errCode: codes.OK,
+			errMsg:  "",
+			size:    1,
+			token:   "",
+		},
+		"pagination negative": {
+			out:     nil,
+			errCode: codes.InvalidArgument,
+			errMsg:  "negative PageSize is not allowed",
+			size:    -10,
+			token:   "",
+		},
+		"pagination error": {
+			out:     nil,
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find pagination token %s", "unknown-pagination-token"),
+			size:    0,
+			token:   "unknown-pagination-token",
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment([]string{})
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Volumes.UringVolumes[testUringVolumeName] = cloneUringVolume(&testUringVolumeWithName)
+			testEnv.opiSpdkServer.Volumes.UringVolumes[testUringVolume2.Name] = cloneUringVolume(&testUringVolume2)
+
+			request := &ListUringVolumesRequest{PageSize: tt.size, PageToken: tt.token}
+			response, err := testEnv.opiSpdkServer.ListUringVolumes(testEnv.ctx, request)
+
+			checkGrpcError(t, err, tt.errCode, tt.errMsg)
+			if response == nil {
+				if tt.out != nil {
+					t.Error("response: expected", tt.out, "received nil")
+				}
+				return
+			}
+			if !reflect.DeepEqual(response.UringVolumes, tt.out) {
+				t.Error("response: expected", tt.out, "received", response.UringVolumes)
+			}
+
+			// Empty NextPageToken indicates end of results list
+			if tt.size != 1 && response.NextPageToken != "" {
+				t.Error("Expected end of results, received non-empty next page token", response.NextPageToken)
+			}
+		})
+	}
+}
+
+func TestBackEnd_GetUringVolume(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		out     *UringVolume
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid request with invalid SPDK response": {
+			in:      testUringVolumeName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("expecting exactly 1 result, got %v", "0"),
+		},
+		"valid request with error code from SPDK response": {
+			in:      testUringVolumeName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":1,"message":"myopierr"}}`},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_get_bdevs: %v", "json response error: myopierr"),
+		},
+		"valid request with valid SPDK response": {
+			in: testUringVolumeName,
+			out: &UringVolume{
+				Name:        testUringVolumeName,
+				BlockSize:   512,
+				BlocksCount: 131072,
+				Filename:    testUringVolume.Filename,
+			},
+			spdk:    []string{`{"jsonrpc":"2.0","id":%d,"result":[{"name":"mytest","block_size":512,"num_blocks":131072}]}`},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"valid request with unknown key": {
+			in:      "unknown-id",
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", "unknown-id"),
+		},
+		"malformed name": {
+			in:      "-ABC-DEF",
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("segment '%s': not a valid DNS name", "-ABC-DEF"),
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Volumes.UringVolumes[testUringVolumeName] = cloneUringVolume(&testUringVolumeWithName)
+
+			request := &GetUringVolumeRequest{Name: tt.in}
+			response, err := testEnv.opiSpdkServer.GetUringVolume(testEnv.ctx, request)
+
+			if !reflect.DeepEqual(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkGrpcError(t, err, tt.errCode, tt.errMsg)
+		})
+	}
+}
+
+func TestBackEnd_StatsUringVolume(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		out     *pb.VolumeStats
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid request with invalid SPDK response": {
+			in:      testUringVolumeName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":{"tick_rate":0,"ticks":0,"bdevs":null}}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("expecting exactly 1 result, got %v", "0"),
+		},
+		"valid request with valid SPDK response": {
+			in: testUringVolumeName,
+			out: &pb.VolumeStats{
+				ReadBytesCount:    1,
+				ReadOpsCount:      2,
+				WriteBytesCount:   3,
+				WriteOpsCount:     4,
+				ReadLatencyTicks:  7,
+				WriteLatencyTicks: 8,
+			},
+			spdk:    []string{`{"jsonrpc":"2.0","id":%d,"result":{"tick_rate":2490000000,"ticks":18787040917434338,"bdevs":[{"name":"mytest","bytes_read":1,"num_read_ops":2,"bytes_written":3,"num_write_ops":4,"bytes_unmapped":0,"num_unmap_ops":0,"read_latency_ticks":7,"write_latency_ticks":8,"unmap_latency_ticks":0}]}}`},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"valid request with unknown key": {
+			in:      "unknown-id",
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", "unknown-id"),
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Volumes.UringVolumes[testUringVolumeName] = cloneUringVolume(&testUringVolumeWithName)
+
+			request := &StatsUringVolumeRequest{Name: tt.in}
+			response, err := testEnv.opiSpdkServer.StatsUringVolume(testEnv.ctx, request)
+
+			var stats *pb.VolumeStats
+			if response != nil {
+				stats = response.Stats
+			}
+			if !proto.Equal(stats, tt.out) {
+				t.Error("response: expected", tt.out, "received", stats)
+			}
+			checkGrpcError(t, err, tt.errCode, tt.errMsg)
+		})
+	}
+}
+
+func TestBackEnd_DeleteUringVolume(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		out     *emptypb.Empty
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+		missing bool
+	}{
+		"valid request with invalid SPDK response": {
+			in:      testUringVolumeName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not delete Uring Dev: %s", testUringVolumeID),
+			missing: false,
+		},
+		"valid request with empty SPDK response": {
+			in:      testUringVolumeName,
+			out:     nil,
+			spdk:    []string{""},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("bdev_uring_delete: %v", "EOF"),
+			missing: false,
+		},
+		"valid request with valid SPDK response": {
+			in:      testUringVolumeName,
+			out:     &emptypb.Empty{},
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode: codes.OK,
+			errMsg:  "",
+			missing: false,
+		},
+		"valid request with unknown key": {
+			in:      utils.ResourceIDToVolumeName("unknown-id"),
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", utils.ResourceIDToVolumeName("unknown-id")),
+			missing: false,
+		},
+		"unknown key with missing allowed": {
+			in:      utils.ResourceIDToVolumeName("unknown-id"),
+			out:     &emptypb.Empty{},
+			spdk:    []string{},
+			errCode: codes.OK,
+			errMsg:  "",
+			missing: true,
+		},
+		"malformed name": {
+			in:      "-ABC-DEF",
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("segment '%s': not a valid DNS name", "-ABC-DEF"),
+			missing: false,
+		},
+		"no required field": {
+			in:      "",
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.InvalidArgument,
+			errMsg:  "missing required field: name",
+			missing: false,
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Volumes.UringVolumes[testUringVolumeName] = cloneUringVolume(&testUringVolumeWithName)
+
+			request := &DeleteUringVolumeRequest{Name: tt.in, AllowMissing: tt.missing}
+			response, err := testEnv.opiSpdkServer.DeleteUringVolume(testEnv.ctx, request)
+
+			if !proto.Equal(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkGrpcError(t, err, tt.errCode, tt.errMsg)
+		})
+	}
+}
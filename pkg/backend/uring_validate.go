@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package backend implememnts the BackEnd APIs (network facing) of the storage Server
+package backend
+
+import (
+	"go.einride.tech/aip/resourceid"
+	"go.einride.tech/aip/resourcename"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) validateCreateUringVolumeRequest(in *CreateUringVolumeRequest) error {
+	// check required fields
+	if in == nil || in.UringVolume == nil {
+		return status.Error(codes.InvalidArgument, "missing required field: uring_volume")
+	}
+	if in.UringVolume.Filename == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: uring_volume.filename")
+	}
+	// see https://google.aip.dev/133#user-specified-ids
+	if in.UringVolumeID != "" {
+		if err := resourceid.ValidateUserSettable(in.UringVolumeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) validateDeleteUringVolumeRequest(in *DeleteUringVolumeRequest) error {
+	// check required fields
+	if in == nil || in.Name == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: name")
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Name)
+}
+
+func (s *Server) validateUpdateUringVolumeRequest(in *UpdateUringVolumeRequest) error {
+	// check required fields
+	if in == nil || in.UringVolume == nil {
+		return status.Error(codes.InvalidArgument, "missing required field: uring_volume")
+	}
+	if in.UringVolume.Filename == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: uring_volume.filename")
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.UringVolume.Name)
+}
+
+func (s *Server) validateGetUringVolumeRequest(in *GetUringVolumeRequest) error {
+	// check required fields
+	if in == nil || in.Name == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: name")
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Name)
+}
+
+func (s *Server) validateStatsUringVolumeRequest(in *StatsUringVolumeRequest) error {
+	// check required fields
+	if in == nil || in.Name == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: name")
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Name)
+}
@@ -0,0 +1,521 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package config defines the bridge configuration read from a file,
+// environment variables and command line flags
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/opiproject/gospdk/spdk"
+
+	"github.com/opiproject/opi-spdk-bridge/pkg/backend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/kvm"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+// EnvPrefix is a prefix of environment variables overriding configuration
+// values, e.g. OPI_SPDK_BRIDGE_KVM_QMP_ADDR overrides kvm.qmp_addr
+const EnvPrefix = "OPI_SPDK_BRIDGE_"
+
+// Config is the bridge configuration
+type Config struct {
+	GrpcPort     int    `yaml:"grpc_port"`
+	HTTPPort     int    `yaml:"http_port"`
+	SpdkAddress  string `yaml:"spdk_addr"`
+	RedisAddress string `yaml:"redis_addr"`
+	// ShutdownTimeout limits waiting for in-flight calls on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	TLS             TLS           `yaml:"tls"`
+	Gateway         Gateway       `yaml:"gateway"`
+	Kvm             Kvm           `yaml:"kvm"`
+	Frontend        Frontend      `yaml:"frontend"`
+	Backend         Backend       `yaml:"backend"`
+	Middleend       Middleend     `yaml:"middleend"`
+	Tracing         Tracing       `yaml:"tracing"`
+	Health          Health        `yaml:"health"`
+	Pagination      Pagination    `yaml:"pagination"`
+}
+
+// TLS contains files to enable TLS for gRPC server. TLS is disabled if no
+// file is set.
+type TLS struct {
+	ServerCert string `yaml:"server_cert"`
+	ServerKey  string `yaml:"server_key"`
+	CaCert     string `yaml:"ca_cert"`
+}
+
+// Gateway configures HTTP gateway server
+type Gateway struct {
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+}
+
+// Kvm configures automated plugging of SPDK devices to a VM
+type Kvm struct {
+	Enabled                bool          `yaml:"enabled"`
+	Hypervisor             string        `yaml:"hypervisor"`
+	QmpAddress             string        `yaml:"qmp_addr"`
+	ChAPISocket            string        `yaml:"ch_api_socket"`
+	LibvirtSocket          string        `yaml:"libvirt_socket"`
+	LibvirtDomain          string        `yaml:"libvirt_domain"`
+	CtrlrDir               string        `yaml:"ctrlr_dir"`
+	Buses                  []string      `yaml:"buses"`
+	Timeout                time.Duration `yaml:"timeout"`
+	PollDevicePresenceStep time.Duration `yaml:"poll_device_presence_step"`
+	// VMs are registered on startup next to the default VM. They can be set
+	// only in the configuration file.
+	VMs []VM `yaml:"vms"`
+}
+
+// VM describes additional VM devices are plugged to when requested on its
+// port_id
+type VM struct {
+	ID         string   `yaml:"id"`
+	PortID     int      `yaml:"port_id"`
+	Hypervisor string   `yaml:"hypervisor"`
+	QmpAddress string   `yaml:"qmp_addr"`
+	APISocket  string   `yaml:"api_socket"`
+	Domain     string   `yaml:"domain"`
+	CtrlrDir   string   `yaml:"ctrlr_dir"`
+	Buses      []string `yaml:"buses"`
+}
+
+// Frontend configures frontend devices
+type Frontend struct {
+	VirtioBlkTransport string `yaml:"virtio_blk_transport"`
+	NvmeAnaReporting   bool   `yaml:"nvme_ana_reporting"`
+	NvmeReservationDir string `yaml:"nvme_reservation_dir"`
+	// NvmeReservationRPCs enables nvmf_ns_get_reservation,
+	// nvmf_ns_preempt_reservation and nvmf_ns_clear_reservation RPCs
+	// available only in patched SPDK
+	NvmeReservationRPCs bool `yaml:"nvme_reservation_rpcs"`
+	// NvmeDhchapDigests and NvmeDhchapDhGroups are offered to hosts of
+	// subsystems requiring DH-HMAC-CHAP
+	NvmeDhchapDigests  []string `yaml:"nvme_dhchap_digests"`
+	NvmeDhchapDhGroups []string `yaml:"nvme_dhchap_dhgroups"`
+	NvmfTCP            NvmfTCP  `yaml:"nvmf_tcp"`
+}
+
+// NvmfTCP configures SPDK NVMe-oF TCP transport created on first use. Zero
+// values keep SPDK defaults, except InCapsuleDataSize where -1 does.
+type NvmfTCP struct {
+	IoUnitSize        int  `yaml:"io_unit_size"`
+	InCapsuleDataSize int  `yaml:"in_capsule_data_size"`
+	MaxQueueDepth     int  `yaml:"max_queue_depth"`
+	NumSharedBuffers  int  `yaml:"num_shared_buffers"`
+	SockPriority      int  `yaml:"sock_priority"`
+	ZeroCopy          bool `yaml:"zcopy"`
+}
+
+// Backend configures connections to remote Nvme controllers. Zero values
+// keep SPDK defaults.
+type Backend struct {
+	CtrlrLossTimeoutSec  int      `yaml:"ctrlr_loss_timeout_sec"`
+	ReconnectDelaySec    int      `yaml:"reconnect_delay_sec"`
+	FastIoFailTimeoutSec int      `yaml:"fast_io_fail_timeout_sec"`
+	KeepAliveTimeoutMs   int      `yaml:"keep_alive_timeout_ms"`
+	MultipathSelector    string   `yaml:"multipath_selector"`
+	DhchapDigests        []string `yaml:"dhchap_digests"`
+	DhchapDhGroups       []string `yaml:"dhchap_dhgroups"`
+}
+
+// Middleend configures middleend volumes
+type Middleend struct {
+	TweakMode string `yaml:"tweak_mode"`
+}
+
+// Tracing configures OpenTelemetry tracing
+type Tracing struct {
+	// OtlpEndpoint is host:port of OTLP collector. If empty,
+	// OTEL_EXPORTER_OTLP_ENDPOINT is used
+	OtlpEndpoint  string  `yaml:"otlp_endpoint"`
+	OtlpInsecure  bool    `yaml:"otlp_insecure"`
+	SamplingRatio float64 `yaml:"sampling_ratio"`
+}
+
+// Health configures checks of dependencies reported by health service and
+// readiness endpoint
+type Health struct {
+	CheckInterval time.Duration `yaml:"check_interval"`
+	CheckTimeout  time.Duration `yaml:"check_timeout"`
+}
+
+// Pagination configures page sizes of List calls
+type Pagination struct {
+	DefaultPageSize int `yaml:"default_page_size"`
+	MaxPageSize     int `yaml:"max_page_size"`
+}
+
+// Default returns configuration used when nothing is overridden
+func Default() *Config {
+	return &Config{
+		GrpcPort:        50051,
+		HTTPPort:        8082,
+		SpdkAddress:     "/var/tmp/spdk.sock",
+		RedisAddress:    "127.0.0.1:6379",
+		ShutdownTimeout: 25 * time.Second,
+		Gateway: Gateway{
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		},
+		Kvm: Kvm{
+			Hypervisor:             string(kvm.HypervisorQemu),
+			QmpAddress:             "127.0.0.1:5555",
+			LibvirtSocket:          "/var/run/libvirt/libvirt-sock",
+			Buses:                  []string{},
+			Timeout:                2 * time.Second,
+			PollDevicePresenceStep: 5 * time.Millisecond,
+			VMs:                    []VM{},
+		},
+		Frontend: Frontend{
+			VirtioBlkTransport: "vhost-user",
+			NvmeDhchapDigests:  []string{},
+			NvmeDhchapDhGroups: []string{},
+			NvmfTCP:            NvmfTCP{InCapsuleDataSize: -1},
+		},
+		Backend: Backend{
+			DhchapDigests:  []string{},
+			DhchapDhGroups: []string{},
+		},
+		Middleend: Middleend{
+			TweakMode: spdk.TweakModeSimpleLba,
+		},
+		Tracing: Tracing{
+			SamplingRatio: 1,
+		},
+		Health: Health{
+			CheckInterval: 5 * time.Second,
+			CheckTimeout:  2 * time.Second,
+		},
+		Pagination: Pagination{
+			DefaultPageSize: 50,
+			MaxPageSize:     250,
+		},
+	}
+}
+
+// Load builds configuration from defaults, a file passed by -config flag or
+// OPI_SPDK_BRIDGE_CONFIG variable, environment variables and flags set in
+// args in order of increasing priority. The result is validated.
+func Load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	var path string
+	fs.StringVar(&path, "config", "", "Path to YAML configuration file. Environment variables and flags override values from the file")
+	Default().RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+
+	c := Default()
+	if path != "" {
+		if err := c.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.ApplyEnv(lookupEnv); err != nil {
+		return nil, err
+	}
+
+	overrides := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	c.RegisterFlags(overrides)
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err == nil && overrides.Lookup(f.Name) != nil {
+			err = overrides.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadFile overrides configuration values by the ones set in YAML file
+func (c *Config) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %v: %w", path, err)
+	}
+	return nil
+}
+
+// RegisterFlags registers command line flags bound to configuration values
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.GrpcPort, "grpc_port", c.GrpcPort, "The gRPC server port")
+	fs.IntVar(&c.HTTPPort, "http_port", c.HTTPPort, "The HTTP server port")
+	fs.StringVar(&c.SpdkAddress, "spdk_addr", c.SpdkAddress, "Points to SPDK unix socket/tcp socket to interact with")
+	fs.StringVar(&c.RedisAddress, "redis_addr", c.RedisAddress, "Redis address in ip_address:port format")
+	fs.Var((*tlsValue)(&c.TLS), "tls", "TLS files in server_cert:server_key:ca_cert format.")
+
+	fs.BoolVar(&c.Kvm.Enabled, "kvm", c.Kvm.Enabled, "Automates interaction with QEMU to plug/unplug SPDK devices")
+	fs.StringVar(&c.Kvm.QmpAddress, "qmp_addr", c.Kvm.QmpAddress, "Points to QMP unix socket/tcp socket to interact with. Valid only with -kvm option")
+	fs.StringVar(&c.Kvm.Hypervisor, "hypervisor", c.Kvm.Hypervisor, "Hypervisor to plug/unplug SPDK devices to: qemu, cloud-hypervisor or libvirt. Valid only with -kvm option")
+	fs.StringVar(&c.Kvm.ChAPISocket, "ch_api_socket", c.Kvm.ChAPISocket, "Points to cloud-hypervisor API unix socket to interact with. Valid only with -kvm -hypervisor=cloud-hypervisor options")
+	fs.StringVar(&c.Kvm.LibvirtSocket, "libvirt_socket", c.Kvm.LibvirtSocket, "Points to libvirt daemon unix socket to interact with. Valid only with -kvm -hypervisor=libvirt options")
+	fs.StringVar(&c.Kvm.LibvirtDomain, "libvirt_domain", c.Kvm.LibvirtDomain, "Name of libvirt domain to plug/unplug SPDK devices to. Valid only with -kvm -hypervisor=libvirt options")
+	fs.StringVar(&c.Kvm.CtrlrDir, "ctrlr_dir", c.Kvm.CtrlrDir, "Directory with created SPDK device unix sockets (-S option in SPDK). Valid only with -kvm option")
+	fs.Var(&listValue{list: &c.Kvm.Buses, separator: ":"}, "buses", "QEMU PCI buses IDs separated by `:` to attach Nvme/virtio-blk devices on. e.g. \"pci.opi.0:pci.opi.1\". Valid only with -kvm option")
+
+	fs.StringVar(&c.Frontend.VirtioBlkTransport, "virtio_blk_transport", c.Frontend.VirtioBlkTransport, "Transport to create virtio-blk devices with: vhost-user or vfio-user. vfio-user is valid only with -kvm option")
+	fs.BoolVar(&c.Frontend.NvmeAnaReporting, "nvme_ana_reporting", c.Frontend.NvmeAnaReporting, "Enables ANA reporting on created Nvme subsystems")
+	fs.StringVar(&c.Frontend.NvmeReservationDir, "nvme_reservation_dir", c.Frontend.NvmeReservationDir, "Directory to keep files persisting Nvme namespace reservations through power loss in. Created on startup if missing")
+	fs.BoolVar(&c.Frontend.NvmeReservationRPCs, "nvme_reservation_rpcs", c.Frontend.NvmeReservationRPCs, "Enables nvmf_ns_get_reservation, nvmf_ns_preempt_reservation and nvmf_ns_clear_reservation RPCs missing in upstream SPDK. Requires SPDK patched with them")
+	fs.Var(&listValue{list: &c.Frontend.NvmeDhchapDigests, separator: ","}, "nvme_dhchap_digests", "DH-HMAC-CHAP digests offered to hosts of Nvme subsystems separated by `,`. e.g. \"sha384,sha512\". Empty keeps SPDK default")
+	fs.Var(&listValue{list: &c.Frontend.NvmeDhchapDhGroups, separator: ","}, "nvme_dhchap_dhgroups", "DH-HMAC-CHAP DH groups offered to hosts of Nvme subsystems separated by `,`. e.g. \"ffdhe3072,ffdhe4096\". Empty keeps SPDK default")
+	fs.IntVar(&c.Frontend.NvmfTCP.IoUnitSize, "nvmf_tcp_io_unit_size", c.Frontend.NvmfTCP.IoUnitSize, "I/O unit size of SPDK NVMe-oF TCP transport created on first use. 0 keeps SPDK default")
+	fs.IntVar(&c.Frontend.NvmfTCP.InCapsuleDataSize, "nvmf_tcp_in_capsule_data_size", c.Frontend.NvmfTCP.InCapsuleDataSize, "Max in-capsule data size of SPDK NVMe-oF TCP transport created on first use. -1 keeps SPDK default")
+	fs.IntVar(&c.Frontend.NvmfTCP.MaxQueueDepth, "nvmf_tcp_max_queue_depth", c.Frontend.NvmfTCP.MaxQueueDepth, "Max queue depth of SPDK NVMe-oF TCP transport created on first use. 0 keeps SPDK default")
+	fs.IntVar(&c.Frontend.NvmfTCP.NumSharedBuffers, "nvmf_tcp_num_shared_buffers", c.Frontend.NvmfTCP.NumSharedBuffers, "Number of shared buffers of SPDK NVMe-oF TCP transport created on first use. 0 keeps SPDK default")
+	fs.IntVar(&c.Frontend.NvmfTCP.SockPriority, "nvmf_tcp_sock_priority", c.Frontend.NvmfTCP.SockPriority, "Socket priority of SPDK NVMe-oF TCP transport created on first use. 0 keeps SPDK default")
+	fs.BoolVar(&c.Frontend.NvmfTCP.ZeroCopy, "nvmf_tcp_zcopy", c.Frontend.NvmfTCP.ZeroCopy, "Enables zero copy send in SPDK NVMe-oF TCP transport created on first use")
+
+	fs.IntVar(&c.Backend.CtrlrLossTimeoutSec, "ctrlr_loss_timeout_sec", c.Backend.CtrlrLossTimeoutSec, "Time to try reconnecting to a lost remote Nvme controller, -1 for infinite. 0 keeps SPDK default")
+	fs.IntVar(&c.Backend.ReconnectDelaySec, "reconnect_delay_sec", c.Backend.ReconnectDelaySec, "Time between reconnect attempts to a remote Nvme controller. 0 keeps SPDK default")
+	fs.IntVar(&c.Backend.FastIoFailTimeoutSec, "fast_io_fail_timeout_sec", c.Backend.FastIoFailTimeoutSec, "Time after which I/O to a reconnecting remote Nvme controller fails. 0 keeps SPDK default")
+	fs.IntVar(&c.Backend.KeepAliveTimeoutMs, "keep_alive_timeout_ms", c.Backend.KeepAliveTimeoutMs, "Keep alive timeout for remote Nvme controllers. 0 keeps SPDK default")
+	fs.StringVar(&c.Backend.MultipathSelector, "multipath_selector", c.Backend.MultipathSelector, "Path selector for active/active multipath remote Nvme controllers: round_robin or queue_depth")
+	fs.Var(&listValue{list: &c.Backend.DhchapDigests, separator: ","}, "dhchap_digests", "DH-HMAC-CHAP digests offered to remote Nvme controllers separated by `,`. e.g. \"sha384,sha512\". Empty keeps SPDK default")
+	fs.Var(&listValue{list: &c.Backend.DhchapDhGroups, separator: ","}, "dhchap_dhgroups", "DH-HMAC-CHAP DH groups offered to remote Nvme controllers separated by `,`. e.g. \"ffdhe3072,ffdhe4096\". Empty keeps SPDK default")
+}
+
+// Validate checks configuration values and reports all invalid ones
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, a ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, a...))
+		}
+	}
+
+	check(c.GrpcPort > 0 && c.GrpcPort <= 65535, "grpc_port %v is out of range", c.GrpcPort)
+	check(c.HTTPPort > 0 && c.HTTPPort <= 65535, "http_port %v is out of range", c.HTTPPort)
+	check(c.SpdkAddress != "", "spdk_addr is required")
+	check(c.RedisAddress != "", "redis_addr is required")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+	tlsFiles := []string{c.TLS.ServerCert, c.TLS.ServerKey, c.TLS.CaCert}
+	check(strings.Join(tlsFiles, "") == "" || !contains(tlsFiles, ""),
+		"tls requires all of server_cert, server_key and ca_cert")
+
+	check(c.Gateway.ReadTimeout > 0, "gateway.read_timeout must be positive")
+	check(c.Gateway.WriteTimeout > 0, "gateway.write_timeout must be positive")
+
+	switch kvm.Hypervisor(c.Kvm.Hypervisor) {
+	case kvm.HypervisorQemu:
+		check(!c.Kvm.Enabled || c.Kvm.QmpAddress != "", "kvm.qmp_addr is required for qemu hypervisor")
+	case kvm.HypervisorCloudHypervisor:
+		check(c.Kvm.Enabled, "%v hypervisor requires kvm", c.Kvm.Hypervisor)
+		check(c.Kvm.ChAPISocket != "", "kvm.ch_api_socket is required for %v hypervisor", c.Kvm.Hypervisor)
+	case kvm.HypervisorLibvirt:
+		check(c.Kvm.Enabled, "%v hypervisor requires kvm", c.Kvm.Hypervisor)
+		check(c.Kvm.LibvirtSocket != "", "kvm.libvirt_socket is required for %v hypervisor", c.Kvm.Hypervisor)
+		check(c.Kvm.LibvirtDomain != "", "kvm.libvirt_domain is required for %v hypervisor", c.Kvm.Hypervisor)
+	default:
+		problems = append(problems, fmt.Sprintf("unknown kvm.hypervisor %q", c.Kvm.Hypervisor))
+	}
+	check(!c.Kvm.Enabled || c.Kvm.CtrlrDir != "", "kvm.ctrlr_dir is required for kvm")
+	check(!contains(c.Kvm.Buses, ""), "kvm.buses cannot contain empty bus")
+	check(c.Kvm.Timeout > 0, "kvm.timeout must be positive")
+	check(c.Kvm.PollDevicePresenceStep > 0, "kvm.poll_device_presence_step must be positive")
+	check(c.Kvm.Enabled || len(c.Kvm.VMs) == 0, "kvm.vms requires kvm")
+	for i, vm := range c.Kvm.VMs {
+		check(vm.ID != "", "kvm.vms[%d].id is required", i)
+		check(vm.PortID > 0, "kvm.vms[%d].port_id must be positive, port 0 is used by the default VM", i)
+	}
+
+	switch c.Frontend.VirtioBlkTransport {
+	case "vhost-user":
+	case "vfio-user":
+		check(c.Kvm.Enabled, "vfio-user frontend.virtio_blk_transport requires kvm")
+	default:
+		problems = append(problems, fmt.Sprintf("unknown frontend.virtio_blk_transport %q", c.Frontend.VirtioBlkTransport))
+	}
+	if err := utils.ValidateDhchapDigests(c.Frontend.NvmeDhchapDigests); err != nil {
+		problems = append(problems, "frontend.nvme_dhchap_digests: "+err.Error())
+	}
+	if err := utils.ValidateDhchapDhGroups(c.Frontend.NvmeDhchapDhGroups); err != nil {
+		problems = append(problems, "frontend.nvme_dhchap_dhgroups: "+err.Error())
+	}
+	tcp := c.Frontend.NvmfTCP
+	check(tcp.IoUnitSize >= 0, "frontend.nvmf_tcp.io_unit_size cannot be negative")
+	check(tcp.InCapsuleDataSize >= -1, "frontend.nvmf_tcp.in_capsule_data_size cannot be less than -1")
+	check(tcp.MaxQueueDepth >= 0, "frontend.nvmf_tcp.max_queue_depth cannot be negative")
+	check(tcp.NumSharedBuffers >= 0, "frontend.nvmf_tcp.num_shared_buffers cannot be negative")
+	check(tcp.SockPriority >= 0, "frontend.nvmf_tcp.sock_priority cannot be negative")
+
+	check(c.Backend.CtrlrLossTimeoutSec >= -1, "backend.ctrlr_loss_timeout_sec cannot be less than -1")
+	check(c.Backend.ReconnectDelaySec >= 0, "backend.reconnect_delay_sec cannot be negative")
+	check(c.Backend.FastIoFailTimeoutSec >= 0, "backend.fast_io_fail_timeout_sec cannot be negative")
+	check(c.Backend.KeepAliveTimeoutMs >= 0, "backend.keep_alive_timeout_ms cannot be negative")
+	check(contains([]string{"", "round_robin", "queue_depth"}, c.Backend.MultipathSelector),
+		"unknown backend.multipath_selector %q", c.Backend.MultipathSelector)
+
+	check(contains([]string{
+		spdk.TweakModeSimpleLba,
+		spdk.TweakModeJoinNegLbaWithLba,
+		spdk.TweakModeIncr512FullLba,
+		spdk.TweakModeIncr512UpperLba,
+	}, c.Middleend.TweakMode), "unknown middleend.tweak_mode %q", c.Middleend.TweakMode)
+
+	check(c.Tracing.SamplingRatio >= 0 && c.Tracing.SamplingRatio <= 1,
+		"tracing.sampling_ratio %v is out of [0, 1] range", c.Tracing.SamplingRatio)
+
+	check(c.Health.CheckInterval > 0, "health.check_interval must be positive")
+	check(c.Health.CheckTimeout > 0, "health.check_timeout must be positive")
+
+	check(c.Pagination.DefaultPageSize > 0, "pagination.default_page_size must be positive")
+	check(c.Pagination.MaxPageSize > 0, "pagination.max_page_size must be positive")
+	check(c.Pagination.DefaultPageSize <= c.Pagination.MaxPageSize,
+		"pagination.default_page_size cannot exceed pagination.max_page_size")
+
+	if len(problems) != 0 {
+		return fmt.Errorf("invalid configuration: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// TLSFiles returns TLS files in server_cert:server_key:ca_cert format or
+// empty string if TLS is disabled
+func (c *Config) TLSFiles() string {
+	if c.TLS == (TLS{}) {
+		return ""
+	}
+	return (*tlsValue)(&c.TLS).String()
+}
+
+// TLSConfig returns TLS configuration of gRPC server
+func (c *Config) TLSConfig() utils.TLSConfig {
+	return utils.TLSConfig{
+		ServerCertPath: c.TLS.ServerCert,
+		ServerKeyPath:  c.TLS.ServerKey,
+		CaCertPath:     c.TLS.CaCert,
+	}
+}
+
+// NvmeReconnectPolicy returns policy applied to remote Nvme controllers
+func (c *Backend) NvmeReconnectPolicy() backend.NvmeReconnectPolicy {
+	return backend.NvmeReconnectPolicy{
+		CtrlrLossTimeoutSec:  int32(c.CtrlrLossTimeoutSec),
+		ReconnectDelaySec:    int32(c.ReconnectDelaySec),
+		FastIoFailTimeoutSec: int32(c.FastIoFailTimeoutSec),
+		KeepAliveTimeoutMs:   int32(c.KeepAliveTimeoutMs),
+		MultipathSelector:    c.MultipathSelector,
+		DhchapDigests:        c.DhchapDigests,
+		DhchapDhGroups:       c.DhchapDhGroups,
+	}
+}
+
+// VMConfig returns configuration of the VM to register. Empty ctrlr_dir
+// means the one of the default VM.
+func (c *VM) VMConfig(ctrlrDir string) kvm.VMConfig {
+	if c.CtrlrDir != "" {
+		ctrlrDir = c.CtrlrDir
+	}
+	return kvm.VMConfig{
+		ID:         c.ID,
+		PortID:     int32(c.PortID),
+		Hypervisor: kvm.Hypervisor(c.Hypervisor),
+		QmpAddress: c.QmpAddress,
+		APISocket:  c.APISocket,
+		Domain:     c.Domain,
+		CtrlrDir:   ctrlrDir,
+		Buses:      c.Buses,
+	}
+}
+
+// TransportOptions returns options of SPDK NVMe-oF TCP transport
+func (c *NvmfTCP) TransportOptions() frontend.NvmfTransportOptions {
+	options := frontend.NvmfTransportOptions{
+		IoUnitSize:       int32(c.IoUnitSize),
+		MaxQueueDepth:    int32(c.MaxQueueDepth),
+		NumSharedBuffers: int32(c.NumSharedBuffers),
+		SockPriority:     int32(c.SockPriority),
+		ZeroCopy:         c.ZeroCopy,
+	}
+	if c.InCapsuleDataSize >= 0 {
+		inCapsuleDataSize := int32(c.InCapsuleDataSize)
+		options.InCapsuleDataSize = &inCapsuleDataSize
+	}
+	return options
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// listValue is a flag value of a list with separated entries
+type listValue struct {
+	list      *[]string
+	separator string
+}
+
+func (v *listValue) String() string {
+	if v.list == nil {
+		return ""
+	}
+	return strings.Join(*v.list, v.separator)
+}
+
+func (v *listValue) Set(s string) error {
+	*v.list = []string{}
+	if s != "" {
+		*v.list = strings.Split(s, v.separator)
+	}
+	return nil
+}
+
+// tlsValue is a flag value of TLS files in server_cert:server_key:ca_cert
+// format
+type tlsValue TLS
+
+func (v *tlsValue) String() string {
+	if v == nil || *v == (tlsValue{}) {
+		return ""
+	}
+	return strings.Join([]string{v.ServerCert, v.ServerKey, v.CaCert}, ":")
+}
+
+func (v *tlsValue) Set(s string) error {
+	if s == "" {
+		*v = tlsValue{}
+		return nil
+	}
+	config, err := utils.ParseTLSFiles(s)
+	if err != nil {
+		return err
+	}
+	*v = tlsValue{
+		ServerCert: config.ServerCertPath,
+		ServerKey:  config.ServerKeyPath,
+		CaCert:     config.CaCertPath,
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package config defines the bridge configuration read from a file,
+// environment variables and command line flags
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := map[string]struct {
+		file          string
+		configFromEnv bool
+		env           map[string]string
+		args          []string
+		modify        func(c *Config)
+		errMsg        string
+	}{
+		"defaults": {
+			modify: func(c *Config) {},
+		},
+		"file values": {
+			file: `
+grpc_port: 50052
+tls:
+  server_cert: /certs/server.crt
+  server_key: /certs/server.key
+  ca_cert: /certs/ca.crt
+gateway:
+  read_timeout: 1m
+kvm:
+  enabled: true
+  ctrlr_dir: /var/tmp
+  buses: [pci.opi.0, pci.opi.1]
+  poll_device_presence_step: 10ms
+  vms:
+    - id: vm1
+      port_id: 1
+      qmp_addr: /var/run/vm1.qmp
+      buses: [pci.opi.2]
+frontend:
+  nvme_dhchap_digests: [sha512]
+backend:
+  dhchap_digests: [sha384]
+middleend:
+  tweak_mode: INCR_512_FULL_LBA
+pagination:
+  max_page_size: 100
+`,
+			modify: func(c *Config) {
+				c.GrpcPort = 50052
+				c.TLS = TLS{ServerCert: "/certs/server.crt", ServerKey: "/certs/server.key", CaCert: "/certs/ca.crt"}
+				c.Gateway.ReadTimeout = time.Minute
+				c.Kvm.Enabled = true
+				c.Kvm.CtrlrDir = "/var/tmp"
+				c.Kvm.Buses = []string{"pci.opi.0", "pci.opi.1"}
+				c.Kvm.PollDevicePresenceStep = 10 * time.Millisecond
+				c.Kvm.VMs = []VM{{ID: "vm1", PortID: 1, QmpAddress: "/var/run/vm1.qmp", Buses: []string{"pci.opi.2"}}}
+				c.Frontend.NvmeDhchapDigests = []string{"sha512"}
+				c.Backend.DhchapDigests = []string{"sha384"}
+				c.Middleend.TweakMode = "INCR_512_FULL_LBA"
+				c.Pagination.MaxPageSize = 100
+			},
+		},
+		"environment overrides file": {
+			file: "grpc_port: 50052\nspdk_addr: /var/tmp/file.sock\n",
+			env: map[string]string{
+				"OPI_SPDK_BRIDGE_GRPC_PORT":                      "50053",
+				"OPI_SPDK_BRIDGE_KVM_TIMEOUT":                    "5s",
+				"OPI_SPDK_BRIDGE_FRONTEND_NVMF_TCP_ZCOPY":        "true",
+				"OPI_SPDK_BRIDGE_BACKEND_DHCHAP_DHGROUPS":        "ffdhe3072,ffdhe4096",
+				"OPI_SPDK_BRIDGE_TRACING_SAMPLING_RATIO":         "0.5",
+				"OPI_SPDK_BRIDGE_HEALTH_CHECK_INTERVAL":          "1m",
+				"OPI_SPDK_BRIDGE_PAGINATION_DEFAULT_PAGE_SIZE":   "10",
+				"OPI_SPDK_BRIDGE_FRONTEND_NVME_RESERVATION_DIR":  "/var/lib/reservations",
+				"OPI_SPDK_BRIDGE_FRONTEND_NVME_RESERVATION_RPCS": "true",
+			},
+			modify: func(c *Config) {
+				c.GrpcPort = 50053
+				c.SpdkAddress = "/var/tmp/file.sock"
+				c.Kvm.Timeout = 5 * time.Second
+				c.Frontend.NvmfTCP.ZeroCopy = true
+				c.Backend.DhchapDhGroups = []string{"ffdhe3072", "ffdhe4096"}
+				c.Tracing.SamplingRatio = 0.5
+				c.Health.CheckInterval = time.Minute
+				c.Pagination.DefaultPageSize = 10
+				c.Frontend.NvmeReservationDir = "/var/lib/reservations"
+				c.Frontend.NvmeReservationRPCs = true
+			},
+		},
+		"flags override environment and file": {
+			file: "grpc_port: 50052\nhttp_port: 8083\nkvm:\n  buses: [pci.opi.0]\n",
+			env:  map[string]string{"OPI_SPDK_BRIDGE_GRPC_PORT": "50053"},
+			args: []string{"-grpc_port=50054", "-buses=pci.opi.1:pci.opi.2", "-tls=a.crt:a.key:ca.crt"},
+			modify: func(c *Config) {
+				c.GrpcPort = 50054
+				c.HTTPPort = 8083
+				c.Kvm.Buses = []string{"pci.opi.1", "pci.opi.2"}
+				c.TLS = TLS{ServerCert: "a.crt", ServerKey: "a.key", CaCert: "ca.crt"}
+			},
+		},
+		"flag set to default value overrides file": {
+			file: "grpc_port: 50052\n",
+			args: []string{"-grpc_port=50051"},
+			modify: func(c *Config) {
+				c.GrpcPort = 50051
+			},
+		},
+		"config file from environment": {
+			file:          "http_port: 8083\n",
+			configFromEnv: true,
+			modify: func(c *Config) {
+				c.HTTPPort = 8083
+			},
+		},
+		"empty file": {
+			file:   "\n",
+			modify: func(c *Config) {},
+		},
+		"unknown key in file": {
+			file:   "kvm:\n  qmp_address: localhost:5555\n",
+			errMsg: "field qmp_address not found in type config.Kvm",
+		},
+		"invalid duration in environment": {
+			env:    map[string]string{"OPI_SPDK_BRIDGE_GATEWAY_WRITE_TIMEOUT": "10"},
+			errMsg: "invalid value \"10\" of OPI_SPDK_BRIDGE_GATEWAY_WRITE_TIMEOUT",
+		},
+		"vms in environment": {
+			env:    map[string]string{"OPI_SPDK_BRIDGE_KVM_VMS": "vm1"},
+			errMsg: "invalid value \"vm1\" of OPI_SPDK_BRIDGE_KVM_VMS: unsupported type []config.VM",
+		},
+		"invalid tls flag": {
+			args:   []string{"-tls=a.crt:a.key"},
+			errMsg: "wrong number of path entries provided",
+		},
+		"invalid result": {
+			args:   []string{"-virtio_blk_transport=vfio-user"},
+			errMsg: "invalid configuration: vfio-user frontend.virtio_blk_transport requires kvm",
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			env := map[string]string{}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			args := tt.args
+			if tt.file != "" {
+				path := writeTestConfigFile(t, tt.file)
+				if tt.configFromEnv {
+					env[EnvPrefix+"CONFIG"] = path
+				} else {
+					args = append([]string{"-config", path}, args...)
+				}
+			}
+			fs := flag.NewFlagSet(testName, flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			lookupEnv := func(key string) (string, bool) {
+				v, ok := env[key]
+				return v, ok
+			}
+
+			c, err := Load(fs, args, lookupEnv)
+
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("Expected error containing %q, received %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, received %v", err)
+			}
+			expected := Default()
+			tt.modify(expected)
+			if !reflect.DeepEqual(c, expected) {
+				t.Errorf("Expected config %+v, received %+v", expected, c)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		modify func(c *Config)
+		errMsg string
+	}{
+		"valid default": {
+			modify: func(c *Config) {},
+		},
+		"valid kvm": {
+			modify: func(c *Config) {
+				c.Kvm.Enabled = true
+				c.Kvm.CtrlrDir = "/var/tmp"
+				c.Frontend.VirtioBlkTransport = "vfio-user"
+			},
+		},
+		"valid libvirt": {
+			modify: func(c *Config) {
+				c.Kvm.Enabled = true
+				c.Kvm.CtrlrDir = "/var/tmp"
+				c.Kvm.Hypervisor = "libvirt"
+				c.Kvm.LibvirtDomain = "vm0"
+			},
+		},
+		"invalid vms": {
+			modify: func(c *Config) {
+				c.Kvm.VMs = []VM{{ID: "vm1", PortID: 1}, {PortID: 0}}
+			},
+			errMsg: "invalid configuration: kvm.vms requires kvm; kvm.vms[1].id is required; " +
+				"kvm.vms[1].port_id must be positive, port 0 is used by the default VM",
+		},
+		"out of range port": {
+			modify: func(c *Config) { c.HTTPPort = 70000 },
+			errMsg: "invalid configuration: http_port 70000 is out of range",
+		},
+		"zero shutdown timeout": {
+			modify: func(c *Config) { c.ShutdownTimeout = 0 },
+			errMsg: "invalid configuration: shutdown_timeout must be positive",
+		},
+		"partial tls": {
+			modify: func(c *Config) { c.TLS.ServerCert = "server.crt" },
+			errMsg: "invalid configuration: tls requires all of server_cert, server_key and ca_cert",
+		},
+		"kvm without ctrlr dir": {
+			modify: func(c *Config) { c.Kvm.Enabled = true },
+			errMsg: "invalid configuration: kvm.ctrlr_dir is required for kvm",
+		},
+		"cloud-hypervisor without kvm and api socket": {
+			modify: func(c *Config) { c.Kvm.Hypervisor = "cloud-hypervisor" },
+			errMsg: "invalid configuration: cloud-hypervisor hypervisor requires kvm; " +
+				"kvm.ch_api_socket is required for cloud-hypervisor hypervisor",
+		},
+		"unknown hypervisor": {
+			modify: func(c *Config) { c.Kvm.Hypervisor = "xen" },
+			errMsg: "invalid configuration: unknown kvm.hypervisor \"xen\"",
+		},
+		"empty bus": {
+			modify: func(c *Config) { c.Kvm.Buses = []string{"pci.opi.0", ""} },
+			errMsg: "invalid configuration: kvm.buses cannot contain empty bus",
+		},
+		"zero timeouts": {
+			modify: func(c *Config) {
+				c.Gateway.WriteTimeout = 0
+				c.Kvm.PollDevicePresenceStep = 0
+			},
+			errMsg: "invalid configuration: gateway.write_timeout must be positive; " +
+				"kvm.poll_device_presence_step must be positive",
+		},
+		"unknown virtio-blk transport": {
+			modify: func(c *Config) { c.Frontend.VirtioBlkTransport = "virtio-pci" },
+			errMsg: "invalid configuration: unknown frontend.virtio_blk_transport \"virtio-pci\"",
+		},
+		"unknown nvme dhchap dh group": {
+			modify: func(c *Config) { c.Frontend.NvmeDhchapDhGroups = []string{"ffdhe1024"} },
+			errMsg: "invalid configuration: frontend.nvme_dhchap_dhgroups: not supported DH-HMAC-CHAP DH group: ffdhe1024",
+		},
+		"negative nvmf tcp option": {
+			modify: func(c *Config) { c.Frontend.NvmfTCP.InCapsuleDataSize = -2 },
+			errMsg: "invalid configuration: frontend.nvmf_tcp.in_capsule_data_size cannot be less than -1",
+		},
+		"unknown multipath selector": {
+			modify: func(c *Config) { c.Backend.MultipathSelector = "random" },
+			errMsg: "invalid configuration: unknown backend.multipath_selector \"random\"",
+		},
+		"unknown tweak mode": {
+			modify: func(c *Config) { c.Middleend.TweakMode = "FULL_LBA" },
+			errMsg: "invalid configuration: unknown middleend.tweak_mode \"FULL_LBA\"",
+		},
+		"sampling ratio out of range": {
+			modify: func(c *Config) { c.Tracing.SamplingRatio = 1.5 },
+			errMsg: "invalid configuration: tracing.sampling_ratio 1.5 is out of [0, 1] range",
+		},
+		"zero health check timeout": {
+			modify: func(c *Config) { c.Health.CheckTimeout = 0 },
+			errMsg: "invalid configuration: health.check_timeout must be positive",
+		},
+		"default page size exceeds max": {
+			modify: func(c *Config) { c.Pagination.DefaultPageSize = 500 },
+			errMsg: "invalid configuration: pagination.default_page_size cannot exceed pagination.max_page_size",
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			c := Default()
+			tt.modify(c)
+
+			err := c.Validate()
+
+			errMsg := ""
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tt.errMsg {
+				t.Errorf("Expected error %q, received %q", tt.errMsg, errMsg)
+			}
+		})
+	}
+}
+
+func TestTransportOptions(t *testing.T) {
+	tcp := NvmfTCP{IoUnitSize: 8192, InCapsuleDataSize: -1}
+	if options := tcp.TransportOptions(); options.InCapsuleDataSize != nil || options.IoUnitSize != 8192 {
+		t.Errorf("Unexpected transport options %+v", options)
+	}
+
+	tcp.InCapsuleDataSize = 0
+	if options := tcp.TransportOptions(); options.InCapsuleDataSize == nil || *options.InCapsuleDataSize != 0 {
+		t.Errorf("Expected zero in-capsule data size, received %+v", options)
+	}
+}
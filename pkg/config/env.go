@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package config defines the bridge configuration read from a file,
+// environment variables and command line flags
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ApplyEnv overrides configuration values by environment variables. A
+// variable name is EnvPrefix followed by upper-cased path of yaml keys joined
+// by `_`, e.g. OPI_SPDK_BRIDGE_GATEWAY_READ_TIMEOUT. Lists are separated by `,`.
+func (c *Config) ApplyEnv(lookupEnv func(string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(c).Elem(), strings.TrimSuffix(EnvPrefix, "_"), lookupEnv)
+}
+
+func applyEnv(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		key, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		name := prefix + "_" + strings.ToUpper(key)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, name, lookupEnv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := lookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(field, value); err != nil {
+			return fmt.Errorf("invalid value %q of %v: %w", value, name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %v", field.Type())
+		}
+		list := []string{}
+		if value != "" {
+			list = strings.Split(value, ",")
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %v", field.Type())
+	}
+	return nil
+}
@@ -59,7 +59,7 @@ func (s *Server) CreateVirtioBlk(ctx context.Context, in *pb.CreateVirtioBlkRequ
 	}
 
 	var result spdk.VhostCreateBlkControllerResult
-	err = s.rpc.Call(ctx, "vhost_create_blk_controller", &params, &result)
+	err = s.rpc.Call(ctx, s.Virt.transport.CreateMethod(), &params, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +97,7 @@ func (s *Server) DeleteVirtioBlk(ctx context.Context, in *pb.DeleteVirtioBlkRequ
 	}
 
 	var result spdk.VhostDeleteControllerResult
-	err = s.rpc.Call(ctx, "vhost_delete_controller", &params, &result)
+	err = s.rpc.Call(ctx, s.Virt.transport.DeleteMethod(), &params, &result)
 	if err != nil {
 		return nil, err
 	}
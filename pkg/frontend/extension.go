@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implements the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"context"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ExtensionRoutes returns frontend APIs which opi-api has no messages for
+// yet, served by the HTTP gateway under utils.ExtensionPathPrefix
+func (s *Server) ExtensionRoutes() []utils.ExtensionRoute {
+	return []utils.ExtensionRoute{
+		{Path: "frontend/CreateNvmfTransport", Handler: utils.ExtensionHandler(s.CreateNvmfTransport)},
+		{Path: "frontend/ListNvmfTransports", Handler: utils.ExtensionHandler(s.ListNvmfTransports)},
+		{Path: "frontend/CreateNvmeSubsystemWithDhchap", Handler: utils.ExtensionHandler(s.createNvmeSubsystemWithDhchap)},
+		{Path: "frontend/SetNvmeControllerAnaState", Handler: utils.ExtensionHandler(s.SetNvmeControllerAnaState)},
+		{Path: "frontend/GetNvmeControllerAnaStatus", Handler: utils.ExtensionHandler(s.GetNvmeControllerAnaStatus)},
+		{Path: "frontend/CreateNvmeNamespaceWithOptions", Handler: utils.ExtensionHandler(s.createNvmeNamespaceWithOptions)},
+		{Path: "frontend/GetNvmeNamespace", Handler: utils.ExtensionHandler(s.GetNvmeNamespaceWithVisibility)},
+		{Path: "frontend/ListNvmeNamespaces", Handler: utils.ExtensionHandler(s.ListNvmeNamespacesWithVisibility)},
+		{Path: "frontend/AddNvmeNamespaceHost", Handler: utils.ExtensionHandler(s.AddNvmeNamespaceHost)},
+		{Path: "frontend/RemoveNvmeNamespaceHost", Handler: utils.ExtensionHandler(s.RemoveNvmeNamespaceHost)},
+		{Path: "frontend/GetNvmeNamespaceReservation", Handler: utils.ExtensionHandler(s.GetNvmeNamespaceReservation)},
+		{Path: "frontend/PreemptNvmeNamespaceReservation", Handler: utils.ExtensionHandler(s.PreemptNvmeNamespaceReservation)},
+		{Path: "frontend/ClearNvmeNamespaceReservation", Handler: utils.ExtensionHandler(s.ClearNvmeNamespaceReservation)},
+	}
+}
+
+func (s *Server) createNvmeSubsystemWithDhchap(ctx context.Context, in *CreateNvmeSubsystemWithDhchapRequest) (*pb.NvmeSubsystem, error) {
+	if in.Request.Message == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing required field: request")
+	}
+	if in.Dhchap == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing required field: dhchap")
+	}
+	return s.CreateNvmeSubsystemWithDhchap(ctx, in.Request.Message, in.Dhchap)
+}
+
+func (s *Server) createNvmeNamespaceWithOptions(ctx context.Context, in *CreateNvmeNamespaceWithOptionsRequest) (*pb.NvmeNamespace, error) {
+	if in.Request.Message == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing required field: request")
+	}
+	return s.CreateNvmeNamespaceWithOptions(ctx, in.Request.Message, in.Options)
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implements the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+func TestFrontEnd_CreateNvmeNamespaceWithOptionsRoute(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		body       string
+		spdk       []string
+		statusCode int
+		response   string
+		hosts      []string
+	}{
+		"namespace without auto visibility": {
+			body: `{"request":{"parent":"` + testSubsystemName + `","nvmeNamespaceId":"` + testNamespaceID + `",` +
+				`"nvmeNamespace":{"spec":{"hostNsid":22,"volumeNameRef":"Malloc1"}}},"options":{"noAutoVisible":true}}`,
+			spdk:       []string{`{"id":%d,"error":{"code":0,"message":""},"result":22}`},
+			statusCode: http.StatusOK,
+			hosts:      []string{},
+		},
+		"missing request": {
+			body:       `{"options":{"noAutoVisible":true}}`,
+			spdk:       []string{},
+			statusCode: http.StatusBadRequest,
+			response:   `{"code":3,"message":"missing required field: request"}`,
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			mux := http.NewServeMux()
+			utils.RegisterExtensionRoutes(mux, testEnv.opiSpdkServer.ExtensionRoutes())
+
+			req := httptest.NewRequest(http.MethodPost,
+				utils.ExtensionPathPrefix+"frontend/CreateNvmeNamespaceWithOptions", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Error("status code: expected", tt.statusCode, "received", w.Code, w.Body.String())
+			}
+			response := strings.ReplaceAll(w.Body.String(), " ", "")
+			if tt.response != "" && response != strings.ReplaceAll(tt.response, " ", "") {
+				t.Error("response: expected", tt.response, "received", w.Body.String())
+			}
+			hosts := testEnv.opiSpdkServer.Nvme.namespaceHosts[testNamespaceName]
+			if !reflect.DeepEqual(hosts, tt.hosts) {
+				t.Error("hosts: expected", tt.hosts, "received", hosts)
+			}
+		})
+	}
+}
+
+func TestFrontEnd_CreateNvmeSubsystemWithDhchapRoute(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		body     string
+		response string
+	}{
+		"missing request": {
+			body:     `{"dhchap":{"hostKey":"REhIQy0xOjAwOg=="}}`,
+			response: `{"code":3,"message":"missing required field: request"}`,
+		},
+		"missing dhchap": {
+			body:     `{"request":{"nvmeSubsystemId":"` + testSubsystemID + `","nvmeSubsystem":{"spec":{"nqn":"nqn.2022-09.io.spdk:opi3"}}}}`,
+			response: `{"code":3,"message":"missing required field: dhchap"}`,
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment([]string{})
+			defer testEnv.Close()
+			mux := http.NewServeMux()
+			utils.RegisterExtensionRoutes(mux, testEnv.opiSpdkServer.ExtensionRoutes())
+
+			req := httptest.NewRequest(http.MethodPost,
+				utils.ExtensionPathPrefix+"frontend/CreateNvmeSubsystemWithDhchap", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Error("status code: expected", http.StatusBadRequest, "received", w.Code, w.Body.String())
+			}
+			response := strings.ReplaceAll(w.Body.String(), " ", "")
+			if response != strings.ReplaceAll(tt.response, " ", "") {
+				t.Error("response: expected", tt.response, "received", w.Body.String())
+			}
+		})
+	}
+}
@@ -21,6 +21,29 @@ type NvmeParameters struct {
 	Controllers map[string]*pb.NvmeController
 	Namespaces  map[string]*pb.NvmeNamespace
 	transports  map[pb.NvmeTransportType]NvmeTransport
+	// AnaReporting enables ANA reporting on created subsystems
+	AnaReporting bool
+	// ReservationDir is directory to keep reservation files of namespaces
+	// persisting reservations through power loss in
+	ReservationDir string
+	// ReservationRPCs enables reservation RPCs which upstream SPDK does not
+	// provide, see nvme_reservation.go
+	ReservationRPCs bool
+	// DhchapDigests and DhchapDhGroups are DH-HMAC-CHAP digests and DH
+	// groups offered to hosts, empty keeps SPDK defaults
+	DhchapDigests  []string
+	DhchapDhGroups []string
+	// dhchapConfigured is set once SPDK offers DhchapDigests and DhchapDhGroups
+	dhchapConfigured bool
+	// anaGroups maps NvmeNamespace name to ANA group set on creation
+	anaGroups map[string]int32
+	// anaStates maps listener key to ANA states set per group
+	anaStates map[string]*nvmeListenerAnaStates
+	// namespaceHosts maps name of NvmeNamespace created without auto
+	// visibility to NQNs of hosts allowed to see it
+	namespaceHosts map[string][]string
+	// dhchapKeys maps NvmeSubsystem name to DH-HMAC-CHAP secrets of its host
+	dhchapKeys map[string]*utils.DhchapKeys
 }
 
 // VirtioParameters contains all VirtIO related structures
@@ -29,6 +52,8 @@ type VirtioParameters struct {
 	ScsiCtrls map[string]*pb.VirtioScsiController
 	ScsiLuns  map[string]*pb.VirtioScsiLun
 	transport VirtioBlkTransport
+	// scsiTargets maps VirtioScsiLun name to its SCSI target number
+	scsiTargets map[string]int
 }
 
 // Server contains frontend related OPI services
@@ -65,12 +90,19 @@ func NewServer(jsonRPC spdk.JSONRPC, store gokv.Store) *Server {
 			transports: map[pb.NvmeTransportType]NvmeTransport{
 				pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP: NewNvmeTCPTransport(jsonRPC),
 			},
+			anaGroups: make(map[string]int32),
+			anaStates: loadNvmeAnaStates(store),
+
+			namespaceHosts: make(map[string][]string),
+			dhchapKeys:     make(map[string]*utils.DhchapKeys),
 		},
 		Virt: VirtioParameters{
 			BlkCtrls:  make(map[string]*pb.VirtioBlk),
 			ScsiCtrls: make(map[string]*pb.VirtioScsiController),
 			ScsiLuns:  make(map[string]*pb.VirtioScsiLun),
 			transport: NewVhostUserBlkTransport(),
+
+			scsiTargets: make(map[string]int),
 		},
 		Pagination: make(map[string]int),
 
@@ -112,3 +144,13 @@ func NewCustomizedServer(
 	server.Virt.transport = virtioBlkTransport
 	return server
 }
+
+// VirtioBlkTransport returns transport used to create virtio-blk devices
+func (s *Server) VirtioBlkTransport() VirtioBlkTransport {
+	return s.Virt.transport
+}
+
+// Store returns store the server was created with
+func (s *Server) Store() gokv.Store {
+	return s.store
+}
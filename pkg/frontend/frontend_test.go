@@ -28,6 +28,8 @@ var checkGlobalTestProtoObjectsNotChanged = utils.CheckTestProtoObjectsNotChange
 	&testController,
 	&testSubsystem,
 	&testNamespace,
+	&testScsiCtrl,
+	&testScsiLun,
 )
 
 // TODO: move test infrastructure code to a separate (test/server) package to avoid duplication
@@ -0,0 +1,379 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implements the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/philippgille/gokv"
+
+	"github.com/opiproject/gospdk/spdk"
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// TODO: opi-api has no ANA fields in NvmeSubsystem, NvmeNamespace and
+// NvmeController, so ANA is managed by Nvme.AnaReporting and the methods
+// below served by the HTTP extension API, see ExtensionRoutes, until they
+// are added.
+
+// nvmeAnaStatesKey is a store key all requested ANA states are kept under,
+// since gokv stores cannot list keys
+const nvmeAnaStatesKey = "frontend/nvme-ana-states"
+
+// NvmeAnaState is ANA state advertised to hosts by a listener
+type NvmeAnaState string
+
+// ANA states supported by SPDK
+const (
+	NvmeAnaStateOptimized    NvmeAnaState = "optimized"
+	NvmeAnaStateNonOptimized NvmeAnaState = "non_optimized"
+	NvmeAnaStateInaccessible NvmeAnaState = "inaccessible"
+)
+
+// SetNvmeControllerAnaStateRequest is a request to change ANA state
+// advertised by the listener of Nvme controller
+type SetNvmeControllerAnaStateRequest struct {
+	// Name is NvmeController name
+	Name string `json:"name"`
+	// AnaGroupID is ANA group to change or 0 for all groups
+	AnaGroupID int32        `json:"anaGroupId"`
+	State      NvmeAnaState `json:"state"`
+}
+
+// NvmeControllerAnaStatus represents ANA states of Nvme controller listener
+type NvmeControllerAnaStatus struct {
+	// States maps ANA group ID to its state on the listener reported by SPDK
+	States map[int32]NvmeAnaState `json:"states"`
+	// Requested maps ANA group ID to the state set by
+	// SetNvmeControllerAnaState, group 0 stands for all groups
+	Requested map[int32]NvmeAnaState `json:"requested,omitempty"`
+}
+
+// nvmeListenerAnaStates keeps ANA states requested for a listener. They are
+// kept per listener since controllers with the same fabrics address share it.
+type nvmeListenerAnaStates struct {
+	Listener spdk.NvmfSubsystemAddListenerParams `json:"listener"`
+	States   map[int32]NvmeAnaState              `json:"states"`
+}
+
+type nvmfCreateSubsystemParams struct {
+	spdk.NvmfCreateSubsystemParams
+	AnaReporting bool `json:"ana_reporting,omitempty"`
+}
+
+type nvmfSubsystemListenerSetAnaStateParams struct {
+	spdk.NvmfSubsystemAddListenerParams
+	AnaState string `json:"ana_state"`
+	Anagrpid int32  `json:"anagrpid,omitempty"`
+}
+
+type nvmfSubsystemListenerSetAnaStateResult bool
+
+type nvmfSubsystemGetListenersParams struct {
+	Nqn string `json:"nqn"`
+}
+
+type nvmfSubsystemGetListenersResult struct {
+	Address struct {
+		Trtype  string `json:"trtype"`
+		Adrfam  string `json:"adrfam"`
+		Traddr  string `json:"traddr"`
+		Trsvcid string `json:"trsvcid"`
+	} `json:"address"`
+	AnaStates []struct {
+		AnaGroup int32  `json:"ana_group"`
+		AnaState string `json:"ana_state"`
+	} `json:"ana_states"`
+}
+
+func isValidNvmeAnaState(state NvmeAnaState) bool {
+	switch state {
+	case NvmeAnaStateOptimized, NvmeAnaStateNonOptimized, NvmeAnaStateInaccessible:
+		return true
+	}
+	return false
+}
+
+// nvmeNamespaceAnaGroup returns ANA group of the namespace. SPDK puts
+// namespaces without explicit group into the group equal to their NSID.
+func (s *Server) nvmeNamespaceAnaGroup(namespace *pb.NvmeNamespace) int32 {
+	if anaGroupID, ok := s.Nvme.anaGroups[namespace.Name]; ok {
+		return anaGroupID
+	}
+	return namespace.GetSpec().GetHostNsid()
+}
+
+func (s *Server) anaGroupExists(subsysName string, anaGroupID int32) bool {
+	for _, namespace := range s.Nvme.Namespaces {
+		subsysID := utils.GetSubsystemIDFromNvmeName(namespace.Name)
+		if utils.ResourceIDToSubsystemName(subsysID) == subsysName &&
+			s.nvmeNamespaceAnaGroup(namespace) == anaGroupID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) nvmeControllerListener(name string, ctrlr *pb.NvmeController) (*pb.NvmeSubsystem, spdk.NvmfSubsystemAddListenerParams, error) {
+	params := spdk.NvmfSubsystemAddListenerParams{}
+	if ctrlr.GetSpec().GetTrtype() != pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP {
+		msg := fmt.Sprintf("ANA is supported only for fabrics controllers: %s", name)
+		return nil, params, status.Errorf(codes.FailedPrecondition, msg)
+	}
+	subsysName := utils.ResourceIDToSubsystemName(utils.GetSubsystemIDFromNvmeName(name))
+	subsys, ok := s.Nvme.Subsystems[subsysName]
+	if !ok {
+		err := fmt.Errorf("unable to find subsystem %s", subsysName)
+		return nil, params, err
+	}
+	params.Nqn = subsys.Spec.Nqn
+	params.ListenAddress.Trtype = "tcp"
+	params.ListenAddress.Traddr = ctrlr.GetSpec().GetFabricsId().GetTraddr()
+	params.ListenAddress.Trsvcid = ctrlr.GetSpec().GetFabricsId().GetTrsvcid()
+	params.ListenAddress.Adrfam = utils.OpiAdressFamilyToSpdk(
+		ctrlr.GetSpec().GetFabricsId().GetAdrfam(),
+	)
+	return subsys, params, nil
+}
+
+// SetNvmeControllerAnaState changes ANA state advertised by the listener of
+// Nvme controller for the given ANA group or for all groups if AnaGroupID is
+// 0. The state is persisted and applied again when the listener is created.
+func (s *Server) SetNvmeControllerAnaState(ctx context.Context, in *SetNvmeControllerAnaStateRequest) (*emptypb.Empty, error) {
+	if !s.Nvme.AnaReporting {
+		return nil, status.Error(codes.FailedPrecondition, "ANA reporting is not enabled")
+	}
+	if !isValidNvmeAnaState(in.State) {
+		msg := fmt.Sprintf("not supported ANA state: %s", in.State)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	if in.AnaGroupID < 0 {
+		msg := fmt.Sprintf("negative ANA group is not allowed: %d", in.AnaGroupID)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	// fetch object from the database
+	ctrlr, ok := s.Nvme.Controllers[in.Name]
+	if !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	subsys, listener, err := s.nvmeControllerListener(ctrlr.Name, ctrlr)
+	if err != nil {
+		return nil, err
+	}
+	if in.AnaGroupID != 0 && !s.anaGroupExists(subsys.Name, in.AnaGroupID) {
+		err := status.Errorf(codes.NotFound, "unable to find ANA group %d in %s", in.AnaGroupID, subsys.Name)
+		return nil, err
+	}
+
+	if err := s.setNvmfListenerAnaState(ctx, listener, in.AnaGroupID, in.State); err != nil {
+		return nil, err
+	}
+
+	key := nvmfListenerKey(&listener)
+	anaStates, ok := s.Nvme.anaStates[key]
+	if !ok || in.AnaGroupID == 0 {
+		anaStates = &nvmeListenerAnaStates{Listener: listener, States: map[int32]NvmeAnaState{}}
+		s.Nvme.anaStates[key] = anaStates
+	}
+	anaStates.States[in.AnaGroupID] = in.State
+	s.saveNvmeAnaStates()
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) setNvmfListenerAnaState(ctx context.Context, listener spdk.NvmfSubsystemAddListenerParams,
+	anaGroupID int32, state NvmeAnaState) error {
+	params := nvmfSubsystemListenerSetAnaStateParams{
+		NvmfSubsystemAddListenerParams: listener,
+		AnaState:                       string(state),
+		Anagrpid:                       anaGroupID,
+	}
+	var result nvmfSubsystemListenerSetAnaStateResult
+	err := s.rpc.Call(ctx, "nvmf_subsystem_listener_set_ana_state", &params, &result)
+	if err != nil {
+		return err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not set ANA state for listener %s of %s",
+			nvmfListenerAddress(&listener), listener.Nqn)
+		return status.Errorf(codes.InvalidArgument, msg)
+	}
+	return nil
+}
+
+// applyNvmfListenerAnaStates sets ANA states requested for the listener in
+// SPDK. State for all groups is applied first to not override the others.
+func (s *Server) applyNvmfListenerAnaStates(ctx context.Context, anaStates *nvmeListenerAnaStates) error {
+	groups := make([]int32, 0, len(anaStates.States))
+	for anaGroupID := range anaStates.States {
+		groups = append(groups, anaGroupID)
+	}
+	sort.Slice(groups, func(i int, j int) bool { return groups[i] < groups[j] })
+	for _, anaGroupID := range groups {
+		err := s.setNvmfListenerAnaState(ctx, anaStates.Listener, anaGroupID, anaStates.States[anaGroupID])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreNvmeControllerAnaStates applies ANA states requested before for the
+// listener of just created Nvme controller
+func (s *Server) restoreNvmeControllerAnaStates(ctx context.Context, ctrlr *pb.NvmeController) error {
+	if !s.Nvme.AnaReporting || ctrlr.GetSpec().GetTrtype() != pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP {
+		return nil
+	}
+	_, listener, err := s.nvmeControllerListener(ctrlr.Name, ctrlr)
+	if err != nil {
+		return err
+	}
+	anaStates, ok := s.Nvme.anaStates[nvmfListenerKey(&listener)]
+	if !ok {
+		return nil
+	}
+	return s.applyNvmfListenerAnaStates(ctx, anaStates)
+}
+
+// RestoreNvmeAnaStates applies persisted ANA states to SPDK listeners after
+// the bridge restart. Listeners missing in SPDK get their states when their
+// controllers are created again.
+func (s *Server) RestoreNvmeAnaStates(ctx context.Context) error {
+	var failed []string
+	for key, anaStates := range s.Nvme.anaStates {
+		found, err := getNvmfListener(ctx, s.rpc, &anaStates.Listener)
+		if err != nil {
+			failed = append(failed, key)
+			log.Printf("Failed to get listener %s: %v", key, err)
+			continue
+		}
+		if found == nil {
+			log.Printf("Listener %s does not exist, ANA states are applied on controller creation", key)
+			continue
+		}
+		if err := s.applyNvmfListenerAnaStates(ctx, anaStates); err != nil {
+			failed = append(failed, key)
+			log.Printf("Failed to restore ANA states of listener %s: %v", key, err)
+		}
+	}
+	if len(failed) != 0 {
+		sort.Strings(failed)
+		return status.Errorf(codes.Unavailable, "ANA states are not restored for listeners %v", failed)
+	}
+	return nil
+}
+
+// forgetNvmeControllerAnaStates drops ANA states of the listener of deleted
+// Nvme controller unless other controllers still use the listener
+func (s *Server) forgetNvmeControllerAnaStates(ctrlr *pb.NvmeController) {
+	if ctrlr.GetSpec().GetTrtype() != pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP {
+		return
+	}
+	_, listener, err := s.nvmeControllerListener(ctrlr.Name, ctrlr)
+	if err != nil {
+		return
+	}
+	key := nvmfListenerKey(&listener)
+	if _, ok := s.Nvme.anaStates[key]; !ok {
+		return
+	}
+	for _, other := range s.Nvme.Controllers {
+		if other.Name == ctrlr.Name || other.GetSpec().GetTrtype() != pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP {
+			continue
+		}
+		_, otherListener, err := s.nvmeControllerListener(other.Name, other)
+		if err == nil && nvmfListenerKey(&otherListener) == key {
+			return
+		}
+	}
+	delete(s.Nvme.anaStates, key)
+	s.saveNvmeAnaStates()
+}
+
+func loadNvmeAnaStates(store gokv.Store) map[string]*nvmeListenerAnaStates {
+	anaStates := map[string]*nvmeListenerAnaStates{}
+	raw := &wrapperspb.StringValue{}
+	found, err := store.Get(nvmeAnaStatesKey, raw)
+	if err != nil {
+		log.Printf("Failed to load ANA states: %v", err)
+		return anaStates
+	}
+	if !found {
+		return anaStates
+	}
+	var entries []*nvmeListenerAnaStates
+	if err := json.Unmarshal([]byte(raw.Value), &entries); err != nil {
+		log.Printf("Failed to parse ANA states: %v", err)
+		return anaStates
+	}
+	for _, e := range entries {
+		anaStates[nvmfListenerKey(&e.Listener)] = e
+	}
+	return anaStates
+}
+
+func (s *Server) saveNvmeAnaStates() {
+	entries := make([]*nvmeListenerAnaStates, 0, len(s.Nvme.anaStates))
+	for _, e := range s.Nvme.anaStates {
+		entries = append(entries, e)
+	}
+	bs, err := json.Marshal(entries)
+	if err != nil {
+		log.Printf("Failed to marshal ANA states: %v", err)
+		return
+	}
+	if err := s.store.Set(nvmeAnaStatesKey, wrapperspb.String(string(bs))); err != nil {
+		log.Printf("Failed to persist ANA states: %v", err)
+	}
+}
+
+// GetNvmeControllerAnaStatus gets ANA states of Nvme controller listener
+func (s *Server) GetNvmeControllerAnaStatus(ctx context.Context, in *pb.GetNvmeControllerRequest) (*NvmeControllerAnaStatus, error) {
+	// check input correctness
+	if err := s.validateGetNvmeControllerRequest(in); err != nil {
+		return nil, err
+	}
+	// fetch object from the database
+	ctrlr, ok := s.Nvme.Controllers[in.Name]
+	if !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+		return nil, err
+	}
+	_, listener, err := s.nvmeControllerListener(ctrlr.Name, ctrlr)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := getNvmfListener(ctx, s.rpc, &listener)
+	if err != nil {
+		return nil, err
+	}
+	if found != nil {
+		anaStatus := &NvmeControllerAnaStatus{States: map[int32]NvmeAnaState{}}
+		for _, anaState := range found.AnaStates {
+			anaStatus.States[anaState.AnaGroup] = NvmeAnaState(anaState.AnaState)
+		}
+		if requested, ok := s.Nvme.anaStates[nvmfListenerKey(&listener)]; ok {
+			anaStatus.Requested = map[int32]NvmeAnaState{}
+			for anaGroupID, state := range requested.States {
+				anaStatus.Requested[anaGroupID] = state
+			}
+		}
+		return anaStatus, nil
+	}
+	msg := fmt.Sprintf("Could not find listener for CTRL: %s", ctrlr.Name)
+	return nil, status.Errorf(codes.FailedPrecondition, msg)
+}
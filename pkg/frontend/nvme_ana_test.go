@@ -0,0 +1,418 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implememnts the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/opiproject/gospdk/spdk"
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+var testAnaListener = spdk.NvmfSubsystemAddListenerParams{
+	Nqn: "nqn.2022-09.io.spdk:opi3",
+	ListenAddress: struct {
+		Trtype  string `json:"trtype"`
+		Traddr  string `json:"traddr"`
+		Trsvcid string `json:"trsvcid,omitempty"`
+		Adrfam  string `json:"adrfam,omitempty"`
+	}{Trtype: "tcp", Traddr: "127.0.0.1", Trsvcid: "4420", Adrfam: "IPV4"},
+}
+
+func testNvmeListenerAnaStates(states map[int32]NvmeAnaState) map[string]*nvmeListenerAnaStates {
+	return map[string]*nvmeListenerAnaStates{
+		nvmfListenerKey(&testAnaListener): {Listener: testAnaListener, States: states},
+	}
+}
+
+func TestFrontEnd_SetNvmeControllerAnaState(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		in           string
+		anaGroupID   int32
+		state        NvmeAnaState
+		anaReporting bool
+		trtype       pb.NvmeTransportType
+		spdk         []string
+		errCode      codes.Code
+		errMsg       string
+		anaStates    map[int32]NvmeAnaState
+	}{
+		"valid request with valid SPDK response": {
+			in:           testControllerName,
+			anaGroupID:   22,
+			state:        NvmeAnaStateInaccessible,
+			anaReporting: true,
+			trtype:       pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+			spdk:         []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode:      codes.OK,
+			errMsg:       "",
+			anaStates:    map[int32]NvmeAnaState{0: NvmeAnaStateOptimized, 22: NvmeAnaStateInaccessible},
+		},
+		"valid request for all ANA groups": {
+			in:           testControllerName,
+			anaGroupID:   0,
+			state:        NvmeAnaStateNonOptimized,
+			anaReporting: true,
+			trtype:       pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+			spdk:         []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode:      codes.OK,
+			errMsg:       "",
+			anaStates:    map[int32]NvmeAnaState{0: NvmeAnaStateNonOptimized},
+		},
+		"valid request with invalid SPDK response": {
+			in:           testControllerName,
+			anaGroupID:   22,
+			state:        NvmeAnaStateInaccessible,
+			anaReporting: true,
+			trtype:       pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+			spdk:         []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode:      codes.InvalidArgument,
+			errMsg:       "Could not set ANA state for listener 127.0.0.1:4420 of nqn.2022-09.io.spdk:opi3",
+			anaStates:    map[int32]NvmeAnaState{0: NvmeAnaStateOptimized},
+		},
+		"valid request with error code from SPDK response": {
+			in:           testControllerName,
+			anaGroupID:   22,
+			state:        NvmeAnaStateInaccessible,
+			anaReporting: true,
+			trtype:       pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+			spdk:         []string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":false}`},
+			errCode:      codes.Unknown,
+			errMsg:       fmt.Sprintf("nvmf_subsystem_listener_set_ana_state: %v", "json response error: Invalid parameters"),
+			anaStates:    map[int32]NvmeAnaState{0: NvmeAnaStateOptimized},
+		},
+		"ANA reporting is not enabled": {
+			in:           testControllerName,
+			anaGroupID:   22,
+			state:        NvmeAnaStateInaccessible,
+			anaReporting: false,
+			trtype:       pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+			spdk:         []string{},
+			errCode:      codes.FailedPrecondition,
+			errMsg:       "ANA reporting is not enabled",
+			anaStates:    map[int32]NvmeAnaState{0: NvmeAnaStateOptimized},
+		},
+		"not supported ANA state": {
+			in:           testControllerName,
+			anaGroupID:   22,
+			state:        NvmeAnaState("change"),
+			anaReporting: true,
+			trtype:       pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+			spdk:         []string{},
+			errCode:      codes.InvalidArgument,
+			errMsg:       fmt.Sprintf("not supported ANA state: %s", "change"),
+			anaStates:    map[int32]NvmeAnaState{0: NvmeAnaStateOptimized},
+		},
+		"negative ANA group": {
+			in:           testControllerName,
+			anaGroupID:   -1,
+			state:        NvmeAnaStateInaccessible,
+			anaReporting: true,
+			trtype:       pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+			spdk:         []string{},
+			errCode:      codes.InvalidArgument,
+			errMsg:       fmt.Sprintf("negative ANA group is not allowed: %d", -1),
+			anaStates:    map[int32]NvmeAnaState{0: NvmeAnaStateOptimized},
+		},
+		"valid request with unknown key": {
+			in:           "unknown-controller-id",
+			anaGroupID:   22,
+			state:        NvmeAnaStateInaccessible,
+			anaReporting: true,
+			trtype:       pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+			spdk:         []string{},
+			errCode:      codes.NotFound,
+			errMsg:       fmt.Sprintf("unable to find key %s", "unknown-controller-id"),
+			anaStates:    map[int32]NvmeAnaState{0: NvmeAnaStateOptimized},
+		},
+		"unknown ANA group": {
+			in:           testControllerName,
+			anaGroupID:   5,
+			state:        NvmeAnaStateInaccessible,
+			anaReporting: true,
+			trtype:       pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP,
+			spdk:         []string{},
+			errCode:      codes.NotFound,
+			errMsg:       fmt.Sprintf("unable to find ANA group %d in %s", 5, testSubsystemName),
+			anaStates:    map[int32]NvmeAnaState{0: NvmeAnaStateOptimized},
+		},
+		"not fabrics controller": {
+			in:           testControllerName,
+			anaGroupID:   22,
+			state:        NvmeAnaStateInaccessible,
+			anaReporting: true,
+			trtype:       pb.NvmeTransportType_NVME_TRANSPORT_TYPE_PCIE,
+			spdk:         []string{},
+			errCode:      codes.FailedPrecondition,
+			errMsg:       fmt.Sprintf("ANA is supported only for fabrics controllers: %s", testControllerName),
+			anaStates:    map[int32]NvmeAnaState{0: NvmeAnaStateOptimized},
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.AnaReporting = tt.anaReporting
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName].Name = testSubsystemName
+			testEnv.opiSpdkServer.Nvme.Controllers[testControllerName] = utils.ProtoClone(&testController)
+			testEnv.opiSpdkServer.Nvme.Controllers[testControllerName].Name = testControllerName
+			testEnv.opiSpdkServer.Nvme.Controllers[testControllerName].Spec.Trtype = tt.trtype
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName].Name = testNamespaceName
+			testEnv.opiSpdkServer.Nvme.anaStates = testNvmeListenerAnaStates(map[int32]NvmeAnaState{0: NvmeAnaStateOptimized})
+
+			request := &SetNvmeControllerAnaStateRequest{Name: tt.in, AnaGroupID: tt.anaGroupID, State: tt.state}
+			_, err := testEnv.opiSpdkServer.SetNvmeControllerAnaState(testEnv.ctx, request)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+
+			wantAnaStates := testNvmeListenerAnaStates(tt.anaStates)
+			if !reflect.DeepEqual(testEnv.opiSpdkServer.Nvme.anaStates, wantAnaStates) {
+				t.Error("ANA states: expected", wantAnaStates, "received", testEnv.opiSpdkServer.Nvme.anaStates)
+			}
+			if tt.errCode == codes.OK {
+				stored := loadNvmeAnaStates(testEnv.opiSpdkServer.store)
+				if !reflect.DeepEqual(stored, wantAnaStates) {
+					t.Error("stored ANA states: expected", wantAnaStates, "received", stored)
+				}
+			}
+		})
+	}
+}
+
+func TestFrontEnd_GetNvmeControllerAnaStatus(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		in        string
+		out       *NvmeControllerAnaStatus
+		spdk      []string
+		errCode   codes.Code
+		errMsg    string
+		anaStates map[string]*nvmeListenerAnaStates
+	}{
+		"valid request with valid SPDK response": {
+			testControllerName,
+			&NvmeControllerAnaStatus{
+				States: map[int32]NvmeAnaState{
+					1:  NvmeAnaStateOptimized,
+					22: NvmeAnaStateInaccessible,
+				},
+			},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[` +
+				`{"address":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4444"},"ana_states":[{"ana_group":1,"ana_state":"non_optimized"}]},` +
+				`{"address":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4420"},"ana_states":[{"ana_group":1,"ana_state":"optimized"},{"ana_group":22,"ana_state":"inaccessible"}]}]}`},
+			codes.OK,
+			"",
+			nil,
+		},
+		"requested states are reported": {
+			testControllerName,
+			&NvmeControllerAnaStatus{
+				States: map[int32]NvmeAnaState{
+					1:  NvmeAnaStateOptimized,
+					22: NvmeAnaStateInaccessible,
+				},
+				Requested: map[int32]NvmeAnaState{
+					22: NvmeAnaStateInaccessible,
+				},
+			},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[` +
+				`{"address":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4420"},"ana_states":[{"ana_group":1,"ana_state":"optimized"},{"ana_group":22,"ana_state":"inaccessible"}]}]}`},
+			codes.OK,
+			"",
+			testNvmeListenerAnaStates(map[int32]NvmeAnaState{22: NvmeAnaStateInaccessible}),
+		},
+		"listener not found in SPDK response": {
+			testControllerName,
+			nil,
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[` +
+				`{"address":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4444"},"ana_states":[{"ana_group":1,"ana_state":"non_optimized"}]}]}`},
+			codes.FailedPrecondition,
+			fmt.Sprintf("Could not find listener for CTRL: %s", testControllerName),
+			nil,
+		},
+		"valid request with error code from SPDK response": {
+			testControllerName,
+			nil,
+			[]string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":[]}`},
+			codes.Unknown,
+			fmt.Sprintf("nvmf_subsystem_get_listeners: %v", "json response error: Invalid parameters"),
+			nil,
+		},
+		"valid request with unknown key": {
+			"unknown-controller-id",
+			nil,
+			[]string{},
+			codes.NotFound,
+			fmt.Sprintf("unable to find key %s", "unknown-controller-id"),
+			nil,
+		},
+		"no required field": {
+			"",
+			nil,
+			[]string{},
+			codes.Unknown,
+			"missing required field: name",
+			nil,
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Controllers[testControllerName] = utils.ProtoClone(&testController)
+			testEnv.opiSpdkServer.Nvme.Controllers[testControllerName].Name = testControllerName
+			if tt.anaStates != nil {
+				testEnv.opiSpdkServer.Nvme.anaStates = tt.anaStates
+			}
+
+			request := &pb.GetNvmeControllerRequest{Name: tt.in}
+			response, err := testEnv.opiSpdkServer.GetNvmeControllerAnaStatus(testEnv.ctx, request)
+
+			if !reflect.DeepEqual(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestFrontEnd_RestoreNvmeAnaStates(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	listeners := `{"id":%d,"error":{"code":0,"message":""},"result":[` +
+		`{"address":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4420"},"ana_states":[{"ana_group":1,"ana_state":"optimized"}]}]}`
+	tests := map[string]struct {
+		anaStates map[int32]NvmeAnaState
+		spdk      []string
+		errCode   codes.Code
+		errMsg    string
+	}{
+		"states are applied to existing listener": {
+			anaStates: map[int32]NvmeAnaState{0: NvmeAnaStateNonOptimized, 22: NvmeAnaStateInaccessible},
+			spdk: []string{
+				listeners,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"missing listener is skipped": {
+			anaStates: map[int32]NvmeAnaState{22: NvmeAnaStateInaccessible},
+			spdk:      []string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`},
+			errCode:   codes.OK,
+			errMsg:    "",
+		},
+		"SPDK fails to set state": {
+			anaStates: map[int32]NvmeAnaState{22: NvmeAnaStateInaccessible},
+			spdk: []string{
+				listeners,
+				`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":false}`,
+			},
+			errCode: codes.Unavailable,
+			errMsg:  fmt.Sprintf("ANA states are not restored for listeners [%s]", nvmfListenerKey(&testAnaListener)),
+		},
+		"nothing persisted": {
+			anaStates: nil,
+			spdk:      []string{},
+			errCode:   codes.OK,
+			errMsg:    "",
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			if tt.anaStates != nil {
+				testEnv.opiSpdkServer.Nvme.anaStates = testNvmeListenerAnaStates(tt.anaStates)
+				testEnv.opiSpdkServer.saveNvmeAnaStates()
+			}
+			// simulate the bridge restart
+			server := NewServer(testEnv.jsonRPC, testEnv.opiSpdkServer.store)
+			server.Nvme.AnaReporting = true
+
+			err := server.RestoreNvmeAnaStates(testEnv.ctx)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+			if tt.anaStates != nil && !reflect.DeepEqual(server.Nvme.anaStates, testNvmeListenerAnaStates(tt.anaStates)) {
+				t.Error("ANA states: expected", tt.anaStates, "received", server.Nvme.anaStates)
+			}
+		})
+	}
+}
+
+func TestFrontEnd_forgetNvmeControllerAnaStates(t *testing.T) {
+	tests := map[string]struct {
+		sharedListener bool
+		want           map[string]*nvmeListenerAnaStates
+	}{
+		"listener used by another controller": {
+			sharedListener: true,
+			want:           testNvmeListenerAnaStates(map[int32]NvmeAnaState{22: NvmeAnaStateInaccessible}),
+		},
+		"last controller of listener": {
+			sharedListener: false,
+			want:           map[string]*nvmeListenerAnaStates{},
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment([]string{})
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Controllers[testControllerName] = utils.ProtoClone(&testController)
+			testEnv.opiSpdkServer.Nvme.Controllers[testControllerName].Name = testControllerName
+			if tt.sharedListener {
+				otherName := utils.ResourceIDToControllerName(testSubsystemID, "controller-other")
+				other := utils.ProtoClone(&testController)
+				other.Name = otherName
+				testEnv.opiSpdkServer.Nvme.Controllers[otherName] = other
+			}
+			testEnv.opiSpdkServer.Nvme.anaStates = testNvmeListenerAnaStates(map[int32]NvmeAnaState{22: NvmeAnaStateInaccessible})
+
+			testEnv.opiSpdkServer.forgetNvmeControllerAnaStates(testEnv.opiSpdkServer.Nvme.Controllers[testControllerName])
+
+			if !reflect.DeepEqual(testEnv.opiSpdkServer.Nvme.anaStates, tt.want) {
+				t.Error("ANA states: expected", tt.want, "received", testEnv.opiSpdkServer.Nvme.anaStates)
+			}
+		})
+	}
+}
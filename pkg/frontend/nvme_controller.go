@@ -67,6 +67,9 @@ func (s *Server) CreateNvmeController(ctx context.Context, in *pb.CreateNvmeCont
 	if err != nil {
 		return nil, err
 	}
+	if err := s.restoreNvmeControllerAnaStates(ctx, in.NvmeController); err != nil {
+		log.Printf("Failed to apply ANA states to %s: %v", in.NvmeController.Name, err)
+	}
 
 	response := utils.ProtoClone(in.NvmeController)
 	response.Spec.NvmeControllerId = proto.Int32(-1)
@@ -109,6 +112,7 @@ func (s *Server) DeleteNvmeController(ctx context.Context, in *pb.DeleteNvmeCont
 		return nil, err
 	}
 
+	s.forgetNvmeControllerAnaStates(controller)
 	delete(s.Nvme.Controllers, controller.Name)
 	return &emptypb.Empty{}, nil
 }
@@ -158,7 +162,7 @@ func (s *Server) ListNvmeControllers(_ context.Context, in *pb.ListNvmeControlle
 }
 
 // GetNvmeController gets an Nvme controller
-func (s *Server) GetNvmeController(_ context.Context, in *pb.GetNvmeControllerRequest) (*pb.NvmeController, error) {
+func (s *Server) GetNvmeController(ctx context.Context, in *pb.GetNvmeControllerRequest) (*pb.NvmeController, error) {
 	// check input correctness
 	if err := s.validateGetNvmeControllerRequest(in); err != nil {
 		return nil, err
@@ -169,7 +173,20 @@ func (s *Server) GetNvmeController(_ context.Context, in *pb.GetNvmeControllerRe
 		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
 		return nil, err
 	}
-	return &pb.NvmeController{Name: in.Name, Spec: &pb.NvmeControllerSpec{NvmeControllerId: controller.Spec.NvmeControllerId}, Status: &pb.NvmeControllerStatus{Active: true}}, nil
+	// fabrics controller is active while its listener exists in SPDK
+	active := true
+	if controller.Spec.Trtype == pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP {
+		_, listener, err := s.nvmeControllerListener(in.Name, controller)
+		if err != nil {
+			return nil, err
+		}
+		found, err := getNvmfListener(ctx, s.rpc, &listener)
+		if err != nil {
+			return nil, err
+		}
+		active = found != nil
+	}
+	return &pb.NvmeController{Name: in.Name, Spec: &pb.NvmeControllerSpec{NvmeControllerId: controller.Spec.NvmeControllerId}, Status: &pb.NvmeControllerStatus{Active: active}}, nil
 }
 
 // StatsNvmeController gets an Nvme controller stats
@@ -81,7 +81,7 @@ func TestFrontEnd_CreateNvmeController(t *testing.T) {
 				},
 			},
 			nil,
-			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP"}]}`, `{"id":%d,"error":{"code":0,"message":""},"result":[]}`, `{"id":%d,"error":{"code":0,"message":""},"result":false}`},
 			codes.InvalidArgument,
 			fmt.Sprintf("Could not create CTRL: %v", testControllerName),
 			false,
@@ -97,7 +97,7 @@ func TestFrontEnd_CreateNvmeController(t *testing.T) {
 				},
 			},
 			nil,
-			[]string{""},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP"}]}`, `{"id":%d,"error":{"code":0,"message":""},"result":[]}`, ""},
 			codes.Unknown,
 			fmt.Sprintf("nvmf_subsystem_add_listener: %v", "EOF"),
 			false,
@@ -113,7 +113,7 @@ func TestFrontEnd_CreateNvmeController(t *testing.T) {
 				},
 			},
 			nil,
-			[]string{`{"id":0,"error":{"code":0,"message":""},"result":false}`},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP"}]}`, `{"id":%d,"error":{"code":0,"message":""},"result":[]}`, `{"id":0,"error":{"code":0,"message":""},"result":false}`},
 			codes.Unknown,
 			fmt.Sprintf("nvmf_subsystem_add_listener: %v", "json response ID mismatch"),
 			false,
@@ -129,7 +129,7 @@ func TestFrontEnd_CreateNvmeController(t *testing.T) {
 				},
 			},
 			nil,
-			[]string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"}}`},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP"}]}`, `{"id":%d,"error":{"code":0,"message":""},"result":[]}`, `{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"}}`},
 			codes.Unknown,
 			fmt.Sprintf("nvmf_subsystem_add_listener: %v", "json response error: Invalid parameters"),
 			false,
@@ -155,7 +155,7 @@ func TestFrontEnd_CreateNvmeController(t *testing.T) {
 					Active: true,
 				},
 			},
-			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP"}]}`, `{"id":%d,"error":{"code":0,"message":""},"result":[]}`, `{"id":%d,"error":{"code":0,"message":""},"result":true}`},
 			codes.OK,
 			"",
 			false,
@@ -724,10 +724,32 @@ func TestFrontEnd_GetNvmeController(t *testing.T) {
 					Active: true,
 				},
 			},
-			[]string{},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"address":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4420"},"ana_states":[]}]}`},
 			codes.OK,
 			"",
 		},
+		"valid request with missing listener": {
+			testControllerName,
+			&pb.NvmeController{
+				Name: testControllerName,
+				Spec: &pb.NvmeControllerSpec{
+					NvmeControllerId: proto.Int32(17),
+				},
+				Status: &pb.NvmeControllerStatus{
+					Active: false,
+				},
+			},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"address":{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4421"},"ana_states":[]}]}`},
+			codes.OK,
+			"",
+		},
+		"valid request with error code from SPDK response": {
+			testControllerName,
+			nil,
+			[]string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":[]}`},
+			codes.Unknown,
+			fmt.Sprintf("nvmf_subsystem_get_listeners: %v", "json response error: Invalid parameters"),
+		},
 		"valid request with unknown key": {
 			"unknown-controller-id",
 			nil,
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implements the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"go.einride.tech/aip/fieldbehavior"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// TODO: opi-api has no visibility fields in NvmeNamespace, so namespace
+// masking is managed by NvmeNamespaceOptions.NoAutoVisible and the methods
+// below served by the HTTP extension API, see ExtensionRoutes, until they
+// are added.
+
+// NvmeNamespaceVisibility represents hosts which can see Nvme namespace
+type NvmeNamespaceVisibility struct {
+	// AllHosts is set if namespace is visible to every host connected to
+	// the subsystem
+	AllHosts bool `json:"allHosts"`
+	// Hosts lists NQNs of hosts allowed to see the namespace if AllHosts is
+	// not set
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// NvmeNamespaceHostRequest is a request to allow or disallow the host to see
+// Nvme namespace created without auto visibility
+type NvmeNamespaceHostRequest struct {
+	// Name is NvmeNamespace name
+	Name    string `json:"name"`
+	HostNqn string `json:"hostNqn"`
+}
+
+// NvmeNamespaceWithVisibility is Nvme namespace along with hosts which can
+// see it
+type NvmeNamespaceWithVisibility struct {
+	NvmeNamespace utils.ProtoJSON[*pb.NvmeNamespace] `json:"nvmeNamespace"`
+	Visibility    *NvmeNamespaceVisibility           `json:"visibility,omitempty"`
+}
+
+// ListNvmeNamespacesWithVisibilityResponse is ListNvmeNamespacesResponse
+// along with hosts which can see the namespaces
+type ListNvmeNamespacesWithVisibilityResponse struct {
+	NvmeNamespaces []*NvmeNamespaceWithVisibility `json:"nvmeNamespaces"`
+	NextPageToken  string                         `json:"nextPageToken,omitempty"`
+}
+
+type nvmfNsHostParams struct {
+	Nqn  string `json:"nqn"`
+	Nsid int    `json:"nsid"`
+	Host string `json:"host"`
+}
+
+type nvmfNsHostResult bool
+
+func (s *Server) nvmeNamespaceVisibility(name string) *NvmeNamespaceVisibility {
+	hosts, ok := s.Nvme.namespaceHosts[name]
+	if !ok {
+		return &NvmeNamespaceVisibility{AllHosts: true}
+	}
+	return &NvmeNamespaceVisibility{Hosts: append([]string{}, hosts...)}
+}
+
+// maskedNvmeNamespace fetches namespace created without auto visibility
+// along with its subsystem
+func (s *Server) maskedNvmeNamespace(name string, hostNqn string) (*pb.NvmeNamespace, *pb.NvmeSubsystem, error) {
+	if hostNqn == "" {
+		return nil, nil, status.Error(codes.InvalidArgument, "missing required field: host nqn")
+	}
+	namespace, subsys, err := s.nvmeNamespaceWithSubsystem(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := s.Nvme.namespaceHosts[name]; !ok {
+		msg := fmt.Sprintf("namespace is visible to all hosts: %s", name)
+		return nil, nil, status.Errorf(codes.FailedPrecondition, msg)
+	}
+	return namespace, subsys, nil
+}
+
+// AddNvmeNamespaceHost makes Nvme namespace created without auto visibility
+// visible to the host
+func (s *Server) AddNvmeNamespaceHost(ctx context.Context, in *NvmeNamespaceHostRequest) (*emptypb.Empty, error) {
+	namespace, subsys, err := s.maskedNvmeNamespace(in.Name, in.HostNqn)
+	if err != nil {
+		return nil, err
+	}
+	hosts := s.Nvme.namespaceHosts[in.Name]
+	for _, host := range hosts {
+		if host == in.HostNqn {
+			log.Printf("Host %v already allowed for NvmeNamespace %v", in.HostNqn, in.Name)
+			return &emptypb.Empty{}, nil
+		}
+	}
+
+	params := nvmfNsHostParams{
+		Nqn:  subsys.Spec.Nqn,
+		Nsid: int(namespace.Spec.HostNsid),
+		Host: in.HostNqn,
+	}
+	var result nvmfNsHostResult
+	err = s.rpc.Call(ctx, "nvmf_ns_add_host", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not add host %s to NS: %s", in.HostNqn, in.Name)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	hosts = append(hosts, in.HostNqn)
+	sort.Strings(hosts)
+	s.Nvme.namespaceHosts[in.Name] = hosts
+	return &emptypb.Empty{}, nil
+}
+
+// RemoveNvmeNamespaceHost hides Nvme namespace created without auto
+// visibility from the host
+func (s *Server) RemoveNvmeNamespaceHost(ctx context.Context, in *NvmeNamespaceHostRequest) (*emptypb.Empty, error) {
+	namespace, subsys, err := s.maskedNvmeNamespace(in.Name, in.HostNqn)
+	if err != nil {
+		return nil, err
+	}
+	hosts := s.Nvme.namespaceHosts[in.Name]
+	index := sort.SearchStrings(hosts, in.HostNqn)
+	if index == len(hosts) || hosts[index] != in.HostNqn {
+		err := status.Errorf(codes.NotFound, "unable to find host %s for %s", in.HostNqn, in.Name)
+		return nil, err
+	}
+
+	params := nvmfNsHostParams{
+		Nqn:  subsys.Spec.Nqn,
+		Nsid: int(namespace.Spec.HostNsid),
+		Host: in.HostNqn,
+	}
+	var result nvmfNsHostResult
+	err = s.rpc.Call(ctx, "nvmf_ns_remove_host", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not remove host %s from NS: %s", in.HostNqn, in.Name)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	s.Nvme.namespaceHosts[in.Name] = append(hosts[:index:index], hosts[index+1:]...)
+	return &emptypb.Empty{}, nil
+}
+
+// GetNvmeNamespaceWithVisibility gets an Nvme namespace along with hosts
+// which can see it
+func (s *Server) GetNvmeNamespaceWithVisibility(ctx context.Context, in *pb.GetNvmeNamespaceRequest) (*NvmeNamespaceWithVisibility, error) {
+	namespace, err := s.GetNvmeNamespace(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return &NvmeNamespaceWithVisibility{
+		NvmeNamespace: utils.ProtoJSON[*pb.NvmeNamespace]{Message: namespace},
+		Visibility:    s.nvmeNamespaceVisibility(in.Name),
+	}, nil
+}
+
+// ListNvmeNamespacesWithVisibility lists Nvme namespaces along with hosts
+// which can see them. Namespaces unknown to the bridge have no visibility.
+func (s *Server) ListNvmeNamespacesWithVisibility(ctx context.Context, in *pb.ListNvmeNamespacesRequest) (*ListNvmeNamespacesWithVisibilityResponse, error) {
+	// check required fields
+	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
+		return nil, err
+	}
+	if _, ok := s.Nvme.Subsystems[in.Parent]; !ok {
+		err := status.Errorf(codes.NotFound, "unable to find subsystem %s", in.Parent)
+		return nil, err
+	}
+	list, err := s.ListNvmeNamespaces(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	// SPDK reports namespaces by NSID only
+	names := map[int32]string{}
+	for name, namespace := range s.Nvme.Namespaces {
+		subsysName := utils.ResourceIDToSubsystemName(utils.GetSubsystemIDFromNvmeName(name))
+		if subsysName == in.Parent {
+			names[namespace.GetSpec().GetHostNsid()] = name
+		}
+	}
+	response := &ListNvmeNamespacesWithVisibilityResponse{NextPageToken: list.NextPageToken}
+	for _, namespace := range list.NvmeNamespaces {
+		item := &NvmeNamespaceWithVisibility{NvmeNamespace: utils.ProtoJSON[*pb.NvmeNamespace]{Message: namespace}}
+		if name, ok := names[namespace.GetSpec().GetHostNsid()]; ok {
+			namespace.Name = name
+			item.Visibility = s.nvmeNamespaceVisibility(name)
+		}
+		response.NvmeNamespaces = append(response.NvmeNamespaces, item)
+	}
+	return response, nil
+}
@@ -0,0 +1,467 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implememnts the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+var (
+	testHostNqn      = "nqn.2014-08.org.nvmexpress:uuid:feb98abe-d51f-40c8-b348-2753f3571d3c"
+	testOtherHostNqn = "nqn.2014-08.org.nvmexpress:uuid:1b4e28ba-2fa1-11d2-883f-0016d3cca427"
+)
+
+func TestFrontEnd_CreateNvmeNamespaceWithOptions(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		opts       NvmeNamespaceOptions
+		spdk       []string
+		errCode    codes.Code
+		errMsg     string
+		hosts      []string
+		anaGroupID int32
+		resDir     string
+	}{
+		"namespace without auto visibility": {
+			opts:    NvmeNamespaceOptions{NoAutoVisible: true},
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":22}`},
+			errCode: codes.OK,
+			errMsg:  "",
+			hosts:   []string{},
+		},
+		"namespace visible to all hosts in ANA group": {
+			opts:       NvmeNamespaceOptions{AnaGroupID: 3},
+			spdk:       []string{`{"id":%d,"error":{"code":0,"message":""},"result":22}`},
+			errCode:    codes.OK,
+			errMsg:     "",
+			hosts:      nil,
+			anaGroupID: 3,
+		},
+		"namespace with persisted reservations": {
+			opts:    NvmeNamespaceOptions{PersistReservations: true},
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":22}`},
+			errCode: codes.OK,
+			errMsg:  "",
+			hosts:   nil,
+			resDir:  "/var/lib/opi/reservations",
+		},
+		"persisted reservations without reservation directory": {
+			opts:    NvmeNamespaceOptions{PersistReservations: true},
+			spdk:    []string{},
+			errCode: codes.FailedPrecondition,
+			errMsg:  "reservation directory is not configured",
+			hosts:   nil,
+		},
+		"negative ANA group": {
+			opts:    NvmeNamespaceOptions{AnaGroupID: -1, NoAutoVisible: true},
+			spdk:    []string{},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("negative ANA group is not allowed: %d", -1),
+			hosts:   nil,
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.ReservationDir = tt.resDir
+
+			request := &pb.CreateNvmeNamespaceRequest{
+				Parent:          testSubsystemName,
+				NvmeNamespace:   utils.ProtoClone(&testNamespace),
+				NvmeNamespaceId: testNamespaceID,
+			}
+			request.NvmeNamespace.Spec.VolumeNameRef = "Malloc1"
+			_, err := testEnv.opiSpdkServer.CreateNvmeNamespaceWithOptions(testEnv.ctx, request, tt.opts)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+
+			hosts := testEnv.opiSpdkServer.Nvme.namespaceHosts[testNamespaceName]
+			if !reflect.DeepEqual(hosts, tt.hosts) {
+				t.Error("hosts: expected", tt.hosts, "received", hosts)
+			}
+			anaGroupID := testEnv.opiSpdkServer.Nvme.anaGroups[testNamespaceName]
+			if anaGroupID != tt.anaGroupID {
+				t.Error("ANA group: expected", tt.anaGroupID, "received", anaGroupID)
+			}
+		})
+	}
+}
+
+func TestFrontEnd_AddNvmeNamespaceHost(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		in       string
+		host     string
+		masked   bool
+		spdk     []string
+		errCode  codes.Code
+		errMsg   string
+		expHosts []string
+	}{
+		"valid request with valid SPDK response": {
+			in:       testNamespaceName,
+			host:     testHostNqn,
+			masked:   true,
+			spdk:     []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode:  codes.OK,
+			errMsg:   "",
+			expHosts: []string{testOtherHostNqn, testHostNqn},
+		},
+		"already allowed host": {
+			in:       testNamespaceName,
+			host:     testOtherHostNqn,
+			masked:   true,
+			spdk:     []string{},
+			errCode:  codes.OK,
+			errMsg:   "",
+			expHosts: []string{testOtherHostNqn},
+		},
+		"valid request with invalid SPDK response": {
+			in:       testNamespaceName,
+			host:     testHostNqn,
+			masked:   true,
+			spdk:     []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode:  codes.InvalidArgument,
+			errMsg:   fmt.Sprintf("Could not add host %s to NS: %s", testHostNqn, testNamespaceName),
+			expHosts: []string{testOtherHostNqn},
+		},
+		"valid request with error code from SPDK response": {
+			in:       testNamespaceName,
+			host:     testHostNqn,
+			masked:   true,
+			spdk:     []string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":false}`},
+			errCode:  codes.Unknown,
+			errMsg:   fmt.Sprintf("nvmf_ns_add_host: %v", "json response error: Invalid parameters"),
+			expHosts: []string{testOtherHostNqn},
+		},
+		"namespace visible to all hosts": {
+			in:       testNamespaceName,
+			host:     testHostNqn,
+			masked:   false,
+			spdk:     []string{},
+			errCode:  codes.FailedPrecondition,
+			errMsg:   fmt.Sprintf("namespace is visible to all hosts: %s", testNamespaceName),
+			expHosts: nil,
+		},
+		"valid request with unknown key": {
+			in:       "unknown-namespace-id",
+			host:     testHostNqn,
+			masked:   true,
+			spdk:     []string{},
+			errCode:  codes.NotFound,
+			errMsg:   fmt.Sprintf("unable to find key %s", "unknown-namespace-id"),
+			expHosts: []string{testOtherHostNqn},
+		},
+		"no host nqn": {
+			in:       testNamespaceName,
+			host:     "",
+			masked:   true,
+			spdk:     []string{},
+			errCode:  codes.InvalidArgument,
+			errMsg:   "missing required field: host nqn",
+			expHosts: []string{testOtherHostNqn},
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+			if tt.masked {
+				testEnv.opiSpdkServer.Nvme.namespaceHosts[testNamespaceName] = []string{testOtherHostNqn}
+			}
+
+			request := &NvmeNamespaceHostRequest{Name: tt.in, HostNqn: tt.host}
+			_, err := testEnv.opiSpdkServer.AddNvmeNamespaceHost(testEnv.ctx, request)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+
+			hosts := testEnv.opiSpdkServer.Nvme.namespaceHosts[testNamespaceName]
+			if !reflect.DeepEqual(hosts, tt.expHosts) {
+				t.Error("hosts: expected", tt.expHosts, "received", hosts)
+			}
+		})
+	}
+}
+
+func TestFrontEnd_RemoveNvmeNamespaceHost(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		in       string
+		host     string
+		spdk     []string
+		errCode  codes.Code
+		errMsg   string
+		expHosts []string
+	}{
+		"valid request with valid SPDK response": {
+			in:       testNamespaceName,
+			host:     testHostNqn,
+			spdk:     []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode:  codes.OK,
+			errMsg:   "",
+			expHosts: []string{testOtherHostNqn},
+		},
+		"valid request with invalid SPDK response": {
+			in:       testNamespaceName,
+			host:     testHostNqn,
+			spdk:     []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode:  codes.InvalidArgument,
+			errMsg:   fmt.Sprintf("Could not remove host %s from NS: %s", testHostNqn, testNamespaceName),
+			expHosts: []string{testOtherHostNqn, testHostNqn},
+		},
+		"valid request with error code from SPDK response": {
+			in:       testNamespaceName,
+			host:     testHostNqn,
+			spdk:     []string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":false}`},
+			errCode:  codes.Unknown,
+			errMsg:   fmt.Sprintf("nvmf_ns_remove_host: %v", "json response error: Invalid parameters"),
+			expHosts: []string{testOtherHostNqn, testHostNqn},
+		},
+		"not allowed host": {
+			in:       testNamespaceName,
+			host:     "nqn.2014-08.org.nvmexpress:uuid:unknown",
+			spdk:     []string{},
+			errCode:  codes.NotFound,
+			errMsg:   fmt.Sprintf("unable to find host %s for %s", "nqn.2014-08.org.nvmexpress:uuid:unknown", testNamespaceName),
+			expHosts: []string{testOtherHostNqn, testHostNqn},
+		},
+		"valid request with unknown key": {
+			in:       "unknown-namespace-id",
+			host:     testHostNqn,
+			spdk:     []string{},
+			errCode:  codes.NotFound,
+			errMsg:   fmt.Sprintf("unable to find key %s", "unknown-namespace-id"),
+			expHosts: []string{testOtherHostNqn, testHostNqn},
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+			testEnv.opiSpdkServer.Nvme.namespaceHosts[testNamespaceName] = []string{testOtherHostNqn, testHostNqn}
+
+			request := &NvmeNamespaceHostRequest{Name: tt.in, HostNqn: tt.host}
+			_, err := testEnv.opiSpdkServer.RemoveNvmeNamespaceHost(testEnv.ctx, request)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+
+			hosts := testEnv.opiSpdkServer.Nvme.namespaceHosts[testNamespaceName]
+			if !reflect.DeepEqual(hosts, tt.expHosts) {
+				t.Error("hosts: expected", tt.expHosts, "received", hosts)
+			}
+		})
+	}
+}
+
+func TestFrontEnd_GetNvmeNamespaceWithVisibility(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	subsystems := `{"id":%d,"error":{"code":0,"message":""},"result":[{"nqn":"nqn.2022-09.io.spdk:opi3","namespaces":[{"nsid":22,"bdev_name":"Malloc1"}]}]}`
+	namespace := &pb.NvmeNamespace{
+		Name: testNamespaceName,
+		Spec: &pb.NvmeNamespaceSpec{HostNsid: 22},
+		Status: &pb.NvmeNamespaceStatus{
+			State:     pb.NvmeNamespaceStatus_STATE_ENABLED,
+			OperState: pb.NvmeNamespaceStatus_OPER_STATE_ONLINE,
+		},
+	}
+	tests := map[string]struct {
+		in         string
+		masked     bool
+		spdk       []string
+		visibility *NvmeNamespaceVisibility
+		errCode    codes.Code
+		errMsg     string
+	}{
+		"namespace visible to all hosts": {
+			in:         testNamespaceName,
+			masked:     false,
+			spdk:       []string{subsystems},
+			visibility: &NvmeNamespaceVisibility{AllHosts: true},
+			errCode:    codes.OK,
+			errMsg:     "",
+		},
+		"namespace without auto visibility": {
+			in:         testNamespaceName,
+			masked:     true,
+			spdk:       []string{subsystems},
+			visibility: &NvmeNamespaceVisibility{Hosts: []string{testHostNqn}},
+			errCode:    codes.OK,
+			errMsg:     "",
+		},
+		"valid request with unknown key": {
+			in:         "unknown-namespace-id",
+			masked:     true,
+			spdk:       []string{},
+			visibility: nil,
+			errCode:    codes.NotFound,
+			errMsg:     fmt.Sprintf("unable to find key %s", "unknown-namespace-id"),
+		},
+		"no required field": {
+			in:         "",
+			masked:     true,
+			spdk:       []string{},
+			visibility: nil,
+			errCode:    codes.Unknown,
+			errMsg:     "missing required field: name",
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName].Name = testNamespaceName
+			if tt.masked {
+				testEnv.opiSpdkServer.Nvme.namespaceHosts[testNamespaceName] = []string{testHostNqn}
+			}
+
+			request := &pb.GetNvmeNamespaceRequest{Name: tt.in}
+			response, err := testEnv.opiSpdkServer.GetNvmeNamespaceWithVisibility(testEnv.ctx, request)
+
+			if tt.visibility != nil {
+				if !proto.Equal(response.NvmeNamespace.Message, namespace) {
+					t.Error("namespace: expected", namespace, "received", response.NvmeNamespace.Message)
+				}
+				if !reflect.DeepEqual(response.Visibility, tt.visibility) {
+					t.Error("visibility: expected", tt.visibility, "received", response.Visibility)
+				}
+			} else if response != nil {
+				t.Error("response: expected nil, received", response)
+			}
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestFrontEnd_ListNvmeNamespacesWithVisibility(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	maskedNamespaceName := utils.ResourceIDToNamespaceName(testSubsystemID, "masked-namespace")
+	otherNamespaceName := utils.ResourceIDToNamespaceName("other-subsystem", testNamespaceID)
+	subsystems := `{"id":%d,"error":{"code":0,"message":""},"result":[{"nqn":"nqn.2022-09.io.spdk:opi3","namespaces":[` +
+		`{"nsid":22,"bdev_name":"Malloc1"},{"nsid":23,"bdev_name":"Malloc2"},{"nsid":24,"bdev_name":"Malloc3"}]}]}`
+	tests := map[string]struct {
+		in         string
+		spdk       []string
+		names      []string
+		visibility []*NvmeNamespaceVisibility
+		errCode    codes.Code
+		errMsg     string
+	}{
+		"valid request": {
+			in:    testSubsystemName,
+			spdk:  []string{subsystems},
+			names: []string{testNamespaceName, maskedNamespaceName, ""},
+			visibility: []*NvmeNamespaceVisibility{
+				{AllHosts: true},
+				{Hosts: []string{testHostNqn}},
+				nil,
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"unknown subsystem": {
+			in:      utils.ResourceIDToSubsystemName("unknown-subsystem-id"),
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find subsystem %s", utils.ResourceIDToSubsystemName("unknown-subsystem-id")),
+		},
+		"no required field": {
+			in:      "",
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  "missing required field: parent",
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+			testEnv.opiSpdkServer.Nvme.Namespaces[maskedNamespaceName] = utils.ProtoClone(&testNamespace)
+			testEnv.opiSpdkServer.Nvme.Namespaces[maskedNamespaceName].Spec.HostNsid = 23
+			testEnv.opiSpdkServer.Nvme.Namespaces[otherNamespaceName] = utils.ProtoClone(&testNamespace)
+			testEnv.opiSpdkServer.Nvme.namespaceHosts[maskedNamespaceName] = []string{testHostNqn}
+			testEnv.opiSpdkServer.Nvme.namespaceHosts[otherNamespaceName] = []string{testOtherHostNqn}
+
+			request := &pb.ListNvmeNamespacesRequest{Parent: tt.in}
+			response, err := testEnv.opiSpdkServer.ListNvmeNamespacesWithVisibility(testEnv.ctx, request)
+
+			var names []string
+			var visibility []*NvmeNamespaceVisibility
+			if response != nil {
+				for _, item := range response.NvmeNamespaces {
+					names = append(names, item.NvmeNamespace.Message.Name)
+					visibility = append(visibility, item.Visibility)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.names) {
+				t.Error("names: expected", tt.names, "received", names)
+			}
+			if !reflect.DeepEqual(visibility, tt.visibility) {
+				t.Error("visibility: expected", tt.visibility, "received", visibility)
+			}
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
@@ -25,14 +25,72 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+// NvmeNamespaceOptions holds namespace creation options not yet present in opi-api
+type NvmeNamespaceOptions struct {
+	// AnaGroupID is ANA group of the namespace. If 0, SPDK uses NSID as the ANA group.
+	AnaGroupID int32 `json:"anaGroupId,omitempty"`
+	// NoAutoVisible hides the namespace from hosts until they are allowed by
+	// AddNvmeNamespaceHost
+	NoAutoVisible bool `json:"noAutoVisible,omitempty"`
+	// PersistReservations keeps reservations of the namespace through power
+	// loss in a file under Nvme.ReservationDir
+	PersistReservations bool `json:"persistReservations,omitempty"`
+}
+
+// CreateNvmeNamespaceWithOptionsRequest is CreateNvmeNamespaceRequest along
+// with options not yet present in opi-api
+type CreateNvmeNamespaceWithOptionsRequest struct {
+	Request utils.ProtoJSON[*pb.CreateNvmeNamespaceRequest] `json:"request"`
+	Options NvmeNamespaceOptions                            `json:"options"`
+}
+
+type nvmfSubsystemAddNsParams struct {
+	Nqn       string `json:"nqn"`
+	Namespace struct {
+		Nsid          int    `json:"nsid"`
+		BdevName      string `json:"bdev_name"`
+		Anagrpid      int32  `json:"anagrpid,omitempty"`
+		NoAutoVisible bool   `json:"no_auto_visible,omitempty"`
+		PtplFile      string `json:"ptpl_file,omitempty"`
+	} `json:"namespace"`
+}
+
 func sortNvmeNamespaces(namespaces []*pb.NvmeNamespace) {
 	sort.Slice(namespaces, func(i int, j int) bool {
 		return namespaces[i].Spec.HostNsid < namespaces[j].Spec.HostNsid
 	})
 }
 
+// nvmeNamespaceWithSubsystem fetches namespace along with its subsystem
+func (s *Server) nvmeNamespaceWithSubsystem(name string) (*pb.NvmeNamespace, *pb.NvmeSubsystem, error) {
+	// fetch object from the database
+	namespace, ok := s.Nvme.Namespaces[name]
+	if !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", name)
+		return nil, nil, err
+	}
+	subsysName := utils.ResourceIDToSubsystemName(utils.GetSubsystemIDFromNvmeName(name))
+	subsys, ok := s.Nvme.Subsystems[subsysName]
+	if !ok {
+		err := fmt.Errorf("unable to find subsystem %s", subsysName)
+		return nil, nil, err
+	}
+	return namespace, subsys, nil
+}
+
 // CreateNvmeNamespace creates an Nvme namespace
 func (s *Server) CreateNvmeNamespace(ctx context.Context, in *pb.CreateNvmeNamespaceRequest) (*pb.NvmeNamespace, error) {
+	return s.CreateNvmeNamespaceWithOptions(ctx, in, NvmeNamespaceOptions{})
+}
+
+// CreateNvmeNamespaceWithOptions creates an Nvme namespace with options not
+// yet present in opi-api
+func (s *Server) CreateNvmeNamespaceWithOptions(ctx context.Context, in *pb.CreateNvmeNamespaceRequest, opts NvmeNamespaceOptions) (*pb.NvmeNamespace, error) {
+	anaGroupID := opts.AnaGroupID
+	if anaGroupID < 0 {
+		msg := fmt.Sprintf("negative ANA group is not allowed: %d", anaGroupID)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
 	// check input correctness
 	if err := s.validateCreateNvmeNamespaceRequest(in); err != nil {
 		return nil, err
@@ -58,13 +116,22 @@ func (s *Server) CreateNvmeNamespace(ctx context.Context, in *pb.CreateNvmeNames
 		return nil, err
 	}
 
-	params := spdk.NvmfSubsystemAddNsParams{
+	params := nvmfSubsystemAddNsParams{
 		Nqn: subsys.Spec.Nqn,
 	}
 
 	// TODO: using bdev for volume id as a middle end handle for now
 	params.Namespace.Nsid = int(in.NvmeNamespace.Spec.HostNsid)
 	params.Namespace.BdevName = in.NvmeNamespace.Spec.VolumeNameRef
+	params.Namespace.Anagrpid = anaGroupID
+	params.Namespace.NoAutoVisible = opts.NoAutoVisible
+	if opts.PersistReservations {
+		ptplFile, err := s.reservationFile(in.NvmeNamespace.Name)
+		if err != nil {
+			return nil, err
+		}
+		params.Namespace.PtplFile = ptplFile
+	}
 
 	var result spdk.NvmfSubsystemAddNsResult
 	err := s.rpc.Call(ctx, "nvmf_subsystem_add_ns", &params, &result)
@@ -84,6 +151,12 @@ func (s *Server) CreateNvmeNamespace(ctx context.Context, in *pb.CreateNvmeNames
 	}
 	response.Spec.HostNsid = int32(result)
 	s.Nvme.Namespaces[in.NvmeNamespace.Name] = response
+	if anaGroupID != 0 {
+		s.Nvme.anaGroups[in.NvmeNamespace.Name] = anaGroupID
+	}
+	if opts.NoAutoVisible {
+		s.Nvme.namespaceHosts[in.NvmeNamespace.Name] = []string{}
+	}
 	return response, nil
 }
 
@@ -124,6 +197,9 @@ func (s *Server) DeleteNvmeNamespace(ctx context.Context, in *pb.DeleteNvmeNames
 		return nil, status.Errorf(codes.InvalidArgument, msg)
 	}
 	delete(s.Nvme.Namespaces, namespace.Name)
+	delete(s.Nvme.anaGroups, namespace.Name)
+	delete(s.Nvme.namespaceHosts, namespace.Name)
+	s.removeReservationFile(namespace.Name)
 	return &emptypb.Empty{}, nil
 }
 
@@ -0,0 +1,303 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implements the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// TODO: opi-api has no reservation fields in NvmeNamespace, so reservations
+// are managed by NvmeNamespaceOptions.PersistReservations and the methods
+// below served by the HTTP extension API, see ExtensionRoutes, until they
+// are added.
+//
+// Upstream SPDK has no RPCs to get, preempt or clear reservations. The
+// nvmf_ns_get_reservation, nvmf_ns_preempt_reservation and
+// nvmf_ns_clear_reservation RPCs used here are available only in SPDK
+// patched with them and are called only if Nvme.ReservationRPCs is set.
+// Without them reservation state is read from persist through power loss
+// file written by SPDK, and preempt and clear are not available.
+
+// NvmeReservationType is type of Nvme reservation as defined by NVMe spec
+type NvmeReservationType int
+
+// Nvme reservation types
+const (
+	NvmeReservationTypeNone                   NvmeReservationType = 0
+	NvmeReservationTypeWriteExclusive         NvmeReservationType = 1
+	NvmeReservationTypeExclusiveAccess        NvmeReservationType = 2
+	NvmeReservationTypeWriteExclusiveRegOnly  NvmeReservationType = 3
+	NvmeReservationTypeExclusiveAccessRegOnly NvmeReservationType = 4
+	NvmeReservationTypeWriteExclusiveAllRegs  NvmeReservationType = 5
+	NvmeReservationTypeExclusiveAccessAllRegs NvmeReservationType = 6
+	nvmeReservationTypeLast                   NvmeReservationType = NvmeReservationTypeExclusiveAccessAllRegs
+)
+
+// NvmeReservationRegistrant represents host registered for Nvme reservation
+type NvmeReservationRegistrant struct {
+	HostID string `json:"hostId"`
+	Key    uint64 `json:"key"`
+}
+
+// NvmeNamespaceReservation represents reservation state of Nvme namespace
+type NvmeNamespaceReservation struct {
+	// Holder is host ID of the reservation holder, empty if not reserved
+	Holder string `json:"holder,omitempty"`
+	// Type is type of the held reservation
+	Type NvmeReservationType `json:"type"`
+	// Key is current reservation key
+	Key         uint64                      `json:"key"`
+	Registrants []NvmeReservationRegistrant `json:"registrants"`
+}
+
+// PreemptNvmeNamespaceReservationRequest is a request to make registered
+// host the holder of Nvme namespace reservation
+type PreemptNvmeNamespaceReservationRequest struct {
+	// Name is NvmeNamespace name
+	Name   string              `json:"name"`
+	HostID string              `json:"hostId"`
+	Type   NvmeReservationType `json:"type"`
+}
+
+// ClearNvmeNamespaceReservationRequest is a request to release reservation
+// and unregister all hosts of Nvme namespace
+type ClearNvmeNamespaceReservationRequest struct {
+	// Name is NvmeNamespace name
+	Name string `json:"name"`
+}
+
+type nvmfNsReservationParams struct {
+	Nqn  string `json:"nqn"`
+	Nsid int    `json:"nsid"`
+}
+
+type nvmfNsGetReservationResult struct {
+	Rtype        int    `json:"rtype"`
+	Crkey        uint64 `json:"crkey"`
+	HolderHostid string `json:"holder_hostid"`
+	Registrants  []struct {
+		Hostid string `json:"hostid"`
+		Rkey   uint64 `json:"rkey"`
+	} `json:"registrants"`
+}
+
+type nvmfNsPreemptReservationParams struct {
+	nvmfNsReservationParams
+	Hostid string `json:"hostid"`
+	Rtype  int    `json:"rtype"`
+}
+
+type nvmfNsReservationResult bool
+
+// spdkPtplReservationInfo is content of SPDK persist through power loss file
+type spdkPtplReservationInfo struct {
+	Ptpl        bool   `json:"ptpl"`
+	Rtype       int    `json:"rtype"`
+	Crkey       uint64 `json:"crkey"`
+	BdevUUID    string `json:"bdev_uuid"`
+	HolderUUID  string `json:"holder_uuid"`
+	Registrants []struct {
+		Rkey     uint64 `json:"rkey"`
+		HostUUID string `json:"host_uuid"`
+	} `json:"registrants"`
+}
+
+// PrepareReservationDir creates directory to keep reservation files in and
+// checks it is writable, so misconfiguration is found on startup rather
+// than on first namespace creation
+func PrepareReservationDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("cannot create reservation directory: %w", err)
+	}
+	probe, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("reservation directory is not writable: %w", err)
+	}
+	_ = probe.Close()
+	if err := os.Remove(probe.Name()); err != nil {
+		return fmt.Errorf("reservation directory is not writable: %w", err)
+	}
+	return nil
+}
+
+// reservationFile returns path to SPDK persist through power loss file of
+// the namespace. It is derived from the namespace name, so the file is found
+// again after the bridge restarts.
+func (s *Server) reservationFile(name string) (string, error) {
+	if s.Nvme.ReservationDir == "" {
+		return "", status.Error(codes.FailedPrecondition, "reservation directory is not configured")
+	}
+	subsysID := utils.GetSubsystemIDFromNvmeName(name)
+	return filepath.Join(s.Nvme.ReservationDir, subsysID+"_"+path.Base(name)+".json"), nil
+}
+
+func (s *Server) removeReservationFile(name string) {
+	ptplFile, err := s.reservationFile(name)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(ptplFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("error: failed to remove reservation file %v: %v", ptplFile, err)
+	}
+}
+
+// readNvmeNamespaceReservation reads reservation state from persist through
+// power loss file of the namespace. SPDK writes it once a host activates
+// persist through power loss, so missing file means no reservation. It is
+// also missing for namespaces created without persisted reservations.
+func (s *Server) readNvmeNamespaceReservation(name string) (*NvmeNamespaceReservation, error) {
+	if s.Nvme.ReservationDir == "" {
+		msg := fmt.Sprintf("reservation RPCs are not enabled and reservations are not persisted for NS: %s", name)
+		return nil, status.Errorf(codes.FailedPrecondition, msg)
+	}
+	ptplFile, err := s.reservationFile(name)
+	if err != nil {
+		return nil, err
+	}
+	reservation := &NvmeNamespaceReservation{Registrants: []NvmeReservationRegistrant{}}
+	data, err := os.ReadFile(ptplFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return reservation, nil
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot read reservation file %s: %v", ptplFile, err)
+	}
+	var info spdkPtplReservationInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot parse reservation file %s: %v", ptplFile, err)
+	}
+	reservation.Holder = info.HolderUUID
+	reservation.Type = NvmeReservationType(info.Rtype)
+	reservation.Key = info.Crkey
+	for _, registrant := range info.Registrants {
+		reservation.Registrants = append(reservation.Registrants, NvmeReservationRegistrant{
+			HostID: registrant.HostUUID,
+			Key:    registrant.Rkey,
+		})
+	}
+	return reservation, nil
+}
+
+// GetNvmeNamespaceReservation gets reservation state of Nvme namespace
+func (s *Server) GetNvmeNamespaceReservation(ctx context.Context, in *pb.GetNvmeNamespaceRequest) (*NvmeNamespaceReservation, error) {
+	// check input correctness
+	if err := s.validateGetNvmeNamespaceRequest(in); err != nil {
+		return nil, err
+	}
+	namespace, subsys, err := s.nvmeNamespaceWithSubsystem(in.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Nvme.ReservationRPCs {
+		return s.readNvmeNamespaceReservation(in.Name)
+	}
+
+	params := nvmfNsReservationParams{
+		Nqn:  subsys.Spec.Nqn,
+		Nsid: int(namespace.Spec.HostNsid),
+	}
+	var result nvmfNsGetReservationResult
+	err = s.rpc.Call(ctx, "nvmf_ns_get_reservation", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+
+	reservation := &NvmeNamespaceReservation{
+		Holder:      result.HolderHostid,
+		Type:        NvmeReservationType(result.Rtype),
+		Key:         result.Crkey,
+		Registrants: []NvmeReservationRegistrant{},
+	}
+	for _, registrant := range result.Registrants {
+		reservation.Registrants = append(reservation.Registrants, NvmeReservationRegistrant{
+			HostID: registrant.Hostid,
+			Key:    registrant.Rkey,
+		})
+	}
+	return reservation, nil
+}
+
+// PreemptNvmeNamespaceReservation forcibly makes registered host the holder
+// of the reservation of given type, dropping other registrants. Intended for
+// recovery of stuck fencing.
+func (s *Server) PreemptNvmeNamespaceReservation(ctx context.Context, in *PreemptNvmeNamespaceReservationRequest) (*emptypb.Empty, error) {
+	if !s.Nvme.ReservationRPCs {
+		return nil, status.Error(codes.FailedPrecondition, "reservation RPCs are not enabled")
+	}
+	if in.HostID == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing required field: host id")
+	}
+	if in.Type <= NvmeReservationTypeNone || in.Type > nvmeReservationTypeLast {
+		msg := fmt.Sprintf("not supported reservation type: %d", in.Type)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	namespace, subsys, err := s.nvmeNamespaceWithSubsystem(in.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	params := nvmfNsPreemptReservationParams{
+		nvmfNsReservationParams: nvmfNsReservationParams{
+			Nqn:  subsys.Spec.Nqn,
+			Nsid: int(namespace.Spec.HostNsid),
+		},
+		Hostid: in.HostID,
+		Rtype:  int(in.Type),
+	}
+	var result nvmfNsReservationResult
+	err = s.rpc.Call(ctx, "nvmf_ns_preempt_reservation", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not preempt reservation for NS: %s", in.Name)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ClearNvmeNamespaceReservation forcibly releases the reservation and
+// unregisters all hosts of Nvme namespace
+func (s *Server) ClearNvmeNamespaceReservation(ctx context.Context, in *ClearNvmeNamespaceReservationRequest) (*emptypb.Empty, error) {
+	if !s.Nvme.ReservationRPCs {
+		return nil, status.Error(codes.FailedPrecondition, "reservation RPCs are not enabled")
+	}
+	namespace, subsys, err := s.nvmeNamespaceWithSubsystem(in.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	params := nvmfNsReservationParams{
+		Nqn:  subsys.Spec.Nqn,
+		Nsid: int(namespace.Spec.HostNsid),
+	}
+	var result nvmfNsReservationResult
+	err = s.rpc.Call(ctx, "nvmf_ns_clear_reservation", &params, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not clear reservation for NS: %s", in.Name)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	return &emptypb.Empty{}, nil
+}
@@ -0,0 +1,446 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implememnts the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+var (
+	testHostID      = "feb98abe-d51f-40c8-b348-2753f3571d3c"
+	testOtherHostID = "1b4e28ba-2fa1-11d2-883f-0016d3cca427"
+)
+
+func TestFrontEnd_GetNvmeNamespaceReservation(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		in      string
+		out     *NvmeNamespaceReservation
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid request with valid SPDK response": {
+			testNamespaceName,
+			&NvmeNamespaceReservation{
+				Holder: testHostID,
+				Type:   NvmeReservationTypeWriteExclusiveRegOnly,
+				Key:    0xa1,
+				Registrants: []NvmeReservationRegistrant{
+					{HostID: testHostID, Key: 0xa1},
+					{HostID: testOtherHostID, Key: 0xb2},
+				},
+			},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":{"rtype":3,"crkey":161,"holder_hostid":"` + testHostID + `",` +
+				`"registrants":[{"hostid":"` + testHostID + `","rkey":161},{"hostid":"` + testOtherHostID + `","rkey":178}]}}`},
+			codes.OK,
+			"",
+		},
+		"not reserved namespace": {
+			testNamespaceName,
+			&NvmeNamespaceReservation{
+				Type:        NvmeReservationTypeNone,
+				Registrants: []NvmeReservationRegistrant{},
+			},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":{"rtype":0,"crkey":0,"holder_hostid":"","registrants":[]}}`},
+			codes.OK,
+			"",
+		},
+		"valid request with error code from SPDK response": {
+			testNamespaceName,
+			nil,
+			[]string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":{}}`},
+			codes.Unknown,
+			fmt.Sprintf("nvmf_ns_get_reservation: %v", "json response error: Invalid parameters"),
+		},
+		"valid request with unknown key": {
+			"unknown-namespace-id",
+			nil,
+			[]string{},
+			codes.NotFound,
+			fmt.Sprintf("unable to find key %s", "unknown-namespace-id"),
+		},
+		"no required field": {
+			"",
+			nil,
+			[]string{},
+			codes.Unknown,
+			"missing required field: name",
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+			testEnv.opiSpdkServer.Nvme.ReservationRPCs = true
+
+			request := &pb.GetNvmeNamespaceRequest{Name: tt.in}
+			response, err := testEnv.opiSpdkServer.GetNvmeNamespaceReservation(testEnv.ctx, request)
+
+			if !reflect.DeepEqual(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestFrontEnd_GetNvmeNamespaceReservationFromFile(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		persisted bool
+		content   string
+		out       *NvmeNamespaceReservation
+		errCode   codes.Code
+		errMsg    string
+	}{
+		"reservation in file": {
+			persisted: true,
+			content: `{"ptpl":true,"rtype":3,"crkey":161,"bdev_uuid":"0eaf8f5d-7a2c-4e25-a0a3-2f6a4a0b3e2d","holder_uuid":"` + testHostID + `",` +
+				`"registrants":[{"rkey":161,"host_uuid":"` + testHostID + `"},{"rkey":178,"host_uuid":"` + testOtherHostID + `"}]}`,
+			out: &NvmeNamespaceReservation{
+				Holder: testHostID,
+				Type:   NvmeReservationTypeWriteExclusiveRegOnly,
+				Key:    0xa1,
+				Registrants: []NvmeReservationRegistrant{
+					{HostID: testHostID, Key: 0xa1},
+					{HostID: testOtherHostID, Key: 0xb2},
+				},
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"no file written by SPDK yet": {
+			persisted: true,
+			content:   "",
+			out:       &NvmeNamespaceReservation{Registrants: []NvmeReservationRegistrant{}},
+			errCode:   codes.OK,
+			errMsg:    "",
+		},
+		"reservations are not persisted": {
+			persisted: false,
+			out:       nil,
+			errCode:   codes.FailedPrecondition,
+			errMsg:    fmt.Sprintf("reservation RPCs are not enabled and reservations are not persisted for NS: %s", testNamespaceName),
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment([]string{})
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+			ptplFile := filepath.Join(t.TempDir(), testSubsystemID+"_"+testNamespaceID+".json")
+			if tt.persisted {
+				testEnv.opiSpdkServer.Nvme.ReservationDir = filepath.Dir(ptplFile)
+			}
+			if tt.content != "" {
+				if err := os.WriteFile(ptplFile, []byte(tt.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			request := &pb.GetNvmeNamespaceRequest{Name: testNamespaceName}
+			response, err := testEnv.opiSpdkServer.GetNvmeNamespaceReservation(testEnv.ctx, request)
+
+			if !reflect.DeepEqual(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestFrontEnd_GetNvmeNamespaceReservationAfterRestart(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	resDir := t.TempDir()
+	testEnv := createTestEnvironment([]string{`{"id":%d,"error":{"code":0,"message":""},"result":22}`})
+	testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+	testEnv.opiSpdkServer.Nvme.ReservationDir = resDir
+	request := &pb.CreateNvmeNamespaceRequest{
+		Parent:          testSubsystemName,
+		NvmeNamespace:   utils.ProtoClone(&testNamespace),
+		NvmeNamespaceId: testNamespaceID,
+	}
+	request.NvmeNamespace.Spec.VolumeNameRef = "Malloc1"
+	namespace, err := testEnv.opiSpdkServer.CreateNvmeNamespaceWithOptions(testEnv.ctx, request,
+		NvmeNamespaceOptions{PersistReservations: true})
+	testEnv.Close()
+	if err != nil {
+		t.Fatal("expected namespace to be created, received", err)
+	}
+	// file written by SPDK once a host activates persist through power loss
+	ptplFile := filepath.Join(resDir, testSubsystemID+"_"+testNamespaceID+".json")
+	content := `{"ptpl":true,"rtype":1,"crkey":161,"holder_uuid":"` + testHostID + `",` +
+		`"registrants":[{"rkey":161,"host_uuid":"` + testHostID + `"}]}`
+	if err := os.WriteFile(ptplFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := createTestEnvironment([]string{})
+	defer restarted.Close()
+	restarted.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+	restarted.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = namespace
+	restarted.opiSpdkServer.Nvme.ReservationDir = resDir
+
+	response, err := restarted.opiSpdkServer.GetNvmeNamespaceReservation(restarted.ctx,
+		&pb.GetNvmeNamespaceRequest{Name: testNamespaceName})
+	if err != nil {
+		t.Fatal("expected reservation after restart, received", err)
+	}
+	expected := &NvmeNamespaceReservation{
+		Holder:      testHostID,
+		Type:        NvmeReservationTypeWriteExclusive,
+		Key:         0xa1,
+		Registrants: []NvmeReservationRegistrant{{HostID: testHostID, Key: 0xa1}},
+	}
+	if !reflect.DeepEqual(response, expected) {
+		t.Error("response: expected", expected, "received", response)
+	}
+}
+
+func TestFrontEnd_NvmeNamespaceReservationRPCsNotEnabled(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	testEnv := createTestEnvironment([]string{})
+	defer testEnv.Close()
+	testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+	testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+
+	preempt := &PreemptNvmeNamespaceReservationRequest{
+		Name:   testNamespaceName,
+		HostID: testOtherHostID,
+		Type:   NvmeReservationTypeExclusiveAccess,
+	}
+	_, preemptErr := testEnv.opiSpdkServer.PreemptNvmeNamespaceReservation(testEnv.ctx, preempt)
+	clear := &ClearNvmeNamespaceReservationRequest{Name: testNamespaceName}
+	_, clearErr := testEnv.opiSpdkServer.ClearNvmeNamespaceReservation(testEnv.ctx, clear)
+
+	for _, err := range []error{preemptErr, clearErr} {
+		er := status.Convert(err)
+		if er.Code() != codes.FailedPrecondition || er.Message() != "reservation RPCs are not enabled" {
+			t.Error("expected reservation RPCs are not enabled error, received", err)
+		}
+	}
+}
+
+func TestFrontEnd_PrepareReservationDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "reservations")
+	if err := PrepareReservationDir(dir); err != nil {
+		t.Fatal("expected no error, received", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Error("expected reservation directory to be created, received", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte{}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := PrepareReservationDir(file); err == nil {
+		t.Error("expected error for file in place of reservation directory")
+	}
+}
+
+func TestFrontEnd_PreemptNvmeNamespaceReservation(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		in      string
+		hostID  string
+		rtype   NvmeReservationType
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid request with valid SPDK response": {
+			testNamespaceName,
+			testOtherHostID,
+			NvmeReservationTypeExclusiveAccess,
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			codes.OK,
+			"",
+		},
+		"valid request with invalid SPDK response": {
+			testNamespaceName,
+			testOtherHostID,
+			NvmeReservationTypeExclusiveAccess,
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			codes.InvalidArgument,
+			fmt.Sprintf("Could not preempt reservation for NS: %s", testNamespaceName),
+		},
+		"valid request with error code from SPDK response": {
+			testNamespaceName,
+			testOtherHostID,
+			NvmeReservationTypeExclusiveAccess,
+			[]string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":false}`},
+			codes.Unknown,
+			fmt.Sprintf("nvmf_ns_preempt_reservation: %v", "json response error: Invalid parameters"),
+		},
+		"no reservation type": {
+			testNamespaceName,
+			testOtherHostID,
+			NvmeReservationTypeNone,
+			[]string{},
+			codes.InvalidArgument,
+			fmt.Sprintf("not supported reservation type: %d", NvmeReservationTypeNone),
+		},
+		"not supported reservation type": {
+			testNamespaceName,
+			testOtherHostID,
+			NvmeReservationType(7),
+			[]string{},
+			codes.InvalidArgument,
+			fmt.Sprintf("not supported reservation type: %d", 7),
+		},
+		"no host id": {
+			testNamespaceName,
+			"",
+			NvmeReservationTypeExclusiveAccess,
+			[]string{},
+			codes.InvalidArgument,
+			"missing required field: host id",
+		},
+		"valid request with unknown key": {
+			"unknown-namespace-id",
+			testOtherHostID,
+			NvmeReservationTypeExclusiveAccess,
+			[]string{},
+			codes.NotFound,
+			fmt.Sprintf("unable to find key %s", "unknown-namespace-id"),
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+			testEnv.opiSpdkServer.Nvme.ReservationRPCs = true
+
+			request := &PreemptNvmeNamespaceReservationRequest{Name: tt.in, HostID: tt.hostID, Type: tt.rtype}
+			_, err := testEnv.opiSpdkServer.PreemptNvmeNamespaceReservation(testEnv.ctx, request)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestFrontEnd_ClearNvmeNamespaceReservation(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		in      string
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid request with valid SPDK response": {
+			testNamespaceName,
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			codes.OK,
+			"",
+		},
+		"valid request with invalid SPDK response": {
+			testNamespaceName,
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			codes.InvalidArgument,
+			fmt.Sprintf("Could not clear reservation for NS: %s", testNamespaceName),
+		},
+		"valid request with error code from SPDK response": {
+			testNamespaceName,
+			[]string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":false}`},
+			codes.Unknown,
+			fmt.Sprintf("nvmf_ns_clear_reservation: %v", "json response error: Invalid parameters"),
+		},
+		"valid request with unknown key": {
+			"unknown-namespace-id",
+			[]string{},
+			codes.NotFound,
+			fmt.Sprintf("unable to find key %s", "unknown-namespace-id"),
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+			testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+			testEnv.opiSpdkServer.Nvme.ReservationRPCs = true
+
+			request := &ClearNvmeNamespaceReservationRequest{Name: tt.in}
+			_, err := testEnv.opiSpdkServer.ClearNvmeNamespaceReservation(testEnv.ctx, request)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestFrontEnd_DeleteNvmeNamespaceRemovesReservationFile(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	testEnv := createTestEnvironment([]string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`})
+	defer testEnv.Close()
+	testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+	testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName] = utils.ProtoClone(&testNamespace)
+	testEnv.opiSpdkServer.Nvme.Namespaces[testNamespaceName].Name = testNamespaceName
+	testEnv.opiSpdkServer.Nvme.ReservationDir = t.TempDir()
+	ptplFile := filepath.Join(testEnv.opiSpdkServer.Nvme.ReservationDir, testSubsystemID+"_"+testNamespaceID+".json")
+	if err := os.WriteFile(ptplFile, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	request := &pb.DeleteNvmeNamespaceRequest{Name: testNamespaceName}
+	_, err := testEnv.client.DeleteNvmeNamespace(testEnv.ctx, request)
+	if err != nil {
+		t.Fatal("expected no error, received", err)
+	}
+
+	if _, err := os.Stat(ptplFile); !os.IsNotExist(err) {
+		t.Error("expected reservation file to be removed, received", err)
+	}
+}
@@ -7,10 +7,12 @@ package frontend
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path"
+	"reflect"
 	"sort"
 
 	"github.com/opiproject/gospdk/spdk"
@@ -26,6 +28,94 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+type nvmfSubsystemAddHostParams struct {
+	spdk.NvmfSubsystemAddHostParams
+	DhchapKey      string `json:"dhchap_key,omitempty"`
+	DhchapCtrlrKey string `json:"dhchap_ctrlr_key,omitempty"`
+}
+
+type frameworkGetConfigParams struct {
+	Name string `json:"name"`
+}
+
+type frameworkGetConfigResult struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type nvmfSetConfigDhchapParams struct {
+	DhchapDigests  []string `json:"dhchap_digests,omitempty"`
+	DhchapDhgroups []string `json:"dhchap_dhgroups,omitempty"`
+}
+
+type nvmfSetConfigResult bool
+
+// ensureNvmfDhchapConfig sets DH-HMAC-CHAP digests and DH groups offered to
+// hosts by SPDK nvmf target unless it already has them. SPDK accepts
+// nvmf_set_config only before its subsystems are initialized, i.e. when
+// started with --wait-for-rpc, otherwise they have to be set by SPDK JSON
+// configuration.
+func (s *Server) ensureNvmfDhchapConfig(ctx context.Context) error {
+	if s.Nvme.dhchapConfigured {
+		return nil
+	}
+	want := nvmfSetConfigDhchapParams{
+		DhchapDigests:  s.Nvme.DhchapDigests,
+		DhchapDhgroups: s.Nvme.DhchapDhGroups,
+	}
+	if len(want.DhchapDigests) == 0 && len(want.DhchapDhgroups) == 0 {
+		s.Nvme.dhchapConfigured = true
+		return nil
+	}
+	var config []frameworkGetConfigResult
+	err := s.rpc.Call(ctx, "framework_get_config", &frameworkGetConfigParams{Name: "nvmf"}, &config)
+	if err != nil {
+		return err
+	}
+	log.Printf("Received from SPDK: %v", config)
+	for _, method := range config {
+		if method.Method != "nvmf_set_config" {
+			continue
+		}
+		var current nvmfSetConfigDhchapParams
+		if err := json.Unmarshal(method.Params, &current); err != nil {
+			return err
+		}
+		if (len(want.DhchapDigests) == 0 || reflect.DeepEqual(current.DhchapDigests, want.DhchapDigests)) &&
+			(len(want.DhchapDhgroups) == 0 || reflect.DeepEqual(current.DhchapDhgroups, want.DhchapDhgroups)) {
+			s.Nvme.dhchapConfigured = true
+			return nil
+		}
+	}
+
+	var result nvmfSetConfigResult
+	err = s.rpc.Call(ctx, "nvmf_set_config", &want, &result)
+	if err != nil {
+		msg := fmt.Sprintf("Could not set DH-HMAC-CHAP digests and DH groups, "+
+			"SPDK has to be started with --wait-for-rpc or configured with them: %v", err)
+		return status.Errorf(codes.FailedPrecondition, msg)
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		return status.Error(codes.InvalidArgument, "Could not set DH-HMAC-CHAP digests and DH groups")
+	}
+	s.Nvme.dhchapConfigured = true
+	return nil
+}
+
+// removeDhchapKeys removes DH-HMAC-CHAP secrets of subsystem host from SPDK keyring
+func (s *Server) removeDhchapKeys(ctx context.Context, name string) {
+	keys, ok := s.Nvme.dhchapKeys[name]
+	if !ok {
+		return
+	}
+	if err := utils.RemoveDhchapKeys(ctx, s.rpc, keys); err != nil {
+		log.Printf("error: failed to remove DH-HMAC-CHAP keys of %v: %v", name, err)
+		return
+	}
+	delete(s.Nvme.dhchapKeys, name)
+}
+
 func sortNvmeSubsystems(subsystems []*pb.NvmeSubsystem) {
 	sort.Slice(subsystems, func(i int, j int) bool {
 		return subsystems[i].Spec.Nqn < subsystems[j].Spec.Nqn
@@ -34,10 +124,33 @@ func sortNvmeSubsystems(subsystems []*pb.NvmeSubsystem) {
 
 // CreateNvmeSubsystem creates an Nvme Subsystem
 func (s *Server) CreateNvmeSubsystem(ctx context.Context, in *pb.CreateNvmeSubsystemRequest) (*pb.NvmeSubsystem, error) {
+	return s.CreateNvmeSubsystemWithDhchap(ctx, in, nil)
+}
+
+// CreateNvmeSubsystemWithDhchapRequest is CreateNvmeSubsystemRequest with
+// DH-HMAC-CHAP secrets of its host
+type CreateNvmeSubsystemWithDhchapRequest struct {
+	Request utils.ProtoJSON[*pb.CreateNvmeSubsystemRequest] `json:"request"`
+	Dhchap  *utils.DhchapConfig                             `json:"dhchap"`
+}
+
+// CreateNvmeSubsystemWithDhchap creates an Nvme Subsystem requiring its host
+// to pass DH-HMAC-CHAP authentication. Digests and DH groups offered to hosts
+// are set by Nvme.DhchapDigests and Nvme.DhchapDhGroups for all subsystems.
+// TODO: move DH-HMAC-CHAP secrets into NvmeSubsystemSpec once opi-api has them
+func (s *Server) CreateNvmeSubsystemWithDhchap(ctx context.Context, in *pb.CreateNvmeSubsystemRequest, dhchap *utils.DhchapConfig) (*pb.NvmeSubsystem, error) {
 	// check input correctness
 	if err := s.validateCreateNvmeSubsystemRequest(in); err != nil {
 		return nil, err
 	}
+	if dhchap != nil {
+		if in.NvmeSubsystem.Spec.Hostnqn == "" {
+			return nil, status.Error(codes.InvalidArgument, "DH-HMAC-CHAP requires hostnqn")
+		}
+		if err := dhchap.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	// see https://google.aip.dev/133#user-specified-ids
 	resourceID := resourceid.NewSystemGenerated()
 	if in.NvmeSubsystemId != "" {
@@ -58,13 +171,21 @@ func (s *Server) CreateNvmeSubsystem(ctx context.Context, in *pb.CreateNvmeSubsy
 			return nil, status.Errorf(codes.AlreadyExists, msg)
 		}
 	}
+	if dhchap != nil {
+		if err := s.ensureNvmfDhchapConfig(ctx); err != nil {
+			return nil, err
+		}
+	}
 	// not found, so create a new one
-	params := spdk.NvmfCreateSubsystemParams{
-		Nqn:           in.NvmeSubsystem.Spec.Nqn,
-		SerialNumber:  in.NvmeSubsystem.Spec.SerialNumber,
-		ModelNumber:   in.NvmeSubsystem.Spec.ModelNumber,
-		AllowAnyHost:  (in.NvmeSubsystem.Spec.Hostnqn == ""),
-		MaxNamespaces: int(in.NvmeSubsystem.Spec.MaxNamespaces),
+	params := nvmfCreateSubsystemParams{
+		NvmfCreateSubsystemParams: spdk.NvmfCreateSubsystemParams{
+			Nqn:           in.NvmeSubsystem.Spec.Nqn,
+			SerialNumber:  in.NvmeSubsystem.Spec.SerialNumber,
+			ModelNumber:   in.NvmeSubsystem.Spec.ModelNumber,
+			AllowAnyHost:  (in.NvmeSubsystem.Spec.Hostnqn == ""),
+			MaxNamespaces: int(in.NvmeSubsystem.Spec.MaxNamespaces),
+		},
+		AnaReporting: s.Nvme.AnaReporting,
 	}
 	var result spdk.NvmfCreateSubsystemResult
 	err := s.rpc.Call(ctx, "nvmf_create_subsystem", &params, &result)
@@ -92,21 +213,36 @@ func (s *Server) CreateNvmeSubsystem(ctx context.Context, in *pb.CreateNvmeSubsy
 
 			psk = keyFile
 		}
-		params := spdk.NvmfSubsystemAddHostParams{
-			Nqn:  in.NvmeSubsystem.Spec.Nqn,
-			Host: in.NvmeSubsystem.Spec.Hostnqn,
-			Psk:  psk,
+		params := nvmfSubsystemAddHostParams{
+			NvmfSubsystemAddHostParams: spdk.NvmfSubsystemAddHostParams{
+				Nqn:  in.NvmeSubsystem.Spec.Nqn,
+				Host: in.NvmeSubsystem.Spec.Hostnqn,
+				Psk:  psk,
+			},
+		}
+		if dhchap != nil {
+			log.Printf("Notice, DH-HMAC-CHAP is used for subsystem %v", in.NvmeSubsystem.Name)
+			keys, err := utils.AddDhchapKeys(ctx, s.rpc, utils.DhchapSubsystemKeyPrefix+resourceID, dhchap, s.keyToTemporaryFile)
+			if err != nil {
+				return nil, err
+			}
+			params.DhchapKey = keys.HostKey
+			params.DhchapCtrlrKey = keys.CtrlrKey
+			s.Nvme.dhchapKeys[in.NvmeSubsystem.Name] = keys
 		}
 		var result spdk.NvmfSubsystemAddHostResult
 		err = s.rpc.Call(ctx, "nvmf_subsystem_add_host", &params, &result)
+		if err == nil {
+			log.Printf("Received from SPDK: %v", result)
+			if !result {
+				msg := fmt.Sprintf("Could not add Hostnqn %s to NQN: %s", in.NvmeSubsystem.Spec.Hostnqn, in.NvmeSubsystem.Spec.Nqn)
+				err = status.Errorf(codes.InvalidArgument, msg)
+			}
+		}
 		if err != nil {
+			s.removeDhchapKeys(ctx, in.NvmeSubsystem.Name)
 			return nil, err
 		}
-		log.Printf("Received from SPDK: %v", result)
-		if !result {
-			msg := fmt.Sprintf("Could not add Hostnqn %s to NQN: %s", in.NvmeSubsystem.Spec.Hostnqn, in.NvmeSubsystem.Spec.Nqn)
-			return nil, status.Errorf(codes.InvalidArgument, msg)
-		}
 	}
 	// get SPDK version
 	var ver spdk.GetVersionResult
@@ -149,6 +285,7 @@ func (s *Server) DeleteNvmeSubsystem(ctx context.Context, in *pb.DeleteNvmeSubsy
 		msg := fmt.Sprintf("Could not delete NQN: %s", subsys.Spec.Nqn)
 		return nil, status.Errorf(codes.InvalidArgument, msg)
 	}
+	s.removeDhchapKeys(ctx, subsys.Name)
 	delete(s.Nvme.Subsystems, subsys.Name)
 	return &emptypb.Empty{}, nil
 }
@@ -902,3 +902,251 @@ func TestFrontEnd_StatsNvmeSubsystem(t *testing.T) {
 		})
 	}
 }
+
+func TestFrontEnd_CreateNvmeSubsystemWithDhchap(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	hostKey := []byte("DHHC-1:00:ia6zGodOr7SGyzRyCq9CqR9pq4W8a8tISgFqvvhv4Bs6hyMl:")
+	ctrlrKey := []byte("DHHC-1:03:MjE4ZTAzNmRlNmZlNDBmNzc0YzY0ZjQ5ZTMyZGM4ODdmMTNjZjdkMWU4OWE0ZDlhOWJmMmZkYmQ4YzY1YjJhN7Xnbw4=:")
+	spdkVersion := `{"jsonrpc":"2.0","id":%d,"result":{"version":"SPDK v20.10","fields":{"major":20,"minor":10,"patch":0,"suffix":""}}}`
+	tests := map[string]struct {
+		hostnqn  string
+		dhchap   *utils.DhchapConfig
+		spdk     []string
+		errCode  codes.Code
+		errMsg   string
+		hostKey  string
+		ctrlrKey string
+	}{
+		"unidirectional authentication": {
+			hostnqn: "nqn.2014-08.org.nvmexpress:uuid:feb98abe-d51f-40c8-b348-2753f3571d3c",
+			dhchap:  &utils.DhchapConfig{HostKey: hostKey},
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				spdkVersion,
+			},
+			errCode:  codes.OK,
+			errMsg:   "",
+			hostKey:  "subsys-" + testSubsystemID + "-dhchap-host",
+			ctrlrKey: "",
+		},
+		"bidirectional authentication": {
+			hostnqn: "nqn.2014-08.org.nvmexpress:uuid:feb98abe-d51f-40c8-b348-2753f3571d3c",
+			dhchap:  &utils.DhchapConfig{HostKey: hostKey, CtrlrKey: ctrlrKey},
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				spdkVersion,
+			},
+			errCode:  codes.OK,
+			errMsg:   "",
+			hostKey:  "subsys-" + testSubsystemID + "-dhchap-host",
+			ctrlrKey: "subsys-" + testSubsystemID + "-dhchap-ctrlr",
+		},
+		"host rejected removes keys": {
+			hostnqn: "nqn.2014-08.org.nvmexpress:uuid:feb98abe-d51f-40c8-b348-2753f3571d3c",
+			dhchap:  &utils.DhchapConfig{HostKey: hostKey},
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":false}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+			},
+			errCode: codes.InvalidArgument,
+			errMsg: fmt.Sprintf("Could not add Hostnqn %s to NQN: %s",
+				"nqn.2014-08.org.nvmexpress:uuid:feb98abe-d51f-40c8-b348-2753f3571d3c", testSubsystem.Spec.Nqn),
+		},
+		"no hostnqn": {
+			hostnqn: "",
+			dhchap:  &utils.DhchapConfig{HostKey: hostKey},
+			spdk:    []string{},
+			errCode: codes.InvalidArgument,
+			errMsg:  "DH-HMAC-CHAP requires hostnqn",
+		},
+		"not DHHC-1 secret": {
+			hostnqn: "nqn.2014-08.org.nvmexpress:uuid:feb98abe-d51f-40c8-b348-2753f3571d3c",
+			dhchap:  &utils.DhchapConfig{HostKey: hostKey, CtrlrKey: []byte("secret")},
+			spdk:    []string{},
+			errCode: codes.InvalidArgument,
+			errMsg:  "DH-HMAC-CHAP secret has to be in DHHC-1 format",
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			keyFiles := []string{}
+			origWriteKey := testEnv.opiSpdkServer.keyToTemporaryFile
+			testEnv.opiSpdkServer.keyToTemporaryFile = func(key []byte) (string, error) {
+				file, err := origWriteKey(key)
+				keyFiles = append(keyFiles, file)
+				return file, err
+			}
+
+			request := &pb.CreateNvmeSubsystemRequest{
+				NvmeSubsystem:   utils.ProtoClone(&testSubsystem),
+				NvmeSubsystemId: testSubsystemID,
+			}
+			request.NvmeSubsystem.Spec.Hostnqn = tt.hostnqn
+			_, err := testEnv.opiSpdkServer.CreateNvmeSubsystemWithDhchap(testEnv.ctx, request, tt.dhchap)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+
+			keys, ok := testEnv.opiSpdkServer.Nvme.dhchapKeys[testSubsystemName]
+			if ok != (tt.hostKey != "") {
+				t.Fatal("expected keys to be stored:", tt.hostKey != "", "received", ok)
+			}
+			if ok && (keys.HostKey != tt.hostKey || keys.CtrlrKey != tt.ctrlrKey) {
+				t.Error("keys: expected", tt.hostKey, tt.ctrlrKey, "received", keys.HostKey, keys.CtrlrKey)
+			}
+			for _, keyFile := range keyFiles {
+				_, err := os.Stat(keyFile)
+				if exists := err == nil; exists != ok {
+					t.Error("expected key file", keyFile, "to exist:", ok, "received", exists)
+				}
+				_ = os.Remove(keyFile)
+			}
+		})
+	}
+}
+
+func TestFrontEnd_ensureNvmfDhchapConfig(t *testing.T) {
+	nvmfConfig := `{"id":%d,"error":{"code":0,"message":""},"result":[{"method":"nvmf_set_config",` +
+		`"params":{"dhchap_digests":["sha384","sha512"],"dhchap_dhgroups":["ffdhe2048"]}}]}`
+	tests := map[string]struct {
+		digests    []string
+		dhgroups   []string
+		spdk       []string
+		errCode    codes.Code
+		errMsg     string
+		configured bool
+	}{
+		"SPDK defaults": {
+			spdk:       []string{},
+			errCode:    codes.OK,
+			errMsg:     "",
+			configured: true,
+		},
+		"already configured": {
+			digests:    []string{"sha384", "sha512"},
+			dhgroups:   []string{"ffdhe2048"},
+			spdk:       []string{nvmfConfig},
+			errCode:    codes.OK,
+			errMsg:     "",
+			configured: true,
+		},
+		"set config": {
+			digests:  []string{"sha512"},
+			dhgroups: []string{"ffdhe2048"},
+			spdk: []string{
+				nvmfConfig,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+			},
+			errCode:    codes.OK,
+			errMsg:     "",
+			configured: true,
+		},
+		"set config rejected by initialized SPDK": {
+			digests: []string{"sha512"},
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":-1,"message":"some internal error"},"result":false}`,
+			},
+			errCode: codes.FailedPrecondition,
+			errMsg: "Could not set DH-HMAC-CHAP digests and DH groups, " +
+				"SPDK has to be started with --wait-for-rpc or configured with them: " +
+				"nvmf_set_config: json response error: some internal error",
+			configured: false,
+		},
+		"set config returned false": {
+			dhgroups: []string{"ffdhe2048"},
+			spdk: []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":false}`,
+			},
+			errCode:    codes.InvalidArgument,
+			errMsg:     "Could not set DH-HMAC-CHAP digests and DH groups",
+			configured: false,
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			testEnv.opiSpdkServer.Nvme.DhchapDigests = tt.digests
+			testEnv.opiSpdkServer.Nvme.DhchapDhGroups = tt.dhgroups
+
+			err := testEnv.opiSpdkServer.ensureNvmfDhchapConfig(testEnv.ctx)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+			if testEnv.opiSpdkServer.Nvme.dhchapConfigured != tt.configured {
+				t.Error("configured: expected", tt.configured, "received", testEnv.opiSpdkServer.Nvme.dhchapConfigured)
+			}
+		})
+	}
+}
+
+func TestFrontEnd_DeleteNvmeSubsystemWithDhchap(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	testEnv := createTestEnvironment([]string{
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+		`{"jsonrpc":"2.0","id":%d,"result":{"version":"SPDK v20.10","fields":{"major":20,"minor":10,"patch":0,"suffix":""}}}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+	})
+	defer testEnv.Close()
+
+	keyFiles := []string{}
+	origWriteKey := testEnv.opiSpdkServer.keyToTemporaryFile
+	testEnv.opiSpdkServer.keyToTemporaryFile = func(key []byte) (string, error) {
+		file, err := origWriteKey(key)
+		keyFiles = append(keyFiles, file)
+		return file, err
+	}
+
+	createRequest := &pb.CreateNvmeSubsystemRequest{
+		NvmeSubsystem:   utils.ProtoClone(&testSubsystem),
+		NvmeSubsystemId: testSubsystemID,
+	}
+	createRequest.NvmeSubsystem.Spec.Hostnqn = "nqn.2014-08.org.nvmexpress:uuid:feb98abe-d51f-40c8-b348-2753f3571d3c"
+	dhchap := &utils.DhchapConfig{HostKey: []byte("DHHC-1:00:ia6zGodOr7SGyzRyCq9CqR9pq4W8a8tISgFqvvhv4Bs6hyMl:")}
+	if _, err := testEnv.opiSpdkServer.CreateNvmeSubsystemWithDhchap(testEnv.ctx, createRequest, dhchap); err != nil {
+		t.Fatal("expected no error on create, received", err)
+	}
+
+	deleteRequest := &pb.DeleteNvmeSubsystemRequest{Name: testSubsystemName}
+	if _, err := testEnv.client.DeleteNvmeSubsystem(testEnv.ctx, deleteRequest); err != nil {
+		t.Fatal("expected no error on delete, received", err)
+	}
+
+	if _, ok := testEnv.opiSpdkServer.Nvme.dhchapKeys[testSubsystemName]; ok {
+		t.Error("expected keys to be removed")
+	}
+	for _, keyFile := range keyFiles {
+		if _, err := os.Stat(keyFile); !errors.Is(err, os.ErrNotExist) {
+			t.Error("expected key file", keyFile, "to be removed")
+		}
+	}
+}
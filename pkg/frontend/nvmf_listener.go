@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implements the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/opiproject/gospdk/spdk"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// nvmfListener is SPDK subsystem listener shared by Nvme controllers with
+// the same fabrics address
+type nvmfListener struct {
+	address       string
+	adrfam        string
+	secureChannel bool
+	// refs is number of Nvme controllers using the listener
+	refs int
+	// existing is set for listener found in SPDK instead of created by the
+	// bridge, e.g. before restart. Its other users are unknown, so it is
+	// never removed from SPDK.
+	existing bool
+}
+
+// nvmfListeners tracks SPDK subsystem listeners by subsystem NQN and address
+type nvmfListeners map[string]*nvmfListener
+
+func nvmfListenerKey(params *spdk.NvmfSubsystemAddListenerParams) string {
+	return params.Nqn + "/" + nvmfListenerAddress(params)
+}
+
+func nvmfListenerAddress(params *spdk.NvmfSubsystemAddListenerParams) string {
+	return net.JoinHostPort(params.ListenAddress.Traddr, params.ListenAddress.Trsvcid)
+}
+
+// acquire registers one more user of the listener. It returns true if the
+// listener has to be created in SPDK.
+func (l nvmfListeners) acquire(params *spdk.NvmfSubsystemAddListenerParams) (bool, error) {
+	address := nvmfListenerAddress(params)
+	for _, listener := range l {
+		if listener.address != address {
+			continue
+		}
+		if listener.adrfam != params.ListenAddress.Adrfam {
+			msg := fmt.Sprintf("listener %s already exists with address family %s", address, listener.adrfam)
+			return false, status.Errorf(codes.FailedPrecondition, msg)
+		}
+		if listener.secureChannel != params.SecureChannel {
+			msg := fmt.Sprintf("listener %s already exists with secure channel %v", address, listener.secureChannel)
+			return false, status.Errorf(codes.FailedPrecondition, msg)
+		}
+	}
+	listener, ok := l[nvmfListenerKey(params)]
+	if ok {
+		listener.refs++
+		log.Printf("Reusing listener %s of %s, used by %d controllers", address, params.Nqn, listener.refs)
+		return false, nil
+	}
+	return true, nil
+}
+
+// add starts tracking listener created in SPDK
+func (l nvmfListeners) add(params *spdk.NvmfSubsystemAddListenerParams) {
+	l[nvmfListenerKey(params)] = &nvmfListener{
+		address:       nvmfListenerAddress(params),
+		adrfam:        params.ListenAddress.Adrfam,
+		secureChannel: params.SecureChannel,
+		refs:          1,
+	}
+}
+
+// adopt starts tracking listener which already exists in SPDK
+func (l nvmfListeners) adopt(params *spdk.NvmfSubsystemAddListenerParams) {
+	log.Printf("Reusing listener %s of %s existing in SPDK", nvmfListenerAddress(params), params.Nqn)
+	l.add(params)
+	l[nvmfListenerKey(params)].existing = true
+}
+
+// release unregisters one user of the listener. It returns true if the
+// listener is not used anymore and has to be removed from SPDK.
+func (l nvmfListeners) release(params *spdk.NvmfSubsystemAddListenerParams) bool {
+	listener, ok := l[nvmfListenerKey(params)]
+	if !ok {
+		return true
+	}
+	if listener.refs > 1 {
+		listener.refs--
+		log.Printf("Keeping listener %s of %s, used by %d controllers",
+			nvmfListenerAddress(params), params.Nqn, listener.refs)
+		return false
+	}
+	if listener.existing {
+		log.Printf("Keeping listener %s of %s not created by the bridge",
+			nvmfListenerAddress(params), params.Nqn)
+		l.remove(params)
+		return false
+	}
+	return true
+}
+
+// remove stops tracking listener removed from SPDK
+func (l nvmfListeners) remove(params *spdk.NvmfSubsystemAddListenerParams) {
+	delete(l, nvmfListenerKey(params))
+}
+
+// getNvmfListener finds listener with given address among listeners of
+// SPDK subsystem. It returns nil if there is no such listener.
+func getNvmfListener(ctx context.Context, rpc spdk.JSONRPC,
+	params *spdk.NvmfSubsystemAddListenerParams) (*nvmfSubsystemGetListenersResult, error) {
+	getParams := nvmfSubsystemGetListenersParams{
+		Nqn: params.Nqn,
+	}
+	var result []nvmfSubsystemGetListenersResult
+	err := rpc.Call(ctx, "nvmf_subsystem_get_listeners", &getParams, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	for i := range result {
+		if result[i].Address.Traddr == params.ListenAddress.Traddr &&
+			result[i].Address.Trsvcid == params.ListenAddress.Trsvcid {
+			return &result[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implememnts the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+func TestFrontEnd_NvmeControllersShareListener(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	testEnv := createTestEnvironment([]string{
+		`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP"}]}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+	})
+	defer testEnv.Close()
+	testEnv.opiSpdkServer.Nvme.Subsystems[testSubsystemName] = utils.ProtoClone(&testSubsystem)
+
+	names := []string{}
+	for _, id := range []string{"controller-1", "controller-2"} {
+		ctrlr := utils.ProtoClone(&testController)
+		ctrlr.Status = nil
+		request := &pb.CreateNvmeControllerRequest{Parent: testSubsystemName, NvmeControllerId: id, NvmeController: ctrlr}
+		response, err := testEnv.client.CreateNvmeController(testEnv.ctx, request)
+		if err != nil {
+			t.Fatal("expected no error on create, received", err)
+		}
+		names = append(names, response.Name)
+	}
+
+	// the listener is removed from SPDK only with the last controller
+	for _, name := range names {
+		request := &pb.DeleteNvmeControllerRequest{Name: name}
+		_, err := testEnv.client.DeleteNvmeController(testEnv.ctx, request)
+		if err != nil {
+			t.Fatal("expected no error on delete, received", err)
+		}
+	}
+}
+
+func TestFrontEnd_NvmeControllerListenerConflict(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		otherNqn string
+		adrfam   pb.NvmeAddressFamily
+		psk      []byte
+		errCode  codes.Code
+		errMsg   string
+	}{
+		"different address family": {
+			testSubsystem.Spec.Nqn,
+			pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV6,
+			nil,
+			codes.FailedPrecondition,
+			fmt.Sprintf("listener %s already exists with address family %s", "127.0.0.1:4420", "IPV4"),
+		},
+		"different secure channel in other subsystem": {
+			"nqn.2022-09.io.spdk:opi4",
+			pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
+			[]byte("NVMeTLSkey-1:01:MDAxMTIyMzM0NDU1NjY3Nzg4OTlhYWJiY2NkZGVlZmZwJEiQ:"),
+			codes.FailedPrecondition,
+			fmt.Sprintf("listener %s already exists with secure channel %v", "127.0.0.1:4420", false),
+		},
+		"same settings in other subsystem": {
+			"nqn.2022-09.io.spdk:opi4",
+			pb.NvmeAddressFamily_NVME_ADDRESS_FAMILY_IPV4,
+			nil,
+			codes.OK,
+			"",
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			spdk := []string{
+				`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP"}]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+			}
+			if tt.errCode == codes.OK {
+				spdk = append(spdk, `{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+					`{"id":%d,"error":{"code":0,"message":""},"result":true}`)
+			}
+			testEnv := createTestEnvironment(spdk)
+			defer testEnv.Close()
+			transport := NewNvmeTCPTransport(testEnv.jsonRPC)
+
+			err := transport.CreateController(testEnv.ctx,
+				utils.ProtoClone(&testController), utils.ProtoClone(&testSubsystem))
+			if err != nil {
+				t.Fatal("expected no error on first controller, received", err)
+			}
+
+			ctrlr := utils.ProtoClone(&testController)
+			ctrlr.Spec.GetFabricsId().Adrfam = tt.adrfam
+			subsys := &pb.NvmeSubsystem{Spec: &pb.NvmeSubsystemSpec{Nqn: tt.otherNqn, Psk: tt.psk}}
+			err = transport.CreateController(testEnv.ctx, ctrlr, subsys)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestFrontEnd_NvmeControllerReusesListenerExistingInSpdk(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	// listener created before restart is neither added nor removed
+	testEnv := createTestEnvironment([]string{
+		`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP"}]}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":[{"address":` +
+			`{"trtype":"TCP","adrfam":"IPv4","traddr":"127.0.0.1","trsvcid":"4420"}}]}`,
+	})
+	defer testEnv.Close()
+	transport := NewNvmeTCPTransport(testEnv.jsonRPC)
+	listeners := transport.(*nvmeTCPTransport).listeners
+
+	for i := 0; i < 2; i++ {
+		err := transport.CreateController(testEnv.ctx,
+			utils.ProtoClone(&testController), utils.ProtoClone(&testSubsystem))
+		if err != nil {
+			t.Fatal("expected no error on create, received", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		err := transport.DeleteController(testEnv.ctx,
+			utils.ProtoClone(&testController), utils.ProtoClone(&testSubsystem))
+		if err != nil {
+			t.Fatal("expected no error on delete, received", err)
+		}
+	}
+	if len(listeners) != 0 {
+		t.Error("expected listener not to be tracked anymore, received", listeners)
+	}
+}
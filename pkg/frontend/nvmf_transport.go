@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implements the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/opiproject/gospdk/spdk"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// TODO: opi-api has no NVMe-oF transport resource, so transports are served
+// by the extension API until it is added.
+
+// NvmfTransportOptions holds tunables of SPDK NVMe-oF transport. Zero values
+// keep SPDK defaults.
+type NvmfTransportOptions struct {
+	// IoUnitSize is I/O unit size in bytes
+	IoUnitSize int32 `json:"ioUnitSize,omitempty"`
+	// InCapsuleDataSize is max in-capsule data size in bytes, nil keeps SPDK default
+	InCapsuleDataSize *int32 `json:"inCapsuleDataSize,omitempty"`
+	// MaxQueueDepth is max number of outstanding I/O per queue
+	MaxQueueDepth int32 `json:"maxQueueDepth,omitempty"`
+	// NumSharedBuffers is number of pooled data buffers shared by poll groups
+	NumSharedBuffers int32 `json:"numSharedBuffers,omitempty"`
+	// SockPriority is priority of sockets, TCP only
+	SockPriority int32 `json:"sockPriority,omitempty"`
+	// ZeroCopy enables zero copy send, TCP only
+	ZeroCopy bool `json:"zeroCopy,omitempty"`
+}
+
+// NvmfTransport represents SPDK NVMe-oF transport
+type NvmfTransport struct {
+	// Trtype is transport type, e.g. TCP or VFIOUSER
+	Trtype  string               `json:"trtype"`
+	Options NvmfTransportOptions `json:"options"`
+}
+
+// ListNvmfTransportsResponse holds NVMe-oF transports created in SPDK
+type ListNvmfTransportsResponse struct {
+	NvmfTransports []*NvmfTransport `json:"nvmfTransports"`
+}
+
+type nvmfCreateTransportParams struct {
+	Trtype            string `json:"trtype"`
+	IoUnitSize        int32  `json:"io_unit_size,omitempty"`
+	InCapsuleDataSize *int32 `json:"in_capsule_data_size,omitempty"`
+	MaxQueueDepth     int32  `json:"max_queue_depth,omitempty"`
+	NumSharedBuffers  int32  `json:"num_shared_buffers,omitempty"`
+	SockPriority      int32  `json:"sock_priority,omitempty"`
+	Zcopy             bool   `json:"zcopy,omitempty"`
+}
+
+// NvmfCreateTransportResult is result of SPDK nvmf_create_transport
+type NvmfCreateTransportResult bool
+
+type nvmfGetTransportsResult struct {
+	Trtype            string `json:"trtype"`
+	IoUnitSize        int32  `json:"io_unit_size"`
+	InCapsuleDataSize int32  `json:"in_capsule_data_size"`
+	MaxQueueDepth     int32  `json:"max_queue_depth"`
+	NumSharedBuffers  int32  `json:"num_shared_buffers"`
+	SockPriority      int32  `json:"sock_priority"`
+	Zcopy             bool   `json:"zcopy"`
+}
+
+func validateNvmfTransport(trtype string, opts NvmfTransportOptions) error {
+	if trtype == "" {
+		return status.Error(codes.InvalidArgument, "missing required field: trtype")
+	}
+	if opts.IoUnitSize < 0 || opts.MaxQueueDepth < 0 || opts.NumSharedBuffers < 0 ||
+		opts.SockPriority < 0 || (opts.InCapsuleDataSize != nil && *opts.InCapsuleDataSize < 0) {
+		return status.Error(codes.InvalidArgument, "negative transport options are not allowed")
+	}
+	if !strings.EqualFold(trtype, "tcp") && (opts.SockPriority != 0 || opts.ZeroCopy) {
+		msg := fmt.Sprintf("sock priority and zero copy are supported only for TCP transport, not %s", trtype)
+		return status.Errorf(codes.InvalidArgument, msg)
+	}
+	return nil
+}
+
+func getNvmfTransports(ctx context.Context, rpc spdk.JSONRPC) ([]nvmfGetTransportsResult, error) {
+	var result []nvmfGetTransportsResult
+	err := rpc.Call(ctx, "nvmf_get_transports", nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	return result, nil
+}
+
+func createNvmfTransport(ctx context.Context, rpc spdk.JSONRPC, trtype string, opts NvmfTransportOptions) error {
+	params := nvmfCreateTransportParams{
+		Trtype:            strings.ToUpper(trtype),
+		IoUnitSize:        opts.IoUnitSize,
+		InCapsuleDataSize: opts.InCapsuleDataSize,
+		MaxQueueDepth:     opts.MaxQueueDepth,
+		NumSharedBuffers:  opts.NumSharedBuffers,
+		SockPriority:      opts.SockPriority,
+		Zcopy:             opts.ZeroCopy,
+	}
+	var result NvmfCreateTransportResult
+	err := rpc.Call(ctx, "nvmf_create_transport", &params, &result)
+	if err != nil {
+		return err
+	}
+	log.Printf("Received from SPDK: %v", result)
+	if !result {
+		msg := fmt.Sprintf("Could not create transport: %s", trtype)
+		return status.Errorf(codes.InvalidArgument, msg)
+	}
+	return nil
+}
+
+// EnsureNvmfTransport creates NVMe-oF transport with given options if SPDK
+// does not have it yet. Options of already existing transport are kept.
+func EnsureNvmfTransport(ctx context.Context, rpc spdk.JSONRPC, trtype string, opts NvmfTransportOptions) error {
+	transports, err := getNvmfTransports(ctx, rpc)
+	if err != nil {
+		return err
+	}
+	for _, transport := range transports {
+		if strings.EqualFold(transport.Trtype, trtype) {
+			return nil
+		}
+	}
+	log.Printf("Creating missing %v transport", trtype)
+	return createNvmfTransport(ctx, rpc, trtype, opts)
+}
+
+// CreateNvmfTransport creates NVMe-oF transport with given options. SPDK does
+// not allow to change options of existing transport.
+func (s *Server) CreateNvmfTransport(ctx context.Context, in *NvmfTransport) (*NvmfTransport, error) {
+	trtype, opts := in.Trtype, in.Options
+	if err := validateNvmfTransport(trtype, opts); err != nil {
+		return nil, err
+	}
+	transports, err := getNvmfTransports(ctx, s.rpc)
+	if err != nil {
+		return nil, err
+	}
+	for _, transport := range transports {
+		if strings.EqualFold(transport.Trtype, trtype) {
+			msg := fmt.Sprintf("transport %s already exists", transport.Trtype)
+			return nil, status.Errorf(codes.AlreadyExists, msg)
+		}
+	}
+	if err := createNvmfTransport(ctx, s.rpc, trtype, opts); err != nil {
+		return nil, err
+	}
+	return &NvmfTransport{Trtype: strings.ToUpper(trtype), Options: opts}, nil
+}
+
+// ListNvmfTransports lists NVMe-oF transports created in SPDK
+func (s *Server) ListNvmfTransports(ctx context.Context, _ *emptypb.Empty) (*ListNvmfTransportsResponse, error) {
+	transports, err := getNvmfTransports(ctx, s.rpc)
+	if err != nil {
+		return nil, err
+	}
+	response := []*NvmfTransport{}
+	for i := range transports {
+		transport := &transports[i]
+		inCapsuleDataSize := transport.InCapsuleDataSize
+		response = append(response, &NvmfTransport{
+			Trtype: transport.Trtype,
+			Options: NvmfTransportOptions{
+				IoUnitSize:        transport.IoUnitSize,
+				InCapsuleDataSize: &inCapsuleDataSize,
+				MaxQueueDepth:     transport.MaxQueueDepth,
+				NumSharedBuffers:  transport.NumSharedBuffers,
+				SockPriority:      transport.SockPriority,
+				ZeroCopy:          transport.Zcopy,
+			},
+		})
+	}
+	return &ListNvmfTransportsResponse{NvmfTransports: response}, nil
+}
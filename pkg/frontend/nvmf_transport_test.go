@@ -0,0 +1,251 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package frontend implememnts the FrontEnd APIs (host facing) of the storage Server
+package frontend
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+func TestFrontEnd_CreateNvmfTransport(t *testing.T) {
+	inCapsuleDataSize := int32(8192)
+	tests := map[string]struct {
+		trtype  string
+		options NvmfTransportOptions
+		out     *NvmfTransport
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid request with valid SPDK response": {
+			"tcp",
+			NvmfTransportOptions{IoUnitSize: 131072, InCapsuleDataSize: &inCapsuleDataSize, SockPriority: 1, ZeroCopy: true},
+			&NvmfTransport{
+				Trtype:  "TCP",
+				Options: NvmfTransportOptions{IoUnitSize: 131072, InCapsuleDataSize: &inCapsuleDataSize, SockPriority: 1, ZeroCopy: true},
+			},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			codes.OK,
+			"",
+		},
+		"already existing transport": {
+			"tcp",
+			NvmfTransportOptions{},
+			nil,
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP"}]}`},
+			codes.AlreadyExists,
+			fmt.Sprintf("transport %s already exists", "TCP"),
+		},
+		"valid request with invalid SPDK response": {
+			"tcp",
+			NvmfTransportOptions{},
+			nil,
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			codes.InvalidArgument,
+			fmt.Sprintf("Could not create transport: %s", "tcp"),
+		},
+		"valid request with error code from SPDK response": {
+			"tcp",
+			NvmfTransportOptions{},
+			nil,
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":false}`},
+			codes.Unknown,
+			fmt.Sprintf("nvmf_create_transport: %v", "json response error: Invalid parameters"),
+		},
+		"get transports error code from SPDK response": {
+			"tcp",
+			NvmfTransportOptions{},
+			nil,
+			[]string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":[]}`},
+			codes.Unknown,
+			fmt.Sprintf("nvmf_get_transports: %v", "json response error: Invalid parameters"),
+		},
+		"no trtype": {
+			"",
+			NvmfTransportOptions{},
+			nil,
+			[]string{},
+			codes.InvalidArgument,
+			"missing required field: trtype",
+		},
+		"negative options": {
+			"tcp",
+			NvmfTransportOptions{MaxQueueDepth: -1},
+			nil,
+			[]string{},
+			codes.InvalidArgument,
+			"negative transport options are not allowed",
+		},
+		"zero copy for not tcp transport": {
+			"vfiouser",
+			NvmfTransportOptions{ZeroCopy: true},
+			nil,
+			[]string{},
+			codes.InvalidArgument,
+			fmt.Sprintf("sock priority and zero copy are supported only for TCP transport, not %s", "vfiouser"),
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			response, err := testEnv.opiSpdkServer.CreateNvmfTransport(testEnv.ctx, &NvmfTransport{Trtype: tt.trtype, Options: tt.options})
+
+			if !reflect.DeepEqual(response, tt.out) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestFrontEnd_ListNvmfTransports(t *testing.T) {
+	inCapsuleDataSize := int32(4096)
+	tests := map[string]struct {
+		out     []*NvmfTransport
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid request with valid SPDK response": {
+			[]*NvmfTransport{
+				{
+					Trtype: "TCP",
+					Options: NvmfTransportOptions{
+						IoUnitSize:        131072,
+						InCapsuleDataSize: &inCapsuleDataSize,
+						MaxQueueDepth:     128,
+						NumSharedBuffers:  511,
+						SockPriority:      1,
+						ZeroCopy:          true,
+					},
+				},
+			},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP","io_unit_size":131072,` +
+				`"in_capsule_data_size":4096,"max_queue_depth":128,"num_shared_buffers":511,"sock_priority":1,"zcopy":true}]}`},
+			codes.OK,
+			"",
+		},
+		"no transports": {
+			[]*NvmfTransport{},
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`},
+			codes.OK,
+			"",
+		},
+		"valid request with error code from SPDK response": {
+			nil,
+			[]string{`{"id":%d,"error":{"code":-32602,"message":"Invalid parameters"},"result":[]}`},
+			codes.Unknown,
+			fmt.Sprintf("nvmf_get_transports: %v", "json response error: Invalid parameters"),
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			response, err := testEnv.opiSpdkServer.ListNvmfTransports(testEnv.ctx, &emptypb.Empty{})
+
+			var transports []*NvmfTransport
+			if response != nil {
+				transports = response.NvmfTransports
+			}
+			if !reflect.DeepEqual(transports, tt.out) {
+				t.Error("response: expected", tt.out, "received", transports)
+			}
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestFrontEnd_NvmeTCPTransportCreatesMissingTransport(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"missing transport is created": {
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			codes.OK,
+			"",
+		},
+		"existing transport is reused": {
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"trtype":"TCP"}]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			codes.OK,
+			"",
+		},
+		"transport creation failure": {
+			[]string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`,
+				`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			codes.InvalidArgument,
+			fmt.Sprintf("Could not create transport: %s", "TCP"),
+		},
+	}
+
+	// run tests
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+			transport := NewNvmeTCPTransport(testEnv.jsonRPC)
+			ctrlr := utils.ProtoClone(&testController)
+			subsys := utils.ProtoClone(&testSubsystem)
+
+			err := transport.CreateController(testEnv.ctx, ctrlr, subsys)
+			if err == nil {
+				// transport is checked only on first use
+				ctrlr.Spec.GetFabricsId().Trsvcid = "4421"
+				err = transport.CreateController(testEnv.ctx, ctrlr, subsys)
+			}
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
@@ -26,25 +26,73 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+// maxScsiTargets is the number of SCSI targets SPDK exposes per vhost-scsi
+// controller. Each target carries a single LUN backed by one bdev.
+const maxScsiTargets = 8
+
+type vhostScsiControllerAddTargetParams struct {
+	Ctrlr         string `json:"ctrlr"`
+	ScsiTargetNum int    `json:"scsi_target_num"`
+	BdevName      string `json:"bdev_name"`
+}
+
+type vhostScsiControllerAddTargetResult int
+
+type vhostScsiControllerRemoveTargetParams struct {
+	Ctrlr         string `json:"ctrlr"`
+	ScsiTargetNum int    `json:"scsi_target_num"`
+}
+
+type vhostScsiControllerRemoveTargetResult bool
+
 func sortScsiControllers(controllers []*pb.VirtioScsiController) {
 	sort.Slice(controllers, func(i int, j int) bool {
 		return controllers[i].Name < controllers[j].Name
 	})
 }
 
+func sortScsiLuns(luns []*pb.VirtioScsiLun) {
+	sort.Slice(luns, func(i int, j int) bool {
+		return luns[i].Name < luns[j].Name
+	})
+}
+
+func (s *Server) numberOfLunsForScsiController(controllerName string) int {
+	number := 0
+	for _, lun := range s.Virt.ScsiLuns {
+		if lun.TargetNameRef == controllerName {
+			number++
+		}
+	}
+	return number
+}
+
+// freeScsiTargetNum returns the lowest SCSI target number not used by any
+// LUN of the controller
+func (s *Server) freeScsiTargetNum(controllerName string) (int, error) {
+	used := make(map[int]bool)
+	for name, lun := range s.Virt.ScsiLuns {
+		if lun.TargetNameRef == controllerName {
+			used[s.Virt.scsiTargets[name]] = true
+		}
+	}
+	for num := 0; num < maxScsiTargets; num++ {
+		if !used[num] {
+			return num, nil
+		}
+	}
+	return -1, status.Errorf(codes.ResourceExhausted, "all %d SCSI targets of %s are in use", maxScsiTargets, controllerName)
+}
+
 // CreateVirtioScsiController creates a Virtio SCSI controller
 func (s *Server) CreateVirtioScsiController(ctx context.Context, in *pb.CreateVirtioScsiControllerRequest) (*pb.VirtioScsiController, error) {
-	// check required fields
-	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
+	// check input correctness
+	if err := s.validateCreateVirtioScsiControllerRequest(in); err != nil {
 		return nil, err
 	}
 	// see https://google.aip.dev/133#user-specified-ids
 	resourceID := resourceid.NewSystemGenerated()
 	if in.VirtioScsiControllerId != "" {
-		err := resourceid.ValidateUserSettable(in.VirtioScsiControllerId)
-		if err != nil {
-			return nil, err
-		}
 		log.Printf("client provided the ID of a resource %v, ignoring the name field %v", in.VirtioScsiControllerId, in.VirtioScsiController.Name)
 		resourceID = in.VirtioScsiControllerId
 	}
@@ -67,7 +115,8 @@ func (s *Server) CreateVirtioScsiController(ctx context.Context, in *pb.CreateVi
 	}
 	log.Printf("Received from SPDK: %v", result)
 	if !result {
-		log.Printf("Could not create: %v", in)
+		msg := fmt.Sprintf("Could not create virtio-scsi: %s", resourceID)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
 	}
 	response := utils.ProtoClone(in.VirtioScsiController)
 	// response.Status = &pb.VirtioScsiControllerStatus{Active: true}
@@ -77,12 +126,8 @@ func (s *Server) CreateVirtioScsiController(ctx context.Context, in *pb.CreateVi
 
 // DeleteVirtioScsiController deletes a Virtio SCSI controller
 func (s *Server) DeleteVirtioScsiController(ctx context.Context, in *pb.DeleteVirtioScsiControllerRequest) (*emptypb.Empty, error) {
-	// check required fields
-	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
-		return nil, err
-	}
-	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
-	if err := resourcename.Validate(in.Name); err != nil {
+	// check input correctness
+	if err := s.validateDeleteVirtioScsiControllerRequest(in); err != nil {
 		return nil, err
 	}
 	// fetch object from the database
@@ -94,6 +139,9 @@ func (s *Server) DeleteVirtioScsiController(ctx context.Context, in *pb.DeleteVi
 		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
 		return nil, err
 	}
+	if s.numberOfLunsForScsiController(controller.Name) > 0 {
+		return nil, status.Error(codes.FailedPrecondition, "VirtioScsiLuns exist for controller")
+	}
 	resourceID := path.Base(controller.Name)
 	params := spdk.VhostDeleteControllerParams{
 		Ctrlr: resourceID,
@@ -105,7 +153,8 @@ func (s *Server) DeleteVirtioScsiController(ctx context.Context, in *pb.DeleteVi
 	}
 	log.Printf("Received from SPDK: %v", result)
 	if !result {
-		log.Printf("Could not delete: %v", in)
+		msg := fmt.Sprintf("Could not delete virtio-scsi: %s", in.Name)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
 	}
 	delete(s.Virt.ScsiCtrls, controller.Name)
 	return &emptypb.Empty{}, nil
@@ -227,22 +276,19 @@ func (s *Server) StatsVirtioScsiController(_ context.Context, in *pb.StatsVirtio
 }
 
 // CreateVirtioScsiLun creates a Virtio SCSI LUN
+//
+// TargetNameRef refers to the VirtioScsiController the LUN is attached to.
+// SPDK exposes every bdev as LUN 0 of its own SCSI target, so each LUN takes
+// the lowest free target number of the controller. SPDK hot-plugs the target
+// into the guest when the controller is already in use.
 func (s *Server) CreateVirtioScsiLun(ctx context.Context, in *pb.CreateVirtioScsiLunRequest) (*pb.VirtioScsiLun, error) {
-	// check required fields
-	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
-		return nil, err
-	}
-	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
-	if err := resourcename.Validate(in.VirtioScsiLun.VolumeNameRef); err != nil {
+	// check input correctness
+	if err := s.validateCreateVirtioScsiLunRequest(in); err != nil {
 		return nil, err
 	}
 	// see https://google.aip.dev/133#user-specified-ids
 	resourceID := resourceid.NewSystemGenerated()
 	if in.VirtioScsiLunId != "" {
-		err := resourceid.ValidateUserSettable(in.VirtioScsiLunId)
-		if err != nil {
-			return nil, err
-		}
 		log.Printf("client provided the ID of a resource %v, ignoring the name field %v", in.VirtioScsiLunId, in.VirtioScsiLun.Name)
 		resourceID = in.VirtioScsiLunId
 	}
@@ -254,36 +300,43 @@ func (s *Server) CreateVirtioScsiLun(ctx context.Context, in *pb.CreateVirtioScs
 		log.Printf("Already existing VirtioScsiLun with id %v", in.VirtioScsiLun.Name)
 		return lun, nil
 	}
+	// check parent controller exists
+	controller, ok := s.Virt.ScsiCtrls[in.VirtioScsiLun.TargetNameRef]
+	if !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.VirtioScsiLun.TargetNameRef)
+		return nil, err
+	}
+	targetNum, err := s.freeScsiTargetNum(controller.Name)
+	if err != nil {
+		return nil, err
+	}
 	// not found, so create a new one
-	params := struct {
-		Name string `json:"ctrlr"`
-		Num  int    `json:"scsi_target_num"`
-		Bdev string `json:"bdev_name"`
-	}{
-		Name: resourceID,
-		Num:  5,
-		Bdev: in.VirtioScsiLun.VolumeNameRef,
+	params := vhostScsiControllerAddTargetParams{
+		Ctrlr:         path.Base(controller.Name),
+		ScsiTargetNum: targetNum,
+		BdevName:      in.VirtioScsiLun.VolumeNameRef,
 	}
-	var result int
-	err := s.rpc.Call(ctx, "vhost_scsi_controller_add_target", &params, &result)
+	var result vhostScsiControllerAddTargetResult
+	err = s.rpc.Call(ctx, "vhost_scsi_controller_add_target", &params, &result)
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("Received from SPDK: %v", result)
+	if int(result) != targetNum {
+		msg := fmt.Sprintf("Could not create virtio-scsi LUN: %s", in.VirtioScsiLun.Name)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
 	response := utils.ProtoClone(in.VirtioScsiLun)
 	// response.Status = &pb.VirtioScsiLunStatus{Active: true}
 	s.Virt.ScsiLuns[in.VirtioScsiLun.Name] = response
+	s.Virt.scsiTargets[in.VirtioScsiLun.Name] = targetNum
 	return response, nil
 }
 
 // DeleteVirtioScsiLun deletes a Virtio SCSI LUN
 func (s *Server) DeleteVirtioScsiLun(ctx context.Context, in *pb.DeleteVirtioScsiLunRequest) (*emptypb.Empty, error) {
-	// check required fields
-	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
-		return nil, err
-	}
-	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
-	if err := resourcename.Validate(in.Name); err != nil {
+	// check input correctness
+	if err := s.validateDeleteVirtioScsiLunRequest(in); err != nil {
 		return nil, err
 	}
 	// fetch object from the database
@@ -295,24 +348,22 @@ func (s *Server) DeleteVirtioScsiLun(ctx context.Context, in *pb.DeleteVirtioScs
 		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
 		return nil, err
 	}
-	resourceID := path.Base(lun.Name)
-	params := struct {
-		Name string `json:"ctrlr"`
-		Num  int    `json:"scsi_target_num"`
-	}{
-		Name: resourceID,
-		Num:  5,
+	params := vhostScsiControllerRemoveTargetParams{
+		Ctrlr:         path.Base(lun.TargetNameRef),
+		ScsiTargetNum: s.Virt.scsiTargets[lun.Name],
 	}
-	var result bool
+	var result vhostScsiControllerRemoveTargetResult
 	err := s.rpc.Call(ctx, "vhost_scsi_controller_remove_target", &params, &result)
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("Received from SPDK: %v", result)
 	if !result {
-		log.Printf("Could not delete: %v", in)
+		msg := fmt.Sprintf("Could not delete virtio-scsi LUN: %s", in.Name)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
 	}
 	delete(s.Virt.ScsiLuns, lun.Name)
+	delete(s.Virt.scsiTargets, lun.Name)
 	return &emptypb.Empty{}, nil
 }
 
@@ -345,9 +396,13 @@ func (s *Server) UpdateVirtioScsiLun(_ context.Context, in *pb.UpdateVirtioScsiL
 }
 
 // ListVirtioScsiLuns lists Virtio SCSI LUNs
-func (s *Server) ListVirtioScsiLuns(ctx context.Context, in *pb.ListVirtioScsiLunsRequest) (*pb.ListVirtioScsiLunsResponse, error) {
-	// check required fields
-	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
+func (s *Server) ListVirtioScsiLuns(_ context.Context, in *pb.ListVirtioScsiLunsRequest) (*pb.ListVirtioScsiLunsResponse, error) {
+	// check input correctness
+	if err := s.validateListVirtioScsiLunsRequest(in); err != nil {
+		return nil, err
+	}
+	if _, ok := s.Virt.ScsiCtrls[in.Parent]; !ok {
+		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Parent)
 		return nil, err
 	}
 	// fetch object from the database
@@ -355,26 +410,20 @@ func (s *Server) ListVirtioScsiLuns(ctx context.Context, in *pb.ListVirtioScsiLu
 	if perr != nil {
 		return nil, perr
 	}
-	var result []spdk.VhostGetControllersResult
-	err := s.rpc.Call(ctx, "vhost_get_controllers", nil, &result)
-	if err != nil {
-		return nil, err
+	Blobarray := []*pb.VirtioScsiLun{}
+	for _, lun := range s.Virt.ScsiLuns {
+		if lun.TargetNameRef == in.Parent {
+			Blobarray = append(Blobarray, utils.ProtoClone(lun))
+		}
 	}
-	log.Printf("Received from SPDK: %v", result)
+	sortScsiLuns(Blobarray)
 	token := ""
-	log.Printf("Limiting result len(%d) to [%d:%d]", len(result), offset, size)
-	result, hasMoreElements := utils.LimitPagination(result, offset, size)
+	log.Printf("Limiting result len(%d) to [%d:%d]", len(Blobarray), offset, size)
+	Blobarray, hasMoreElements := utils.LimitPagination(Blobarray, offset, size)
 	if hasMoreElements {
 		token = uuid.New().String()
 		s.Pagination[token] = offset + size
 	}
-	Blobarray := make([]*pb.VirtioScsiLun, len(result))
-	for i := range result {
-		r := &result[i]
-		Blobarray[i] = &pb.VirtioScsiLun{
-			VolumeNameRef: utils.ResourceIDToVolumeName(r.Ctrlr),
-		}
-	}
 	return &pb.ListVirtioScsiLunsResponse{VirtioScsiLuns: Blobarray, NextPageToken: token}, nil
 }
 
@@ -389,14 +438,13 @@ func (s *Server) GetVirtioScsiLun(ctx context.Context, in *pb.GetVirtioScsiLunRe
 		return nil, err
 	}
 	// fetch object from the database
-	volume, ok := s.Virt.ScsiLuns[in.Name]
+	lun, ok := s.Virt.ScsiLuns[in.Name]
 	if !ok {
 		err := status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
 		return nil, err
 	}
-	resourceID := path.Base(volume.Name)
 	params := spdk.VhostGetControllersParams{
-		Name: resourceID,
+		Name: path.Base(lun.TargetNameRef),
 	}
 	var result []spdk.VhostGetControllersResult
 	err := s.rpc.Call(ctx, "vhost_get_controllers", &params, &result)
@@ -408,7 +456,7 @@ func (s *Server) GetVirtioScsiLun(ctx context.Context, in *pb.GetVirtioScsiLunRe
 		msg := fmt.Sprintf("expecting exactly 1 result, got %d", len(result))
 		return nil, status.Errorf(codes.InvalidArgument, msg)
 	}
-	return &pb.VirtioScsiLun{VolumeNameRef: utils.ResourceIDToVolumeName(result[0].Ctrlr)}, nil
+	return utils.ProtoClone(lun), nil
 }
 
 // StatsVirtioScsiLun gets a Virtio SCSI LUN stats
@@ -5,15 +5,232 @@
 package frontend
 
 import (
+	"fmt"
 	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
 )
 
-func TestFrontEnd_CreateVirtioScsiController(_ *testing.T) {
+var (
+	testScsiCtrlID   = "virtio-scsi-42"
+	testScsiCtrlName = utils.ResourceIDToVolumeName(testScsiCtrlID)
+	testScsiCtrl     = pb.VirtioScsiController{
+		PcieId: &pb.PciEndpoint{
+			PhysicalFunction: wrapperspb.Int32(43),
+			VirtualFunction:  wrapperspb.Int32(0),
+			PortId:           wrapperspb.Int32(0)},
+	}
+
+	testScsiLunID   = "virtio-scsi-lun-42"
+	testScsiLunName = utils.ResourceIDToVolumeName(testScsiLunID)
+	testScsiLun     = pb.VirtioScsiLun{
+		TargetNameRef: testScsiCtrlName,
+		VolumeNameRef: "Malloc42",
+	}
+)
 
+func checkScsiGrpcError(t *testing.T, err error, errCode codes.Code, errMsg string) {
+	if er, ok := status.FromError(err); ok {
+		if er.Code() != errCode {
+			t.Error("error code: expected", errCode, "received", er.Code())
+		}
+		if er.Message() != errMsg {
+			t.Error("error message: expected", errMsg, "received", er.Message())
+		}
+	} else {
+		t.Error("expected grpc error status")
+	}
 }
 
-func TestFrontEnd_DeleteVirtioScsiController(_ *testing.T) {
+func TestFrontEnd_CreateVirtioScsiController(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		id      string
+		in      *pb.VirtioScsiController
+		out     *pb.VirtioScsiController
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+		exist   bool
+	}{
+		"illegal resource_id": {
+			id:      "CapitalLettersNotAllowed",
+			in:      &testScsiCtrl,
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("user-settable ID must only contain lowercase, numbers and hyphens (%v)", "got: 'C' in position 0"),
+			exist:   false,
+		},
+		"valid virtio-scsi creation": {
+			id:      testScsiCtrlID,
+			in:      &testScsiCtrl,
+			out:     &testScsiCtrl,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode: codes.OK,
+			errMsg:  "",
+			exist:   false,
+		},
+		"spdk virtio-scsi creation error": {
+			id:      testScsiCtrlID,
+			in:      &testScsiCtrl,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":1,"message":"some internal error"},"result":false}`},
+			errCode: codes.Unknown,
+			errMsg:  "vhost_create_scsi_controller: json response error: some internal error",
+			exist:   false,
+		},
+		"spdk virtio-scsi creation returned false response with no error": {
+			id:      testScsiCtrlID,
+			in:      &testScsiCtrl,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not create virtio-scsi: %s", testScsiCtrlID),
+			exist:   false,
+		},
+		"already exists": {
+			id:      testScsiCtrlID,
+			in:      &testScsiCtrl,
+			out:     &testScsiCtrl,
+			spdk:    []string{},
+			errCode: codes.OK,
+			errMsg:  "",
+			exist:   true,
+		},
+		"no required field": {
+			id:      testScsiCtrlID,
+			in:      nil,
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  "missing required field: virtio_scsi_controller",
+			exist:   false,
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			if tt.exist {
+				testEnv.opiSpdkServer.Virt.ScsiCtrls[testScsiCtrlName] = utils.ProtoClone(&testScsiCtrl)
+				testEnv.opiSpdkServer.Virt.ScsiCtrls[testScsiCtrlName].Name = testScsiCtrlName
+			}
+			if tt.out != nil {
+				tt.out = utils.ProtoClone(tt.out)
+				tt.out.Name = testScsiCtrlName
+			}
+
+			request := &pb.CreateVirtioScsiControllerRequest{
+				VirtioScsiController:   utils.ProtoClone(tt.in),
+				VirtioScsiControllerId: tt.id,
+			}
+			response, err := testEnv.client.CreateVirtioScsiController(testEnv.ctx, request)
+
+			if !proto.Equal(tt.out, response) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkScsiGrpcError(t, err, tt.errCode, tt.errMsg)
+			if _, ok := testEnv.opiSpdkServer.Virt.ScsiCtrls[testScsiCtrlName]; ok != (tt.out != nil) {
+				t.Error("controller stored: expected", tt.out != nil, "received", ok)
+			}
+		})
+	}
+}
+
+func TestFrontEnd_DeleteVirtioScsiController(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		out     *emptypb.Empty
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+		missing bool
+		lun     bool
+	}{
+		"valid request with valid SPDK response": {
+			in:      testScsiCtrlName,
+			out:     &emptypb.Empty{},
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"valid request with invalid SPDK response": {
+			in:      testScsiCtrlName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not delete virtio-scsi: %s", testScsiCtrlName),
+		},
+		"valid request with error code from SPDK response": {
+			in:      testScsiCtrlName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":1,"message":"myopierr"},"result":false}`},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("vhost_delete_controller: %v", "json response error: myopierr"),
+		},
+		"controller with luns": {
+			in:      testScsiCtrlName,
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.FailedPrecondition,
+			errMsg:  "VirtioScsiLuns exist for controller",
+			lun:     true,
+		},
+		"valid request with unknown key": {
+			in:      utils.ResourceIDToVolumeName("unknown-id"),
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", utils.ResourceIDToVolumeName("unknown-id")),
+		},
+		"unknown key with missing allowed": {
+			in:      utils.ResourceIDToVolumeName("unknown-id"),
+			out:     &emptypb.Empty{},
+			spdk:    []string{},
+			errCode: codes.OK,
+			errMsg:  "",
+			missing: true,
+		},
+		"malformed name": {
+			in:      "-ABC-DEF",
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("segment '%s': not a valid DNS name", "-ABC-DEF"),
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Virt.ScsiCtrls[testScsiCtrlName] = &pb.VirtioScsiController{Name: testScsiCtrlName}
+			if tt.lun {
+				lun := utils.ProtoClone(&testScsiLun)
+				lun.Name = testScsiLunName
+				testEnv.opiSpdkServer.Virt.ScsiLuns[testScsiLunName] = lun
+			}
+
+			request := &pb.DeleteVirtioScsiControllerRequest{Name: tt.in, AllowMissing: tt.missing}
+			response, err := testEnv.client.DeleteVirtioScsiController(testEnv.ctx, request)
 
+			if !proto.Equal(tt.out, response) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkScsiGrpcError(t, err, tt.errCode, tt.errMsg)
+		})
+	}
 }
 
 func TestFrontEnd_UpdateVirtioScsiController(_ *testing.T) {
@@ -32,24 +249,368 @@ func TestFrontEnd_StatsVirtioScsiController(_ *testing.T) {
 
 }
 
-func TestFrontEnd_CreateVirtioScsiLun(_ *testing.T) {
+func TestFrontEnd_CreateVirtioScsiLun(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		id        string
+		in        *pb.VirtioScsiLun
+		out       *pb.VirtioScsiLun
+		spdk      []string
+		errCode   codes.Code
+		errMsg    string
+		usedNums  []int
+		targetNum int
+	}{
+		"valid lun on first target": {
+			id:        testScsiLunID,
+			in:        &testScsiLun,
+			out:       &testScsiLun,
+			spdk:      []string{`{"id":%d,"error":{"code":0,"message":""},"result":0}`},
+			errCode:   codes.OK,
+			errMsg:    "",
+			usedNums:  nil,
+			targetNum: 0,
+		},
+		"lowest free target is taken": {
+			id:        testScsiLunID,
+			in:        &testScsiLun,
+			out:       &testScsiLun,
+			spdk:      []string{`{"id":%d,"error":{"code":0,"message":""},"result":1}`},
+			errCode:   codes.OK,
+			errMsg:    "",
+			usedNums:  []int{0, 2},
+			targetNum: 1,
+		},
+		"all targets in use": {
+			id:       testScsiLunID,
+			in:       &testScsiLun,
+			out:      nil,
+			spdk:     []string{},
+			errCode:  codes.ResourceExhausted,
+			errMsg:   fmt.Sprintf("all %d SCSI targets of %s are in use", maxScsiTargets, testScsiCtrlName),
+			usedNums: []int{0, 1, 2, 3, 4, 5, 6, 7},
+		},
+		"unknown controller": {
+			id: testScsiLunID,
+			in: &pb.VirtioScsiLun{
+				TargetNameRef: utils.ResourceIDToVolumeName("unknown-id"),
+				VolumeNameRef: testScsiLun.VolumeNameRef,
+			},
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", utils.ResourceIDToVolumeName("unknown-id")),
+		},
+		"spdk returned other target number": {
+			id:      testScsiLunID,
+			in:      &testScsiLun,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":3}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not create virtio-scsi LUN: %s", testScsiLunName),
+		},
+		"spdk add target error": {
+			id:      testScsiLunID,
+			in:      &testScsiLun,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":-32602,"message":"No such device"}}`},
+			errCode: codes.Unknown,
+			errMsg:  "vhost_scsi_controller_add_target: json response error: No such device",
+		},
+		"no required field": {
+			id:      testScsiLunID,
+			in:      nil,
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  "missing required field: virtio_scsi_lun",
+		},
+		"malformed target name": {
+			id:      testScsiLunID,
+			in:      &pb.VirtioScsiLun{TargetNameRef: "-ABC-DEF", VolumeNameRef: testScsiLun.VolumeNameRef},
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("segment '%s': not a valid DNS name", "-ABC-DEF"),
+		},
+		"malformed volume name": {
+			id:      testScsiLunID,
+			in:      &pb.VirtioScsiLun{TargetNameRef: testScsiCtrlName, VolumeNameRef: "-ABC-DEF"},
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("segment '%s': not a valid DNS name", "-ABC-DEF"),
+		},
+	}
 
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Virt.ScsiCtrls[testScsiCtrlName] = &pb.VirtioScsiController{Name: testScsiCtrlName}
+			for _, num := range tt.usedNums {
+				name := utils.ResourceIDToVolumeName(fmt.Sprintf("used-lun-%d", num))
+				testEnv.opiSpdkServer.Virt.ScsiLuns[name] = &pb.VirtioScsiLun{
+					Name:          name,
+					TargetNameRef: testScsiCtrlName,
+					VolumeNameRef: "Malloc0",
+				}
+				testEnv.opiSpdkServer.Virt.scsiTargets[name] = num
+			}
+			if tt.out != nil {
+				tt.out = utils.ProtoClone(tt.out)
+				tt.out.Name = testScsiLunName
+			}
+
+			request := &pb.CreateVirtioScsiLunRequest{VirtioScsiLun: utils.ProtoClone(tt.in), VirtioScsiLunId: tt.id}
+			response, err := testEnv.client.CreateVirtioScsiLun(testEnv.ctx, request)
+
+			if !proto.Equal(tt.out, response) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkScsiGrpcError(t, err, tt.errCode, tt.errMsg)
+			if num, ok := testEnv.opiSpdkServer.Virt.scsiTargets[testScsiLunName]; tt.out != nil && (!ok || num != tt.targetNum) {
+				t.Error("target number: expected", tt.targetNum, "received", num)
+			}
+		})
+	}
 }
 
-func TestFrontEnd_DeleteVirtioScsiLun(_ *testing.T) {
+func TestFrontEnd_DeleteVirtioScsiLun(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		out     *emptypb.Empty
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+		missing bool
+	}{
+		"valid request with valid SPDK response": {
+			in:      testScsiLunName,
+			out:     &emptypb.Empty{},
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":true}`},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"valid request with invalid SPDK response": {
+			in:      testScsiLunName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":false}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("Could not delete virtio-scsi LUN: %s", testScsiLunName),
+		},
+		"valid request with error code from SPDK response": {
+			in:      testScsiLunName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":1,"message":"myopierr"}}`},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("vhost_scsi_controller_remove_target: %v", "json response error: myopierr"),
+		},
+		"valid request with unknown key": {
+			in:      utils.ResourceIDToVolumeName("unknown-id"),
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", utils.ResourceIDToVolumeName("unknown-id")),
+		},
+		"unknown key with missing allowed": {
+			in:      utils.ResourceIDToVolumeName("unknown-id"),
+			out:     &emptypb.Empty{},
+			spdk:    []string{},
+			errCode: codes.OK,
+			errMsg:  "",
+			missing: true,
+		},
+		"malformed name": {
+			in:      "-ABC-DEF",
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("segment '%s': not a valid DNS name", "-ABC-DEF"),
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Virt.ScsiCtrls[testScsiCtrlName] = &pb.VirtioScsiController{Name: testScsiCtrlName}
+			lun := utils.ProtoClone(&testScsiLun)
+			lun.Name = testScsiLunName
+			testEnv.opiSpdkServer.Virt.ScsiLuns[testScsiLunName] = lun
+			testEnv.opiSpdkServer.Virt.scsiTargets[testScsiLunName] = 3
+
+			request := &pb.DeleteVirtioScsiLunRequest{Name: tt.in, AllowMissing: tt.missing}
+			response, err := testEnv.client.DeleteVirtioScsiLun(testEnv.ctx, request)
 
+			if !proto.Equal(tt.out, response) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkScsiGrpcError(t, err, tt.errCode, tt.errMsg)
+			_, stored := testEnv.opiSpdkServer.Virt.scsiTargets[testScsiLunName]
+			if deleted := tt.out != nil && tt.in == testScsiLunName; stored == deleted {
+				t.Error("target number kept: expected", !deleted, "received", stored)
+			}
+		})
+	}
 }
 
 func TestFrontEnd_UpdateVirtioScsiLun(_ *testing.T) {
 
 }
 
-func TestFrontEnd_ListVirtioScsiLuns(_ *testing.T) {
+func TestFrontEnd_ListVirtioScsiLuns(t *testing.T) {
+	otherCtrlName := utils.ResourceIDToVolumeName("virtio-scsi-other")
+	lun0 := &pb.VirtioScsiLun{
+		Name:          utils.ResourceIDToVolumeName("lun-0"),
+		TargetNameRef: testScsiCtrlName,
+		VolumeNameRef: "Malloc0",
+	}
+	lun1 := &pb.VirtioScsiLun{
+		Name:          utils.ResourceIDToVolumeName("lun-1"),
+		TargetNameRef: testScsiCtrlName,
+		VolumeNameRef: "Malloc1",
+	}
+	otherLun := &pb.VirtioScsiLun{
+		Name:          utils.ResourceIDToVolumeName("lun-other"),
+		TargetNameRef: otherCtrlName,
+		VolumeNameRef: "Malloc2",
+	}
+	tests := map[string]struct {
+		in      string
+		out     []*pb.VirtioScsiLun
+		errCode codes.Code
+		errMsg  string
+		size    int32
+		token   string
+	}{
+		"luns of controller": {
+			in:      testScsiCtrlName,
+			out:     []*pb.VirtioScsiLun{lun0, lun1},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"pagination": {
+			in:      testScsiCtrlName,
+			out:     []*pb.VirtioScsiLun{lun0},
+			errCode: codes.OK,
+			errMsg:  "",
+			size:    1,
+		},
+		"pagination negative": {
+			in:      testScsiCtrlName,
+			out:     nil,
+			errCode: codes.InvalidArgument,
+			errMsg:  "negative PageSize is not allowed",
+			size:    -10,
+		},
+		"pagination error": {
+			in:      testScsiCtrlName,
+			out:     nil,
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find pagination token %s", "unknown-pagination-token"),
+			token:   "unknown-pagination-token",
+		},
+		"unknown controller": {
+			in:      utils.ResourceIDToVolumeName("unknown-id"),
+			out:     nil,
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", utils.ResourceIDToVolumeName("unknown-id")),
+		},
+		"no required field": {
+			in:      "",
+			out:     nil,
+			errCode: codes.Unknown,
+			errMsg:  "missing required field: parent",
+		},
+	}
 
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			testEnv := createTestEnvironment([]string{})
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Virt.ScsiCtrls[testScsiCtrlName] = &pb.VirtioScsiController{Name: testScsiCtrlName}
+			testEnv.opiSpdkServer.Virt.ScsiCtrls[otherCtrlName] = &pb.VirtioScsiController{Name: otherCtrlName}
+			for _, lun := range []*pb.VirtioScsiLun{lun0, lun1, otherLun} {
+				testEnv.opiSpdkServer.Virt.ScsiLuns[lun.Name] = utils.ProtoClone(lun)
+			}
+
+			request := &pb.ListVirtioScsiLunsRequest{Parent: tt.in, PageSize: tt.size, PageToken: tt.token}
+			response, err := testEnv.client.ListVirtioScsiLuns(testEnv.ctx, request)
+
+			if len(response.GetVirtioScsiLuns()) != len(tt.out) {
+				t.Error("response: expected", tt.out, "received", response.GetVirtioScsiLuns())
+			}
+			for i := range tt.out {
+				if !proto.Equal(tt.out[i], response.GetVirtioScsiLuns()[i]) {
+					t.Error("response: expected", tt.out, "received", response.GetVirtioScsiLuns())
+				}
+			}
+			checkScsiGrpcError(t, err, tt.errCode, tt.errMsg)
+		})
+	}
 }
 
-func TestFrontEnd_GetVirtioScsiLun(_ *testing.T) {
+func TestFrontEnd_GetVirtioScsiLun(t *testing.T) {
+	testScsiLunWithName := utils.ProtoClone(&testScsiLun)
+	testScsiLunWithName.Name = testScsiLunName
+	tests := map[string]struct {
+		in      string
+		out     *pb.VirtioScsiLun
+		spdk    []string
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid request with valid SPDK response": {
+			in:      testScsiLunName,
+			out:     testScsiLunWithName,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":[{"ctrlr":"virtio-scsi-42","cpumask":"0x1","delay_base_us":0,"iops_threshold":60000,"socket":"/var/tmp/virtio-scsi-42","backend_specific":{}}]}`},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"controller gone from SPDK": {
+			in:      testScsiLunName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":0,"message":""},"result":[]}`},
+			errCode: codes.InvalidArgument,
+			errMsg:  fmt.Sprintf("expecting exactly 1 result, got %d", 0),
+		},
+		"valid request with error code from SPDK response": {
+			in:      testScsiLunName,
+			out:     nil,
+			spdk:    []string{`{"id":%d,"error":{"code":1,"message":"myopierr"}}`},
+			errCode: codes.Unknown,
+			errMsg:  fmt.Sprintf("vhost_get_controllers: %v", "json response error: myopierr"),
+		},
+		"valid request with unknown key": {
+			in:      utils.ResourceIDToVolumeName("unknown-id"),
+			out:     nil,
+			spdk:    []string{},
+			errCode: codes.NotFound,
+			errMsg:  fmt.Sprintf("unable to find key %v", utils.ResourceIDToVolumeName("unknown-id")),
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			testEnv := createTestEnvironment(tt.spdk)
+			defer testEnv.Close()
+
+			testEnv.opiSpdkServer.Virt.ScsiCtrls[testScsiCtrlName] = &pb.VirtioScsiController{Name: testScsiCtrlName}
+			testEnv.opiSpdkServer.Virt.ScsiLuns[testScsiLunName] = utils.ProtoClone(testScsiLunWithName)
+
+			request := &pb.GetVirtioScsiLunRequest{Name: tt.in}
+			response, err := testEnv.client.GetVirtioScsiLun(testEnv.ctx, request)
 
+			if !proto.Equal(tt.out, response) {
+				t.Error("response: expected", tt.out, "received", response)
+			}
+			checkScsiGrpcError(t, err, tt.errCode, tt.errMsg)
+		})
+	}
 }
 
 func TestFrontEnd_StatsVirtioScsiLun(_ *testing.T) {
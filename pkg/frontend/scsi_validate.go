@@ -3,3 +3,74 @@
 
 // Package frontend implememnts the FrontEnd APIs (host facing) of the storage Server
 package frontend
+
+import (
+	"go.einride.tech/aip/fieldbehavior"
+	"go.einride.tech/aip/resourceid"
+	"go.einride.tech/aip/resourcename"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+)
+
+func (s *Server) validateCreateVirtioScsiControllerRequest(in *pb.CreateVirtioScsiControllerRequest) error {
+	// check required fields
+	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
+		return err
+	}
+	// see https://google.aip.dev/133#user-specified-ids
+	if in.VirtioScsiControllerId != "" {
+		if err := resourceid.ValidateUserSettable(in.VirtioScsiControllerId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) validateDeleteVirtioScsiControllerRequest(in *pb.DeleteVirtioScsiControllerRequest) error {
+	// check required fields
+	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
+		return err
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Name)
+}
+
+func (s *Server) validateCreateVirtioScsiLunRequest(in *pb.CreateVirtioScsiLunRequest) error {
+	// check required fields
+	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
+		return err
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	if err := resourcename.Validate(in.VirtioScsiLun.TargetNameRef); err != nil {
+		return err
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	if err := resourcename.Validate(in.VirtioScsiLun.VolumeNameRef); err != nil {
+		return err
+	}
+	// see https://google.aip.dev/133#user-specified-ids
+	if in.VirtioScsiLunId != "" {
+		if err := resourceid.ValidateUserSettable(in.VirtioScsiLunId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) validateDeleteVirtioScsiLunRequest(in *pb.DeleteVirtioScsiLunRequest) error {
+	// check required fields
+	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
+		return err
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Name)
+}
+
+func (s *Server) validateListVirtioScsiLunsRequest(in *pb.ListVirtioScsiLunsRequest) error {
+	// check required fields
+	if err := fieldbehavior.ValidateRequiredFields(in); err != nil {
+		return err
+	}
+	// Validate that a resource name conforms to the restrictions outlined in AIP-122.
+	return resourcename.Validate(in.Parent)
+}
@@ -29,12 +29,19 @@ type NvmeTransport interface {
 // VirtioBlkTransport interface is used to provide SPDK call params to create/delete
 // virtio-blk controllers depending on used transport type.
 type VirtioBlkTransport interface {
+	CreateMethod() string
 	CreateParams(virtioBlk *pb.VirtioBlk) (any, error)
+	DeleteMethod() string
 	DeleteParams(virtioBlk *pb.VirtioBlk) (any, error)
 }
 
 type nvmeTCPTransport struct {
-	rpc spdk.JSONRPC
+	rpc     spdk.JSONRPC
+	options NvmfTransportOptions
+	// ready is set once TCP transport is known to exist in SPDK
+	ready bool
+	// listeners are shared by controllers with the same fabrics address
+	listeners nvmfListeners
 }
 
 // build time check that struct implements interface
@@ -42,12 +49,23 @@ var _ NvmeTransport = (*nvmeTCPTransport)(nil)
 
 // NewNvmeTCPTransport creates a new instance of nvmeTcpTransport
 func NewNvmeTCPTransport(rpc spdk.JSONRPC) NvmeTransport {
+	return NewNvmeTCPTransportWithOptions(rpc, NvmfTransportOptions{})
+}
+
+// NewNvmeTCPTransportWithOptions creates a new instance of nvmeTcpTransport
+// which creates missing SPDK TCP transport with provided options on first use
+func NewNvmeTCPTransportWithOptions(rpc spdk.JSONRPC, options NvmfTransportOptions) NvmeTransport {
 	if rpc == nil {
 		log.Panicf("rpc cannot be nil")
 	}
+	if err := validateNvmfTransport("TCP", options); err != nil {
+		log.Panicf("invalid TCP transport options: %v", err)
+	}
 
 	return &nvmeTCPTransport{
-		rpc: rpc,
+		rpc:       rpc,
+		options:   options,
+		listeners: nvmfListeners{},
 	}
 }
 
@@ -56,9 +74,27 @@ func (c *nvmeTCPTransport) CreateController(
 	ctrlr *pb.NvmeController,
 	subsys *pb.NvmeSubsystem,
 ) error {
+	if !c.ready {
+		if err := EnsureNvmfTransport(ctx, c.rpc, "TCP", c.options); err != nil {
+			return err
+		}
+		c.ready = true
+	}
 	params := c.params(ctrlr, subsys)
+	create, err := c.listeners.acquire(&params)
+	if err != nil || !create {
+		return err
+	}
+	existing, err := getNvmfListener(ctx, c.rpc, &params)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		c.listeners.adopt(&params)
+		return nil
+	}
 	var result spdk.NvmfSubsystemAddListenerResult
-	err := c.rpc.Call(ctx, "nvmf_subsystem_add_listener", &params, &result)
+	err = c.rpc.Call(ctx, "nvmf_subsystem_add_listener", &params, &result)
 	if err != nil {
 		return err
 	}
@@ -67,6 +103,7 @@ func (c *nvmeTCPTransport) CreateController(
 		msg := fmt.Sprintf("Could not create CTRL: %s", ctrlr.Name)
 		return status.Errorf(codes.InvalidArgument, msg)
 	}
+	c.listeners.add(&params)
 
 	return nil
 }
@@ -77,6 +114,9 @@ func (c *nvmeTCPTransport) DeleteController(
 	subsys *pb.NvmeSubsystem,
 ) error {
 	params := c.params(ctrlr, subsys)
+	if !c.listeners.release(&params) {
+		return nil
+	}
 	var result spdk.NvmfSubsystemAddListenerResult
 	err := c.rpc.Call(ctx, "nvmf_subsystem_remove_listener", &params, &result)
 	if err != nil {
@@ -87,6 +127,7 @@ func (c *nvmeTCPTransport) DeleteController(
 		msg := fmt.Sprintf("Could not delete CTRL: %s", ctrlr.Name)
 		return status.Errorf(codes.InvalidArgument, msg)
 	}
+	c.listeners.remove(&params)
 
 	return nil
 }
@@ -116,6 +157,10 @@ func NewVhostUserBlkTransport() VirtioBlkTransport {
 	return &vhostUserBlkTransport{}
 }
 
+func (v vhostUserBlkTransport) CreateMethod() string {
+	return "vhost_create_blk_controller"
+}
+
 func (v vhostUserBlkTransport) CreateParams(virtioBlk *pb.VirtioBlk) (any, error) {
 	if err := v.verifyTransportSpecificParams(virtioBlk); err != nil {
 		return nil, err
@@ -128,6 +173,10 @@ func (v vhostUserBlkTransport) CreateParams(virtioBlk *pb.VirtioBlk) (any, error
 	}, nil
 }
 
+func (v vhostUserBlkTransport) DeleteMethod() string {
+	return "vhost_delete_controller"
+}
+
 func (v vhostUserBlkTransport) DeleteParams(virtioBlk *pb.VirtioBlk) (any, error) {
 	if err := v.verifyTransportSpecificParams(virtioBlk); err != nil {
 		return nil, err
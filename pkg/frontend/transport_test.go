@@ -38,7 +38,51 @@ func TestNewNvmeVfiouserTransport(t *testing.T) {
 
 			gotTransport := NewNvmeTCPTransport(tt.rpc)
 			wantTransport := &nvmeTCPTransport{
-				rpc: tt.rpc,
+				rpc:       tt.rpc,
+				listeners: nvmfListeners{},
+			}
+
+			if !reflect.DeepEqual(gotTransport, wantTransport) {
+				t.Errorf("Received transport %v not equal to expected one %v", gotTransport, wantTransport)
+			}
+		})
+	}
+}
+
+func TestNewNvmeTCPTransportWithOptions(t *testing.T) {
+	tests := map[string]struct {
+		options   NvmfTransportOptions
+		wantPanic bool
+	}{
+		"default options": {
+			options:   NvmfTransportOptions{},
+			wantPanic: false,
+		},
+		"tuned options": {
+			options:   NvmfTransportOptions{IoUnitSize: 131072, MaxQueueDepth: 256, SockPriority: 1, ZeroCopy: true},
+			wantPanic: false,
+		},
+		"negative options": {
+			options:   NvmfTransportOptions{NumSharedBuffers: -1},
+			wantPanic: true,
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if (r != nil) != tt.wantPanic {
+					t.Errorf("NewNvmeTCPTransportWithOptions() recover = %v, wantPanic = %v", r, tt.wantPanic)
+				}
+			}()
+
+			rpc := spdk.NewClient("/some/path")
+			gotTransport := NewNvmeTCPTransportWithOptions(rpc, tt.options)
+			wantTransport := &nvmeTCPTransport{
+				rpc:       rpc,
+				options:   tt.options,
+				listeners: nvmfListeners{},
 			}
 
 			if !reflect.DeepEqual(gotTransport, wantTransport) {
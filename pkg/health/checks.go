@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package health reports serving status of the bridge services based on
+// availability of dependencies they use
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/opiproject/gospdk/spdk"
+	"github.com/philippgille/gokv"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// storeCheckKey is a key read to check that the store is reachable
+const storeCheckKey = "opi-spdk-bridge/health"
+
+// Spdk checks that SPDK JSON-RPC socket at address answers spdk_get_version.
+// The check uses its own connection, since spdk.Client exits the process if
+// SPDK socket cannot be dialed.
+func Spdk(address string) Check {
+	protocol := "tcp"
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		protocol = "unix"
+	}
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, protocol, address)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = conn.Close() }()
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		} else {
+			_ = conn.SetDeadline(time.Now().Add(time.Minute))
+		}
+
+		request := spdk.RPCRequest{RPCVersion: spdk.JSONRPCVersion, ID: 1, Method: "spdk_get_version"}
+		if err := json.NewEncoder(conn).Encode(request); err != nil {
+			return err
+		}
+		var response spdk.RPCResponse
+		if err := json.NewDecoder(conn).Decode(&response); err != nil {
+			return err
+		}
+		if response.Error.Code != 0 {
+			return fmt.Errorf("spdk_get_version: %v", response.Error.Message)
+		}
+		return nil
+	}
+}
+
+// Store checks that gokv store is reachable
+func Store(store gokv.Store) Check {
+	return func(_ context.Context) error {
+		_, err := store.Get(storeCheckKey, &wrapperspb.StringValue{})
+		return err
+	}
+}
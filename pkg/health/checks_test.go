@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package health reports serving status of the bridge services based on
+// availability of dependencies they use
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opiproject/gospdk/spdk"
+	"github.com/philippgille/gokv/gomap"
+
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+// serveTestSpdk answers every request on a unix socket with response
+func serveTestSpdk(t *testing.T, response string) string {
+	address := filepath.Join(t.TempDir(), "spdk.sock")
+	lis, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			var request spdk.RPCRequest
+			if err := json.NewDecoder(conn).Decode(&request); err == nil && request.Method == "spdk_get_version" {
+				_, _ = fmt.Fprint(conn, response)
+			}
+			_ = conn.Close()
+		}
+	}()
+	return address
+}
+
+func TestSpdk(t *testing.T) {
+	tests := map[string]struct {
+		response string
+		noSocket bool
+		errMsg   string
+	}{
+		"spdk answers": {
+			response: `{"jsonrpc":"2.0","id":1,"result":{"version":"SPDK v24.01"}}`,
+			errMsg:   "",
+		},
+		"spdk responds with error": {
+			response: `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method not found"}}`,
+			errMsg:   "spdk_get_version: Method not found",
+		},
+		"spdk socket does not exist": {
+			noSocket: true,
+			errMsg:   "no such file or directory",
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			address := filepath.Join(t.TempDir(), "spdk.sock")
+			if !tt.noSocket {
+				address = serveTestSpdk(t, tt.response)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			err := Spdk(address)(ctx)
+
+			errMsg := ""
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if !strings.Contains(errMsg, tt.errMsg) || (tt.errMsg == "" && err != nil) {
+				t.Errorf("Expected error containing %q, received %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	options := gomap.DefaultOptions
+	options.Codec = utils.ProtoCodec{}
+	store := gomap.NewStore(options)
+
+	if err := Store(store)(context.Background()); err != nil {
+		t.Errorf("Expected reachable store, received %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package health reports serving status of the bridge services based on
+// availability of dependencies they use
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	grpchealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var errNotChecked = errors.New("not checked yet")
+
+// Check verifies that a dependency is available
+type Check func(ctx context.Context) error
+
+// Checker periodically runs dependency checks and sets serving status of
+// gRPC services depending on them in the standard grpc.health.v1 service.
+// The overall status of the server is serving if all dependencies are
+// available.
+type Checker struct {
+	server  *grpchealth.Server
+	timeout time.Duration
+
+	mu       sync.Mutex
+	checks   map[string]Check
+	services map[string][]string
+	// results keep error of the last check of every dependency
+	results  map[string]error
+	shutdown bool
+}
+
+// NewChecker creates Checker limiting every dependency check by timeout.
+// Services are not serving until dependencies are checked.
+func NewChecker(timeout time.Duration) *Checker {
+	server := grpchealth.NewServer()
+	server.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	return &Checker{
+		server:   server,
+		timeout:  timeout,
+		checks:   map[string]Check{},
+		services: map[string][]string{},
+		results:  map[string]error{},
+	}
+}
+
+// Server returns grpc.health.v1 service to register on gRPC server
+func (c *Checker) Server() grpc_health_v1.HealthServer {
+	return c.server
+}
+
+// AddDependency adds a named dependency verified by check
+func (c *Checker) AddDependency(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+	c.results[name] = errNotChecked
+}
+
+// AddService adds gRPC service which is serving only if all dependencies
+// are available
+func (c *Checker) AddService(service string, dependencies ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.services[service] = append(c.services[service], dependencies...)
+	c.updateLocked()
+}
+
+// CheckNow runs all dependency checks concurrently and updates serving
+// status of the services
+func (c *Checker) CheckNow(ctx context.Context) {
+	c.mu.Lock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var resultsMu sync.Mutex
+	results := map[string]error{}
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			err := c.runCheck(ctx, check)
+			resultsMu.Lock()
+			results[name] = err
+			resultsMu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, err := range results {
+		prev := c.results[name]
+		switch {
+		case err != nil && (prev == nil || prev == errNotChecked):
+			log.Printf("Dependency %v became unavailable: %v", name, err)
+		case err == nil && prev != nil:
+			log.Printf("Dependency %v is available", name)
+		}
+		c.results[name] = err
+	}
+	c.updateLocked()
+}
+
+// runCheck runs check limited by timeout. Checks of dependencies which do
+// not support cancellation are left running in background on timeout.
+func (c *Checker) runCheck(ctx context.Context, check Check) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run checks dependencies every interval until ctx is done
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.CheckNow(ctx)
+		}
+	}
+}
+
+// Shutdown sets all services not serving and keeps them so regardless of
+// further checks. It is called when the server starts draining.
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shutdown = true
+	c.server.Shutdown()
+}
+
+func (c *Checker) updateLocked() {
+	if c.shutdown {
+		return
+	}
+	all := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		all = append(all, name)
+	}
+	c.server.SetServingStatus("", c.statusLocked(all))
+	for service, dependencies := range c.services {
+		c.server.SetServingStatus(service, c.statusLocked(dependencies))
+	}
+}
+
+func (c *Checker) statusLocked(dependencies []string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	for _, name := range dependencies {
+		if err, ok := c.results[name]; !ok || err != nil {
+			return grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	return grpc_health_v1.HealthCheckResponse_SERVING
+}
+
+// LivenessHandler reports the process is alive
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+}
+
+// ReadinessHandler reports status of every dependency and responds with
+// 503 Service Unavailable if any of them is unavailable or the server is
+// shutting down
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		c.mu.Lock()
+		ready := !c.shutdown
+		names := make([]string, 0, len(c.results))
+		for name := range c.results {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var body strings.Builder
+		if c.shutdown {
+			body.WriteString("shutting down\n")
+		}
+		for _, name := range names {
+			if err := c.results[name]; err != nil {
+				ready = false
+				fmt.Fprintf(&body, "%v: %v\n", name, err)
+			} else {
+				fmt.Fprintf(&body, "%v: ok\n", name)
+			}
+		}
+		c.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = w.Write([]byte(body.String()))
+	})
+}
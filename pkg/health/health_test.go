@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package health reports serving status of the bridge services based on
+// availability of dependencies they use
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	testFrontendService = "opi_api.storage.v1.FrontendNvmeService"
+	testBackendService  = "opi_api.storage.v1.AioVolumeService"
+)
+
+func newTestChecker(spdkErr, vmErr *error) *Checker {
+	c := NewChecker(50 * time.Millisecond)
+	c.AddDependency("spdk", func(context.Context) error { return *spdkErr })
+	c.AddDependency("vm", func(context.Context) error { return *vmErr })
+	c.AddService(testFrontendService, "spdk", "vm")
+	c.AddService(testBackendService, "spdk")
+	return c
+}
+
+func servingStatus(t *testing.T, c *Checker, service string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	response, err := c.Server().Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("Failed to check %v: %v", service, err)
+	}
+	return response.Status
+}
+
+func TestCheckNow(t *testing.T) {
+	serving := grpc_health_v1.HealthCheckResponse_SERVING
+	notServing := grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	tests := map[string]struct {
+		spdkErr         error
+		vmErr           error
+		overall         grpc_health_v1.HealthCheckResponse_ServingStatus
+		frontend        grpc_health_v1.HealthCheckResponse_ServingStatus
+		backend         grpc_health_v1.HealthCheckResponse_ServingStatus
+		readyStatusCode int
+		readyBody       string
+	}{
+		"all dependencies available": {
+			overall:         serving,
+			frontend:        serving,
+			backend:         serving,
+			readyStatusCode: http.StatusOK,
+			readyBody:       "spdk: ok\nvm: ok\n",
+		},
+		"vm is not reachable": {
+			vmErr:           errors.New("connection refused"),
+			overall:         notServing,
+			frontend:        notServing,
+			backend:         serving,
+			readyStatusCode: http.StatusServiceUnavailable,
+			readyBody:       "spdk: ok\nvm: connection refused\n",
+		},
+		"spdk is not reachable": {
+			spdkErr:         errors.New("no such file or directory"),
+			overall:         notServing,
+			frontend:        notServing,
+			backend:         notServing,
+			readyStatusCode: http.StatusServiceUnavailable,
+			readyBody:       "spdk: no such file or directory\nvm: ok\n",
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			spdkErr, vmErr := tt.spdkErr, tt.vmErr
+			c := newTestChecker(&spdkErr, &vmErr)
+
+			c.CheckNow(context.Background())
+
+			if status := servingStatus(t, c, ""); status != tt.overall {
+				t.Errorf("Expected overall status %v, received %v", tt.overall, status)
+			}
+			if status := servingStatus(t, c, testFrontendService); status != tt.frontend {
+				t.Errorf("Expected frontend status %v, received %v", tt.frontend, status)
+			}
+			if status := servingStatus(t, c, testBackendService); status != tt.backend {
+				t.Errorf("Expected backend status %v, received %v", tt.backend, status)
+			}
+			recorder := httptest.NewRecorder()
+			c.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if recorder.Code != tt.readyStatusCode {
+				t.Errorf("Expected readiness code %v, received %v", tt.readyStatusCode, recorder.Code)
+			}
+			if recorder.Body.String() != tt.readyBody {
+				t.Errorf("Expected readiness body %q, received %q", tt.readyBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestStatusFlipsWithDependency(t *testing.T) {
+	var spdkErr, vmErr error
+	c := newTestChecker(&spdkErr, &vmErr)
+	if status := servingStatus(t, c, testBackendService); status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected service not serving before first check, received %v", status)
+	}
+
+	c.CheckNow(context.Background())
+	if status := servingStatus(t, c, testBackendService); status != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("Expected service serving, received %v", status)
+	}
+
+	spdkErr = errors.New("connection refused")
+	c.CheckNow(context.Background())
+	if status := servingStatus(t, c, testBackendService); status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected service not serving after SPDK went away, received %v", status)
+	}
+
+	spdkErr = nil
+	c.CheckNow(context.Background())
+	if status := servingStatus(t, c, testBackendService); status != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("Expected service serving after SPDK is back, received %v", status)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	c := NewChecker(10 * time.Millisecond)
+	unblock := make(chan struct{})
+	defer close(unblock)
+	c.AddDependency("spdk", func(context.Context) error {
+		<-unblock
+		return nil
+	})
+
+	c.CheckNow(context.Background())
+
+	if status := servingStatus(t, c, ""); status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected not serving on hung dependency, received %v", status)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var spdkErr, vmErr error
+	c := newTestChecker(&spdkErr, &vmErr)
+	c.CheckNow(context.Background())
+
+	c.Shutdown()
+	c.CheckNow(context.Background())
+
+	if status := servingStatus(t, c, testFrontendService); status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected not serving after shutdown, received %v", status)
+	}
+	recorder := httptest.NewRecorder()
+	c.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness code %v, received %v", http.StatusServiceUnavailable, recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	c.LivenessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected liveness code %v, received %v", http.StatusOK, recorder.Code)
+	}
+}
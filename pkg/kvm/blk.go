@@ -20,77 +20,106 @@ func (s *Server) CreateVirtioBlk(ctx context.Context, in *pb.CreateVirtioBlkRequ
 		return nil, errNoPcieEndpoint
 	}
 
-	location, err := s.locator.Calculate(in.VirtioBlk.PcieId)
+	v, err := s.vmForEndpoint(in.VirtioBlk.PcieId)
+	if err != nil {
+		return nil, err
+	}
+
+	_, vfiouserBlk := s.Server.VirtioBlkTransport().(*virtioBlkVfiouserTransport)
+	location, err := v.locator.Calculate(in.VirtioBlk.PcieId)
 	if err != nil {
 		log.Println("Failed to calculate device location:", err)
 		return nil, errDeviceEndpoint
 	}
 
+	op := s.journal.begin(&journalEntry{
+		Operation: operationCreate,
+		Object:    objectVirtioBlk,
+		VMID:      v.config.ID,
+		Vfiouser:  vfiouserBlk,
+	})
 	out, err := s.Server.CreateVirtioBlk(ctx, in)
 	if err != nil {
 		log.Println("Error running cmd on opi-spdk bridge:", err)
+		s.journal.finish(op)
 		return out, err
 	}
+	s.journal.created(op, out.Name, out, nil)
 
-	mon, err := newMonitor(s.qmpAddress, s.protocol, s.timeout, s.pollDevicePresenceStep)
+	mon, err := v.connectMonitor()
 	if err != nil {
 		log.Println("Couldn't create QEMU monitor")
-		_, _ = s.Server.DeleteVirtioBlk(context.Background(), &pb.DeleteVirtioBlkRequest{Name: out.Name})
+		s.rollback(op, nil)
 		return nil, errMonitorCreation
 	}
-	defer mon.Disconnect()
-
-	ctrlr := filepath.Join(s.ctrlrDir, filepath.Base(out.Name))
-	qemuChardevID := toQemuID(out.Name)
-	if err := mon.AddChardev(qemuChardevID, ctrlr); err != nil {
-		log.Println("Couldn't add chardev:", err)
-		_, _ = s.Server.DeleteVirtioBlk(context.Background(), &pb.DeleteVirtioBlkRequest{Name: out.Name})
-		return nil, errAddChardevFailed
-	}
 
-	qemuDevID := toQemuID(out.Name)
-	if err = mon.AddVirtioBlkDevice(qemuDevID, qemuChardevID, location); err != nil {
-		log.Println("Couldn't add device:", err)
-		_ = mon.DeleteChardev(qemuDevID)
-		_, _ = s.Server.DeleteVirtioBlk(context.Background(), &pb.DeleteVirtioBlkRequest{Name: out.Name})
-		return nil, errAddDeviceFailed
+	if err := s.plugVirtioBlk(mon, v, out, location, op); err != nil {
+		s.rollback(op, mon)
+		return nil, err
 	}
+	s.journal.finish(op)
 
 	return out, nil
 }
 
-// DeleteVirtioBlk deletes a virtio-blk device and detaches it from QEMU instance
-func (s *Server) DeleteVirtioBlk(ctx context.Context, in *pb.DeleteVirtioBlkRequest) (*emptypb.Empty, error) {
-	mon, monErr := newMonitor(s.qmpAddress, s.protocol, s.timeout, s.pollDevicePresenceStep)
-	if monErr != nil {
-		log.Println("Couldn't create QEMU monitor")
-		return nil, errMonitorCreation
+// plugVirtioBlk reserves location and adds QEMU device (and chardev for
+// vhost-user) of virtio-blk created in SPDK. Added objects are recorded in
+// op, so that they are removed if the operation is rolled back.
+func (s *Server) plugVirtioBlk(mon hypervisor, v *vm, virtioBlk *pb.VirtioBlk, location deviceLocation, op *journalEntry) error {
+	qemuDevID := toQemuID(virtioBlk.Name)
+	location, err := v.reserveLocation(mon, qemuDevID, location)
+	if err != nil {
+		return err
+	}
+
+	socketPath := filepath.Join(v.config.CtrlrDir, filepath.Base(virtioBlk.Name))
+	if _, ok := s.Server.VirtioBlkTransport().(*virtioBlkVfiouserTransport); ok {
+		if err := mon.AddVfiouserDevice(qemuDevID, socketPath, location); err != nil {
+			log.Println("Couldn't add device:", err)
+			v.locator.Release(qemuDevID)
+			return errAddDeviceFailed
+		}
+		s.journal.stepDone(op, stepDevice)
+		return nil
 	}
-	defer mon.Disconnect()
 
-	qemuDeviceID := toQemuID(in.Name)
-	delDevErr := mon.DeleteVirtioBlkDevice(qemuDeviceID)
-	if delDevErr != nil {
-		log.Printf("Couldn't delete virtio-blk: %v", delDevErr)
+	qemuChardevID := toQemuID(virtioBlk.Name)
+	if err := mon.AddChardev(qemuChardevID, socketPath); err != nil {
+		log.Println("Couldn't add chardev:", err)
+		v.locator.Release(qemuDevID)
+		return errAddChardevFailed
 	}
+	s.journal.stepDone(op, stepChardev)
 
-	qemuChardevID := toQemuID(in.Name)
-	delChardevErr := mon.DeleteChardev(qemuChardevID)
-	if delChardevErr != nil {
-		log.Printf("Couldn't delete chardev for virtio-blk: %v. Device is partially deleted", delChardevErr)
+	if err := mon.AddVirtioBlkDevice(qemuDevID, qemuChardevID, location); err != nil {
+		log.Println("Couldn't add device:", err)
+		if mon.DeleteChardev(qemuChardevID) == nil {
+			s.journal.stepUndone(op, stepChardev)
+		}
+		v.locator.Release(qemuDevID)
+		return errAddDeviceFailed
 	}
+	s.journal.stepDone(op, stepDevice)
+	return nil
+}
 
-	response, spdkErr := s.Server.DeleteVirtioBlk(ctx, in)
-	if spdkErr != nil {
-		log.Println("Error running underlying cmd on opi-spdk bridge:", spdkErr)
+// DeleteVirtioBlk deletes a virtio-blk device and detaches it from QEMU instance
+func (s *Server) DeleteVirtioBlk(ctx context.Context, in *pb.DeleteVirtioBlkRequest) (*emptypb.Empty, error) {
+	virtioBlk, ok := s.Virt.BlkCtrls[in.Name]
+	if !ok {
+		return s.Server.DeleteVirtioBlk(ctx, in)
+	}
+	v, vmErr := s.vmForEndpoint(virtioBlk.PcieId)
+	if vmErr != nil {
+		return nil, vmErr
 	}
 
-	var err error
-	if delDevErr != nil && delChardevErr != nil && spdkErr != nil {
-		err = errDeviceNotDeleted
-	} else if delDevErr != nil || delChardevErr != nil || spdkErr != nil {
-		err = errDevicePartiallyDeleted
+	mon, monErr := v.connectMonitor()
+	if monErr != nil {
+		log.Println("Couldn't create QEMU monitor")
+		return nil, errMonitorCreation
 	}
 
-	return response, err
+	op := s.beginDelete(objectVirtioBlk, in.Name, v, virtioBlk)
+	return s.runDelete(ctx, op, mon)
 }
@@ -74,7 +74,8 @@ func TestCreateVirtioBlk(t *testing.T) {
 			errCode: status.Convert(errAddChardevFailed).Code(),
 			errMsg:  status.Convert(errAddChardevFailed).Message(),
 			mockQmpCalls: newMockQmpCalls().
-				ExpectAddChardev(testVirtioBlkID).WithErrorResponse(),
+				ExpectAddChardev(testVirtioBlkID).WithErrorResponse().
+				ExpectQueryChardev(),
 		},
 		"qemu device add failed": {
 			in:      testCreateVirtioBlkRequest,
@@ -84,8 +85,19 @@ func TestCreateVirtioBlk(t *testing.T) {
 			mockQmpCalls: newMockQmpCalls().
 				ExpectAddChardev(testVirtioBlkID).
 				ExpectAddVirtioBlk(testVirtioBlkID, testVirtioBlkID).WithErrorResponse().
+				ExpectNoDeviceQueryPci().
 				ExpectDeleteChardev(testVirtioBlkID),
 		},
+		"virtio-blk is already plugged": {
+			in:      testCreateVirtioBlkRequest,
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			out:     expectNotNilOut,
+			mockQmpCalls: newMockQmpCalls().
+				ExpectAddChardev(testVirtioBlkID).WithErrorResponse().
+				ExpectQueryChardev(testVirtioBlkID).
+				ExpectAddVirtioBlk(testVirtioBlkID, testVirtioBlkID).WithErrorResponse().
+				ExpectQueryPci(testVirtioBlkID),
+		},
 		"failed to create monitor": {
 			in:                   testCreateVirtioBlkRequest,
 			nonDefaultQmpAddress: "/dev/null",
@@ -114,6 +126,7 @@ func TestCreateVirtioBlk(t *testing.T) {
 			jsonRPC: alwaysSuccessfulJSONRPC,
 			buses:   []string{"pci.opi.0", "pci.opi.1"},
 			mockQmpCalls: newMockQmpCalls().
+				ExpectNoDeviceQueryPci().
 				ExpectAddChardev(testVirtioBlkID).
 				ExpectAddVirtioBlkWithAddress(testVirtioBlkID, testVirtioBlkID, "pci.opi.0", 1).
 				ExpectQueryPci(testVirtioBlkID),
@@ -124,10 +137,21 @@ func TestCreateVirtioBlk(t *testing.T) {
 			jsonRPC: alwaysSuccessfulJSONRPC,
 			buses:   []string{"pci.opi.0", "pci.opi.1"},
 			mockQmpCalls: newMockQmpCalls().
+				ExpectNoDeviceQueryPci().
 				ExpectAddChardev(testVirtioBlkID).
 				ExpectAddVirtioBlkWithAddress(testVirtioBlkID, testVirtioBlkID, "pci.opi.1", 10).
 				ExpectQueryPci(testVirtioBlkID),
 		},
+		"virtio-blk location is used by another device": {
+			in:      testCreateVirtioBlkRequest,
+			out:     nil,
+			errCode: codes.FailedPrecondition,
+			errMsg:  "PCI address pci.opi.1:0xa.0x0 is already used by opi-other-blk",
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			buses:   []string{"pci.opi.0", "pci.opi.1"},
+			mockQmpCalls: newMockQmpCalls().
+				ExpectQueryPciWithBusDevice("pci.opi.1", 10, "other-blk"),
+		},
 		"virtio-blk creation with physical function goes out of buses": {
 			in:      testCreateVirtioBlkRequest,
 			out:     nil,
@@ -226,6 +250,7 @@ func TestDeleteVirtioBlk(t *testing.T) {
 			errMsg:  status.Convert(errDevicePartiallyDeleted).Message(),
 			mockQmpCalls: newMockQmpCalls().
 				ExpectDeleteVirtioBlk(testVirtioBlkID).WithErrorResponse().
+				ExpectQueryPci(testVirtioBlkID).
 				ExpectDeleteChardev(testVirtioBlkID),
 		},
 		"qemu device delete failed by timeout": {
@@ -242,7 +267,8 @@ func TestDeleteVirtioBlk(t *testing.T) {
 			errMsg:  status.Convert(errDevicePartiallyDeleted).Message(),
 			mockQmpCalls: newMockQmpCalls().
 				ExpectDeleteVirtioBlkWithEvent(testVirtioBlkID).
-				ExpectDeleteChardev(testVirtioBlkID).WithErrorResponse(),
+				ExpectDeleteChardev(testVirtioBlkID).WithErrorResponse().
+				ExpectQueryChardev(testVirtioBlkID),
 		},
 		"spdk failed to delete virtio-blk": {
 			jsonRPC: alwaysFailingJSONRPC,
@@ -258,7 +284,17 @@ func TestDeleteVirtioBlk(t *testing.T) {
 			errMsg:  status.Convert(errDeviceNotDeleted).Message(),
 			mockQmpCalls: newMockQmpCalls().
 				ExpectDeleteVirtioBlk(testVirtioBlkID).WithErrorResponse().
-				ExpectDeleteChardev(testVirtioBlkID).WithErrorResponse(),
+				ExpectQueryPci(testVirtioBlkID).
+				ExpectDeleteChardev(testVirtioBlkID).WithErrorResponse().
+				ExpectQueryChardev(testVirtioBlkID),
+		},
+		"virtio-blk is already unplugged": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteVirtioBlk(testVirtioBlkID).WithErrorResponse().
+				ExpectNoDeviceQueryPci().
+				ExpectDeleteChardev(testVirtioBlkID).WithErrorResponse().
+				ExpectQueryChardev(),
 		},
 		"failed to create monitor": {
 			nonDefaultQmpAddress: "/dev/null",
@@ -306,3 +342,117 @@ func TestDeleteVirtioBlk(t *testing.T) {
 		})
 	}
 }
+
+func TestVfiouserVirtioBlk(t *testing.T) {
+	expectNotNilOut := utils.ProtoClone(testCreateVirtioBlkRequest.VirtioBlk)
+	expectNotNilOut.Name = testVirtioBlkName
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+
+	tests := map[string]struct {
+		jsonRPC spdk.JSONRPC
+		errCode codes.Code
+		errMsg  string
+		out     *pb.VirtioBlk
+
+		createQmpCalls *mockQmpCalls
+		deleteQmpCalls *mockQmpCalls
+		deleteErrCode  codes.Code
+		deleteErrMsg   string
+	}{
+		"valid virtio-blk creation and deletion": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			out:     expectNotNilOut,
+			createQmpCalls: newMockQmpCalls().
+				ExpectAddVirtioBlkVfiouser(testVirtioBlkID).
+				ExpectQueryPci(testVirtioBlkID),
+			deleteQmpCalls: newMockQmpCalls().
+				ExpectDeleteVirtioBlkVfiouser(testVirtioBlkID).
+				ExpectNoDeviceQueryPci(),
+		},
+		"qemu device add failed": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			errCode: status.Convert(errAddDeviceFailed).Code(),
+			errMsg:  status.Convert(errAddDeviceFailed).Message(),
+			createQmpCalls: newMockQmpCalls().
+				ExpectAddVirtioBlkVfiouser(testVirtioBlkID).WithErrorResponse().
+				ExpectNoDeviceQueryPci(),
+		},
+		"qemu device delete failed": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			out:     expectNotNilOut,
+			createQmpCalls: newMockQmpCalls().
+				ExpectAddVirtioBlkVfiouser(testVirtioBlkID).
+				ExpectQueryPci(testVirtioBlkID),
+			deleteQmpCalls: newMockQmpCalls().
+				ExpectDeleteVirtioBlkVfiouser(testVirtioBlkID).WithErrorResponse().
+				ExpectQueryPci(testVirtioBlkID),
+			deleteErrCode: status.Convert(errDevicePartiallyDeleted).Code(),
+			deleteErrMsg:  status.Convert(errDevicePartiallyDeleted).Message(),
+		},
+		"spdk failed to create virtio-blk": {
+			jsonRPC: alwaysFailingJSONRPC,
+			errCode: status.Convert(errStub).Code(),
+			errMsg:  status.Convert(errStub).Message(),
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qmpServer := startMockQmpServer(t, tt.createQmpCalls)
+			defer qmpServer.Stop()
+			options := gomap.DefaultOptions
+			options.Codec = utils.ProtoCodec{}
+			store := gomap.NewStore(options)
+			opiSpdkServer := frontend.NewCustomizedServer(tt.jsonRPC, store,
+				map[pb.NvmeTransportType]frontend.NvmeTransport{
+					pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP: frontend.NewNvmeTCPTransport(tt.jsonRPC),
+				},
+				NewVirtioBlkVfiouserTransport(qmpServer.testDir),
+			)
+			kvmServer := NewServer(opiSpdkServer, qmpServer.socketPath, qmpServer.testDir, nil)
+			kvmServer.timeout = qmplibTimeout
+
+			out, err := kvmServer.CreateVirtioBlk(context.Background(), utils.ProtoClone(testCreateVirtioBlkRequest))
+
+			if !proto.Equal(out, tt.out) {
+				t.Error("response: expected", tt.out, "received", out)
+			}
+			if er, ok := status.FromError(err); ok {
+				if er.Code() != tt.errCode {
+					t.Error("error code: expected", tt.errCode, "received", er.Code())
+				}
+				if er.Message() != tt.errMsg {
+					t.Error("error message: expected", tt.errMsg, "received", er.Message())
+				}
+			} else {
+				t.Errorf("expected grpc error status")
+			}
+			if !qmpServer.WereExpectedCallsPerformed() {
+				t.Errorf("Not all expected create calls were performed")
+			}
+			if tt.deleteQmpCalls == nil {
+				return
+			}
+
+			// QEMU restart is expected to be handled by reconnection
+			qmpServer.Restart(tt.deleteQmpCalls)
+			waitForMonitorDisconnected(t, kvmServer)
+
+			_, err = kvmServer.DeleteVirtioBlk(context.Background(), utils.ProtoClone(testDeleteVirtioBlkRequest))
+
+			if er, ok := status.FromError(err); ok {
+				if er.Code() != tt.deleteErrCode {
+					t.Error("error code: expected", tt.deleteErrCode, "received", er.Code())
+				}
+				if er.Message() != tt.deleteErrMsg {
+					t.Error("error message: expected", tt.deleteErrMsg, "received", er.Message())
+				}
+			} else {
+				t.Errorf("expected grpc error status")
+			}
+			if !qmpServer.WereExpectedCallsPerformed() {
+				t.Errorf("Not all expected delete calls were performed")
+			}
+		})
+	}
+}
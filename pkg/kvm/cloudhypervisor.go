@@ -0,0 +1,322 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errCloudHypervisorClosed   = errors.New("cloud-hypervisor client is closed")
+	errNoCloudHypervisorEvents = status.Error(codes.Unimplemented,
+		"VM events are not supported for cloud-hypervisor")
+)
+
+// cloudHypervisorAPI is a base URL of Cloud Hypervisor REST API. Host is
+// ignored, since requests are sent over API unix socket
+const cloudHypervisorAPI = "http://localhost/api/v1/"
+
+// cloudHypervisor plugs devices over Cloud Hypervisor REST API. It has no
+// chardevs, so vhost-user sockets of added chardevs are kept to pass them
+// on device creation.
+type cloudHypervisor struct {
+	apiSocket string
+	client    *http.Client
+
+	pollDevicePresenceTimeout time.Duration
+	pollDevicePresenceStep    time.Duration
+
+	mu       sync.Mutex
+	closed   bool
+	chardevs map[string]string
+}
+
+func newCloudHypervisor(apiSocket string,
+	timeout time.Duration, pollDevicePresenceStep time.Duration) *cloudHypervisor {
+	return &cloudHypervisor{
+		apiSocket: apiSocket,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, unixSocketProtocol, apiSocket)
+				},
+			},
+		},
+		pollDevicePresenceTimeout: timeout,
+		pollDevicePresenceStep:    pollDevicePresenceStep,
+		chardevs:                  map[string]string{},
+	}
+}
+
+// Connect checks Cloud Hypervisor API is reachable. Requests are sent over
+// short-lived HTTP connections, so there is nothing to keep open.
+func (c *cloudHypervisor) Connect() error {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return errCloudHypervisorClosed
+	}
+	if _, err := c.call(http.MethodGet, "vmm.ping", nil); err != nil {
+		log.Printf("Failed to connect to cloud-hypervisor: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Disconnect makes all further Connect calls fail
+func (c *cloudHypervisor) Disconnect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func (c *cloudHypervisor) AddChardev(id string, sockPath string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.chardevs[id] = sockPath
+	return nil
+}
+
+func (c *cloudHypervisor) DeleteChardev(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.chardevs, id)
+	return nil
+}
+
+func (c *cloudHypervisor) AddVirtioBlkDevice(id string, chardevID string, _ deviceLocation) error {
+	socket, err := c.chardevSocket(chardevID)
+	if err != nil {
+		return err
+	}
+	return c.addDevice(id, "vm.add-disk", struct {
+		ID          string `json:"id"`
+		VhostUser   bool   `json:"vhost_user"`
+		VhostSocket string `json:"vhost_socket"`
+	}{
+		ID:          id,
+		VhostUser:   true,
+		VhostSocket: socket,
+	})
+}
+
+func (c *cloudHypervisor) AddVirtioScsiDevice(string, string, deviceLocation) error {
+	return errors.New("virtio-scsi is not supported by cloud-hypervisor")
+}
+
+func (c *cloudHypervisor) AddNvmeControllerDevice(id string, ctrlrDir string, location deviceLocation) error {
+	return c.AddVfiouserDevice(id, filepath.Join(ctrlrDir, "cntrl"), location)
+}
+
+func (c *cloudHypervisor) AddVfiouserDevice(id string, socket string, _ deviceLocation) error {
+	return c.addDevice(id, "vm.add-user-device", struct {
+		ID     string `json:"id"`
+		Socket string `json:"socket"`
+	}{
+		ID:     id,
+		Socket: socket,
+	})
+}
+
+func (c *cloudHypervisor) DeleteVirtioBlkDevice(id string) error {
+	return c.DeleteDevice(id)
+}
+
+func (c *cloudHypervisor) DeleteVirtioScsiDevice(id string) error {
+	return c.DeleteDevice(id)
+}
+
+func (c *cloudHypervisor) DeleteNvmeControllerDevice(id string) error {
+	return c.DeleteDevice(id)
+}
+
+func (c *cloudHypervisor) DeleteVfiouserDevice(id string) error {
+	return c.DeleteDevice(id)
+}
+
+// DeleteDevice removes device of any type and waits until it disappears
+// from the VM device tree
+func (c *cloudHypervisor) DeleteDevice(id string) error {
+	_, err := c.call(http.MethodPut, "vm.remove-device", struct {
+		ID string `json:"id"`
+	}{ID: id})
+	if err != nil {
+		if exist, existErr := c.deviceExist(id); existErr == nil && !exist {
+			log.Printf("Device %v is already deleted", id)
+			return nil
+		}
+		return fmt.Errorf("couldn't delete device: %w", err)
+	}
+	return c.waitForDevicePresence(id, false)
+}
+
+// Ping checks Cloud Hypervisor API is reachable
+func (c *cloudHypervisor) Ping() error {
+	return c.Connect()
+}
+
+// QueryDeviceIDs returns IDs of all devices in the VM device tree
+func (c *cloudHypervisor) QueryDeviceIDs() (map[string]struct{}, error) {
+	info, err := c.vmInfo()
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]struct{}{}
+	for id := range info.DeviceTree {
+		ids[id] = struct{}{}
+	}
+	return ids, nil
+}
+
+// QueryChardevIDs returns IDs of kept vhost-user sockets
+func (c *cloudHypervisor) QueryChardevIDs() (map[string]struct{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := map[string]struct{}{}
+	for id := range c.chardevs {
+		ids[id] = struct{}{}
+	}
+	return ids, nil
+}
+
+// QueryPciAddresses returns no addresses, since cloud-hypervisor has no named
+// buses to calculate device locations on
+func (c *cloudHypervisor) QueryPciAddresses() (map[pciAddress]string, error) {
+	return map[pciAddress]string{}, nil
+}
+
+func (c *cloudHypervisor) SubscribeVMEvents() (<-chan VMEvent, error) {
+	return nil, errNoCloudHypervisorEvents
+}
+
+func (c *cloudHypervisor) UnsubscribeVMEvents(<-chan VMEvent) {}
+
+func (c *cloudHypervisor) chardevSocket(chardevID string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	socket, ok := c.chardevs[chardevID]
+	if !ok {
+		return "", fmt.Errorf("no vhost-user socket added for %v", chardevID)
+	}
+	return socket, nil
+}
+
+func (c *cloudHypervisor) addDevice(id string, endpoint string, body interface{}) error {
+	if _, err := c.call(http.MethodPut, endpoint, body); err != nil {
+		log.Println("cloud-hypervisor error:", err)
+		if exist, existErr := c.deviceExist(id); existErr == nil && exist {
+			log.Printf("Device %v already exists", id)
+			return nil
+		}
+		return fmt.Errorf("couldn't add device: %w", err)
+	}
+	return c.waitForDevicePresence(id, true)
+}
+
+func (c *cloudHypervisor) waitForDevicePresence(id string, shouldExist bool) error {
+	timeoutTimer := time.NewTimer(c.pollDevicePresenceTimeout)
+	defer timeoutTimer.Stop()
+	devicePresenceTicker := time.NewTicker(c.pollDevicePresenceStep)
+	defer devicePresenceTicker.Stop()
+	for {
+		select {
+		case <-timeoutTimer.C:
+			return fmt.Errorf("timeout waiting for device %v presence %v", id, shouldExist)
+		case <-devicePresenceTicker.C:
+			exist, err := c.deviceExist(id)
+			if err != nil {
+				log.Println("failed to check device existence:", err)
+				continue
+			}
+			if exist == shouldExist {
+				return nil
+			}
+		}
+	}
+}
+
+func (c *cloudHypervisor) deviceExist(id string) (bool, error) {
+	info, err := c.vmInfo()
+	if err != nil {
+		return false, err
+	}
+	_, ok := info.DeviceTree[id]
+	return ok, nil
+}
+
+// cloudHypervisorVMInfo is a part of vm.info response used by the bridge
+type cloudHypervisorVMInfo struct {
+	State      string                     `json:"state"`
+	DeviceTree map[string]json.RawMessage `json:"device_tree"`
+}
+
+func (c *cloudHypervisor) vmInfo() (*cloudHypervisorVMInfo, error) {
+	raw, err := c.call(http.MethodGet, "vm.info", nil)
+	if err != nil {
+		return nil, err
+	}
+	info := &cloudHypervisorVMInfo{}
+	if err := json.Unmarshal(raw, info); err != nil {
+		return nil, fmt.Errorf("couldn't parse vm.info response: %w", err)
+	}
+	return info, nil
+}
+
+// call sends request to Cloud Hypervisor API endpoint and returns response
+// body of a successful request
+func (c *cloudHypervisor) call(method string, endpoint string, body interface{}) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			log.Println("json marshalling error:", err)
+			return nil, fmt.Errorf("couldn't create cloud-hypervisor request: %w", err)
+		}
+		log.Printf("cloud-hypervisor request to send: %v %v", endpoint, string(bs))
+		reqBody = bytes.NewReader(bs)
+	}
+
+	req, err := http.NewRequest(method, cloudHypervisorAPI+endpoint, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("cloud-hypervisor %v returned %v: %s", endpoint, resp.StatusCode, raw)
+	}
+	return raw, nil
+}
@@ -0,0 +1,348 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/philippgille/gokv/gomap"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeCloudHypervisorRequest is a request received by fake cloud-hypervisor
+type fakeCloudHypervisorRequest struct {
+	endpoint string
+	body     map[string]interface{}
+}
+
+// fakeCloudHypervisor serves cloud-hypervisor REST API on a unix socket and
+// keeps device tree changed by add/remove requests
+type fakeCloudHypervisor struct {
+	server    *httptest.Server
+	testDir   string
+	apiSocket string
+
+	mu       sync.Mutex
+	devices  map[string]struct{}
+	failures map[string]struct{}
+	requests []fakeCloudHypervisorRequest
+}
+
+func startFakeCloudHypervisor(t *testing.T) *fakeCloudHypervisor {
+	testDir, err := os.MkdirTemp("", "opi-spdk-kvm-ch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := &fakeCloudHypervisor{
+		testDir:   testDir,
+		apiSocket: filepath.Join(testDir, "ch.sock"),
+		devices:   map[string]struct{}{},
+		failures:  map[string]struct{}{},
+	}
+	lis, err := net.Listen(unixSocketProtocol, ch.apiSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.server = httptest.NewUnstartedServer(http.HandlerFunc(ch.handle))
+	_ = ch.server.Listener.Close()
+	ch.server.Listener = lis
+	ch.server.Start()
+	return ch
+}
+
+func (ch *fakeCloudHypervisor) Stop() {
+	ch.server.Close()
+	_ = os.RemoveAll(ch.testDir)
+}
+
+// Fail makes requests to the endpoint fail without changing device tree
+func (ch *fakeCloudHypervisor) Fail(endpoint string) *fakeCloudHypervisor {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.failures[endpoint] = struct{}{}
+	return ch
+}
+
+// WithDevice adds device to device tree
+func (ch *fakeCloudHypervisor) WithDevice(id string) *fakeCloudHypervisor {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.devices[id] = struct{}{}
+	return ch
+}
+
+// Requests returns received requests except of vm.info polling
+func (ch *fakeCloudHypervisor) Requests() []fakeCloudHypervisorRequest {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return append([]fakeCloudHypervisorRequest{}, ch.requests...)
+}
+
+func (ch *fakeCloudHypervisor) handle(w http.ResponseWriter, r *http.Request) {
+	endpoint := filepath.Base(r.URL.Path)
+	var body map[string]interface{}
+	if raw, _ := io.ReadAll(r.Body); len(raw) != 0 {
+		_ = json.Unmarshal(raw, &body)
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if endpoint != "vm.info" {
+		ch.requests = append(ch.requests, fakeCloudHypervisorRequest{endpoint: endpoint, body: body})
+	}
+	if _, ok := ch.failures[endpoint]; ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	id, _ := body["id"].(string)
+	switch endpoint {
+	case "vmm.ping":
+		_, _ = w.Write([]byte(`{"version":"v38.0"}`))
+	case "vm.info":
+		tree := map[string]interface{}{}
+		for id := range ch.devices {
+			tree[id] = map[string]interface{}{"id": id}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"state": "Running", "device_tree": tree})
+	case "vm.add-disk", "vm.add-user-device":
+		ch.devices[id] = struct{}{}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "bdf": "0000:00:06.0"})
+	case "vm.remove-device":
+		if _, ok := ch.devices[id]; !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		delete(ch.devices, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestCloudHypervisorKvmServer(t *testing.T, ch *fakeCloudHypervisor) *Server {
+	options := gomap.DefaultOptions
+	options.Codec = utils.ProtoCodec{}
+	store := gomap.NewStore(options)
+	opiSpdkServer := frontend.NewCustomizedServer(alwaysSuccessfulJSONRPC, store,
+		map[pb.NvmeTransportType]frontend.NvmeTransport{
+			pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP: frontend.NewNvmeTCPTransport(alwaysSuccessfulJSONRPC),
+		},
+		NewVirtioBlkVhostUserTransport(),
+	)
+	kvmServer := NewServerWithVM(opiSpdkServer, VMConfig{
+		ID:         DefaultVMID,
+		PortID:     0,
+		Hypervisor: HypervisorCloudHypervisor,
+		APISocket:  ch.apiSocket,
+		CtrlrDir:   ch.testDir,
+	})
+	kvmServer.timeout = qmplibTimeout
+	t.Cleanup(func() { _ = kvmServer.Close() })
+	return kvmServer
+}
+
+func TestCloudHypervisorDevices(t *testing.T) {
+	testID := "opi-nvme-42"
+	testSocket := "/var/tmp/nvme-42/cntrl"
+	tests := map[string]struct {
+		existingDevice bool
+		failedEndpoint string
+		call           func(hv hypervisor) error
+		wantErr        bool
+		wantRequests   []fakeCloudHypervisorRequest
+		wantDevice     bool
+	}{
+		"add vfio-user device": {
+			call: func(hv hypervisor) error {
+				return hv.AddVfiouserDevice(testID, testSocket, deviceLocation{})
+			},
+			wantRequests: []fakeCloudHypervisorRequest{
+				{endpoint: "vm.add-user-device", body: map[string]interface{}{"id": testID, "socket": testSocket}},
+			},
+			wantDevice: true,
+		},
+		"add vhost-user disk": {
+			call: func(hv hypervisor) error {
+				_ = hv.AddChardev(testID, testSocket)
+				return hv.AddVirtioBlkDevice(testID, testID, deviceLocation{})
+			},
+			wantRequests: []fakeCloudHypervisorRequest{
+				{endpoint: "vm.add-disk", body: map[string]interface{}{
+					"id": testID, "vhost_user": true, "vhost_socket": testSocket,
+				}},
+			},
+			wantDevice: true,
+		},
+		"add vhost-user disk without socket": {
+			call: func(hv hypervisor) error {
+				return hv.AddVirtioBlkDevice(testID, testID, deviceLocation{})
+			},
+			wantErr:      true,
+			wantRequests: []fakeCloudHypervisorRequest{},
+		},
+		"add already existing device": {
+			existingDevice: true,
+			failedEndpoint: "vm.add-user-device",
+			call: func(hv hypervisor) error {
+				return hv.AddVfiouserDevice(testID, testSocket, deviceLocation{})
+			},
+			wantRequests: []fakeCloudHypervisorRequest{
+				{endpoint: "vm.add-user-device", body: map[string]interface{}{"id": testID, "socket": testSocket}},
+			},
+			wantDevice: true,
+		},
+		"failed to add device": {
+			failedEndpoint: "vm.add-user-device",
+			call: func(hv hypervisor) error {
+				return hv.AddVfiouserDevice(testID, testSocket, deviceLocation{})
+			},
+			wantErr: true,
+			wantRequests: []fakeCloudHypervisorRequest{
+				{endpoint: "vm.add-user-device", body: map[string]interface{}{"id": testID, "socket": testSocket}},
+			},
+		},
+		"delete device": {
+			existingDevice: true,
+			call: func(hv hypervisor) error {
+				return hv.DeleteDevice(testID)
+			},
+			wantRequests: []fakeCloudHypervisorRequest{
+				{endpoint: "vm.remove-device", body: map[string]interface{}{"id": testID}},
+			},
+		},
+		"delete already deleted device": {
+			call: func(hv hypervisor) error {
+				return hv.DeleteDevice(testID)
+			},
+			wantRequests: []fakeCloudHypervisorRequest{
+				{endpoint: "vm.remove-device", body: map[string]interface{}{"id": testID}},
+			},
+		},
+		"failed to delete device": {
+			existingDevice: true,
+			failedEndpoint: "vm.remove-device",
+			call: func(hv hypervisor) error {
+				return hv.DeleteDevice(testID)
+			},
+			wantErr: true,
+			wantRequests: []fakeCloudHypervisorRequest{
+				{endpoint: "vm.remove-device", body: map[string]interface{}{"id": testID}},
+			},
+			wantDevice: true,
+		},
+		"virtio-scsi is not supported": {
+			call: func(hv hypervisor) error {
+				_ = hv.AddChardev(testID, testSocket)
+				return hv.AddVirtioScsiDevice(testID, testID, deviceLocation{})
+			},
+			wantErr:      true,
+			wantRequests: []fakeCloudHypervisorRequest{},
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ch := startFakeCloudHypervisor(t)
+			defer ch.Stop()
+			if tt.existingDevice {
+				ch.WithDevice(testID)
+			}
+			if tt.failedEndpoint != "" {
+				ch.Fail(tt.failedEndpoint)
+			}
+			hv := newCloudHypervisor(ch.apiSocket, qmplibTimeout, 5*time.Millisecond)
+
+			err := tt.call(hv)
+
+			if (err != nil) != tt.wantErr {
+				t.Error("expected error", tt.wantErr, "received", err)
+			}
+			if requests := ch.Requests(); !reflect.DeepEqual(requests, tt.wantRequests) {
+				t.Error("expected requests", tt.wantRequests, "received", requests)
+			}
+			ids, err := hv.QueryDeviceIDs()
+			if err != nil {
+				t.Fatal("expected device tree, received", err)
+			}
+			if _, ok := ids[testID]; ok != tt.wantDevice {
+				t.Error("expected device presence", tt.wantDevice, "received", ok)
+			}
+		})
+	}
+}
+
+func TestCloudHypervisorVirtioBlk(t *testing.T) {
+	ch := startFakeCloudHypervisor(t)
+	defer ch.Stop()
+	kvmServer := newTestCloudHypervisorKvmServer(t, ch)
+	qemuID := toQemuID(testVirtioBlkName)
+
+	if _, err := kvmServer.CreateVirtioBlk(context.Background(), utils.ProtoClone(testCreateVirtioBlkRequest)); err != nil {
+		t.Fatal("expected virtio-blk to be created, received", err)
+	}
+	if _, err := kvmServer.DeleteVirtioBlk(context.Background(), testDeleteVirtioBlkRequest); err != nil {
+		t.Fatal("expected virtio-blk to be deleted, received", err)
+	}
+
+	want := []fakeCloudHypervisorRequest{
+		{endpoint: "vmm.ping"},
+		{endpoint: "vm.add-disk", body: map[string]interface{}{
+			"id":           qemuID,
+			"vhost_user":   true,
+			"vhost_socket": filepath.Join(ch.testDir, testVirtioBlkID),
+		}},
+		{endpoint: "vmm.ping"},
+		{endpoint: "vm.remove-device", body: map[string]interface{}{"id": qemuID}},
+	}
+	if requests := ch.Requests(); !reflect.DeepEqual(requests, want) {
+		t.Error("expected requests", want, "received", requests)
+	}
+}
+
+func TestCloudHypervisorVirtioScsiController(t *testing.T) {
+	ch := startFakeCloudHypervisor(t)
+	defer ch.Stop()
+	kvmServer := newTestCloudHypervisorKvmServer(t, ch)
+
+	_, err := kvmServer.CreateVirtioScsiController(context.Background(),
+		utils.ProtoClone(testCreateVirtioScsiRequest))
+
+	if status.Code(err) != codes.Unimplemented {
+		t.Error("expected", codes.Unimplemented, "received", err)
+	}
+	if _, ok := kvmServer.Virt.ScsiCtrls[testVirtioScsiName]; ok {
+		t.Error("expected virtio-scsi controller not to be created")
+	}
+	if requests := ch.Requests(); len(requests) != 0 {
+		t.Error("expected no requests, received", requests)
+	}
+}
+
+func TestCloudHypervisorVMEvents(t *testing.T) {
+	ch := startFakeCloudHypervisor(t)
+	defer ch.Stop()
+	kvmServer := newTestCloudHypervisorKvmServer(t, ch)
+
+	if _, err := kvmServer.SubscribeVMEvents(DefaultVMID); status.Code(err) != codes.Unimplemented {
+		t.Error("expected", codes.Unimplemented, "received", err)
+	}
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+)
+
+// VMEventType is type of QEMU instance lifecycle event
+type VMEventType string
+
+// VM lifecycle events reported by QEMU
+const (
+	VMEventShutdown      VMEventType = "SHUTDOWN"
+	VMEventReset         VMEventType = "RESET"
+	VMEventGuestPanicked VMEventType = "GUEST_PANICKED"
+)
+
+// vmEventBufferSize is number of VM events kept for a slow subscriber
+// before new events are dropped
+const vmEventBufferSize = 16
+
+// VMEvent is lifecycle event of QEMU instance
+type VMEvent struct {
+	Type      VMEventType
+	Data      map[string]interface{}
+	Timestamp time.Time
+}
+
+func isVMEvent(event string) bool {
+	switch VMEventType(event) {
+	case VMEventShutdown, VMEventReset, VMEventGuestPanicked:
+		return true
+	}
+	return false
+}
+
+// eventWaiter waits for QMP event with a string data field of given value
+type eventWaiter struct {
+	event string
+	key   string
+	value string
+	done  chan error
+}
+
+func (w *eventWaiter) matches(e qmp.Event) bool {
+	if e.Event != w.event {
+		return false
+	}
+	v, ok := e.Data[w.key]
+	if !ok {
+		return false
+	}
+	val, ok := v.(string)
+	return ok && val == w.value
+}
+
+// complete finishes waiting with the result, unless already finished
+func (w *eventWaiter) complete(err error) {
+	select {
+	case w.done <- err:
+	default:
+	}
+}
+
+func (w *eventWaiter) wait(timeout time.Duration) error {
+	timeoutTimer := time.NewTimer(timeout)
+	defer timeoutTimer.Stop()
+	select {
+	case err := <-w.done:
+		if err == nil {
+			log.Println("Event:", w.event, "found")
+		}
+		return err
+	case <-timeoutTimer.C:
+		log.Println("Event timeout:", w.event, ", key:", w.key, "value:", w.value)
+		return fmt.Errorf("qemu event not found: %v", w.event)
+	}
+}
+
+// expectEvent registers a waiter for the event. It has to be called before
+// the command triggering the event is sent.
+func (m *monitor) expectEvent(event string, key string, value string) *eventWaiter {
+	waiter := &eventWaiter{event: event, key: key, value: value, done: make(chan error, 1)}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waiters[waiter] = struct{}{}
+	return waiter
+}
+
+func (m *monitor) forgetWaiter(waiter *eventWaiter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.waiters, waiter)
+}
+
+// SubscribeVMEvents returns a channel receiving VM lifecycle events. Events
+// are dropped if the subscriber does not keep up. QMP connection is kept
+// open and restored in background while there are subscribers.
+func (m *monitor) SubscribeVMEvents() (<-chan VMEvent, error) {
+	events := make(chan VMEvent, vmEventBufferSize)
+	m.mu.Lock()
+	m.subscribers[events] = struct{}{}
+	m.mu.Unlock()
+	m.keepConnected()
+	return events, nil
+}
+
+// UnsubscribeVMEvents stops delivering VM lifecycle events to the channel
+// and closes it
+func (m *monitor) UnsubscribeVMEvents(events <-chan VMEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for subscriber := range m.subscribers {
+		if subscriber == events {
+			delete(m.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+func (m *monitor) dispatchEvents(conn *qmpConnection, events <-chan qmp.Event) {
+	for e := range events {
+		log.Println("qemu event:", e)
+		m.dispatchEvent(e)
+	}
+	m.connectionLost(conn)
+}
+
+func (m *monitor) dispatchEvent(e qmp.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for waiter := range m.waiters {
+		if waiter.matches(e) {
+			waiter.complete(nil)
+		}
+	}
+	if !isVMEvent(e.Event) {
+		return
+	}
+	vmEvent := VMEvent{
+		Type:      VMEventType(e.Event),
+		Data:      e.Data,
+		Timestamp: time.Unix(e.Timestamp.Seconds, e.Timestamp.Microseconds*int64(time.Microsecond)),
+	}
+	for subscriber := range m.subscribers {
+		select {
+		case subscriber <- vmEvent:
+		default:
+			log.Printf("Dropping VM event %v for slow subscriber", vmEvent.Type)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/philippgille/gokv/gomap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+func newTestKvmServer(qmpServer *mockQmpServer) *Server {
+	options := gomap.DefaultOptions
+	options.Codec = utils.ProtoCodec{}
+	store := gomap.NewStore(options)
+	opiSpdkServer := frontend.NewServer(alwaysSuccessfulJSONRPC, store)
+	kvmServer := NewServer(opiSpdkServer, qmpServer.socketPath, qmpServer.testDir, nil)
+	kvmServer.timeout = qmplibTimeout
+	return kvmServer
+}
+
+func receiveVMEvent(events <-chan VMEvent) (VMEvent, bool) {
+	select {
+	case e, ok := <-events:
+		return e, ok
+	case <-time.After(qmpServerOperationTimeout):
+		return VMEvent{}, false
+	}
+}
+
+func TestSubscribeVMEvents(t *testing.T) {
+	tests := map[string]struct {
+		mockQmpCalls *mockQmpCalls
+		expected     []VMEventType
+	}{
+		"shutdown": {
+			mockQmpCalls: newMockQmpCalls().ExpectEvent("SHUTDOWN"),
+			expected:     []VMEventType{VMEventShutdown},
+		},
+		"reset and guest panic": {
+			mockQmpCalls: newMockQmpCalls().ExpectEvent("RESET").ExpectEvent("GUEST_PANICKED"),
+			expected:     []VMEventType{VMEventReset, VMEventGuestPanicked},
+		},
+		"not lifecycle events are skipped": {
+			mockQmpCalls: newMockQmpCalls().ExpectEvent("DEVICE_DELETED").ExpectEvent("SHUTDOWN"),
+			expected:     []VMEventType{VMEventShutdown},
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qmpServer := startMockQmpServer(t, tt.mockQmpCalls)
+			defer qmpServer.Stop()
+			kvmServer := newTestKvmServer(qmpServer)
+			defer func() { _ = kvmServer.Close() }()
+
+			events, err := kvmServer.SubscribeVMEvents(DefaultVMID)
+			if err != nil {
+				t.Fatal("expected subscription, received", err)
+			}
+			for _, expected := range tt.expected {
+				e, ok := receiveVMEvent(events)
+				if !ok {
+					t.Fatal("expected event", expected, "received nothing")
+				}
+				if e.Type != expected {
+					t.Error("expected event", expected, "received", e.Type)
+				}
+				if e.Timestamp != time.Unix(1, 2000) {
+					t.Error("expected timestamp", time.Unix(1, 2000), "received", e.Timestamp)
+				}
+			}
+
+			if err := kvmServer.UnsubscribeVMEvents(DefaultVMID, events); err != nil {
+				t.Error("expected no error on unsubscribe, received", err)
+			}
+			if _, ok := <-events; ok {
+				t.Error("expected events channel to be closed")
+			}
+			if !qmpServer.WereExpectedCallsPerformed() {
+				t.Errorf("Not all expected calls were performed")
+			}
+		})
+	}
+}
+
+func TestVMEventsAfterReconnect(t *testing.T) {
+	qmpServer := startMockQmpServer(t, newMockQmpCalls().ExpectEvent("RESET"))
+	defer qmpServer.Stop()
+	kvmServer := newTestKvmServer(qmpServer)
+	defer func() { _ = kvmServer.Close() }()
+
+	events, err := kvmServer.SubscribeVMEvents(DefaultVMID)
+	if err != nil {
+		t.Fatal("expected subscription, received", err)
+	}
+	if e, ok := receiveVMEvent(events); !ok || e.Type != VMEventReset {
+		t.Fatal("expected event", VMEventReset, "received", e.Type)
+	}
+
+	// connection is restored in background while there are subscribers
+	qmpServer.Restart(newMockQmpCalls().ExpectEvent("SHUTDOWN"))
+	select {
+	case e := <-events:
+		if e.Type != VMEventShutdown {
+			t.Error("expected event", VMEventShutdown, "received", e.Type)
+		}
+	case <-time.After(4 * qmplibTimeout):
+		t.Error("expected event", VMEventShutdown, "after reconnection")
+	}
+}
+
+func TestCloseMonitor(t *testing.T) {
+	qmpServer := startMockQmpServer(t, newMockQmpCalls())
+	defer qmpServer.Stop()
+	kvmServer := newTestKvmServer(qmpServer)
+	v, err := kvmServer.vmByID(DefaultVMID)
+	if err != nil {
+		t.Fatal("expected default VM, received", err)
+	}
+
+	if _, err := v.connectMonitor(); err != nil {
+		t.Fatal("expected monitor to connect, received", err)
+	}
+	if err := kvmServer.Close(); err != nil {
+		t.Error("expected no error on close, received", err)
+	}
+	if _, err := v.connectMonitor(); err != errMonitorClosed {
+		t.Error("expected", errMonitorClosed, "received", err)
+	}
+}
+
+func TestSubscribeVMEventsUnknownVM(t *testing.T) {
+	qmpServer := startMockQmpServer(t, newMockQmpCalls())
+	defer qmpServer.Stop()
+	kvmServer := newTestKvmServer(qmpServer)
+	defer func() { _ = kvmServer.Close() }()
+
+	if _, err := kvmServer.SubscribeVMEvents("unknown"); status.Code(err) != codes.NotFound {
+		t.Error("expected", codes.NotFound, "received", err)
+	}
+	if err := kvmServer.UnsubscribeVMEvents("unknown", nil); status.Code(err) != codes.NotFound {
+		t.Error("expected", codes.NotFound, "received", err)
+	}
+}
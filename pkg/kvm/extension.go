@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"context"
+
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// DeregisterVMRequest identifies VM to remove from the registry
+type DeregisterVMRequest struct {
+	ID string `json:"id"`
+}
+
+// ListVMsResponse holds registered VMs
+type ListVMsResponse struct {
+	VMs []VMConfig `json:"vms"`
+}
+
+// ListPendingOperationsResponse holds partially created or deleted devices
+type ListPendingOperationsResponse struct {
+	PendingOperations []PendingOperation `json:"pendingOperations"`
+}
+
+// ExtensionRoutes returns frontend APIs, VM registry and pending operations
+// which opi-api has no messages for yet, served by the HTTP gateway under utils.ExtensionPathPrefix
+func (s *Server) ExtensionRoutes() []utils.ExtensionRoute {
+	return append(s.Server.ExtensionRoutes(),
+		utils.ExtensionRoute{Path: "kvm/RegisterVM", Handler: utils.ExtensionHandler(s.registerVM)},
+		utils.ExtensionRoute{Path: "kvm/DeregisterVM", Handler: utils.ExtensionHandler(s.deregisterVM)},
+		utils.ExtensionRoute{Path: "kvm/ListVMs", Handler: utils.ExtensionHandler(s.listVMs)},
+		utils.ExtensionRoute{Path: "kvm/Reconcile", Handler: utils.ExtensionHandler(s.Reconcile)},
+		utils.ExtensionRoute{Path: "kvm/ListPendingOperations", Handler: utils.ExtensionHandler(s.listPendingOperations)},
+		utils.ExtensionRoute{Path: "kvm/ResumePendingOperations", Handler: utils.ExtensionHandler(s.resumePendingOperationsRoute)},
+	)
+}
+
+func (s *Server) registerVM(_ context.Context, in *VMConfig) (*emptypb.Empty, error) {
+	if err := s.RegisterVM(*in); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) deregisterVM(_ context.Context, in *DeregisterVMRequest) (*emptypb.Empty, error) {
+	if err := s.DeregisterVM(in.ID); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) listVMs(_ context.Context, _ *emptypb.Empty) (*ListVMsResponse, error) {
+	return &ListVMsResponse{VMs: s.ListVMs()}, nil
+}
+
+func (s *Server) listPendingOperations(_ context.Context, _ *emptypb.Empty) (*ListPendingOperationsResponse, error) {
+	return &ListPendingOperationsResponse{PendingOperations: s.ListPendingOperations()}, nil
+}
+
+// resumePendingOperationsRoute retries pending operations and returns the ones
+// still left incomplete with their errors
+func (s *Server) resumePendingOperationsRoute(_ context.Context, _ *emptypb.Empty) (*ListPendingOperationsResponse, error) {
+	_ = s.ResumePendingOperations()
+	return &ListPendingOperationsResponse{PendingOperations: s.ListPendingOperations()}, nil
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+func TestPendingOperationRoutes(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	qmpServer := startMockQmpServer(t, newMockQmpCalls().
+		ExpectDeleteChardev(testVirtioBlkID))
+	defer qmpServer.Stop()
+	kvmServer := newTestKvmServer(qmpServer)
+	mux := http.NewServeMux()
+	utils.RegisterExtensionRoutes(mux, kvmServer.ExtensionRoutes())
+
+	blk := utils.ProtoClone(testCreateVirtioBlkRequest.VirtioBlk)
+	blk.Name = testVirtioBlkName
+	e := kvmServer.journal.begin(&journalEntry{
+		Operation: operationDelete, Object: objectVirtioBlk, Name: testVirtioBlkName, VMID: DefaultVMID,
+		Resource: marshalJournalResource(blk),
+	})
+	e.StartTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	kvmServer.journal.stepDone(e, stepDevice)
+	kvmServer.journal.fail(e, errors.New("chardev is busy"))
+
+	steps := []struct {
+		path     string
+		response string
+	}{
+		{
+			path: "kvm/ListPendingOperations",
+			response: `{"pendingOperations":[{"id":"` + e.ID + `","operation":"delete","object":"virtio-blk",` +
+				`"name":"` + testVirtioBlkName + `","vmId":"default","completedSteps":["device"],` +
+				`"error":"chardevisbusy","startTime":"2024-01-02T03:04:05Z"}]}`,
+		},
+		{
+			path:     "kvm/ResumePendingOperations",
+			response: `{"pendingOperations":[]}`,
+		},
+		{
+			path:     "kvm/ListPendingOperations",
+			response: `{"pendingOperations":[]}`,
+		},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, utils.ExtensionPathPrefix+step.path, strings.NewReader(""))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Error(step.path, "status code: expected", http.StatusOK, "received", w.Code, w.Body.String())
+		}
+		response := strings.ReplaceAll(w.Body.String(), " ", "")
+		if response != step.response {
+			t.Error(step.path, "response: expected", step.response, "received", w.Body.String())
+		}
+	}
+	if !qmpServer.WereExpectedCallsPerformed() {
+		t.Errorf("Not all expected calls were performed")
+	}
+}
+
+func TestVMRegistryRoutes(t *testing.T) {
+	qmpServer := startMockQmpServer(t, nil)
+	defer qmpServer.Stop()
+	kvmServer := newTestKvmServer(qmpServer)
+	mux := http.NewServeMux()
+	utils.RegisterExtensionRoutes(mux, kvmServer.ExtensionRoutes())
+
+	steps := []struct {
+		path       string
+		body       string
+		statusCode int
+		response   string
+	}{
+		{
+			path:       "kvm/RegisterVM",
+			body:       `{"id":"vm1","portId":1,"qmpAddress":"localhost:4444","ctrlrDir":"/tmp","buses":["pci.opi.0"]}`,
+			statusCode: http.StatusOK,
+			response:   `{}`,
+		},
+		{
+			path:       "kvm/RegisterVM",
+			body:       `{"id":"vm2","portId":1,"qmpAddress":"localhost:4444","ctrlrDir":"/tmp"}`,
+			statusCode: http.StatusConflict,
+			response:   `{"code":6,"message":"port 1 is already used by VM vm1"}`,
+		},
+		{
+			path:       "kvm/ListVMs",
+			statusCode: http.StatusOK,
+			response: `{"vms":[{"id":"default","portId":0,"hypervisor":"qemu","qmpAddress":"` + qmpServer.socketPath +
+				`","ctrlrDir":"` + qmpServer.testDir + `"},{"id":"vm1","portId":1,"hypervisor":"qemu",` +
+				`"qmpAddress":"localhost:4444","ctrlrDir":"/tmp","buses":["pci.opi.0"]}]}`,
+		},
+		{
+			path:       "kvm/DeregisterVM",
+			body:       `{"id":"vm1"}`,
+			statusCode: http.StatusOK,
+			response:   `{}`,
+		},
+		{
+			path:       "kvm/DeregisterVM",
+			body:       `{"id":"vm1"}`,
+			statusCode: http.StatusNotFound,
+			response:   `{"code":5,"message":"unable to find key vm1"}`,
+		},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, utils.ExtensionPathPrefix+step.path, strings.NewReader(step.body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != step.statusCode {
+			t.Error(step.path, "status code: expected", step.statusCode, "received", w.Code, w.Body.String())
+		}
+		response := strings.ReplaceAll(w.Body.String(), " ", "")
+		if response != strings.ReplaceAll(step.response, " ", "") {
+			t.Error(step.path, "response: expected", step.response, "received", w.Body.String())
+		}
+	}
+}
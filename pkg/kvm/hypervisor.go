@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+// Hypervisor is a type of VMM devices are plugged to
+type Hypervisor string
+
+const (
+	// HypervisorQemu plugs devices over QMP
+	HypervisorQemu Hypervisor = "qemu"
+	// HypervisorCloudHypervisor plugs devices over Cloud Hypervisor REST API
+	HypervisorCloudHypervisor Hypervisor = "cloud-hypervisor"
+	// HypervisorLibvirt plugs devices to QEMU domain over libvirt RPC API
+	HypervisorLibvirt Hypervisor = "libvirt"
+)
+
+// supportsVirtioScsi reports if vhost-user-scsi devices can be plugged
+func (h Hypervisor) supportsVirtioScsi() bool {
+	return h == HypervisorQemu
+}
+
+// hypervisor hotplugs SPDK devices to a VM. Chardevs are QEMU specific,
+// other implementations keep vhost-user sockets of added chardevs to pass
+// them with devices.
+type hypervisor interface {
+	Connect() error
+	Disconnect() error
+	// Ping checks the hypervisor is reachable without waiting for running
+	// device operations
+	Ping() error
+
+	AddChardev(id string, sockPath string) error
+	DeleteChardev(id string) error
+
+	AddVirtioBlkDevice(id string, chardevID string, location deviceLocation) error
+	AddVirtioScsiDevice(id string, chardevID string, location deviceLocation) error
+	AddNvmeControllerDevice(id string, ctrlrDir string, location deviceLocation) error
+	AddVfiouserDevice(id string, socket string, location deviceLocation) error
+
+	DeleteVirtioBlkDevice(id string) error
+	DeleteVirtioScsiDevice(id string) error
+	DeleteNvmeControllerDevice(id string) error
+	DeleteVfiouserDevice(id string) error
+	DeleteDevice(id string) error
+
+	QueryDeviceIDs() (map[string]struct{}, error)
+	QueryChardevIDs() (map[string]struct{}, error)
+	QueryPciAddresses() (map[pciAddress]string, error)
+
+	SubscribeVMEvents() (<-chan VMEvent, error)
+	UnsubscribeVMEvents(events <-chan VMEvent)
+}
+
+// build time check that structs implement interface
+var (
+	_ hypervisor = (*monitor)(nil)
+	_ hypervisor = (*cloudHypervisor)(nil)
+	_ hypervisor = (*libvirtHypervisor)(nil)
+)
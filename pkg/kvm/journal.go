@@ -0,0 +1,521 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/philippgille/gokv"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+)
+
+// journalKey is a store key the whole journal is kept under, since gokv
+// stores cannot list keys
+const journalKey = "kvm/journal"
+
+type operationKind string
+
+const (
+	operationCreate operationKind = "create"
+	operationDelete operationKind = "delete"
+)
+
+type objectKind string
+
+const (
+	objectNvmeController       objectKind = "nvme-controller"
+	objectVirtioBlk            objectKind = "virtio-blk"
+	objectVirtioScsiController objectKind = "virtio-scsi-controller"
+)
+
+type journalStep string
+
+const (
+	stepControllerDir journalStep = "controller-dir"
+	stepSpdkObject    journalStep = "spdk-object"
+	stepChardev       journalStep = "chardev"
+	stepDevice        journalStep = "device"
+)
+
+// journalEntry records completed steps of a create or delete operation.
+// Steps are created objects for create operations and deleted objects for
+// delete operations.
+type journalEntry struct {
+	ID        string          `json:"id"`
+	Operation operationKind   `json:"operation"`
+	Object    objectKind      `json:"object"`
+	Name      string          `json:"name,omitempty"`
+	VMID      string          `json:"vm_id"`
+	DirName   string          `json:"dir_name,omitempty"`
+	Vfiouser  bool            `json:"vfiouser,omitempty"`
+	Resource  json.RawMessage `json:"resource,omitempty"`
+	// Parent is Nvme subsystem of Nvme controller
+	Parent    json.RawMessage `json:"parent,omitempty"`
+	Steps     []journalStep   `json:"steps"`
+	Error     string          `json:"error,omitempty"`
+	StartTime time.Time       `json:"start_time"`
+
+	// inProgress is set for operations running in this process, so that
+	// they are not resumed concurrently
+	inProgress bool
+}
+
+func (e *journalEntry) done(step journalStep) bool {
+	for _, s := range e.Steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// teardownSteps returns steps removing the object in order of execution
+func (e *journalEntry) teardownSteps() []journalStep {
+	switch e.Object {
+	case objectNvmeController:
+		return []journalStep{stepDevice, stepSpdkObject, stepControllerDir}
+	case objectVirtioBlk:
+		if e.Vfiouser {
+			return []journalStep{stepDevice, stepSpdkObject}
+		}
+		return []journalStep{stepDevice, stepChardev, stepSpdkObject}
+	default:
+		return []journalStep{stepDevice, stepChardev, stepSpdkObject}
+	}
+}
+
+// pendingTeardownSteps returns steps left to roll back a create operation
+// or to complete a delete operation
+func (e *journalEntry) pendingTeardownSteps() []journalStep {
+	var steps []journalStep
+	for _, step := range e.teardownSteps() {
+		if e.done(step) == (e.Operation == operationCreate) {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// PendingOperation is a create or delete operation which failed or was
+// interrupted and left a partially created or deleted device behind
+type PendingOperation struct {
+	ID             string    `json:"id"`
+	Operation      string    `json:"operation"`
+	Object         string    `json:"object"`
+	Name           string    `json:"name"`
+	VMID           string    `json:"vmId"`
+	CompletedSteps []string  `json:"completedSteps"`
+	Error          string    `json:"error,omitempty"`
+	StartTime      time.Time `json:"startTime"`
+}
+
+// journal keeps entries of running and failed operations in the store to
+// roll back or complete them after a failure or a crash
+type journal struct {
+	store gokv.Store
+
+	mu      sync.Mutex
+	entries map[string]*journalEntry
+}
+
+func newJournal(store gokv.Store) *journal {
+	j := &journal{store: store, entries: map[string]*journalEntry{}}
+	if store == nil {
+		return j
+	}
+	raw := &wrapperspb.StringValue{}
+	found, err := store.Get(journalKey, raw)
+	if err != nil {
+		log.Printf("Failed to load kvm journal: %v", err)
+		return j
+	}
+	if !found {
+		return j
+	}
+	var entries []*journalEntry
+	if err := json.Unmarshal([]byte(raw.Value), &entries); err != nil {
+		log.Printf("Failed to parse kvm journal: %v", err)
+		return j
+	}
+	for _, e := range entries {
+		j.entries[e.ID] = e
+	}
+	return j
+}
+
+// begin records a new operation. Failed operations of the same object are
+// superseded by it.
+func (j *journal) begin(e *journalEntry) *journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e.ID = uuid.NewString()
+	e.StartTime = time.Now()
+	e.inProgress = true
+	if e.Name != "" {
+		for id, other := range j.entries {
+			if other.Object == e.Object && other.Name == e.Name && !other.inProgress {
+				delete(j.entries, id)
+			}
+		}
+	}
+	j.entries[e.ID] = e
+	j.persistLocked()
+	return e
+}
+
+// created records the object of a create operation with the created
+// resource to be able to remove it after a crash
+func (j *journal) created(e *journalEntry, name string, resource proto.Message, parent proto.Message) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e.Name = name
+	e.Resource = marshalJournalResource(resource)
+	e.Parent = marshalJournalResource(parent)
+	e.Steps = append(e.Steps, stepSpdkObject)
+	j.persistLocked()
+}
+
+func marshalJournalResource(resource proto.Message) json.RawMessage {
+	if resource == nil || reflect.ValueOf(resource).IsNil() {
+		return nil
+	}
+	bs, err := protojson.Marshal(resource)
+	if err != nil {
+		log.Printf("Failed to marshal %v for kvm journal: %v", resource, err)
+		return nil
+	}
+	return bs
+}
+
+// stepDone records completed steps. e is nil for devices plugged outside of
+// an operation, e.g. on reconcile, which are not recorded.
+func (j *journal) stepDone(e *journalEntry, steps ...journalStep) {
+	if e == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e.Steps = append(e.Steps, steps...)
+	j.persistLocked()
+}
+
+func (j *journal) stepUndone(e *journalEntry, step journalStep) {
+	if e == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, s := range e.Steps {
+		if s == step {
+			e.Steps = append(e.Steps[:i], e.Steps[i+1:]...)
+			break
+		}
+	}
+	j.persistLocked()
+}
+
+// finish forgets completed or fully rolled back operation
+func (j *journal) finish(e *journalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.entries, e.ID)
+	j.persistLocked()
+}
+
+// fail keeps operation to be listed and resumed later
+func (j *journal) fail(e *journalEntry, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e.Error = err.Error()
+	e.inProgress = false
+	j.persistLocked()
+}
+
+// needsVM reports if pending teardown steps of the operation are run on its VM
+func (e *journalEntry) needsVM() bool {
+	for _, step := range e.pendingTeardownSteps() {
+		if step == stepDevice || step == stepChardev {
+			return true
+		}
+	}
+	return false
+}
+
+// claimPending returns operations which are not running and accepted by
+// the filter and marks them running
+func (j *journal) claimPending(filter func(e *journalEntry) bool) []*journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var entries []*journalEntry
+	for _, e := range j.entries {
+		if !e.inProgress && filter(e) {
+			e.inProgress = true
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, k int) bool { return entries[i].StartTime.Before(entries[k].StartTime) })
+	return entries
+}
+
+func (j *journal) list() []PendingOperation {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	operations := []PendingOperation{}
+	for _, e := range j.entries {
+		if e.inProgress {
+			continue
+		}
+		steps := []string{}
+		for _, step := range e.Steps {
+			steps = append(steps, string(step))
+		}
+		operations = append(operations, PendingOperation{
+			ID:             e.ID,
+			Operation:      string(e.Operation),
+			Object:         string(e.Object),
+			Name:           e.Name,
+			VMID:           e.VMID,
+			CompletedSteps: steps,
+			Error:          e.Error,
+			StartTime:      e.StartTime,
+		})
+	}
+	sort.Slice(operations, func(i, k int) bool { return operations[i].StartTime.Before(operations[k].StartTime) })
+	return operations
+}
+
+func (j *journal) persistLocked() {
+	if j.store == nil {
+		return
+	}
+	entries := make([]*journalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		entries = append(entries, e)
+	}
+	bs, err := json.Marshal(entries)
+	if err != nil {
+		log.Printf("Failed to marshal kvm journal: %v", err)
+		return
+	}
+	if err := j.store.Set(journalKey, wrapperspb.String(string(bs))); err != nil {
+		log.Printf("Failed to persist kvm journal: %v", err)
+	}
+}
+
+// restoreResource puts the object back to the bridge, since it is needed to
+// delete the object in SPDK and is lost on restart. Returned function
+// removes restored Nvme subsystem again.
+func (s *Server) restoreResource(e *journalEntry) func() {
+	if len(e.Resource) == 0 {
+		return func() {}
+	}
+	switch e.Object {
+	case objectNvmeController:
+		if _, ok := s.Nvme.Controllers[e.Name]; !ok {
+			ctrlr := &pb.NvmeController{}
+			if err := protojson.Unmarshal(e.Resource, ctrlr); err == nil {
+				s.Nvme.Controllers[e.Name] = ctrlr
+			}
+		}
+		subsys := &pb.NvmeSubsystem{}
+		if len(e.Parent) == 0 || protojson.Unmarshal(e.Parent, subsys) != nil {
+			return func() {}
+		}
+		if _, ok := s.Nvme.Subsystems[subsys.Name]; ok {
+			return func() {}
+		}
+		s.Nvme.Subsystems[subsys.Name] = subsys
+		return func() { delete(s.Nvme.Subsystems, subsys.Name) }
+	case objectVirtioBlk:
+		if _, ok := s.Virt.BlkCtrls[e.Name]; ok {
+			break
+		}
+		blk := &pb.VirtioBlk{}
+		if err := protojson.Unmarshal(e.Resource, blk); err == nil {
+			s.Virt.BlkCtrls[e.Name] = blk
+		}
+	case objectVirtioScsiController:
+		if _, ok := s.Virt.ScsiCtrls[e.Name]; ok {
+			break
+		}
+		scsiCtrl := &pb.VirtioScsiController{}
+		if err := protojson.Unmarshal(e.Resource, scsiCtrl); err == nil {
+			s.Virt.ScsiCtrls[e.Name] = scsiCtrl
+		}
+	}
+	return func() {}
+}
+
+// ListPendingOperations returns failed or interrupted create and delete
+// operations, i.e. partially created or deleted devices
+func (s *Server) ListPendingOperations() []PendingOperation {
+	return s.journal.list()
+}
+
+// ResumePendingOperations rolls back failed or interrupted create operations
+// and completes delete operations. It is called on startup to clean up after
+// a crash and can be called any time later. Operations of VMs which are not
+// registered yet are kept pending and resumed once their VM is registered.
+func (s *Server) ResumePendingOperations() error {
+	s.vmsMu.Lock()
+	s.resumeOnRegister = true
+	registered := make(map[string]bool, len(s.vms))
+	for id := range s.vms {
+		registered[id] = true
+	}
+	s.vmsMu.Unlock()
+
+	return s.resumePendingOperations(func(e *journalEntry) bool {
+		if !e.needsVM() || registered[e.VMID] {
+			return true
+		}
+		log.Printf("%v of %v %v waits for VM %v to be registered", e.Operation, e.Object, e.Name, e.VMID)
+		return false
+	})
+}
+
+// resumePendingOperationsOfVM resumes pending operations of just registered VM
+func (s *Server) resumePendingOperationsOfVM(id string) {
+	err := s.resumePendingOperations(func(e *journalEntry) bool { return e.VMID == id })
+	if err != nil {
+		log.Printf("Pending operations of VM %v are not resumed: %v", id, err)
+	}
+}
+
+func (s *Server) resumePendingOperations(filter func(e *journalEntry) bool) error {
+	var err error
+	for _, e := range s.journal.claimPending(filter) {
+		log.Printf("Resuming %v of %v %v", e.Operation, e.Object, e.Name)
+		if _, failed := s.teardown(context.Background(), e, nil); failed != 0 {
+			err = errResumeFailed
+		}
+	}
+	return err
+}
+
+// beginDelete begins delete operation of the object
+func (s *Server) beginDelete(object objectKind, name string, v *vm, resource proto.Message) *journalEntry {
+	_, vfiouserBlk := s.Server.VirtioBlkTransport().(*virtioBlkVfiouserTransport)
+	return s.journal.begin(&journalEntry{
+		Operation: operationDelete,
+		Object:    object,
+		Name:      name,
+		VMID:      v.config.ID,
+		Vfiouser:  object == objectVirtioBlk && vfiouserBlk,
+		Resource:  marshalJournalResource(resource),
+	})
+}
+
+// runDelete runs delete operation steps and converts their result to an
+// error of the delete call
+func (s *Server) runDelete(ctx context.Context, e *journalEntry, hv hypervisor) (*emptypb.Empty, error) {
+	steps, failed := s.teardown(ctx, e, hv)
+
+	var err error
+	if failed != 0 && failed == steps {
+		err = errDeviceNotDeleted
+	} else if failed != 0 {
+		err = errDevicePartiallyDeleted
+	}
+	if !e.done(stepSpdkObject) {
+		return nil, err
+	}
+	return &emptypb.Empty{}, err
+}
+
+// rollback removes objects created by a failed create operation. hv can be
+// nil if no hypervisor connection was established.
+func (s *Server) rollback(e *journalEntry, hv hypervisor) {
+	_, _ = s.teardown(context.Background(), e, hv)
+}
+
+// teardown runs pending teardown steps of the operation. The operation is
+// finished if all steps succeed and kept in the journal otherwise. If hv is
+// nil, the hypervisor is connected on the first step requiring it.
+func (s *Server) teardown(ctx context.Context, e *journalEntry, hv hypervisor) (steps int, failed int) {
+	var lastErr error
+	pending := e.pendingTeardownSteps()
+	for _, step := range pending {
+		if err := s.teardownStep(ctx, e, step, &hv); err != nil {
+			log.Printf("Couldn't remove %v of %v %v: %v", step, e.Object, e.Name, err)
+			lastErr = err
+			failed++
+			continue
+		}
+		if e.Operation == operationCreate {
+			s.journal.stepUndone(e, step)
+		} else {
+			s.journal.stepDone(e, step)
+		}
+	}
+
+	if lastErr != nil {
+		log.Printf("%v of %v %v is left incomplete", e.Operation, e.Object, e.Name)
+		s.journal.fail(e, lastErr)
+	} else {
+		s.journal.finish(e)
+	}
+	return len(pending), failed
+}
+
+func (s *Server) teardownStep(ctx context.Context, e *journalEntry, step journalStep, hv *hypervisor) error {
+	qemuID := toQemuID(e.Name)
+	switch step {
+	case stepDevice, stepChardev:
+		v, err := s.vmByID(e.VMID)
+		if err != nil {
+			return err
+		}
+		if *hv == nil {
+			if *hv, err = v.connectMonitor(); err != nil {
+				*hv = nil
+				return errMonitorCreation
+			}
+		}
+		mon := *hv
+		if step == stepChardev {
+			return mon.DeleteChardev(qemuID)
+		}
+		defer v.locator.Release(qemuID)
+		switch {
+		case e.Object == objectNvmeController:
+			return mon.DeleteNvmeControllerDevice(qemuID)
+		case e.Object == objectVirtioScsiController:
+			return mon.DeleteVirtioScsiDevice(qemuID)
+		case e.Vfiouser:
+			return mon.DeleteVfiouserDevice(qemuID)
+		default:
+			return mon.DeleteVirtioBlkDevice(qemuID)
+		}
+	case stepSpdkObject:
+		cleanup := s.restoreResource(e)
+		defer cleanup()
+		var err error
+		switch e.Object {
+		case objectNvmeController:
+			_, err = s.Server.DeleteNvmeController(ctx, &pb.DeleteNvmeControllerRequest{Name: e.Name})
+		case objectVirtioScsiController:
+			_, err = s.Server.DeleteVirtioScsiController(ctx, &pb.DeleteVirtioScsiControllerRequest{Name: e.Name})
+		default:
+			_, err = s.Server.DeleteVirtioBlk(ctx, &pb.DeleteVirtioBlkRequest{Name: e.Name})
+		}
+		return err
+	case stepControllerDir:
+		return deleteControllerDir(s.ctrlrDir, e.DirName)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/philippgille/gokv/gomap"
+
+	"github.com/opiproject/gospdk/spdk"
+	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+)
+
+func TestJournalPersistence(t *testing.T) {
+	options := gomap.DefaultOptions
+	options.Codec = utils.ProtoCodec{}
+	store := gomap.NewStore(options)
+	blk := utils.ProtoClone(testCreateVirtioBlkRequest.VirtioBlk)
+	blk.Name = testVirtioBlkName
+
+	j := newJournal(store)
+	failed := j.begin(&journalEntry{Operation: operationDelete, Object: objectVirtioBlk, Name: testVirtioBlkName, VMID: DefaultVMID})
+	j.stepDone(failed, stepDevice)
+	j.fail(failed, errors.New("chardev is busy"))
+	interrupted := j.begin(&journalEntry{Operation: operationCreate, Object: objectVirtioScsiController, VMID: DefaultVMID})
+	j.created(interrupted, testVirtioScsiName, nil, nil)
+	finished := j.begin(&journalEntry{Operation: operationCreate, Object: objectVirtioBlk, VMID: DefaultVMID})
+	j.created(finished, "finished", blk, nil)
+	j.finish(finished)
+
+	if ops := j.list(); len(ops) != 1 || ops[0].ID != failed.ID {
+		t.Errorf("Expected only failed operation to be listed, received %v", ops)
+	}
+
+	reloaded := newJournal(store).list()
+	expected := []PendingOperation{
+		{
+			ID: failed.ID, Operation: "delete", Object: "virtio-blk", Name: testVirtioBlkName,
+			VMID: DefaultVMID, CompletedSteps: []string{"device"}, Error: "chardev is busy",
+		},
+		{
+			ID: interrupted.ID, Operation: "create", Object: "virtio-scsi-controller", Name: testVirtioScsiName,
+			VMID: DefaultVMID, CompletedSteps: []string{"spdk-object"},
+		},
+	}
+	if len(reloaded) != len(expected) {
+		t.Fatalf("Expected %v pending operations after reload, received %v", len(expected), reloaded)
+	}
+	for i := range expected {
+		expected[i].StartTime = reloaded[i].StartTime
+		if !reflect.DeepEqual(reloaded[i], expected[i]) {
+			t.Errorf("Expected pending operation %v, received %v", expected[i], reloaded[i])
+		}
+	}
+}
+
+func TestResumePendingOperations(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		jsonRPC      spdk.JSONRPC
+		entry        journalEntry
+		mockQmpCalls *mockQmpCalls
+		wantErr      error
+		wantSteps    []string
+		wantBlk      bool
+	}{
+		"interrupted delete is completed": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			entry: journalEntry{
+				Operation: operationDelete, Object: objectVirtioBlk,
+				Steps: []journalStep{stepDevice},
+			},
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteChardev(testVirtioBlkID),
+		},
+		"interrupted delete of plugged device is completed": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			entry: journalEntry{
+				Operation: operationDelete, Object: objectVirtioBlk,
+			},
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteVirtioBlkWithEvent(testVirtioBlkID).
+				ExpectDeleteChardev(testVirtioBlkID),
+		},
+		"interrupted create is rolled back": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			entry: journalEntry{
+				Operation: operationCreate, Object: objectVirtioBlk,
+				Steps: []journalStep{stepSpdkObject},
+			},
+			mockQmpCalls: newMockQmpCalls(),
+		},
+		"create interrupted after device is added is rolled back": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			entry: journalEntry{
+				Operation: operationCreate, Object: objectVirtioBlk,
+				Steps: []journalStep{stepSpdkObject, stepChardev, stepDevice},
+			},
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteVirtioBlkWithEvent(testVirtioBlkID).
+				ExpectDeleteChardev(testVirtioBlkID),
+		},
+		"create interrupted after chardev is added is rolled back": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			entry: journalEntry{
+				Operation: operationCreate, Object: objectVirtioBlk,
+				Steps: []journalStep{stepSpdkObject, stepChardev},
+			},
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteChardev(testVirtioBlkID),
+		},
+		"failed qemu step leaves operation pending": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			entry: journalEntry{
+				Operation: operationDelete, Object: objectVirtioBlk,
+				Steps: []journalStep{stepDevice},
+			},
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteChardev(testVirtioBlkID).WithErrorResponse().
+				ExpectQueryChardev(testVirtioBlkID),
+			wantErr:   errResumeFailed,
+			wantSteps: []string{"device", "spdk-object"},
+		},
+		"failed spdk step leaves operation pending": {
+			jsonRPC: alwaysFailingJSONRPC,
+			entry: journalEntry{
+				Operation: operationCreate, Object: objectVirtioBlk,
+				Steps: []journalStep{stepSpdkObject},
+			},
+			mockQmpCalls: newMockQmpCalls(),
+			wantErr:      errResumeFailed,
+			wantSteps:    []string{"spdk-object"},
+			wantBlk:      true,
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			options := gomap.DefaultOptions
+			options.Codec = utils.ProtoCodec{}
+			store := gomap.NewStore(options)
+			blk := utils.ProtoClone(testCreateVirtioBlkRequest.VirtioBlk)
+			blk.Name = testVirtioBlkName
+			entry := tt.entry
+			entry.Name = testVirtioBlkName
+			entry.VMID = DefaultVMID
+			entry.Resource = marshalJournalResource(blk)
+			// operation is left in progress to emulate a crash
+			_ = newJournal(store).begin(&entry)
+
+			opiSpdkServer := frontend.NewServer(tt.jsonRPC, store)
+			qmpServer := startMockQmpServer(t, tt.mockQmpCalls)
+			defer qmpServer.Stop()
+			kvmServer := NewServer(opiSpdkServer, qmpServer.socketPath, qmpServer.testDir, nil)
+			kvmServer.timeout = qmplibTimeout
+
+			err := kvmServer.ResumePendingOperations()
+			if err != tt.wantErr {
+				t.Errorf("Expected error %v, received %v", tt.wantErr, err)
+			}
+
+			var steps []string
+			if ops := kvmServer.ListPendingOperations(); len(ops) != 0 {
+				steps = ops[0].CompletedSteps
+			}
+			if !reflect.DeepEqual(steps, tt.wantSteps) {
+				t.Errorf("Expected pending steps %v, received %v", tt.wantSteps, steps)
+			}
+			if _, ok := opiSpdkServer.Virt.BlkCtrls[testVirtioBlkName]; ok != tt.wantBlk {
+				t.Errorf("Expected virtio-blk presence %v, received %v", tt.wantBlk, ok)
+			}
+			if !qmpServer.WereExpectedCallsPerformed() {
+				t.Errorf("Not all expected calls were performed")
+			}
+		})
+	}
+}
+
+func TestPendingOperationWaitsForVMRegistration(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	options := gomap.DefaultOptions
+	options.Codec = utils.ProtoCodec{}
+	store := gomap.NewStore(options)
+	blk := utils.ProtoClone(testCreateVirtioBlkRequest.VirtioBlk)
+	blk.Name = testVirtioBlkName
+	// operation is left in progress to emulate a crash
+	_ = newJournal(store).begin(&journalEntry{
+		Operation: operationDelete, Object: objectVirtioBlk, Name: testVirtioBlkName,
+		VMID: "vm1", Steps: []journalStep{stepDevice}, Resource: marshalJournalResource(blk),
+	})
+
+	opiSpdkServer := frontend.NewServer(alwaysSuccessfulJSONRPC, store)
+	qmpServer := startMockQmpServer(t, newMockQmpCalls())
+	defer qmpServer.Stop()
+	vmQmpServer := startMockQmpServer(t, newMockQmpCalls().
+		ExpectDeleteChardev(testVirtioBlkID))
+	defer vmQmpServer.Stop()
+	kvmServer := NewServer(opiSpdkServer, qmpServer.socketPath, qmpServer.testDir, nil)
+	kvmServer.timeout = qmplibTimeout
+	defer func() { _ = kvmServer.Close() }()
+
+	if err := kvmServer.ResumePendingOperations(); err != nil {
+		t.Errorf("Expected no error, received %v", err)
+	}
+	if ops := kvmServer.ListPendingOperations(); len(ops) != 1 || ops[0].VMID != "vm1" {
+		t.Fatalf("Expected operation of vm1 to wait for registration, received %v", ops)
+	}
+
+	err := kvmServer.RegisterVM(VMConfig{
+		ID:         "vm1",
+		PortID:     1,
+		QmpAddress: vmQmpServer.socketPath,
+		CtrlrDir:   vmQmpServer.testDir,
+	})
+	if err != nil {
+		t.Fatal("expected VM to be registered, received", err)
+	}
+	if ops := kvmServer.ListPendingOperations(); len(ops) != 0 {
+		t.Errorf("Expected operation to be completed on VM registration, received %v", ops)
+	}
+	if !qmpServer.WereExpectedCallsPerformed() || !vmQmpServer.WereExpectedCallsPerformed() {
+		t.Errorf("Not all expected calls were performed")
+	}
+}
+
+func TestDeleteFailureIsListedAsPending(t *testing.T) {
+	options := gomap.DefaultOptions
+	options.Codec = utils.ProtoCodec{}
+	store := gomap.NewStore(options)
+	opiSpdkServer := frontend.NewServer(alwaysSuccessfulJSONRPC, store)
+	opiSpdkServer.Virt.BlkCtrls[testVirtioBlkName] =
+		utils.ProtoClone(testCreateVirtioBlkRequest.VirtioBlk)
+	opiSpdkServer.Virt.BlkCtrls[testVirtioBlkName].Name = testVirtioBlkName
+	qmpServer := startMockQmpServer(t, newMockQmpCalls().
+		ExpectDeleteVirtioBlk(testVirtioBlkID).WithErrorResponse().
+		ExpectQueryPci(testVirtioBlkID).
+		ExpectDeleteChardev(testVirtioBlkID))
+	defer qmpServer.Stop()
+	kvmServer := NewServer(opiSpdkServer, qmpServer.socketPath, qmpServer.testDir, nil)
+	kvmServer.timeout = qmplibTimeout
+
+	_, err := kvmServer.DeleteVirtioBlk(context.Background(), utils.ProtoClone(testDeleteVirtioBlkRequest))
+	if err != errDevicePartiallyDeleted {
+		t.Errorf("Expected error %v, received %v", errDevicePartiallyDeleted, err)
+	}
+
+	ops := kvmServer.ListPendingOperations()
+	if len(ops) != 1 {
+		t.Fatalf("Expected single pending operation, received %v", ops)
+	}
+	if ops[0].Operation != "delete" || ops[0].Name != testVirtioBlkName ||
+		!reflect.DeepEqual(ops[0].CompletedSteps, []string{"chardev", "spdk-object"}) {
+		t.Errorf("Unexpected pending operation %v", ops[0])
+	}
+	if !qmpServer.WereExpectedCallsPerformed() {
+		t.Errorf("Not all expected calls were performed")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
@@ -23,61 +24,141 @@ const (
 )
 
 var (
-	errAddChardevFailed       = status.Error(codes.FailedPrecondition, "couldn't add chardev")
-	errMonitorCreation        = status.Error(codes.Internal, "failed to create QEMU monitor")
-	errAddDeviceFailed        = status.Error(codes.FailedPrecondition, "couldn't add device")
-	errDeviceNotDeleted       = status.Error(codes.FailedPrecondition, "device is not deleted")
-	errNoController           = status.Error(codes.NotFound, "no controller found")
-	errInvalidSubsystem       = status.Error(codes.InvalidArgument, "invalid subsystem")
-	errDevicePartiallyDeleted = status.Error(codes.Internal, "device is partially deleted")
-	errFailedToCreateNvmeDir  = status.Error(codes.FailedPrecondition, "cannot create directory for Nvme controller")
-	errDeviceEndpoint         = status.Error(codes.InvalidArgument, "values in endpoint cannot be used to calculate device location")
-	errNoPcieEndpoint         = status.Error(codes.InvalidArgument, "no pcie endpoint provided")
+	errAddChardevFailed          = status.Error(codes.FailedPrecondition, "couldn't add chardev")
+	errMonitorCreation           = status.Error(codes.Internal, "failed to create QEMU monitor")
+	errAddDeviceFailed           = status.Error(codes.FailedPrecondition, "couldn't add device")
+	errDeviceNotDeleted          = status.Error(codes.FailedPrecondition, "device is not deleted")
+	errNoController              = status.Error(codes.NotFound, "no controller found")
+	errInvalidSubsystem          = status.Error(codes.InvalidArgument, "invalid subsystem")
+	errDevicePartiallyDeleted    = status.Error(codes.Internal, "device is partially deleted")
+	errFailedToCreateNvmeDir     = status.Error(codes.FailedPrecondition, "cannot create directory for Nvme controller")
+	errDeviceEndpoint            = status.Error(codes.InvalidArgument, "values in endpoint cannot be used to calculate device location")
+	errNoPcieEndpoint            = status.Error(codes.InvalidArgument, "no pcie endpoint provided")
+	errScsiLunsExist             = status.Error(codes.FailedPrecondition, "VirtioScsiLuns exist for controller")
+	errNoVM                      = status.Error(codes.NotFound, "no VM registered for the port")
+	errDeviceLocationNotReserved = status.Error(codes.Unavailable, "couldn't check device location is free in QEMU")
+	errNotSupportedByHypervisor  = status.Error(codes.Unimplemented, "device type is not supported by VM hypervisor")
+	errResumeFailed              = status.Error(codes.Internal, "failed to resume pending operations")
 )
 
 // Server is a wrapper for default opi-spdk-bridge frontend which automates
-// interaction with QEMU instance to plug/unplug SPDK devices
+// interaction with QEMU instances to plug/unplug SPDK devices
 type Server struct {
 	*frontend.Server
 
-	qmpAddress string
-	ctrlrDir   string
-	protocol   string
+	// ctrlrDir is directory with SPDK device sockets as seen by SPDK
+	ctrlrDir string
 
 	timeout                time.Duration
 	pollDevicePresenceStep time.Duration
 
-	locator deviceLocator
+	vmsMu sync.Mutex
+	// vms maps VM ID to QEMU instance devices are plugged to
+	vms map[string]*vm
+	// resumeOnRegister is set once pending operations are resumed on startup,
+	// operations of VMs registered later are resumed on their registration
+	resumeOnRegister bool
+
+	// journal records steps of create and delete operations to roll back or
+	// complete them after a failure
+	journal *journal
 }
 
-// NewServer creates instance of KvmServer
+// NewServer creates instance of KvmServer with a single QEMU VM registered
+// as DefaultVMID on port 0
 func NewServer(s *frontend.Server, qmpAddress string, ctrlrDir string, buses []string) *Server {
+	if qmpAddress == "" {
+		log.Fatalf("qmpAddress cannot be empty")
+	}
+
+	_, err := getProtocol(qmpAddress)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	validateBusesOrPanic(buses)
+	return NewServerWithVM(s, VMConfig{
+		ID:         DefaultVMID,
+		PortID:     0,
+		Hypervisor: HypervisorQemu,
+		QmpAddress: qmpAddress,
+		CtrlrDir:   ctrlrDir,
+		Buses:      buses,
+	})
+}
+
+// NewServerWithVM creates instance of KvmServer with a single VM of any
+// hypervisor registered
+func NewServerWithVM(s *frontend.Server, config VMConfig) *Server {
 	if s == nil {
 		log.Fatalf("Frontend Server cannot be nil")
 	}
 
-	if qmpAddress == "" {
-		log.Fatalf("qmpAddress cannot be empty")
+	if config.CtrlrDir == "" {
+		log.Fatalf("ctrlrDir cannot be empty")
 	}
 
-	if ctrlrDir == "" {
-		log.Fatalf("ctrlrDir cannot be empty")
+	timeout := 2 * time.Second
+	pollDevicePresenceStep := 5 * time.Millisecond
+	server := &Server{
+		Server:                 s,
+		ctrlrDir:               config.CtrlrDir,
+		timeout:                timeout,
+		pollDevicePresenceStep: pollDevicePresenceStep,
+		vms:                    make(map[string]*vm),
+		journal:                newJournal(s.Store()),
 	}
 
-	qmpProtocol, err := getProtocol(qmpAddress)
+	if err := server.RegisterVM(config); err != nil {
+		log.Fatalf("Failed to register VM: %v", err)
+	}
+	return server
+}
+
+// SetTimeouts sets timeout of hypervisor operations and step of polling device
+// presence in a VM. VMs which were already used keep former values.
+func (s *Server) SetTimeouts(timeout, pollDevicePresenceStep time.Duration) {
+	s.vmsMu.Lock()
+	defer s.vmsMu.Unlock()
+	s.timeout = timeout
+	s.pollDevicePresenceStep = pollDevicePresenceStep
+}
+
+// SubscribeVMEvents returns a channel receiving lifecycle events (shutdown,
+// reset, guest panic) of the VM. QMP connection is kept open and restored in
+// background while there are subscribers.
+func (s *Server) SubscribeVMEvents(vmID string) (<-chan VMEvent, error) {
+	v, err := s.vmByID(vmID)
 	if err != nil {
-		log.Fatalf(err.Error())
+		return nil, err
 	}
+	return v.hv.SubscribeVMEvents()
+}
 
-	timeout := 2 * time.Second
-	pollDevicePresenceStep := 5 * time.Millisecond
-	return &Server{s,
-		qmpAddress,
-		ctrlrDir,
-		qmpProtocol,
-		timeout,
-		pollDevicePresenceStep,
-		newDeviceLocator(buses)}
+// UnsubscribeVMEvents stops delivering lifecycle events of the VM to the
+// channel returned by SubscribeVMEvents and closes it
+func (s *Server) UnsubscribeVMEvents(vmID string, events <-chan VMEvent) error {
+	v, err := s.vmByID(vmID)
+	if err != nil {
+		return err
+	}
+	v.hv.UnsubscribeVMEvents(events)
+	return nil
+}
+
+// Close closes connections to hypervisors of all VMs
+func (s *Server) Close() error {
+	s.vmsMu.Lock()
+	defer s.vmsMu.Unlock()
+	var err error
+	for _, v := range s.vms {
+		if v.hv == nil {
+			continue
+		}
+		if disconnectErr := v.hv.Disconnect(); disconnectErr != nil {
+			err = disconnectErr
+		}
+	}
+	return err
 }
 
 func getProtocol(qmpAddress string) (string, error) {
@@ -104,8 +185,11 @@ func isTCPAddress(qmpAddress string) bool {
 	return err == nil
 }
 
+// qemuIDPrefix marks QEMU devices and chardevs plugged by the bridge
+const qemuIDPrefix = "opi-"
+
 func toQemuID(name string) string {
 	resourceID := filepath.Base(name)
 	// qemu id cannot start with numbers. Add prefix
-	return "opi-" + resourceID
+	return qemuIDPrefix + resourceID
 }
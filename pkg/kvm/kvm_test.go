@@ -12,12 +12,14 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/opiproject/gospdk/spdk"
+	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
 	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -44,6 +46,8 @@ var (
 		&testSubsystem,
 		testCreateVirtioBlkRequest,
 		testDeleteVirtioBlkRequest,
+		testCreateVirtioScsiRequest,
+		testDeleteVirtioScsiRequest,
 	)
 )
 
@@ -68,7 +72,7 @@ func (s *stubJSONRRPC) GetVersion(_ context.Context) string {
 }
 
 func (s *stubJSONRRPC) Call(_ context.Context, method string, arg, result interface{}) error {
-	if method == "vhost_create_blk_controller" {
+	if method == "vhost_create_blk_controller" || method == "vfu_virtio_create_blk_endpoint" {
 		if s.err == nil {
 			resultCreateVirtioBLk, ok := result.(*spdk.VhostCreateBlkControllerResult)
 			if !ok {
@@ -76,7 +80,15 @@ func (s *stubJSONRRPC) Call(_ context.Context, method string, arg, result interf
 			}
 			*resultCreateVirtioBLk = spdk.VhostCreateBlkControllerResult(true)
 		}
-	} else if method == "vhost_delete_controller" {
+	} else if method == "vhost_create_scsi_controller" {
+		if s.err == nil {
+			resultCreateVirtioScsi, ok := result.(*spdk.VhostCreateScsiControllerResult)
+			if !ok {
+				log.Panicf("Unexpected type for virtio-scsi controller creation result")
+			}
+			*resultCreateVirtioScsi = spdk.VhostCreateScsiControllerResult(true)
+		}
+	} else if method == "vhost_delete_controller" || method == "vfu_virtio_delete_endpoint" {
 		if s.err == nil {
 			resultDeleteVirtioBLk, ok := result.(*spdk.VhostDeleteControllerResult)
 			if !ok {
@@ -84,6 +96,14 @@ func (s *stubJSONRRPC) Call(_ context.Context, method string, arg, result interf
 			}
 			*resultDeleteVirtioBLk = spdk.VhostDeleteControllerResult(true)
 		}
+	} else if method == "nvmf_create_transport" {
+		if s.err == nil {
+			resultCreateNvmfTransport, ok := result.(*frontend.NvmfCreateTransportResult)
+			if !ok {
+				log.Panicf("Unexpected type for nvmf transport creation result")
+			}
+			*resultCreateNvmfTransport = frontend.NvmfCreateTransportResult(true)
+		}
 	} else if method == "nvmf_subsystem_add_listener" || method == "nvmf_subsystem_remove_listener" {
 		if s.err == nil {
 			resultCreateNvmeController, ok := result.(*spdk.NvmfSubsystemAddListenerResult)
@@ -101,6 +121,7 @@ func (s *stubJSONRRPC) Call(_ context.Context, method string, arg, result interf
 type mockCall struct {
 	response           string
 	event              string
+	eventOnly          bool
 	expectedArgs       []string
 	expectedRegExpArgs []*regexp.Regexp
 }
@@ -150,6 +171,29 @@ func (s *mockQmpCalls) ExpectAddVirtioBlkWithAddress(id string, chardevID string
 	return s
 }
 
+func (s *mockQmpCalls) ExpectAddVirtioScsi(id string, chardevID string) *mockQmpCalls {
+	s.expectedCalls = append(s.expectedCalls, mockCall{
+		response: genericQmpOk,
+		expectedArgs: []string{
+			`"execute":"device_add"`,
+			`"driver":"vhost-user-scsi-pci"`,
+			qmpID + toQemuID(id) + `"`,
+			`"chardev":"` + toQemuID(chardevID) + `"`,
+		},
+	})
+	return s
+}
+
+func (s *mockQmpCalls) ExpectAddVirtioScsiWithAddress(id string, chardevID string, bus string, pf uint32) *mockQmpCalls {
+	s.ExpectAddVirtioScsi(id, chardevID)
+	index := len(s.expectedCalls) - 1
+	s.expectedCalls[index].expectedArgs =
+		append(s.expectedCalls[index].expectedArgs, `"bus":"`+bus+`"`)
+	s.expectedCalls[index].expectedArgs =
+		append(s.expectedCalls[index].expectedArgs, `"addr":"`+fmt.Sprintf("%#x", pf)+`"`)
+	return s
+}
+
 func (s *mockQmpCalls) ExpectAddNvmeController(id string, ctrlrDir string) *mockQmpCalls {
 	s.expectedCalls = append(s.expectedCalls, mockCall{
 		response: genericQmpOk,
@@ -165,6 +209,21 @@ func (s *mockQmpCalls) ExpectAddNvmeController(id string, ctrlrDir string) *mock
 	return s
 }
 
+func (s *mockQmpCalls) ExpectAddVirtioBlkVfiouser(id string) *mockQmpCalls {
+	s.expectedCalls = append(s.expectedCalls, mockCall{
+		response: genericQmpOk,
+		expectedArgs: []string{
+			`"execute":"device_add"`,
+			`"driver":"vfio-user-pci"`,
+			qmpID + toQemuID(id) + `"`,
+		},
+		expectedRegExpArgs: []*regexp.Regexp{
+			regexp.MustCompile(`"socket":"` + pathRegexpStr + id + `"`),
+		},
+	})
+	return s
+}
+
 func (s *mockQmpCalls) ExpectAddNvmeControllerWithAddress(id string, ctrlDir string, bus string, pf uint32) *mockQmpCalls {
 	s.ExpectAddNvmeController(id, ctrlDir)
 	index := len(s.expectedCalls) - 1
@@ -198,14 +257,48 @@ func (s *mockQmpCalls) ExpectDeleteVirtioBlk(id string) *mockQmpCalls {
 	return s.expectDeleteDevice(id)
 }
 
+func (s *mockQmpCalls) ExpectDeleteVirtioScsiWithEvent(id string) *mockQmpCalls {
+	return s.ExpectDeleteVirtioBlkWithEvent(id)
+}
+
+func (s *mockQmpCalls) ExpectDeleteVirtioScsi(id string) *mockQmpCalls {
+	return s.expectDeleteDevice(id)
+}
+
+func (s *mockQmpCalls) ExpectDeleteVirtioBlkVfiouser(id string) *mockQmpCalls {
+	return s.expectDeleteDevice(id)
+}
+
 func (s *mockQmpCalls) ExpectDeleteNvmeController(id string) *mockQmpCalls {
 	return s.expectDeleteDevice(id)
 }
 
-func (s *mockQmpCalls) ExpectQueryPci(id string) *mockQmpCalls {
-	response := `{"return":[{"bus":0,"devices":[{"bus":0,"slot":0,"function":0,` +
+func (s *mockQmpCalls) ExpectQueryPci(ids ...string) *mockQmpCalls {
+	devices := []string{}
+	for i, id := range ids {
+		devices = append(devices, `{"bus":0,"slot":`+strconv.Itoa(i)+`,"function":0,`+
+			`"class_info":{"class":0},"id":{"device":0,"vendor":0},"qdev_id":"`+
+			toQemuID(id)+`","regions":[]}`)
+	}
+	response := `{"return":[{"bus":0,"devices":[` + strings.Join(devices, ",") + `]}]}` + "\n"
+	s.expectedCalls = append(s.expectedCalls, mockCall{
+		response: response,
+		expectedArgs: []string{
+			`"execute":"query-pci"`,
+		},
+	})
+	return s
+}
+
+func (s *mockQmpCalls) ExpectQueryPciWithBusDevice(bus string, slot uint32, id string) *mockQmpCalls {
+	response := `{"return":[{"bus":0,"devices":[{"bus":0,"slot":1,"function":0,` +
+		`"class_info":{"class":0},"id":{"device":0,"vendor":0},"qdev_id":"` + bus + `",` +
+		`"pci_bridge":{"bus":{"number":1,"secondary":1,"subordinate":1,` +
+		`"io_range":{"base":0,"limit":0},"memory_range":{"base":0,"limit":0},` +
+		`"prefetchable_range":{"base":0,"limit":0}},` +
+		`"devices":[{"bus":1,"slot":` + strconv.Itoa(int(slot)) + `,"function":0,` +
 		`"class_info":{"class":0},"id":{"device":0,"vendor":0},"qdev_id":"` +
-		toQemuID(id) + `","regions":[]}]}]}` + "\n"
+		toQemuID(id) + `","regions":[]}]},"regions":[]}]}]}` + "\n"
 	s.expectedCalls = append(s.expectedCalls, mockCall{
 		response: response,
 		expectedArgs: []string{
@@ -225,6 +318,39 @@ func (s *mockQmpCalls) ExpectNoDeviceQueryPci() *mockQmpCalls {
 	return s
 }
 
+func (s *mockQmpCalls) ExpectQueryStatus() *mockQmpCalls {
+	s.expectedCalls = append(s.expectedCalls, mockCall{
+		response: `{"return":{"running":true,"singlestep":false,"status":"running"}}` + "\n",
+		expectedArgs: []string{
+			`"execute":"query-status"`,
+		},
+	})
+	return s
+}
+
+func (s *mockQmpCalls) ExpectQueryChardev(ids ...string) *mockQmpCalls {
+	chardevs := []string{}
+	for _, id := range ids {
+		chardevs = append(chardevs, `{"label":"`+toQemuID(id)+`","filename":"unix:/some/path","frontend-open":true}`)
+	}
+	s.expectedCalls = append(s.expectedCalls, mockCall{
+		response: `{"return":[` + strings.Join(chardevs, ",") + `]}` + "\n",
+		expectedArgs: []string{
+			`"execute":"query-chardev"`,
+		},
+	})
+	return s
+}
+
+func (s *mockQmpCalls) ExpectEvent(event string) *mockQmpCalls {
+	s.expectedCalls = append(s.expectedCalls, mockCall{
+		event: `{"event":"` + event + `","data":{"guest":true},` +
+			`"timestamp":{"seconds":1,"microseconds":2}}` + "\n",
+		eventOnly: true,
+	})
+	return s
+}
+
 func (s *mockQmpCalls) WithErrorResponse() *mockQmpCalls {
 	if len(s.expectedCalls) == 0 {
 		log.Panicf("No instance to add a QMP error")
@@ -260,6 +386,7 @@ type mockQmpServer struct {
 	test          *testing.T
 	mu            sync.Mutex
 	callIndex     uint32
+	conn          net.Conn
 }
 
 func startMockQmpServer(t *testing.T, m *mockQmpCalls) *mockQmpServer {
@@ -283,18 +410,27 @@ func startMockQmpServer(t *testing.T, m *mockQmpCalls) *mockQmpServer {
 	}
 
 	s.socketPath = filepath.Join(s.testDir, "qmp.sock")
+	s.test = t
+	s.listen()
+
+	return s
+}
+
+func (s *mockQmpServer) listen() {
 	socket, err := net.Listen("unix", s.socketPath)
 	if err != nil {
 		log.Panic(err.Error())
 	}
 	s.socket = socket
-	s.test = t
 
 	go func() {
-		conn, err := s.socket.Accept()
+		conn, err := socket.Accept()
 		if err != nil {
 			return
 		}
+		s.mu.Lock()
+		s.conn = conn
+		s.mu.Unlock()
 		err = conn.SetDeadline(time.Now().Add(qmpServerOperationTimeout))
 		if err != nil {
 			log.Panicf("Failed to set deadline: %v", err)
@@ -306,21 +442,61 @@ func startMockQmpServer(t *testing.T, m *mockQmpCalls) *mockQmpServer {
 			s.handleExpectedCall(call, conn)
 		}
 	}()
+}
 
-	return s
+// Restart emulates QEMU restart on the same QMP socket. Established
+// connection is closed and new one expects provided calls.
+func (s *mockQmpServer) Restart(m *mockQmpCalls) {
+	s.close()
+	s.mu.Lock()
+	s.expectedCalls = m.GetExpectedCalls()
+	s.callIndex = 0
+	s.mu.Unlock()
+	s.listen()
 }
 
 func (s *mockQmpServer) Stop() {
+	s.close()
+	if err := os.RemoveAll(s.testDir); err != nil {
+		log.Panicf("Failed to delete test dir: %v", err)
+	}
+}
+
+func (s *mockQmpServer) close() {
 	if s.socket != nil {
 		if err := s.socket.Close(); err != nil {
 			log.Panicf("Failed to close socket: %v", err)
 		}
+		s.socket = nil
 	}
-	if err := os.RemoveAll(s.testDir); err != nil {
-		log.Panicf("Failed to delete test dir: %v", err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
 	}
 }
 
+// waitForMonitorDisconnected waits until kvm server notices that QMP
+// connection is lost
+func waitForMonitorDisconnected(t *testing.T, kvmServer *Server) {
+	v, err := kvmServer.vmByID(DefaultVMID)
+	if err != nil {
+		t.Fatal("expected default VM, received", err)
+	}
+	mon := v.hv.(*monitor)
+	for i := 0; i < 100; i++ {
+		mon.mu.Lock()
+		conn := mon.conn
+		mon.mu.Unlock()
+		if conn == nil {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("QMP connection is not closed")
+}
+
 func (s *mockQmpServer) WereExpectedCallsPerformed() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -342,6 +518,12 @@ func (s *mockQmpServer) handleExpectedCall(call mockCall, conn net.Conn) {
 }
 
 func (s *mockQmpServer) handleCall(call mockCall, conn net.Conn) {
+	if call.eventOnly {
+		// let QMP library finish handshake, it drops data buffered during it
+		time.Sleep(time.Millisecond * 10)
+		s.write(call.event, conn)
+		return
+	}
 	req := s.read(conn)
 	for _, expectedArg := range call.expectedArgs {
 		if !strings.Contains(req, expectedArg) {
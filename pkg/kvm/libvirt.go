@@ -0,0 +1,689 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/digitalocean/go-libvirt/socket/dialers"
+	qmpraw "github.com/digitalocean/go-qemu/qmp/raw"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errLibvirtClosed     = errors.New("libvirt connection is closed")
+	errNoLibvirtVMEvents = status.Error(codes.Unimplemented,
+		"VM events are not supported for libvirt")
+)
+
+// libvirtUserAliasPrefix is required by libvirt for user defined device
+// aliases. QEMU device ID is the alias.
+const libvirtUserAliasPrefix = "ua-"
+
+// libvirtDeviceModifyFlags applies changes to the running domain and to its
+// persistent definition to keep them in sync for restart and migration
+const libvirtDeviceModifyFlags = uint32(libvirt.DomainDeviceModifyLive | libvirt.DomainDeviceModifyConfig)
+
+// libvirtConnection is a part of libvirt RPC API used to hotplug devices
+type libvirtConnection interface {
+	Connect() error
+	Disconnect() error
+	Disconnected() <-chan struct{}
+	DomainLookupByName(name string) (libvirt.Domain, error)
+	DomainGetXMLDesc(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error)
+	DomainAttachDeviceFlags(dom libvirt.Domain, xml string, flags uint32) error
+	DomainDetachDeviceAlias(dom libvirt.Domain, alias string, flags uint32) error
+	QEMUDomainMonitorCommand(dom libvirt.Domain, cmd string, flags uint32) (string, error)
+}
+
+// newLibvirtConnection creates connection to libvirt daemon socket. It is
+// a variable to be replaced in tests.
+var newLibvirtConnection = func(socket string, timeout time.Duration) libvirtConnection {
+	return libvirt.NewWithDialer(dialers.NewLocal(
+		dialers.WithSocket(socket),
+		dialers.WithLocalTimeout(timeout),
+	))
+}
+
+// libvirtHypervisor plugs devices to libvirt domain by attaching and
+// detaching device XML, so that libvirt keeps track of them. vhost-user
+// sockets of added chardevs are kept to put them in the device XML.
+// libvirt has no device XML for vfio-user, so such devices are plugged by
+// QMP commands passed through libvirt to the domain QEMU. libvirt marks the
+// domain as tainted and does not keep the devices in the domain definition,
+// they are plugged again by Reconcile after the domain restarts.
+type libvirtHypervisor struct {
+	conn       libvirtConnection
+	domainName string
+
+	pollDevicePresenceTimeout time.Duration
+	pollDevicePresenceStep    time.Duration
+
+	// opMu serializes operations, since device XML depends on domain state
+	opMu sync.Mutex
+
+	mu       sync.Mutex
+	domain   *libvirt.Domain
+	closed   bool
+	chardevs map[string]string
+}
+
+func newLibvirtHypervisor(conn libvirtConnection, domainName string,
+	timeout time.Duration, pollDevicePresenceStep time.Duration) *libvirtHypervisor {
+	return &libvirtHypervisor{
+		conn:                      conn,
+		domainName:                domainName,
+		pollDevicePresenceTimeout: timeout,
+		pollDevicePresenceStep:    pollDevicePresenceStep,
+		chardevs:                  map[string]string{},
+	}
+}
+
+// Connect establishes libvirt connection and looks up the domain if there
+// is no connection
+func (l *libvirtHypervisor) Connect() error {
+	_, err := l.connection()
+	return err
+}
+
+func (l *libvirtHypervisor) connection() (libvirt.Domain, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return libvirt.Domain{}, errLibvirtClosed
+	}
+	if l.domain != nil && !l.disconnected() {
+		return *l.domain, nil
+	}
+
+	l.domain = nil
+	if l.disconnected() {
+		if err := l.conn.Connect(); err != nil {
+			log.Printf("Failed to connect to libvirt: %v", err)
+			return libvirt.Domain{}, err
+		}
+	}
+	domain, err := l.conn.DomainLookupByName(l.domainName)
+	if err != nil {
+		log.Printf("Failed to find libvirt domain %v: %v", l.domainName, err)
+		return libvirt.Domain{}, err
+	}
+	l.domain = &domain
+	return domain, nil
+}
+
+func (l *libvirtHypervisor) disconnected() bool {
+	select {
+	case <-l.conn.Disconnected():
+		return true
+	default:
+		return false
+	}
+}
+
+// Disconnect closes libvirt connection and makes all further operations fail
+func (l *libvirtHypervisor) Disconnect() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.domain = nil
+	if l.disconnected() {
+		return nil
+	}
+	err := l.conn.Disconnect()
+	if err != nil {
+		log.Printf("Failed to disconnect from libvirt %v", err)
+	}
+	return err
+}
+
+func (l *libvirtHypervisor) AddChardev(id string, sockPath string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.chardevs[id] = sockPath
+	return nil
+}
+
+func (l *libvirtHypervisor) DeleteChardev(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.chardevs, id)
+	return nil
+}
+
+func (l *libvirtHypervisor) AddVirtioBlkDevice(id string, chardevID string, location deviceLocation) error {
+	l.mu.Lock()
+	socket, ok := l.chardevs[chardevID]
+	l.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no vhost-user socket added for %v", chardevID)
+	}
+
+	l.opMu.Lock()
+	defer l.opMu.Unlock()
+	domain, err := l.connection()
+	if err != nil {
+		return err
+	}
+	desc, err := l.domainXML(domain)
+	if err != nil {
+		return err
+	}
+	if desc.hasAlias(id) {
+		log.Printf("Device %v already exists", id)
+		return nil
+	}
+	target, err := desc.freeDiskTarget()
+	if err != nil {
+		return err
+	}
+	address, err := desc.address(location)
+	if err != nil {
+		return err
+	}
+
+	disk := libvirtDiskXML{
+		Type:    "vhostuser",
+		Device:  "disk",
+		Driver:  libvirtDiskDriverXML{Name: "qemu", Type: "raw"},
+		Source:  libvirtDiskSourceXML{Type: "unix", Path: socket},
+		Target:  libvirtDiskTargetXML{Dev: target, Bus: "virtio"},
+		Alias:   &libvirtAliasXML{Name: libvirtUserAliasPrefix + id},
+		Address: address,
+	}
+	return l.attachDevice(domain, id, disk)
+}
+
+func (l *libvirtHypervisor) AddVirtioScsiDevice(string, string, deviceLocation) error {
+	return errors.New("vhost-user-scsi is not supported by libvirt")
+}
+
+func (l *libvirtHypervisor) AddNvmeControllerDevice(id string, ctrlrDir string, location deviceLocation) error {
+	return l.AddVfiouserDevice(id, filepath.Join(ctrlrDir, "cntrl"), location)
+}
+
+// AddVfiouserDevice plugs vfio-user device by QMP device_add, since libvirt
+// has no device XML for it
+func (l *libvirtHypervisor) AddVfiouserDevice(id string, socket string, location deviceLocation) error {
+	l.opMu.Lock()
+	defer l.opMu.Unlock()
+	domain, err := l.connection()
+	if err != nil {
+		return err
+	}
+	if exist, err := l.pciDeviceExist(domain, id); err == nil && exist {
+		log.Printf("Device %v already exists", id)
+		return nil
+	}
+
+	if err := l.runQmp(domain, "device_add", newVfiouserDeviceArgs(id, socket, location), nil); err != nil {
+		if exist, existErr := l.pciDeviceExist(domain, id); existErr == nil && exist {
+			log.Printf("Device %v already exists", id)
+			return nil
+		}
+		return fmt.Errorf("couldn't add device: %w", err)
+	}
+	return l.waitForPciDevicePresence(domain, id, true)
+}
+
+func (l *libvirtHypervisor) DeleteVirtioBlkDevice(id string) error {
+	return l.DeleteDevice(id)
+}
+
+func (l *libvirtHypervisor) DeleteVirtioScsiDevice(id string) error {
+	return l.DeleteDevice(id)
+}
+
+func (l *libvirtHypervisor) DeleteNvmeControllerDevice(id string) error {
+	return l.DeleteVfiouserDevice(id)
+}
+
+// DeleteVfiouserDevice unplugs device by QMP device_del and waits until
+// the guest releases it
+func (l *libvirtHypervisor) DeleteVfiouserDevice(id string) error {
+	l.opMu.Lock()
+	defer l.opMu.Unlock()
+	domain, err := l.connection()
+	if err != nil {
+		return err
+	}
+	return l.deleteQmpDevice(domain, id)
+}
+
+// DeleteDevice detaches device of any type by its alias and waits until it
+// disappears from the live domain XML, i.e. until the guest releases it.
+// Devices unknown to libvirt are deleted over QMP.
+func (l *libvirtHypervisor) DeleteDevice(id string) error {
+	l.opMu.Lock()
+	defer l.opMu.Unlock()
+	domain, err := l.connection()
+	if err != nil {
+		return err
+	}
+	desc, err := l.domainXML(domain)
+	if err != nil {
+		return err
+	}
+	if !desc.hasAlias(id) {
+		return l.deleteQmpDevice(domain, id)
+	}
+
+	err = l.conn.DomainDetachDeviceAlias(domain, libvirtUserAliasPrefix+id, libvirtDeviceModifyFlags)
+	if err != nil {
+		if desc, descErr := l.domainXML(domain); descErr == nil && !desc.hasAlias(id) {
+			log.Printf("Device %v is already deleted", id)
+			return nil
+		}
+		return fmt.Errorf("couldn't detach device: %w", err)
+	}
+	return l.waitForDeviceNotExist(domain, id)
+}
+
+// Ping checks libvirt connection is alive and the domain exists. It does
+// not wait for running operations.
+func (l *libvirtHypervisor) Ping() error {
+	_, err := l.connection()
+	return err
+}
+
+// QueryDeviceIDs returns QEMU IDs of all devices with an alias in the
+// domain and of PCI devices plugged over QMP
+func (l *libvirtHypervisor) QueryDeviceIDs() (map[string]struct{}, error) {
+	l.opMu.Lock()
+	defer l.opMu.Unlock()
+	domain, err := l.connection()
+	if err != nil {
+		return nil, err
+	}
+	desc, err := l.domainXML(domain)
+	if err != nil {
+		return nil, err
+	}
+	pci, err := l.queryPci(domain)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]struct{}{}
+	for _, bus := range pci {
+		collectDeviceIDs(bus.Devices, ids)
+	}
+	for _, dev := range desc.Devices.Devices {
+		if dev.Alias != nil {
+			ids[dev.qemuID()] = struct{}{}
+		}
+	}
+	return ids, nil
+}
+
+// QueryChardevIDs returns IDs of kept vhost-user sockets
+func (l *libvirtHypervisor) QueryChardevIDs() (map[string]struct{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ids := map[string]struct{}{}
+	for id := range l.chardevs {
+		ids[id] = struct{}{}
+	}
+	return ids, nil
+}
+
+// QueryPciAddresses returns QEMU IDs of devices by addresses they use on PCI
+// controllers with an alias, i.e. on buses named as in QEMU, including
+// devices plugged over QMP
+func (l *libvirtHypervisor) QueryPciAddresses() (map[pciAddress]string, error) {
+	l.opMu.Lock()
+	defer l.opMu.Unlock()
+	domain, err := l.connection()
+	if err != nil {
+		return nil, err
+	}
+	desc, err := l.domainXML(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	pci, err := l.queryPci(domain)
+	if err != nil {
+		return nil, err
+	}
+	addresses := map[pciAddress]string{}
+	for _, bus := range pci {
+		collectPciAddresses(bus.Devices, addresses)
+	}
+	for address, id := range addresses {
+		addresses[address] = strings.TrimPrefix(id, libvirtUserAliasPrefix)
+	}
+
+	buses := desc.pciBuses()
+	for _, dev := range desc.Devices.Devices {
+		if dev.Alias == nil || dev.Address == nil || dev.Address.Type != "pci" {
+			continue
+		}
+		index, errBus := parseLibvirtNumber(dev.Address.Bus)
+		slot, errSlot := parseLibvirtNumber(dev.Address.Slot)
+		function, errFunction := parseLibvirtNumber(dev.Address.Function)
+		if errBus != nil || errSlot != nil || errFunction != nil {
+			continue
+		}
+		bus, ok := buses[index]
+		if !ok {
+			continue
+		}
+		addresses[pciAddress{bus: bus, slot: slot, function: function}] = dev.qemuID()
+	}
+	return addresses, nil
+}
+
+func (l *libvirtHypervisor) SubscribeVMEvents() (<-chan VMEvent, error) {
+	return nil, errNoLibvirtVMEvents
+}
+
+func (l *libvirtHypervisor) UnsubscribeVMEvents(<-chan VMEvent) {}
+
+func (l *libvirtHypervisor) attachDevice(domain libvirt.Domain, id string, device interface{}) error {
+	bs, err := xml.Marshal(device)
+	if err != nil {
+		log.Println("xml marshalling error:", err)
+		return fmt.Errorf("couldn't create device xml: %w", err)
+	}
+
+	log.Println("libvirt device to attach:", string(bs))
+	if err := l.conn.DomainAttachDeviceFlags(domain, string(bs), libvirtDeviceModifyFlags); err != nil {
+		log.Println("libvirt error:", err)
+		if desc, descErr := l.domainXML(domain); descErr == nil && desc.hasAlias(id) {
+			log.Printf("Device %v already exists", id)
+			return nil
+		}
+		return fmt.Errorf("couldn't attach device: %w", err)
+	}
+	return nil
+}
+
+func (l *libvirtHypervisor) waitForDeviceNotExist(domain libvirt.Domain, id string) error {
+	timeoutTimer := time.NewTimer(l.pollDevicePresenceTimeout)
+	defer timeoutTimer.Stop()
+	devicePresenceTicker := time.NewTicker(l.pollDevicePresenceStep)
+	defer devicePresenceTicker.Stop()
+	for {
+		select {
+		case <-timeoutTimer.C:
+			return fmt.Errorf("timeout waiting for device %v to be detached", id)
+		case <-devicePresenceTicker.C:
+			desc, err := l.domainXML(domain)
+			if err != nil {
+				log.Println("failed to check device existence:", err)
+				continue
+			}
+			if !desc.hasAlias(id) {
+				return nil
+			}
+		}
+	}
+}
+
+// deleteQmpDevice deletes device plugged over QMP. Absent device is
+// considered deleted.
+func (l *libvirtHypervisor) deleteQmpDevice(domain libvirt.Domain, id string) error {
+	if err := l.runQmp(domain, "device_del", map[string]string{"id": id}, nil); err != nil {
+		if exist, existErr := l.pciDeviceExist(domain, id); existErr == nil && !exist {
+			log.Printf("Device %v is already deleted", id)
+			return nil
+		}
+		return fmt.Errorf("couldn't delete device: %w", err)
+	}
+	return l.waitForPciDevicePresence(domain, id, false)
+}
+
+func (l *libvirtHypervisor) waitForPciDevicePresence(domain libvirt.Domain, id string, shouldExist bool) error {
+	timeoutTimer := time.NewTimer(l.pollDevicePresenceTimeout)
+	defer timeoutTimer.Stop()
+	devicePresenceTicker := time.NewTicker(l.pollDevicePresenceStep)
+	defer devicePresenceTicker.Stop()
+	for {
+		select {
+		case <-timeoutTimer.C:
+			return fmt.Errorf("timeout waiting for PCI device %v presence %v", id, shouldExist)
+		case <-devicePresenceTicker.C:
+			exist, err := l.pciDeviceExist(domain, id)
+			if err != nil {
+				log.Println("failed to check pci device existence:", err)
+				continue
+			}
+			if exist == shouldExist {
+				return nil
+			}
+		}
+	}
+}
+
+func (l *libvirtHypervisor) pciDeviceExist(domain libvirt.Domain, id string) (bool, error) {
+	pci, err := l.queryPci(domain)
+	if err != nil {
+		return false, err
+	}
+	ids := map[string]struct{}{}
+	for _, bus := range pci {
+		collectDeviceIDs(bus.Devices, ids)
+	}
+	_, ok := ids[id]
+	return ok, nil
+}
+
+func (l *libvirtHypervisor) queryPci(domain libvirt.Domain) ([]qmpraw.PCIInfo, error) {
+	var pci []qmpraw.PCIInfo
+	if err := l.runQmp(domain, "query-pci", nil, &pci); err != nil {
+		return nil, err
+	}
+	return pci, nil
+}
+
+// runQmp passes QMP command through libvirt to the domain QEMU and
+// unmarshals the returned value into result if it is not nil
+func (l *libvirtHypervisor) runQmp(domain libvirt.Domain, execute string, arguments interface{}, result interface{}) error {
+	cmd := map[string]interface{}{"execute": execute}
+	if arguments != nil {
+		cmd["arguments"] = arguments
+	}
+	bs, err := json.Marshal(cmd)
+	if err != nil {
+		log.Println("json marshalling error:", err)
+		return fmt.Errorf("couldn't create QMP command: %w", err)
+	}
+
+	raw, err := l.conn.QEMUDomainMonitorCommand(domain, string(bs), 0)
+	if err != nil {
+		log.Println("libvirt error:", err)
+		return err
+	}
+	response := struct {
+		Return json.RawMessage `json:"return"`
+		Error  *struct {
+			Class string `json:"class"`
+			Desc  string `json:"desc"`
+		} `json:"error"`
+	}{}
+	if err := json.Unmarshal([]byte(raw), &response); err != nil {
+		return fmt.Errorf("couldn't parse QMP response: %w", err)
+	}
+	if response.Error != nil {
+		log.Printf("QMP %v error: %v", execute, raw)
+		return fmt.Errorf("%v: %v", response.Error.Class, response.Error.Desc)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Return, result)
+}
+
+func (l *libvirtHypervisor) domainXML(domain libvirt.Domain) (*libvirtDomainXML, error) {
+	raw, err := l.conn.DomainGetXMLDesc(domain, 0)
+	if err != nil {
+		return nil, err
+	}
+	desc := &libvirtDomainXML{}
+	if err := xml.Unmarshal([]byte(raw), desc); err != nil {
+		return nil, fmt.Errorf("couldn't parse domain xml: %w", err)
+	}
+	return desc, nil
+}
+
+// libvirtDomainXML is a part of live domain XML used by the bridge
+type libvirtDomainXML struct {
+	XMLName xml.Name `xml:"domain"`
+	Devices struct {
+		Devices []libvirtDeviceXML `xml:",any"`
+	} `xml:"devices"`
+}
+
+// libvirtDeviceXML keeps fields common for all device elements
+type libvirtDeviceXML struct {
+	XMLName xml.Name
+	Type    string                `xml:"type,attr"`
+	Model   string                `xml:"model,attr"`
+	Index   string                `xml:"index,attr"`
+	Target  *libvirtDiskTargetXML `xml:"target"`
+	Alias   *libvirtAliasXML      `xml:"alias"`
+	Address *libvirtAddressXML    `xml:"address"`
+}
+
+func (d *libvirtDeviceXML) qemuID() string {
+	return strings.TrimPrefix(d.Alias.Name, libvirtUserAliasPrefix)
+}
+
+type libvirtAliasXML struct {
+	Name string `xml:"name,attr"`
+}
+
+type libvirtAddressXML struct {
+	Type          string `xml:"type,attr"`
+	Domain        string `xml:"domain,attr,omitempty"`
+	Bus           string `xml:"bus,attr,omitempty"`
+	Slot          string `xml:"slot,attr,omitempty"`
+	Function      string `xml:"function,attr,omitempty"`
+	Multifunction string `xml:"multifunction,attr,omitempty"`
+}
+
+type libvirtDiskXML struct {
+	XMLName xml.Name             `xml:"disk"`
+	Type    string               `xml:"type,attr"`
+	Device  string               `xml:"device,attr"`
+	Driver  libvirtDiskDriverXML `xml:"driver"`
+	Source  libvirtDiskSourceXML `xml:"source"`
+	Target  libvirtDiskTargetXML `xml:"target"`
+	Alias   *libvirtAliasXML     `xml:"alias"`
+	Address *libvirtAddressXML   `xml:"address"`
+}
+
+type libvirtDiskDriverXML struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type libvirtDiskSourceXML struct {
+	Type string `xml:"type,attr"`
+	Path string `xml:"path,attr"`
+}
+
+type libvirtDiskTargetXML struct {
+	Dev string `xml:"dev,attr"`
+	Bus string `xml:"bus,attr,omitempty"`
+}
+
+func (d *libvirtDomainXML) hasAlias(id string) bool {
+	for _, dev := range d.Devices.Devices {
+		if dev.Alias != nil && dev.Alias.Name == libvirtUserAliasPrefix+id {
+			return true
+		}
+	}
+	return false
+}
+
+// pciBuses maps indexes of PCI controllers to their aliases, which are
+// QEMU IDs of the buses
+func (d *libvirtDomainXML) pciBuses() map[uint32]string {
+	buses := map[uint32]string{}
+	for _, dev := range d.Devices.Devices {
+		if dev.XMLName.Local != "controller" || dev.Type != "pci" || dev.Alias == nil {
+			continue
+		}
+		index, err := parseLibvirtNumber(dev.Index)
+		if err != nil {
+			continue
+		}
+		buses[index] = dev.Alias.Name
+	}
+	return buses
+}
+
+// address converts location calculated on QEMU bus into libvirt address on
+// the PCI controller with the same alias. No address is returned for
+// locations assigned by libvirt.
+func (d *libvirtDomainXML) address(location deviceLocation) (*libvirtAddressXML, error) {
+	if location.address == nil {
+		return nil, nil
+	}
+	for index, bus := range d.pciBuses() {
+		if bus != location.address.bus {
+			continue
+		}
+		address := &libvirtAddressXML{
+			Type:     "pci",
+			Domain:   "0x0000",
+			Bus:      fmt.Sprintf("%#x", index),
+			Slot:     fmt.Sprintf("%#x", location.address.slot),
+			Function: fmt.Sprintf("%#x", location.address.function),
+		}
+		if location.Multifunction != nil {
+			address.Multifunction = *location.Multifunction
+		}
+		return address, nil
+	}
+	return nil, fmt.Errorf("no PCI controller with alias %v in domain", location.address.bus)
+}
+
+// freeDiskTarget returns first virtio disk name not used in the domain
+func (d *libvirtDomainXML) freeDiskTarget() (string, error) {
+	used := map[string]struct{}{}
+	for _, dev := range d.Devices.Devices {
+		if dev.XMLName.Local == "disk" && dev.Target != nil {
+			used[dev.Target.Dev] = struct{}{}
+		}
+	}
+	for index := 0; index < maxLibvirtDisks; index++ {
+		name := libvirtDiskName(index)
+		if _, ok := used[name]; !ok {
+			return name, nil
+		}
+	}
+	return "", errors.New("no free virtio disk name in domain")
+}
+
+// maxLibvirtDisks limits virtio disk names to vda..vdzz
+const maxLibvirtDisks = 26 * 27
+
+// libvirtDiskName converts index to virtio disk name the same way libvirt
+// does: 0 is vda, 25 is vdz, 26 is vdaa
+func libvirtDiskName(index int) string {
+	name := ""
+	for i := index; i >= 0; i = i/26 - 1 {
+		name = string(rune('a'+i%26)) + name
+	}
+	return "vd" + name
+}
+
+func parseLibvirtNumber(value string) (uint32, error) {
+	number, err := strconv.ParseUint(value, 0, 32)
+	return uint32(number), err
+}
@@ -0,0 +1,487 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	qmpraw "github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/philippgille/gokv/gomap"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testLibvirtDomain     = "opi-vm"
+	testLibvirtController = `<controller type="pci" index="1" model="pci-bridge"><alias name="pci.opi.0"/></controller>`
+	testLibvirtDisk       = `<disk type="file" device="disk"><target dev="vda" bus="virtio"/><alias name="virtio-disk0"/></disk>`
+)
+
+// fakeLibvirt keeps devices of a single domain changed by attach/detach
+// calls and devices on pci.opi.0 bus changed by passed through QMP commands
+type fakeLibvirt struct {
+	mu           sync.Mutex
+	disconnected chan struct{}
+	devices      []string
+	attached     []string
+	detached     []string
+	attachErr    error
+	detachErr    error
+	qmpDevices   []string
+	qmpCommands  []string
+	qmpErr       bool
+}
+
+func newFakeLibvirt(devices ...string) *fakeLibvirt {
+	disconnected := make(chan struct{})
+	close(disconnected)
+	return &fakeLibvirt{
+		disconnected: disconnected,
+		devices:      append([]string{testLibvirtController, testLibvirtDisk}, devices...),
+	}
+}
+
+func (f *fakeLibvirt) Connect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disconnected = make(chan struct{})
+	return nil
+}
+
+func (f *fakeLibvirt) Disconnect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	close(f.disconnected)
+	return nil
+}
+
+func (f *fakeLibvirt) Disconnected() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.disconnected
+}
+
+func (f *fakeLibvirt) DomainLookupByName(name string) (libvirt.Domain, error) {
+	if name != testLibvirtDomain {
+		return libvirt.Domain{}, errors.New("domain not found")
+	}
+	return libvirt.Domain{Name: name, ID: 1}, nil
+}
+
+func (f *fakeLibvirt) DomainGetXMLDesc(libvirt.Domain, libvirt.DomainXMLFlags) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return "<domain><devices>" + strings.Join(f.devices, "") + "</devices></domain>", nil
+}
+
+func (f *fakeLibvirt) DomainAttachDeviceFlags(_ libvirt.Domain, xml string, _ uint32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attached = append(f.attached, xml)
+	if f.attachErr != nil {
+		return f.attachErr
+	}
+	f.devices = append(f.devices, xml)
+	return nil
+}
+
+func (f *fakeLibvirt) DomainDetachDeviceAlias(_ libvirt.Domain, alias string, _ uint32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.detached = append(f.detached, alias)
+	if f.detachErr != nil {
+		return f.detachErr
+	}
+	for i, dev := range f.devices {
+		if strings.Contains(dev, `<alias name="`+alias+`">`) || strings.Contains(dev, `<alias name="`+alias+`"/>`) {
+			f.devices = append(f.devices[:i], f.devices[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("device not found")
+}
+
+func (f *fakeLibvirt) QEMUDomainMonitorCommand(_ libvirt.Domain, cmd string, _ uint32) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	request := struct {
+		Execute   string            `json:"execute"`
+		Arguments map[string]string `json:"arguments"`
+	}{}
+	if err := json.Unmarshal([]byte(cmd), &request); err != nil {
+		return "", err
+	}
+	if request.Execute == "query-pci" {
+		bridge := qmpraw.PCIDeviceInfo{QdevID: "pci.opi.0", PCIBridge: &qmpraw.PCIBridgeInfo{}}
+		for i, id := range f.qmpDevices {
+			bridge.PCIBridge.Devices = append(bridge.PCIBridge.Devices,
+				qmpraw.PCIDeviceInfo{Bus: 1, Slot: int64(i), QdevID: id})
+		}
+		bs, err := json.Marshal([]qmpraw.PCIInfo{{Devices: []qmpraw.PCIDeviceInfo{bridge}}})
+		return `{"return":` + string(bs) + `}`, err
+	}
+
+	f.qmpCommands = append(f.qmpCommands, cmd)
+	if f.qmpErr {
+		return `{"error":{"class":"GenericError","desc":"QMP command failed"}}`, nil
+	}
+	id := request.Arguments["id"]
+	switch request.Execute {
+	case "device_add":
+		f.qmpDevices = append(f.qmpDevices, id)
+	case "device_del":
+		for i, dev := range f.qmpDevices {
+			if dev == id {
+				f.qmpDevices = append(f.qmpDevices[:i], f.qmpDevices[i+1:]...)
+				return `{"return":{}}`, nil
+			}
+		}
+		return `{"error":{"class":"DeviceNotFound","desc":"Device '` + id + `' not found"}}`, nil
+	}
+	return `{"return":{}}`, nil
+}
+
+func TestLibvirtDevices(t *testing.T) {
+	testID := "opi-virtio-blk-42"
+	testSocket := "/var/tmp/virtio-blk-42"
+	testDevice := `<disk type="vhostuser" device="disk"><driver name="qemu" type="raw"></driver>` +
+		`<source type="unix" path="` + testSocket + `"></source><target dev="vdb" bus="virtio"></target>` +
+		`<alias name="ua-` + testID + `"></alias></disk>`
+	testBus := "pci.opi.0"
+	testAddr := "0x2"
+	testVfiouserAdd := `{"arguments":{"driver":"vfio-user-pci","id":"` + testID +
+		`","socket":"` + testSocket + `"},"execute":"device_add"}`
+	testVfiouserDel := `{"arguments":{"id":"` + testID + `"},"execute":"device_del"}`
+	tests := map[string]struct {
+		devices     []string
+		qmpDevices  []string
+		attachErr   error
+		detachErr   error
+		qmpErr      bool
+		call        func(hv hypervisor) error
+		wantErr     bool
+		attached    []string
+		detached    []string
+		qmpCommands []string
+		present     bool
+	}{
+		"attach vhost-user disk": {
+			call: func(hv hypervisor) error {
+				_ = hv.AddChardev(testID, testSocket)
+				return hv.AddVirtioBlkDevice(testID, testID, deviceLocation{})
+			},
+			attached: []string{testDevice},
+			present:  true,
+		},
+		"attach vhost-user disk on bus": {
+			call: func(hv hypervisor) error {
+				_ = hv.AddChardev(testID, testSocket)
+				multifunction := "on"
+				return hv.AddVirtioBlkDevice(testID, testID, deviceLocation{
+					Multifunction: &multifunction,
+					address:       &pciAddress{bus: "pci.opi.0", slot: 2, function: 1},
+				})
+			},
+			attached: []string{strings.Replace(testDevice, "</disk>",
+				`<address type="pci" domain="0x0000" bus="0x1" slot="0x2" function="0x1" multifunction="on"></address></disk>`, 1)},
+			present: true,
+		},
+		"attach vhost-user disk on unknown bus": {
+			call: func(hv hypervisor) error {
+				_ = hv.AddChardev(testID, testSocket)
+				return hv.AddVirtioBlkDevice(testID, testID, deviceLocation{
+					address: &pciAddress{bus: "pci.opi.1", slot: 2},
+				})
+			},
+			wantErr: true,
+		},
+		"attach vhost-user disk without socket": {
+			call: func(hv hypervisor) error {
+				return hv.AddVirtioBlkDevice(testID, testID, deviceLocation{})
+			},
+			wantErr: true,
+		},
+		"attach already attached disk": {
+			devices: []string{testDevice},
+			call: func(hv hypervisor) error {
+				_ = hv.AddChardev(testID, testSocket)
+				return hv.AddVirtioBlkDevice(testID, testID, deviceLocation{})
+			},
+			present: true,
+		},
+		"failed to attach disk": {
+			attachErr: errors.New("attach failed"),
+			call: func(hv hypervisor) error {
+				_ = hv.AddChardev(testID, testSocket)
+				return hv.AddVirtioBlkDevice(testID, testID, deviceLocation{})
+			},
+			wantErr:  true,
+			attached: []string{testDevice},
+		},
+		"detach device": {
+			devices: []string{testDevice},
+			call: func(hv hypervisor) error {
+				return hv.DeleteDevice(testID)
+			},
+			detached: []string{"ua-" + testID},
+		},
+		"detach already detached device": {
+			call: func(hv hypervisor) error {
+				return hv.DeleteDevice(testID)
+			},
+			qmpCommands: []string{testVfiouserDel},
+		},
+		"failed to detach device": {
+			devices:   []string{testDevice},
+			detachErr: errors.New("detach failed"),
+			call: func(hv hypervisor) error {
+				return hv.DeleteDevice(testID)
+			},
+			wantErr:  true,
+			detached: []string{"ua-" + testID},
+			present:  true,
+		},
+		"add vfio-user device": {
+			call: func(hv hypervisor) error {
+				return hv.AddVfiouserDevice(testID, testSocket, deviceLocation{})
+			},
+			qmpCommands: []string{testVfiouserAdd},
+			present:     true,
+		},
+		"add vfio-user device on bus": {
+			call: func(hv hypervisor) error {
+				return hv.AddVfiouserDevice(testID, testSocket, deviceLocation{Bus: &testBus, Addr: &testAddr})
+			},
+			qmpCommands: []string{`{"arguments":{"driver":"vfio-user-pci","id":"` + testID +
+				`","bus":"pci.opi.0","addr":"0x2","socket":"` + testSocket + `"},"execute":"device_add"}`},
+			present: true,
+		},
+		"add Nvme controller device": {
+			call: func(hv hypervisor) error {
+				return hv.AddNvmeControllerDevice(testID, "/var/tmp", deviceLocation{})
+			},
+			qmpCommands: []string{`{"arguments":{"driver":"vfio-user-pci","id":"` + testID +
+				`","socket":"/var/tmp/cntrl"},"execute":"device_add"}`},
+			present: true,
+		},
+		"add already added vfio-user device": {
+			qmpDevices: []string{testID},
+			call: func(hv hypervisor) error {
+				return hv.AddVfiouserDevice(testID, testSocket, deviceLocation{})
+			},
+			present: true,
+		},
+		"failed to add vfio-user device": {
+			qmpErr: true,
+			call: func(hv hypervisor) error {
+				return hv.AddVfiouserDevice(testID, testSocket, deviceLocation{})
+			},
+			wantErr:     true,
+			qmpCommands: []string{testVfiouserAdd},
+		},
+		"delete vfio-user device": {
+			qmpDevices: []string{testID},
+			call: func(hv hypervisor) error {
+				return hv.DeleteVfiouserDevice(testID)
+			},
+			qmpCommands: []string{testVfiouserDel},
+		},
+		"delete already deleted vfio-user device": {
+			call: func(hv hypervisor) error {
+				return hv.DeleteNvmeControllerDevice(testID)
+			},
+			qmpCommands: []string{testVfiouserDel},
+		},
+		"failed to delete vfio-user device": {
+			qmpDevices: []string{testID},
+			qmpErr:     true,
+			call: func(hv hypervisor) error {
+				return hv.DeleteVfiouserDevice(testID)
+			},
+			wantErr:     true,
+			qmpCommands: []string{testVfiouserDel},
+			present:     true,
+		},
+		"delete device plugged over QMP": {
+			qmpDevices: []string{testID},
+			call: func(hv hypervisor) error {
+				return hv.DeleteDevice(testID)
+			},
+			qmpCommands: []string{testVfiouserDel},
+		},
+		"vhost-user-scsi is not supported": {
+			call: func(hv hypervisor) error {
+				_ = hv.AddChardev(testID, testSocket)
+				return hv.AddVirtioScsiDevice(testID, testID, deviceLocation{})
+			},
+			wantErr: true,
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			conn := newFakeLibvirt(tt.devices...)
+			conn.qmpDevices = tt.qmpDevices
+			conn.attachErr = tt.attachErr
+			conn.detachErr = tt.detachErr
+			conn.qmpErr = tt.qmpErr
+			hv := newLibvirtHypervisor(conn, testLibvirtDomain, qmplibTimeout, 5*time.Millisecond)
+
+			err := tt.call(hv)
+
+			if (err != nil) != tt.wantErr {
+				t.Error("expected error", tt.wantErr, "received", err)
+			}
+			if !reflect.DeepEqual(conn.attached, tt.attached) {
+				t.Error("expected attached", tt.attached, "received", conn.attached)
+			}
+			if !reflect.DeepEqual(conn.detached, tt.detached) {
+				t.Error("expected detached", tt.detached, "received", conn.detached)
+			}
+			if !reflect.DeepEqual(conn.qmpCommands, tt.qmpCommands) {
+				t.Error("expected QMP commands", tt.qmpCommands, "received", conn.qmpCommands)
+			}
+			ids, err := hv.QueryDeviceIDs()
+			if err != nil {
+				t.Fatal("expected device IDs, received", err)
+			}
+			if _, ok := ids[testID]; ok != tt.present {
+				t.Error("expected device presence", tt.present, "received", ok)
+			}
+		})
+	}
+}
+
+func TestLibvirtQueryPciAddresses(t *testing.T) {
+	conn := newFakeLibvirt(
+		`<disk type="vhostuser" device="disk"><target dev="vdb" bus="virtio"/><alias name="ua-opi-virtio-blk-42"/>`+
+			`<address type="pci" domain="0x0000" bus="0x01" slot="0x02" function="0x0"/></disk>`,
+		`<interface type="network"><alias name="net0"/>`+
+			`<address type="pci" domain="0x0000" bus="0x00" slot="0x03" function="0x0"/></interface>`,
+	)
+	hv := newLibvirtHypervisor(conn, testLibvirtDomain, qmplibTimeout, 5*time.Millisecond)
+
+	addresses, err := hv.QueryPciAddresses()
+
+	if err != nil {
+		t.Fatal("expected addresses, received", err)
+	}
+	want := map[pciAddress]string{{bus: "pci.opi.0", slot: 2, function: 0}: "opi-virtio-blk-42"}
+	if !reflect.DeepEqual(addresses, want) {
+		t.Error("expected", want, "received", addresses)
+	}
+}
+
+func TestLibvirtDiskName(t *testing.T) {
+	tests := map[int]string{0: "vda", 1: "vdb", 25: "vdz", 26: "vdaa", 27: "vdab", 701: "vdzz"}
+	for index, want := range tests {
+		if name := libvirtDiskName(index); name != want {
+			t.Error("index", index, "expected", want, "received", name)
+		}
+	}
+}
+
+func newTestLibvirtKvmServer(t *testing.T, conn *fakeLibvirt, ctrlrDir string) *Server {
+	prevNewLibvirtConnection := newLibvirtConnection
+	newLibvirtConnection = func(string, time.Duration) libvirtConnection { return conn }
+	t.Cleanup(func() { newLibvirtConnection = prevNewLibvirtConnection })
+
+	options := gomap.DefaultOptions
+	options.Codec = utils.ProtoCodec{}
+	store := gomap.NewStore(options)
+	opiSpdkServer := frontend.NewCustomizedServer(alwaysSuccessfulJSONRPC, store,
+		map[pb.NvmeTransportType]frontend.NvmeTransport{
+			pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP:  frontend.NewNvmeTCPTransport(alwaysSuccessfulJSONRPC),
+			pb.NvmeTransportType_NVME_TRANSPORT_TYPE_PCIE: NewNvmeVfiouserTransport(ctrlrDir, alwaysSuccessfulJSONRPC),
+		},
+		NewVirtioBlkVhostUserTransport(),
+	)
+	kvmServer := NewServerWithVM(opiSpdkServer, VMConfig{
+		ID:         DefaultVMID,
+		PortID:     0,
+		Hypervisor: HypervisorLibvirt,
+		APISocket:  "/var/run/libvirt/libvirt-sock",
+		Domain:     testLibvirtDomain,
+		CtrlrDir:   ctrlrDir,
+	})
+	kvmServer.timeout = qmplibTimeout
+	t.Cleanup(func() { _ = kvmServer.Close() })
+	return kvmServer
+}
+
+func TestLibvirtVirtioBlk(t *testing.T) {
+	conn := newFakeLibvirt()
+	kvmServer := newTestLibvirtKvmServer(t, conn, "/var/tmp")
+	qemuID := toQemuID(testVirtioBlkName)
+
+	if _, err := kvmServer.CreateVirtioBlk(context.Background(), utils.ProtoClone(testCreateVirtioBlkRequest)); err != nil {
+		t.Fatal("expected virtio-blk to be created, received", err)
+	}
+	if len(conn.attached) != 1 || !strings.Contains(conn.attached[0], `path="/var/tmp/`+testVirtioBlkID+`"`) {
+		t.Error("expected vhost-user disk to be attached, received", conn.attached)
+	}
+	if _, err := kvmServer.DeleteVirtioBlk(context.Background(), testDeleteVirtioBlkRequest); err != nil {
+		t.Fatal("expected virtio-blk to be deleted, received", err)
+	}
+	if want := []string{"ua-" + qemuID}; !reflect.DeepEqual(conn.detached, want) {
+		t.Error("expected detached", want, "received", conn.detached)
+	}
+}
+
+func TestLibvirtNvmeController(t *testing.T) {
+	conn := newFakeLibvirt()
+	ctrlrDir := t.TempDir()
+	kvmServer := newTestLibvirtKvmServer(t, conn, ctrlrDir)
+	kvmServer.Server.Nvme.Subsystems[testSubsystemName] = &testSubsystem
+	qemuID := toQemuID(testNvmeControllerName)
+
+	if _, err := kvmServer.CreateNvmeController(context.Background(),
+		utils.ProtoClone(testCreateNvmeControllerRequest)); err != nil {
+		t.Fatal("expected Nvme controller to be created, received", err)
+	}
+	if want := []string{qemuID}; !reflect.DeepEqual(conn.qmpDevices, want) {
+		t.Error("expected QMP devices", want, "received", conn.qmpDevices)
+	}
+	if len(conn.qmpCommands) != 1 || !strings.Contains(conn.qmpCommands[0], `"socket":"`+ctrlrDir+`/`) {
+		t.Error("expected vfio-user device to be added, received", conn.qmpCommands)
+	}
+	if _, err := kvmServer.DeleteNvmeController(context.Background(),
+		testDeleteNvmeControllerRequest); err != nil {
+		t.Fatal("expected Nvme controller to be deleted, received", err)
+	}
+	if len(conn.qmpDevices) != 0 {
+		t.Error("expected no QMP devices, received", conn.qmpDevices)
+	}
+	if len(conn.attached) != 0 || len(conn.detached) != 0 {
+		t.Error("expected no device XML changes, received", conn.attached, conn.detached)
+	}
+}
+
+func TestLibvirtNotSupportedDevices(t *testing.T) {
+	conn := newFakeLibvirt()
+	kvmServer := newTestLibvirtKvmServer(t, conn, "/var/tmp")
+
+	_, err := kvmServer.CreateVirtioScsiController(context.Background(),
+		utils.ProtoClone(testCreateVirtioScsiRequest))
+	if status.Code(err) != codes.Unimplemented {
+		t.Error("virtio-scsi: expected", codes.Unimplemented, "received", err)
+	}
+
+	if len(conn.attached) != 0 {
+		t.Error("expected no devices attached, received", conn.attached)
+	}
+}
@@ -7,52 +7,112 @@ package kvm
 import (
 	"fmt"
 	"log"
+	"sync"
 
 	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type deviceLocation struct {
-	Bus  *string
-	Addr *string
+	Bus           *string
+	Addr          *string
+	Multifunction *string
+	// address is set if location is calculated by the bridge
+	address *pciAddress
 }
 
+// pciAddress is a function in a slot of a named QEMU bus
+type pciAddress struct {
+	bus      string
+	slot     uint32
+	function uint32
+}
+
+func (a pciAddress) String() string {
+	return fmt.Sprintf("%v:%#x.%#x", a.bus, a.slot, a.function)
+}
+
+// occupiedAddresses returns QEMU device IDs by PCI addresses they use
+type occupiedAddresses func() (map[pciAddress]string, error)
+
 type deviceLocator interface {
 	Calculate(endpoint *pb.PciEndpoint) (deviceLocation, error)
+	// Reserve makes sure calculated location is not used by other devices
+	// and keeps it for device id until Release is called
+	Reserve(id string, location deviceLocation, occupied occupiedAddresses) (deviceLocation, error)
+	Release(id string)
 }
 
-func newDeviceLocator(buses []string) deviceLocator {
-	if len(buses) == 0 {
-		log.Println("Device location for virtio-blk and Nvme devices will be assigned by QEMU")
-		return defaultDeviceLocator{}
-	}
+func validateBuses(buses []string) error {
 	elementSet := make(map[string]struct{})
 	for _, bus := range buses {
 		if bus == "" {
-			log.Panicln("Empty bus name cannot be used in", buses)
+			return fmt.Errorf("empty bus name cannot be used in %v", buses)
 		}
 		if _, ok := elementSet[bus]; ok {
-			log.Panicln("Duplicated bus", bus)
+			return fmt.Errorf("duplicated bus %v", bus)
 		}
 		elementSet[bus] = struct{}{}
 	}
+	return nil
+}
+
+func validateBusesOrPanic(buses []string) {
+	if err := validateBuses(buses); err != nil {
+		log.Panicln(err)
+	}
+}
+
+func newDeviceLocator(buses []string) deviceLocator {
+	if len(buses) == 0 {
+		log.Println("Device location for virtio-blk and Nvme devices will be assigned by QEMU")
+		return defaultDeviceLocator{}
+	}
+	validateBusesOrPanic(buses)
 	log.Println("Device location will be calculated based on requested PcieEndpoint on", buses)
-	return busDeviceLocator{buses}
+	return &busDeviceLocator{
+		buses:    buses,
+		reserved: map[pciAddress]string{},
+	}
 }
 
 type defaultDeviceLocator struct{}
 
-func (defaultDeviceLocator) Calculate(_ *pb.PciEndpoint) (deviceLocation, error) {
+func (defaultDeviceLocator) Calculate(endpoint *pb.PciEndpoint) (deviceLocation, error) {
+	if vf := endpoint.GetVirtualFunction().GetValue(); vf != 0 {
+		return deviceLocation{}, fmt.Errorf("virtual function %v requires buses to calculate device location", vf)
+	}
 	return deviceLocation{
 		Bus:  nil,
 		Addr: nil,
 	}, nil
 }
 
+func (defaultDeviceLocator) Reserve(_ string, location deviceLocation, _ occupiedAddresses) (deviceLocation, error) {
+	return location, nil
+}
+
+func (defaultDeviceLocator) Release(_ string) {}
+
+// maxFunctionsInSlot is number of functions of multifunction PCI device
+const maxFunctionsInSlot = 8
+
+// busDeviceLocator places devices on buses at addresses derived from
+// requested PciEndpoint. Free slots are not allocated automatically: a
+// requested address used by another device fails the request.
 type busDeviceLocator struct {
 	buses []string
+
+	// mu makes check and reservation of an address atomic
+	mu sync.Mutex
+	// reserved maps addresses to IDs of devices they are reserved for
+	reserved map[pciAddress]string
 }
 
-func (l busDeviceLocator) Calculate(endpoint *pb.PciEndpoint) (deviceLocation, error) {
+// Calculate maps physical function to a slot and virtual function to a
+// function in the slot
+func (l *busDeviceLocator) Calculate(endpoint *pb.PciEndpoint) (deviceLocation, error) {
 	if endpoint == nil {
 		return deviceLocation{}, fmt.Errorf("pci endpoint is required to calculate device location")
 	}
@@ -60,15 +120,71 @@ func (l busDeviceLocator) Calculate(endpoint *pb.PciEndpoint) (deviceLocation, e
 	if err != nil {
 		return deviceLocation{}, err
 	}
+	function := endpoint.GetVirtualFunction().GetValue()
+	if function < 0 || function >= maxFunctionsInSlot {
+		return deviceLocation{}, fmt.Errorf("virtual function %v is out of [0, %v) range", function, maxFunctionsInSlot)
+	}
 
+	address := &pciAddress{bus: bus, slot: addr, function: uint32(function)}
 	addrInHex := fmt.Sprintf("%#x", addr)
+	if function != 0 {
+		addrInHex = fmt.Sprintf("%#x.%#x", addr, function)
+	}
 	return deviceLocation{
-		Bus:  &bus,
-		Addr: &addrInHex,
+		Bus:     &bus,
+		Addr:    &addrInHex,
+		address: address,
 	}, nil
 }
 
-func (l busDeviceLocator) calculateBusAddr(physicalFunction int32) (bus string, addr uint32, err error) {
+// Reserve fails with FailedPrecondition if the address is reserved for or
+// used in QEMU by another device. Function 0 is plugged as multifunction if
+// other functions of the slot are in use, since QEMU expects function 0 to be
+// plugged last.
+func (l *busDeviceLocator) Reserve(id string, location deviceLocation, occupied occupiedAddresses) (deviceLocation, error) {
+	if location.address == nil {
+		return location, nil
+	}
+	address := *location.address
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	used, err := occupied()
+	if err != nil {
+		return deviceLocation{}, err
+	}
+	for addr, owner := range l.reserved {
+		used[addr] = owner
+	}
+	if owner, ok := used[address]; ok && owner != id {
+		msg := fmt.Sprintf("PCI address %v is already used by %v", address, owner)
+		return deviceLocation{}, status.Errorf(codes.FailedPrecondition, msg)
+	}
+
+	multifunction := address.function != 0
+	for function := uint32(1); function < maxFunctionsInSlot && !multifunction; function++ {
+		_, multifunction = used[pciAddress{bus: address.bus, slot: address.slot, function: function}]
+	}
+	if multifunction {
+		on := "on"
+		location.Multifunction = &on
+	}
+
+	l.reserved[address] = id
+	return location, nil
+}
+
+func (l *busDeviceLocator) Release(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for addr, owner := range l.reserved {
+		if owner == id {
+			delete(l.reserved, addr)
+		}
+	}
+}
+
+func (l *busDeviceLocator) calculateBusAddr(physicalFunction int32) (bus string, addr uint32, err error) {
 	if physicalFunction < 0 {
 		err = fmt.Errorf("physical function cannot be negative")
 		return
@@ -5,8 +5,14 @@
 package kvm
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestNewDeviceLocator(t *testing.T) {
@@ -23,8 +29,9 @@ func TestNewDeviceLocator(t *testing.T) {
 		"bus device locator on provided buses": {
 			buses:     []string{"bus.opi.0", "bus.opi.1"},
 			wantPanic: false,
-			expectLocator: busDeviceLocator{
-				buses: []string{"bus.opi.0", "bus.opi.1"},
+			expectLocator: &busDeviceLocator{
+				buses:    []string{"bus.opi.0", "bus.opi.1"},
+				reserved: map[pciAddress]string{},
 			},
 		},
 		"panic on empty bus": {
@@ -54,3 +61,184 @@ func TestNewDeviceLocator(t *testing.T) {
 		})
 	}
 }
+
+func TestBusDeviceLocatorCalculate(t *testing.T) {
+	tests := map[string]struct {
+		pf          int32
+		vf          int32
+		wantErr     bool
+		wantBus     string
+		wantAddr    string
+		wantAddress pciAddress
+	}{
+		"physical function on first bus": {
+			pf:          1,
+			vf:          0,
+			wantErr:     false,
+			wantBus:     "pci.opi.0",
+			wantAddr:    "0x1",
+			wantAddress: pciAddress{bus: "pci.opi.0", slot: 1, function: 0},
+		},
+		"physical function on second bus": {
+			pf:          33,
+			vf:          0,
+			wantErr:     false,
+			wantBus:     "pci.opi.1",
+			wantAddr:    "0x1",
+			wantAddress: pciAddress{bus: "pci.opi.1", slot: 1, function: 0},
+		},
+		"virtual function is mapped to function": {
+			pf:          2,
+			vf:          7,
+			wantErr:     false,
+			wantBus:     "pci.opi.0",
+			wantAddr:    "0x2.0x7",
+			wantAddress: pciAddress{bus: "pci.opi.0", slot: 2, function: 7},
+		},
+		"virtual function out of slot functions": {
+			pf:      2,
+			vf:      8,
+			wantErr: true,
+		},
+		"negative virtual function": {
+			pf:      2,
+			vf:      -1,
+			wantErr: true,
+		},
+		"physical function out of buses": {
+			pf:      64,
+			vf:      0,
+			wantErr: true,
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			locator := newDeviceLocator([]string{"pci.opi.0", "pci.opi.1"})
+
+			location, err := locator.Calculate(&pb.PciEndpoint{
+				PhysicalFunction: wrapperspb.Int32(tt.pf),
+				VirtualFunction:  wrapperspb.Int32(tt.vf),
+				PortId:           wrapperspb.Int32(0),
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatal("expected error", tt.wantErr, "received", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *location.Bus != tt.wantBus || *location.Addr != tt.wantAddr {
+				t.Error("expected", tt.wantBus, tt.wantAddr, "received", *location.Bus, *location.Addr)
+			}
+			if *location.address != tt.wantAddress {
+				t.Error("expected address", tt.wantAddress, "received", *location.address)
+			}
+		})
+	}
+}
+
+func TestDefaultDeviceLocatorVirtualFunction(t *testing.T) {
+	locator := newDeviceLocator(nil)
+	_, err := locator.Calculate(&pb.PciEndpoint{
+		PhysicalFunction: wrapperspb.Int32(1),
+		VirtualFunction:  wrapperspb.Int32(1),
+		PortId:           wrapperspb.Int32(0),
+	})
+	if err == nil {
+		t.Error("expected error for virtual function without buses")
+	}
+}
+
+func TestBusDeviceLocatorReserve(t *testing.T) {
+	testAddress := pciAddress{bus: "pci.opi.0", slot: 1, function: 0}
+	tests := map[string]struct {
+		address           pciAddress
+		occupied          map[pciAddress]string
+		occupiedErr       error
+		reserved          map[pciAddress]string
+		errCode           codes.Code
+		wantMultifunction bool
+	}{
+		"free address": {
+			address:  testAddress,
+			occupied: map[pciAddress]string{},
+			reserved: map[pciAddress]string{},
+			errCode:  codes.OK,
+		},
+		"address used in QEMU by another device": {
+			address:  testAddress,
+			occupied: map[pciAddress]string{testAddress: "opi-other"},
+			reserved: map[pciAddress]string{},
+			errCode:  codes.FailedPrecondition,
+		},
+		"address used in QEMU by the same device": {
+			address:  testAddress,
+			occupied: map[pciAddress]string{testAddress: "opi-dev"},
+			reserved: map[pciAddress]string{},
+			errCode:  codes.OK,
+		},
+		"address reserved for another device": {
+			address:  testAddress,
+			occupied: map[pciAddress]string{},
+			reserved: map[pciAddress]string{testAddress: "opi-other"},
+			errCode:  codes.FailedPrecondition,
+		},
+		"non-zero function is multifunction": {
+			address:           pciAddress{bus: "pci.opi.0", slot: 1, function: 3},
+			occupied:          map[pciAddress]string{},
+			reserved:          map[pciAddress]string{},
+			errCode:           codes.OK,
+			wantMultifunction: true,
+		},
+		"function 0 with other functions in use is multifunction": {
+			address:           testAddress,
+			occupied:          map[pciAddress]string{{bus: "pci.opi.0", slot: 1, function: 1}: "opi-other"},
+			reserved:          map[pciAddress]string{},
+			errCode:           codes.OK,
+			wantMultifunction: true,
+		},
+		"function 0 with other slots in use is not multifunction": {
+			address:           testAddress,
+			occupied:          map[pciAddress]string{{bus: "pci.opi.0", slot: 2, function: 1}: "opi-other"},
+			reserved:          map[pciAddress]string{},
+			errCode:           codes.OK,
+			wantMultifunction: false,
+		},
+		"failed to query occupied addresses": {
+			address:     testAddress,
+			occupiedErr: errors.New("some error"),
+			reserved:    map[pciAddress]string{},
+			errCode:     codes.Unknown,
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			locator := &busDeviceLocator{buses: []string{"pci.opi.0"}, reserved: tt.reserved}
+			address := tt.address
+			location := deviceLocation{address: &address}
+
+			location, err := locator.Reserve("opi-dev", location, func() (map[pciAddress]string, error) {
+				return tt.occupied, tt.occupiedErr
+			})
+
+			if status.Code(err) != tt.errCode {
+				t.Fatal("error code: expected", tt.errCode, "received", err)
+			}
+			if err != nil {
+				return
+			}
+			if (location.Multifunction != nil) != tt.wantMultifunction {
+				t.Error("expected multifunction", tt.wantMultifunction, "received", location.Multifunction)
+			}
+			if owner := locator.reserved[tt.address]; owner != "opi-dev" {
+				t.Error("expected address to be reserved, reserved by", owner)
+			}
+			locator.Release("opi-dev")
+			if _, ok := locator.reserved[tt.address]; ok {
+				t.Error("expected address to be released")
+			}
+		})
+	}
+}
@@ -7,30 +7,80 @@ package kvm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/digitalocean/go-qemu/qmp"
 	qmpraw "github.com/digitalocean/go-qemu/qmp/raw"
 )
 
-// TODO: check for device existence to provide idempotence in all methods
+var errMonitorClosed = errors.New("QMP monitor is closed")
 
-type monitor struct {
+// qmpConnection is a single established QMP session
+type qmpConnection struct {
 	rmon *qmpraw.Monitor
 	mon  qmp.Monitor
+}
+
+// monitor keeps a long-lived QMP connection to QEMU instance. The connection
+// is established on first use and re-established automatically when lost.
+// Operations are serialized, since QEMU handles them one by one anyway.
+type monitor struct {
+	qmpAddress string
+	protocol   string
 
 	waitEventTimeout          time.Duration
 	pollDevicePresenceTimeout time.Duration
 	pollDevicePresenceStep    time.Duration
+	reconnectDelay            time.Duration
+
+	// opMu serializes operations sent over QMP
+	opMu sync.Mutex
+
+	mu           sync.Mutex
+	conn         *qmpConnection
+	closed       bool
+	reconnecting bool
+	waiters      map[*eventWaiter]struct{}
+	subscribers  map[chan VMEvent]struct{}
 }
 
 func newMonitor(qmpAddress string, protocol string,
-	timeout time.Duration, pollDevicePresenceStep time.Duration) (*monitor, error) {
-	mon, err := qmp.NewSocketMonitor(protocol, qmpAddress, timeout)
+	timeout time.Duration, pollDevicePresenceStep time.Duration) *monitor {
+	return &monitor{
+		qmpAddress:                qmpAddress,
+		protocol:                  protocol,
+		waitEventTimeout:          timeout,
+		pollDevicePresenceTimeout: timeout,
+		pollDevicePresenceStep:    pollDevicePresenceStep,
+		reconnectDelay:            timeout,
+		waiters:                   map[*eventWaiter]struct{}{},
+		subscribers:               map[chan VMEvent]struct{}{},
+	}
+}
+
+// Connect establishes QMP connection if there is none
+func (m *monitor) Connect() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.connectLocked()
+	return err
+}
+
+func (m *monitor) connectLocked() (*qmpConnection, error) {
+	if m.closed {
+		return nil, errMonitorClosed
+	}
+	if m.conn != nil {
+		return m.conn, nil
+	}
+
+	mon, err := qmp.NewSocketMonitor(m.protocol, m.qmpAddress, m.waitEventTimeout)
 	if err != nil {
 		log.Printf("couldn't create QEMU monitor: %v", err)
 		return nil, err
@@ -38,96 +88,347 @@ func newMonitor(qmpAddress string, protocol string,
 
 	if err := mon.Connect(); err != nil {
 		log.Printf("Failed to connect to QEMU: %v", err)
+		_ = mon.Disconnect()
 		return nil, err
 	}
 
-	rawMon := qmpraw.NewMonitor(mon)
-	return &monitor{
-		rmon:                      rawMon,
-		mon:                       mon,
-		waitEventTimeout:          timeout,
-		pollDevicePresenceTimeout: timeout,
-		pollDevicePresenceStep:    pollDevicePresenceStep}, nil
+	// events have to be consumed all the time, otherwise QMP library blocks
+	// delivery of command responses
+	events, err := mon.Events(context.Background())
+	if err != nil {
+		log.Printf("Failed to get QEMU event stream: %v", err)
+		_ = mon.Disconnect()
+		return nil, err
+	}
+
+	m.conn = &qmpConnection{rmon: qmpraw.NewMonitor(mon), mon: mon}
+	go m.dispatchEvents(m.conn, events)
+	return m.conn, nil
+}
+
+func (m *monitor) connection() (*qmpConnection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.connectLocked()
 }
 
-func (m *monitor) Disconnect() {
-	err := m.mon.Disconnect()
+// Disconnect closes QMP connection and stops reconnection attempts
+func (m *monitor) Disconnect() error {
+	m.mu.Lock()
+	m.closed = true
+	conn := m.conn
+	m.conn = nil
+	m.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	err := conn.mon.Disconnect()
 	if err != nil {
-		log.Fatalf("Failed to disconnect QMP monitor %v", err)
+		log.Printf("Failed to disconnect QMP monitor %v", err)
+	}
+	return err
+}
+
+// keepConnected makes sure the connection is established now or restored
+// in background
+func (m *monitor) keepConnected() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.connectLocked(); err == nil || m.closed || m.reconnecting {
+		return
+	}
+	m.reconnecting = true
+	go m.reconnect()
+}
+
+// connectionLost forgets broken connection and keeps trying to reconnect in
+// background to not miss VM lifecycle events
+func (m *monitor) connectionLost(conn *qmpConnection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn != conn {
+		return
+	}
+	log.Printf("QMP connection to %v is lost", m.qmpAddress)
+	m.conn = nil
+	for waiter := range m.waiters {
+		waiter.complete(errors.New("QMP connection is lost"))
+	}
+	// commands reconnect on demand, so only event subscribers need the
+	// connection to be restored in background
+	if m.closed || m.reconnecting || len(m.subscribers) == 0 {
+		return
+	}
+	m.reconnecting = true
+	go m.reconnect()
+}
+
+func (m *monitor) reconnect() {
+	for {
+		time.Sleep(m.reconnectDelay)
+		m.mu.Lock()
+		_, err := m.connectLocked()
+		if err == nil || m.closed || len(m.subscribers) == 0 {
+			m.reconnecting = false
+			m.mu.Unlock()
+			if err == nil {
+				log.Printf("QMP connection to %v is restored", m.qmpAddress)
+			}
+			return
+		}
+		m.mu.Unlock()
 	}
 }
 
 func (m *monitor) AddChardev(id string, sockPath string) error {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	conn, err := m.connection()
+	if err != nil {
+		return err
+	}
+
 	server := false
 	socketBackend := qmpraw.ChardevBackendSocket{
 		Addr: qmpraw.SocketAddressLegacyUnix{
 			Path: sockPath},
 		Server: &server}
-	_, err := m.rmon.ChardevAdd(id, socketBackend)
+	_, err = conn.rmon.ChardevAdd(id, socketBackend)
+	if err != nil && m.chardevExist(conn, id) {
+		log.Printf("Chardev %v already exists", id)
+		return nil
+	}
 	return err
 }
 
 func (m *monitor) DeleteChardev(id string) error {
-	return m.rmon.ChardevRemove(id)
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	conn, err := m.connection()
+	if err != nil {
+		return err
+	}
+	err = conn.rmon.ChardevRemove(id)
+	if err != nil && !m.chardevExist(conn, id) {
+		log.Printf("Chardev %v is already removed", id)
+		return nil
+	}
+	return err
 }
 
 func (m *monitor) AddVirtioBlkDevice(id string, chardevID string, location deviceLocation) error {
+	return m.addVhostUserDevice("vhost-user-blk-pci", id, chardevID, location)
+}
+
+func (m *monitor) AddVirtioScsiDevice(id string, chardevID string, location deviceLocation) error {
+	return m.addVhostUserDevice("vhost-user-scsi-pci", id, chardevID, location)
+}
+
+func (m *monitor) addVhostUserDevice(driver string, id string, chardevID string, location deviceLocation) error {
 	qmpCmd := struct {
-		Driver  string  `json:"driver"`
-		ID      *string `json:"id,omitempty"`
-		Bus     *string `json:"bus,omitempty"`
-		Addr    *string `json:"addr,omitempty"`
-		Chardev *string `json:"chardev,omitempty"`
+		Driver        string  `json:"driver"`
+		ID            *string `json:"id,omitempty"`
+		Bus           *string `json:"bus,omitempty"`
+		Addr          *string `json:"addr,omitempty"`
+		Multifunction *string `json:"multifunction,omitempty"`
+		Chardev       *string `json:"chardev,omitempty"`
 	}{
-		Driver:  "vhost-user-blk-pci",
-		ID:      &id,
-		Bus:     location.Bus,
-		Addr:    location.Addr,
-		Chardev: &chardevID,
-	}
-	if err := m.addDevice(qmpCmd); err != nil {
-		return err
+		Driver:        driver,
+		ID:            &id,
+		Bus:           location.Bus,
+		Addr:          location.Addr,
+		Multifunction: location.Multifunction,
+		Chardev:       &chardevID,
 	}
-	return m.waitForDeviceExist(id)
+	return m.addDevice(id, qmpCmd)
 }
 
 func (m *monitor) AddNvmeControllerDevice(id string, ctrlrDir string, location deviceLocation) error {
-	socket := filepath.Join(ctrlrDir, "cntrl")
-	qmpCmd := struct {
-		Driver string  `json:"driver"`
-		ID     *string `json:"id,omitempty"`
-		Bus    *string `json:"bus,omitempty"`
-		Addr   *string `json:"addr,omitempty"`
-		Socket *string `json:"socket,omitempty"`
-	}{
-		Driver: "vfio-user-pci",
-		ID:     &id,
-		Bus:    location.Bus,
-		Addr:   location.Addr,
-		Socket: &socket,
-	}
-	if err := m.addDevice(qmpCmd); err != nil {
-		return err
+	return m.AddVfiouserDevice(id, filepath.Join(ctrlrDir, "cntrl"), location)
+}
+
+func (m *monitor) AddVfiouserDevice(id string, socket string, location deviceLocation) error {
+	return m.addDevice(id, newVfiouserDeviceArgs(id, socket, location))
+}
+
+// vfiouserDeviceArgs are device_add arguments of a vfio-user device
+type vfiouserDeviceArgs struct {
+	Driver        string  `json:"driver"`
+	ID            *string `json:"id,omitempty"`
+	Bus           *string `json:"bus,omitempty"`
+	Addr          *string `json:"addr,omitempty"`
+	Multifunction *string `json:"multifunction,omitempty"`
+	Socket        *string `json:"socket,omitempty"`
+}
+
+func newVfiouserDeviceArgs(id string, socket string, location deviceLocation) vfiouserDeviceArgs {
+	return vfiouserDeviceArgs{
+		Driver:        "vfio-user-pci",
+		ID:            &id,
+		Bus:           location.Bus,
+		Addr:          location.Addr,
+		Multifunction: location.Multifunction,
+		Socket:        &socket,
 	}
-	return m.waitForDeviceExist(id)
 }
 
 func (m *monitor) DeleteVirtioBlkDevice(id string) error {
-	err := m.rmon.DeviceDel(id)
+	return m.deleteVhostUserDevice(id)
+}
+
+func (m *monitor) DeleteVirtioScsiDevice(id string) error {
+	return m.deleteVhostUserDevice(id)
+}
+
+func (m *monitor) deleteVhostUserDevice(id string) error {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	conn, err := m.connection()
+	if err != nil {
+		return err
+	}
+
+	// register before the command is sent to not miss the event
+	waiter := m.expectEvent("DEVICE_DELETED", "device", id)
+	defer m.forgetWaiter(waiter)
+	err = conn.rmon.DeviceDel(id)
 	if err != nil {
+		if m.deviceAbsent(conn, id) {
+			return nil
+		}
 		return fmt.Errorf("couldn't delete device: %w", err)
 	}
-	return m.waitForEvent("DEVICE_DELETED", "device", id)
+	return waiter.wait(m.waitEventTimeout)
 }
 
 func (m *monitor) DeleteNvmeControllerDevice(id string) error {
-	if err := m.rmon.DeviceDel(id); err != nil {
+	return m.DeleteVfiouserDevice(id)
+}
+
+func (m *monitor) DeleteVfiouserDevice(id string) error {
+	return m.DeleteDevice(id)
+}
+
+// DeleteDevice deletes device of any type and waits until it disappears
+// from the PCI tree
+func (m *monitor) DeleteDevice(id string) error {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	conn, err := m.connection()
+	if err != nil {
 		return err
 	}
-	return m.waitForDeviceNotExist(id)
+
+	if err := conn.rmon.DeviceDel(id); err != nil {
+		if m.deviceAbsent(conn, id) {
+			return nil
+		}
+		return err
+	}
+	return m.waitForDeviceNotExist(conn, id)
+}
+
+// Ping sends query-status outside of operations, since hotplug can hold
+// them for a long time waiting for guest to release the device
+func (m *monitor) Ping() error {
+	conn, err := m.connection()
+	if err != nil {
+		return err
+	}
+	_, err = conn.rmon.QueryStatus()
+	return err
+}
+
+// QueryDeviceIDs returns IDs of all PCI devices of the QEMU instance
+func (m *monitor) QueryDeviceIDs() (map[string]struct{}, error) {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	conn, err := m.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	pci, err := conn.rmon.QueryPCI()
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]struct{}{}
+	for _, pciDev := range pci {
+		collectDeviceIDs(pciDev.Devices, ids)
+	}
+	return ids, nil
+}
+
+// QueryPciAddresses returns IDs of devices by addresses they use on named
+// buses, i.e. buses provided by bridges and ports with an ID
+func (m *monitor) QueryPciAddresses() (map[pciAddress]string, error) {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	conn, err := m.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	pci, err := conn.rmon.QueryPCI()
+	if err != nil {
+		return nil, err
+	}
+	addresses := map[pciAddress]string{}
+	for _, pciDev := range pci {
+		collectPciAddresses(pciDev.Devices, addresses)
+	}
+	return addresses, nil
+}
+
+// QueryChardevIDs returns IDs of all chardevs of the QEMU instance
+func (m *monitor) QueryChardevIDs() (map[string]struct{}, error) {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	conn, err := m.connection()
+	if err != nil {
+		return nil, err
+	}
+	return m.queryChardevIDs(conn)
+}
+
+func (m *monitor) queryChardevIDs(conn *qmpConnection) (map[string]struct{}, error) {
+	chardevs, err := conn.rmon.QueryChardev()
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]struct{}{}
+	for _, chardev := range chardevs {
+		ids[chardev.Label] = struct{}{}
+	}
+	return ids, nil
+}
+
+// chardevExist reports false if the chardev presence cannot be checked
+func (m *monitor) chardevExist(conn *qmpConnection, id string) bool {
+	ids, err := m.queryChardevIDs(conn)
+	if err != nil {
+		log.Println("failed to check chardev existence:", err)
+		return false
+	}
+	_, ok := ids[id]
+	return ok
 }
 
-func (m *monitor) addDevice(qmpCmd interface{}) error {
+// deviceAbsent reports false if the device presence cannot be checked
+func (m *monitor) deviceAbsent(conn *qmpConnection, id string) bool {
+	exist, err := m.pciDeviceExist(conn, id)
+	if err != nil {
+		log.Println("failed to check pci device existence:", err)
+		return false
+	}
+	if !exist {
+		log.Printf("Device %v is already deleted", id)
+	}
+	return !exist
+}
+
+func (m *monitor) addDevice(id string, qmpCmd interface{}) error {
 	bs, err := json.Marshal(map[string]interface{}{
 		"execute":   "device_add",
 		"arguments": qmpCmd,
@@ -137,10 +438,21 @@ func (m *monitor) addDevice(qmpCmd interface{}) error {
 		return fmt.Errorf("couldn't create QMP command: %w", err)
 	}
 
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	conn, err := m.connection()
+	if err != nil {
+		return err
+	}
+
 	log.Println("QMP command to send: ", string(bs))
-	raw, err := m.mon.Run(bs)
+	raw, err := conn.mon.Run(bs)
 	if err != nil {
 		log.Println("QMP error:", err)
+		if exist, existErr := m.pciDeviceExist(conn, id); existErr == nil && exist {
+			log.Printf("Device %v already exists", id)
+			return nil
+		}
 		return fmt.Errorf("couldn't run QMP command: %w", err)
 	}
 
@@ -150,52 +462,18 @@ func (m *monitor) addDevice(qmpCmd interface{}) error {
 		return fmt.Errorf("qemu cmd run error: %v", string(bs))
 	}
 
-	return nil
-}
-
-func (m *monitor) waitForEvent(event string, key string, value string) error {
-	stream, err := m.mon.Events(context.Background())
-	if err != nil {
-		return fmt.Errorf("couldn't get event channel: %v", err)
-	}
-
-	timeoutTimer := time.NewTimer(m.waitEventTimeout)
-	for {
-		select {
-		case e := <-stream:
-			log.Println("qemu event:", e)
-			if e.Event != event {
-				continue
-			}
-			v, ok := e.Data[key]
-			if !ok {
-				continue
-			}
-			val, ok := v.(string)
-			if !ok {
-				continue
-			}
-			if val != value {
-				continue
-			}
-			log.Println("Event:", event, "found")
-			return nil
-		case <-timeoutTimer.C:
-			log.Println("Event timeout:", event, ", key:", key, "value:", value)
-			return fmt.Errorf("qemu event not found: %v", event)
-		}
-	}
+	return m.waitForDeviceExist(conn, id)
 }
 
-func (m *monitor) waitForDeviceExist(id string) error {
-	return m.waitForDevicePresence(id, true)
+func (m *monitor) waitForDeviceExist(conn *qmpConnection, id string) error {
+	return m.waitForDevicePresence(conn, id, true)
 }
 
-func (m *monitor) waitForDeviceNotExist(id string) error {
-	return m.waitForDevicePresence(id, false)
+func (m *monitor) waitForDeviceNotExist(conn *qmpConnection, id string) error {
+	return m.waitForDevicePresence(conn, id, false)
 }
 
-func (m *monitor) waitForDevicePresence(id string, shouldExist bool) error {
+func (m *monitor) waitForDevicePresence(conn *qmpConnection, id string, shouldExist bool) error {
 	timeoutTimer := time.NewTimer(m.pollDevicePresenceTimeout)
 	devicePresenceTicker := time.NewTicker(m.pollDevicePresenceStep)
 	defer devicePresenceTicker.Stop()
@@ -204,7 +482,7 @@ func (m *monitor) waitForDevicePresence(id string, shouldExist bool) error {
 		case <-timeoutTimer.C:
 			return fmt.Errorf("timeout waiting for PCI device %v presence %v", id, shouldExist)
 		case <-devicePresenceTicker.C:
-			exist, err := m.pciDeviceExist(id)
+			exist, err := m.pciDeviceExist(conn, id)
 			if err != nil {
 				log.Println("failed to check pci device existence:", err)
 				continue
@@ -217,8 +495,8 @@ func (m *monitor) waitForDevicePresence(id string, shouldExist bool) error {
 	}
 }
 
-func (m *monitor) pciDeviceExist(id string) (bool, error) {
-	pci, err := m.rmon.QueryPCI()
+func (m *monitor) pciDeviceExist(conn *qmpConnection, id string) (bool, error) {
+	pci, err := conn.rmon.QueryPCI()
 	if err != nil {
 		return false, err
 	}
@@ -231,6 +509,35 @@ func (m *monitor) pciDeviceExist(id string) (bool, error) {
 	return false, nil
 }
 
+func collectDeviceIDs(devs []qmpraw.PCIDeviceInfo, ids map[string]struct{}) {
+	for _, dev := range devs {
+		if dev.QdevID != "" {
+			ids[dev.QdevID] = struct{}{}
+		}
+		if dev.PCIBridge != nil {
+			collectDeviceIDs(dev.PCIBridge.Devices, ids)
+		}
+	}
+}
+
+func collectPciAddresses(devs []qmpraw.PCIDeviceInfo, addresses map[pciAddress]string) {
+	for _, dev := range devs {
+		if dev.PCIBridge == nil {
+			continue
+		}
+		if dev.QdevID != "" {
+			for _, child := range dev.PCIBridge.Devices {
+				addresses[pciAddress{
+					bus:      dev.QdevID,
+					slot:     uint32(child.Slot),
+					function: uint32(child.Function),
+				}] = child.QdevID
+			}
+		}
+		collectPciAddresses(dev.PCIBridge.Devices, addresses)
+	}
+}
+
 func (m *monitor) findDeviceWithID(devs []qmpraw.PCIDeviceInfo, id string) bool {
 	for _, dev := range devs {
 		if dev.QdevID == id {
@@ -31,7 +31,11 @@ func (s *Server) CreateNvmeController(ctx context.Context, in *pb.CreateNvmeCont
 		log.Println("Pci endpoint should be specified")
 		return nil, errNoPcieEndpoint
 	}
-	location, err := s.locator.Calculate(in.GetNvmeController().GetSpec().GetPcieId())
+	v, err := s.vmForEndpoint(in.GetNvmeController().GetSpec().GetPcieId())
+	if err != nil {
+		return nil, err
+	}
+	location, err := v.locator.Calculate(in.GetNvmeController().GetSpec().GetPcieId())
 	if err != nil {
 		log.Println("Failed to calculate device location: ", err)
 		return nil, errDeviceEndpoint
@@ -45,37 +49,62 @@ func (s *Server) CreateNvmeController(ctx context.Context, in *pb.CreateNvmeCont
 		return nil, errInvalidSubsystem
 	}
 
+	op := s.journal.begin(&journalEntry{
+		Operation: operationCreate,
+		Object:    objectNvmeController,
+		VMID:      v.config.ID,
+		DirName:   dirName,
+	})
 	err = createControllerDir(s.ctrlrDir, dirName)
 	if err != nil {
 		log.Print(err)
+		s.journal.finish(op)
 		return nil, errFailedToCreateNvmeDir
 	}
+	s.journal.stepDone(op, stepControllerDir)
 
 	out, err := s.Server.CreateNvmeController(ctx, in)
 	if err != nil {
 		log.Println("Error running cmd on opi-spdk bridge:", err)
-		_ = deleteControllerDir(s.ctrlrDir, dirName)
+		s.rollback(op, nil)
 		return out, err
 	}
 	name := out.Name
+	s.journal.created(op, name, out, s.Nvme.Subsystems[in.Parent])
 
-	mon, monErr := newMonitor(s.qmpAddress, s.protocol, s.timeout, s.pollDevicePresenceStep)
+	mon, monErr := v.connectMonitor()
 	if monErr != nil {
 		log.Println("Couldn't create QEMU monitor")
-		_, _ = s.Server.DeleteNvmeController(context.Background(), &pb.DeleteNvmeControllerRequest{Name: name})
-		_ = deleteControllerDir(s.ctrlrDir, dirName)
+		s.rollback(op, nil)
 		return nil, errMonitorCreation
 	}
-	defer mon.Disconnect()
 
+	if err := s.plugNvmeController(mon, v, name, dirName, location, op); err != nil {
+		s.rollback(op, mon)
+		return nil, err
+	}
+	s.journal.finish(op)
+	return out, nil
+}
+
+// plugNvmeController reserves location and adds QEMU device of Nvme
+// controller created in SPDK. The added device is recorded in op, so that
+// it is removed if the operation is rolled back.
+func (s *Server) plugNvmeController(mon hypervisor, v *vm, name string, dirName string,
+	location deviceLocation, op *journalEntry) error {
 	qemuDeviceID := toQemuID(name)
-	if err := mon.AddNvmeControllerDevice(qemuDeviceID, controllerDirPath(s.ctrlrDir, dirName), location); err != nil {
+	location, err := v.reserveLocation(mon, qemuDeviceID, location)
+	if err != nil {
+		return err
+	}
+
+	if err := mon.AddNvmeControllerDevice(qemuDeviceID, controllerDirPath(v.config.CtrlrDir, dirName), location); err != nil {
 		log.Println("Couldn't add Nvme controller:", err)
-		_, _ = s.Server.DeleteNvmeController(context.Background(), &pb.DeleteNvmeControllerRequest{Name: name})
-		_ = deleteControllerDir(s.ctrlrDir, dirName)
-		return nil, errAddDeviceFailed
+		v.locator.Release(qemuDeviceID)
+		return errAddDeviceFailed
 	}
-	return out, nil
+	s.journal.stepDone(op, stepDevice)
+	return nil
 }
 
 // DeleteNvmeController deletes an Nvme controller device and detaches it from QEMU instance
@@ -84,13 +113,16 @@ func (s *Server) DeleteNvmeController(ctx context.Context, in *pb.DeleteNvmeCont
 	if !ok || controller.GetSpec().GetTrtype() != pb.NvmeTransportType_NVME_TRANSPORT_TYPE_PCIE {
 		return s.Server.DeleteNvmeController(ctx, in)
 	}
+	v, vmErr := s.vmForEndpoint(controller.GetSpec().GetPcieId())
+	if vmErr != nil {
+		return nil, vmErr
+	}
 
-	mon, monErr := newMonitor(s.qmpAddress, s.protocol, s.timeout, s.pollDevicePresenceStep)
+	mon, monErr := v.connectMonitor()
 	if monErr != nil {
 		log.Println("Couldn't create QEMU monitor")
 		return nil, errMonitorCreation
 	}
-	defer mon.Disconnect()
 
 	dirName, findDirNameErr := s.findDirName(in.Name)
 	if findDirNameErr != nil {
@@ -98,29 +130,10 @@ func (s *Server) DeleteNvmeController(ctx context.Context, in *pb.DeleteNvmeCont
 		return nil, findDirNameErr
 	}
 
-	qemuDeviceID := toQemuID(in.Name)
-	delNvmeErr := mon.DeleteNvmeControllerDevice(qemuDeviceID)
-	if delNvmeErr != nil {
-		log.Printf("Couldn't delete Nvme controller: %v", delNvmeErr)
-	}
-
-	response, spdkErr := s.Server.DeleteNvmeController(ctx, in)
-	if spdkErr != nil {
-		log.Println("Error running underlying cmd on opi-spdk bridge:", spdkErr)
-	}
-
-	delDirErr := deleteControllerDir(s.ctrlrDir, dirName)
-	if delDirErr != nil {
-		log.Println("Failed to delete Nvme controller directory:", delDirErr)
-	}
-
-	var err error
-	if delNvmeErr != nil && spdkErr != nil && delDirErr != nil {
-		err = errDeviceNotDeleted
-	} else if delNvmeErr != nil || spdkErr != nil || delDirErr != nil {
-		err = errDevicePartiallyDeleted
-	}
-	return response, err
+	op := s.beginDelete(objectNvmeController, in.Name, v, controller)
+	op.DirName = dirName
+	op.Parent = marshalJournalResource(s.Nvme.Subsystems[utils.ResourceIDToSubsystemName(dirName)])
+	return s.runDelete(ctx, op, mon)
 }
 
 func (s *Server) findDirName(name string) (string, error) {
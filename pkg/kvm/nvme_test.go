@@ -112,7 +112,8 @@ func TestCreateNvmeController(t *testing.T) {
 			errCode:                       status.Convert(errAddDeviceFailed).Code(),
 			errMsg:                        status.Convert(errAddDeviceFailed).Message(),
 			mockQmpCalls: newMockQmpCalls().
-				ExpectAddNvmeController(testNvmeControllerID, testSubsystemID).WithErrorResponse(),
+				ExpectAddNvmeController(testNvmeControllerID, testSubsystemID).WithErrorResponse().
+				ExpectNoDeviceQueryPci(),
 		},
 		"failed to create monitor": {
 			in:                            testCreateNvmeControllerRequest,
@@ -193,6 +194,7 @@ func TestCreateNvmeController(t *testing.T) {
 			jsonRPC:                       alwaysSuccessfulJSONRPC,
 			buses:                         []string{"pci.opi.0", "pci.opi.1"},
 			mockQmpCalls: newMockQmpCalls().
+				ExpectNoDeviceQueryPci().
 				ExpectAddNvmeControllerWithAddress(testNvmeControllerID, testSubsystemID, "pci.opi.0", 1).
 				ExpectQueryPci(testNvmeControllerID),
 		},
@@ -204,6 +206,7 @@ func TestCreateNvmeController(t *testing.T) {
 			jsonRPC:                       alwaysSuccessfulJSONRPC,
 			buses:                         []string{"pci.opi.0", "pci.opi.1"},
 			mockQmpCalls: newMockQmpCalls().
+				ExpectNoDeviceQueryPci().
 				ExpectAddNvmeControllerWithAddress(testNvmeControllerID, testSubsystemID, "pci.opi.1", 11).
 				ExpectQueryPci(testNvmeControllerID),
 		},
@@ -347,7 +350,8 @@ func TestDeleteNvmeController(t *testing.T) {
 			errCode:                       status.Convert(errDevicePartiallyDeleted).Code(),
 			errMsg:                        status.Convert(errDevicePartiallyDeleted).Message(),
 			mockQmpCalls: newMockQmpCalls().
-				ExpectDeleteNvmeController(testNvmeControllerID).WithErrorResponse(),
+				ExpectDeleteNvmeController(testNvmeControllerID).WithErrorResponse().
+				ExpectQueryPci(testNvmeControllerID),
 		},
 		"spdk failed to delete Nvme controller": {
 			jsonRPC:                       alwaysFailingJSONRPC,
@@ -399,7 +403,8 @@ func TestDeleteNvmeController(t *testing.T) {
 			errCode:                       status.Convert(errDeviceNotDeleted).Code(),
 			errMsg:                        status.Convert(errDeviceNotDeleted).Message(),
 			mockQmpCalls: newMockQmpCalls().
-				ExpectDeleteNvmeController(testNvmeControllerID).WithErrorResponse(),
+				ExpectDeleteNvmeController(testNvmeControllerID).WithErrorResponse().
+				ExpectQueryPci(testNvmeControllerID),
 		},
 		"no controller found": {
 			jsonRPC:                       alwaysFailingJSONRPC,
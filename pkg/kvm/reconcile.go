@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errReconcileFailed = status.Error(codes.Internal, "failed to reconcile QEMU devices with bridge objects")
+
+// qemuDevice is a QEMU device expected for a bridge object
+type qemuDevice struct {
+	// withChardev is set for vhost-user devices
+	withChardev bool
+	endpoint    *pb.PciEndpoint
+	// plug reserves location and adds the device
+	plug func(mon hypervisor, location deviceLocation) error
+}
+
+// StrayDevice is opi-* device or chardev found in a VM without bridge object
+type StrayDevice struct {
+	VMID    string `json:"vmId"`
+	ID      string `json:"id"`
+	Chardev bool   `json:"chardev,omitempty"`
+}
+
+// ReconcileRequest selects how stray devices are handled
+type ReconcileRequest struct {
+	// RemoveStrayDevices removes stray devices from VMs instead of only
+	// reporting them. Bridge objects are kept in memory, so after restart
+	// every device is stray until its object is created again.
+	RemoveStrayDevices bool `json:"removeStrayDevices"`
+}
+
+// ReconcileResponse reports stray devices found in VMs
+type ReconcileResponse struct {
+	StrayDevices []StrayDevice `json:"strayDevices"`
+}
+
+// Reconcile brings devices of all registered VMs in line with bridge
+// objects: locations of plugged devices are reserved, missing devices are
+// plugged again and stray opi-* devices and
+// chardevs without bridge objects are reported, or removed if requested.
+// It is called on startup and can be called any time later.
+func (s *Server) Reconcile(_ context.Context, in *ReconcileRequest) (*ReconcileResponse, error) {
+	var err error
+	response := &ReconcileResponse{StrayDevices: []StrayDevice{}}
+	for _, config := range s.ListVMs() {
+		v, vmErr := s.vmByID(config.ID)
+		if vmErr != nil {
+			continue
+		}
+		stray, vmErr := s.reconcileVM(v, in.RemoveStrayDevices)
+		response.StrayDevices = append(response.StrayDevices, stray...)
+		if vmErr != nil {
+			log.Printf("Failed to reconcile VM %v: %v", config.ID, vmErr)
+			err = errReconcileFailed
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (s *Server) reconcileVM(v *vm, removeStray bool) ([]StrayDevice, error) {
+	mon, err := v.connectMonitor()
+	if err != nil {
+		log.Println("Couldn't create QEMU monitor")
+		return nil, errMonitorCreation
+	}
+	devices, err := mon.QueryDeviceIDs()
+	if err != nil {
+		return nil, err
+	}
+	chardevs, err := mon.QueryChardevIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var result error
+	expected := s.expectedQemuDevices(v)
+	for id, device := range expected {
+		location, err := v.locator.Calculate(device.endpoint)
+		if err != nil {
+			log.Printf("Couldn't calculate location of device %v: %v", id, err)
+			result = errDeviceEndpoint
+			continue
+		}
+		if _, ok := devices[id]; ok {
+			// keep location of plugged device reserved after restart
+			if _, err := v.reserveLocation(mon, id, location); err != nil {
+				result = err
+			}
+			continue
+		}
+		log.Printf("Device %v is missing in VM %v, plugging it", id, v.config.ID)
+		if err := device.plug(mon, location); err != nil {
+			log.Printf("Couldn't plug device %v: %v", id, err)
+			result = err
+		}
+	}
+
+	stray := []StrayDevice{}
+	for id := range devices {
+		if _, ok := expected[id]; ok || !strings.HasPrefix(id, qemuIDPrefix) {
+			continue
+		}
+		stray = append(stray, StrayDevice{VMID: v.config.ID, ID: id})
+		if !removeStray {
+			log.Printf("Device %v has no bridge object in VM %v", id, v.config.ID)
+			continue
+		}
+		log.Printf("Device %v has no bridge object, removing it from VM %v", id, v.config.ID)
+		if err := mon.DeleteDevice(id); err != nil {
+			log.Printf("Couldn't delete device %v: %v", id, err)
+			result = err
+		}
+	}
+
+	// chardevs can be removed only after devices using them
+	for id := range chardevs {
+		if device, ok := expected[id]; (ok && device.withChardev) || !strings.HasPrefix(id, qemuIDPrefix) {
+			continue
+		}
+		stray = append(stray, StrayDevice{VMID: v.config.ID, ID: id, Chardev: true})
+		if !removeStray {
+			log.Printf("Chardev %v has no bridge object in VM %v", id, v.config.ID)
+			continue
+		}
+		log.Printf("Chardev %v has no bridge object, removing it from VM %v", id, v.config.ID)
+		if err := mon.DeleteChardev(id); err != nil {
+			log.Printf("Couldn't delete chardev %v: %v", id, err)
+			result = err
+		}
+	}
+	sort.Slice(stray, func(i int, j int) bool {
+		if stray[i].Chardev != stray[j].Chardev {
+			return !stray[i].Chardev
+		}
+		return stray[i].ID < stray[j].ID
+	})
+	return stray, result
+}
+
+// expectedQemuDevices maps QEMU IDs to devices of bridge objects which are
+// expected to be plugged to the VM
+func (s *Server) expectedQemuDevices(v *vm) map[string]qemuDevice {
+	expected := map[string]qemuDevice{}
+	_, vfiouserBlk := s.Server.VirtioBlkTransport().(*virtioBlkVfiouserTransport)
+	for _, blk := range s.Virt.BlkCtrls {
+		blk := blk
+		if blk.GetPcieId().GetPortId().GetValue() != v.config.PortID {
+			continue
+		}
+		expected[toQemuID(blk.Name)] = qemuDevice{
+			withChardev: !vfiouserBlk,
+			endpoint:    blk.PcieId,
+			plug: func(mon hypervisor, location deviceLocation) error {
+				return s.plugVirtioBlk(mon, v, blk, location, nil)
+			},
+		}
+	}
+	for _, scsiCtrl := range s.Virt.ScsiCtrls {
+		scsiCtrl := scsiCtrl
+		if scsiCtrl.GetPcieId().GetPortId().GetValue() != v.config.PortID {
+			continue
+		}
+		expected[toQemuID(scsiCtrl.Name)] = qemuDevice{
+			withChardev: true,
+			endpoint:    scsiCtrl.PcieId,
+			plug: func(mon hypervisor, location deviceLocation) error {
+				return s.plugVirtioScsiController(mon, v, scsiCtrl, location, nil)
+			},
+		}
+	}
+	for _, ctrlr := range s.Nvme.Controllers {
+		ctrlr := ctrlr
+		if ctrlr.GetSpec().GetTrtype() != pb.NvmeTransportType_NVME_TRANSPORT_TYPE_PCIE ||
+			ctrlr.GetSpec().GetPcieId().GetPortId().GetValue() != v.config.PortID {
+			continue
+		}
+		expected[toQemuID(ctrlr.Name)] = qemuDevice{
+			endpoint: ctrlr.GetSpec().GetPcieId(),
+			plug: func(mon hypervisor, location deviceLocation) error {
+				dirName, err := s.findDirName(ctrlr.Name)
+				if err != nil {
+					return err
+				}
+				return s.plugNvmeController(mon, v, ctrlr.Name, dirName, location, nil)
+			},
+		}
+	}
+	return expected
+}
@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/philippgille/gokv/gomap"
+
+	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReconcile(t *testing.T) {
+	testStrayID := "stray-42"
+	tests := map[string]struct {
+		withVirtioBlk        bool
+		nonDefaultQmpAddress string
+		removeStray          bool
+		stray                []StrayDevice
+		errCode              codes.Code
+		errMsg               string
+
+		mockQmpCalls *mockQmpCalls
+	}{
+		"devices are in sync": {
+			withVirtioBlk: true,
+			errCode:       codes.OK,
+			errMsg:        "",
+			mockQmpCalls: newMockQmpCalls().
+				ExpectQueryPci(testVirtioBlkID).
+				ExpectQueryChardev(testVirtioBlkID),
+		},
+		"missing device is plugged": {
+			withVirtioBlk: true,
+			errCode:       codes.OK,
+			errMsg:        "",
+			mockQmpCalls: newMockQmpCalls().
+				ExpectNoDeviceQueryPci().
+				ExpectQueryChardev().
+				ExpectAddChardev(testVirtioBlkID).
+				ExpectAddVirtioBlk(testVirtioBlkID, testVirtioBlkID).
+				ExpectQueryPci(testVirtioBlkID),
+		},
+		"missing device with present chardev is plugged": {
+			withVirtioBlk: true,
+			errCode:       codes.OK,
+			errMsg:        "",
+			mockQmpCalls: newMockQmpCalls().
+				ExpectNoDeviceQueryPci().
+				ExpectQueryChardev(testVirtioBlkID).
+				ExpectAddChardev(testVirtioBlkID).WithErrorResponse().
+				ExpectQueryChardev(testVirtioBlkID).
+				ExpectAddVirtioBlk(testVirtioBlkID, testVirtioBlkID).
+				ExpectQueryPci(testVirtioBlkID),
+		},
+		"devices without bridge objects after restart are kept": {
+			withVirtioBlk: false,
+			stray: []StrayDevice{
+				{VMID: DefaultVMID, ID: toQemuID(testStrayID)},
+				{VMID: DefaultVMID, ID: toQemuID(testVirtioBlkID)},
+				{VMID: DefaultVMID, ID: toQemuID(testVirtioBlkID), Chardev: true},
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+			mockQmpCalls: newMockQmpCalls().
+				ExpectQueryPci(testVirtioBlkID, testStrayID).
+				ExpectQueryChardev(testVirtioBlkID),
+		},
+		"stray device and chardev are removed on request": {
+			withVirtioBlk: false,
+			removeStray:   true,
+			stray: []StrayDevice{
+				{VMID: DefaultVMID, ID: toQemuID(testStrayID)},
+				{VMID: DefaultVMID, ID: toQemuID(testStrayID), Chardev: true},
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+			mockQmpCalls: newMockQmpCalls().
+				ExpectQueryPci(testStrayID).
+				ExpectQueryChardev(testStrayID).
+				expectDeleteDevice(testStrayID).
+				ExpectNoDeviceQueryPci().
+				ExpectDeleteChardev(testStrayID),
+		},
+		"failed to plug missing device": {
+			withVirtioBlk: true,
+			errCode:       status.Convert(errReconcileFailed).Code(),
+			errMsg:        status.Convert(errReconcileFailed).Message(),
+			mockQmpCalls: newMockQmpCalls().
+				ExpectNoDeviceQueryPci().
+				ExpectQueryChardev().
+				ExpectAddChardev(testVirtioBlkID).WithErrorResponse().
+				ExpectQueryChardev(),
+		},
+		"failed to create monitor": {
+			withVirtioBlk:        true,
+			nonDefaultQmpAddress: "/dev/null",
+			errCode:              status.Convert(errReconcileFailed).Code(),
+			errMsg:               status.Convert(errReconcileFailed).Message(),
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			options := gomap.DefaultOptions
+			options.Codec = utils.ProtoCodec{}
+			store := gomap.NewStore(options)
+			opiSpdkServer := frontend.NewServer(alwaysSuccessfulJSONRPC, store)
+			if tt.withVirtioBlk {
+				opiSpdkServer.Virt.BlkCtrls[testVirtioBlkName] =
+					utils.ProtoClone(testCreateVirtioBlkRequest.VirtioBlk)
+				opiSpdkServer.Virt.BlkCtrls[testVirtioBlkName].Name = testVirtioBlkName
+			}
+			qmpServer := startMockQmpServer(t, tt.mockQmpCalls)
+			defer qmpServer.Stop()
+			qmpAddress := qmpServer.socketPath
+			if tt.nonDefaultQmpAddress != "" {
+				qmpAddress = tt.nonDefaultQmpAddress
+			}
+			kvmServer := NewServer(opiSpdkServer, qmpAddress, qmpServer.testDir, nil)
+			kvmServer.timeout = qmplibTimeout
+
+			response, err := kvmServer.Reconcile(context.Background(), &ReconcileRequest{RemoveStrayDevices: tt.removeStray})
+
+			var stray []StrayDevice
+			if response != nil {
+				stray = response.StrayDevices
+			}
+			if len(stray) != 0 || len(tt.stray) != 0 {
+				if !reflect.DeepEqual(stray, tt.stray) {
+					t.Error("stray devices: expected", tt.stray, "received", stray)
+				}
+			}
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+
+			if !qmpServer.WereExpectedCallsPerformed() {
+				t.Errorf("Not all expected calls were performed")
+			}
+		})
+	}
+}
+
+func TestReconcileReservesLocationOfPluggedDevice(t *testing.T) {
+	options := gomap.DefaultOptions
+	options.Codec = utils.ProtoCodec{}
+	opiSpdkServer := frontend.NewServer(alwaysSuccessfulJSONRPC, gomap.NewStore(options))
+	opiSpdkServer.Virt.BlkCtrls[testVirtioBlkName] = utils.ProtoClone(testCreateVirtioBlkRequest.VirtioBlk)
+	opiSpdkServer.Virt.BlkCtrls[testVirtioBlkName].Name = testVirtioBlkName
+	qmpServer := startMockQmpServer(t, newMockQmpCalls().
+		ExpectQueryPciWithBusDevice("pci.opi.1", 10, testVirtioBlkID).
+		ExpectQueryChardev(testVirtioBlkID).
+		ExpectQueryPciWithBusDevice("pci.opi.1", 10, testVirtioBlkID))
+	defer qmpServer.Stop()
+	kvmServer := NewServer(opiSpdkServer, qmpServer.socketPath, qmpServer.testDir, []string{"pci.opi.0", "pci.opi.1"})
+	kvmServer.timeout = qmplibTimeout
+
+	if _, err := kvmServer.Reconcile(context.Background(), &ReconcileRequest{}); err != nil {
+		t.Fatal("expected no error, received", err)
+	}
+
+	locator := kvmServer.vms[DefaultVMID].locator.(*busDeviceLocator)
+	want := map[pciAddress]string{{bus: "pci.opi.1", slot: 10}: toQemuID(testVirtioBlkID)}
+	if !reflect.DeepEqual(locator.reserved, want) {
+		t.Error("reserved: expected", want, "received", locator.reserved)
+	}
+	if !qmpServer.WereExpectedCallsPerformed() {
+		t.Errorf("Not all expected calls were performed")
+	}
+}
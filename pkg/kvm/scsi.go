@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2023 Intel Corporation
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// CreateVirtioScsiController creates a virtio-scsi controller and attaches it to QEMU instance
+func (s *Server) CreateVirtioScsiController(ctx context.Context, in *pb.CreateVirtioScsiControllerRequest) (*pb.VirtioScsiController, error) {
+	if in.VirtioScsiController.PcieId == nil {
+		log.Println("Pci endpoint should be specified")
+		return nil, errNoPcieEndpoint
+	}
+
+	v, err := s.vmForEndpoint(in.VirtioScsiController.PcieId)
+	if err != nil {
+		return nil, err
+	}
+	if !v.config.Hypervisor.supportsVirtioScsi() {
+		log.Println("virtio-scsi is not supported by", v.config.Hypervisor)
+		return nil, errNotSupportedByHypervisor
+	}
+
+	location, err := v.locator.Calculate(in.VirtioScsiController.PcieId)
+	if err != nil {
+		log.Println("Failed to calculate device location:", err)
+		return nil, errDeviceEndpoint
+	}
+
+	op := s.journal.begin(&journalEntry{
+		Operation: operationCreate,
+		Object:    objectVirtioScsiController,
+		VMID:      v.config.ID,
+	})
+	out, err := s.Server.CreateVirtioScsiController(ctx, in)
+	if err != nil {
+		log.Println("Error running cmd on opi-spdk bridge:", err)
+		s.journal.finish(op)
+		return out, err
+	}
+	s.journal.created(op, out.Name, out, nil)
+
+	mon, err := v.connectMonitor()
+	if err != nil {
+		log.Println("Couldn't create QEMU monitor")
+		s.rollback(op, nil)
+		return nil, errMonitorCreation
+	}
+
+	if err := s.plugVirtioScsiController(mon, v, out, location, op); err != nil {
+		s.rollback(op, mon)
+		return nil, err
+	}
+	s.journal.finish(op)
+
+	return out, nil
+}
+
+// plugVirtioScsiController reserves location and adds QEMU chardev and
+// device of virtio-scsi controller created in SPDK. Added objects are
+// recorded in op, so that they are removed if the operation is rolled back.
+func (s *Server) plugVirtioScsiController(mon hypervisor, v *vm, scsiCtrl *pb.VirtioScsiController,
+	location deviceLocation, op *journalEntry) error {
+	qemuDevID := toQemuID(scsiCtrl.Name)
+	location, err := v.reserveLocation(mon, qemuDevID, location)
+	if err != nil {
+		return err
+	}
+
+	ctrlr := filepath.Join(v.config.CtrlrDir, filepath.Base(scsiCtrl.Name))
+	qemuChardevID := toQemuID(scsiCtrl.Name)
+	if err := mon.AddChardev(qemuChardevID, ctrlr); err != nil {
+		log.Println("Couldn't add chardev:", err)
+		v.locator.Release(qemuDevID)
+		return errAddChardevFailed
+	}
+	s.journal.stepDone(op, stepChardev)
+
+	if err := mon.AddVirtioScsiDevice(qemuDevID, qemuChardevID, location); err != nil {
+		log.Println("Couldn't add device:", err)
+		if mon.DeleteChardev(qemuChardevID) == nil {
+			s.journal.stepUndone(op, stepChardev)
+		}
+		v.locator.Release(qemuDevID)
+		return errAddDeviceFailed
+	}
+	s.journal.stepDone(op, stepDevice)
+	return nil
+}
+
+// DeleteVirtioScsiController deletes a virtio-scsi controller and detaches it from QEMU instance
+func (s *Server) DeleteVirtioScsiController(ctx context.Context, in *pb.DeleteVirtioScsiControllerRequest) (*emptypb.Empty, error) {
+	// do not unplug controller from QEMU if SPDK refuses to delete it anyway
+	for _, lun := range s.Virt.ScsiLuns {
+		if lun.TargetNameRef == in.Name {
+			log.Println("Virtio-scsi controller still has LUNs:", in.Name)
+			return nil, errScsiLunsExist
+		}
+	}
+
+	scsiCtrl, ok := s.Virt.ScsiCtrls[in.Name]
+	if !ok {
+		return s.Server.DeleteVirtioScsiController(ctx, in)
+	}
+	v, vmErr := s.vmForEndpoint(scsiCtrl.PcieId)
+	if vmErr != nil {
+		return nil, vmErr
+	}
+
+	mon, monErr := v.connectMonitor()
+	if monErr != nil {
+		log.Println("Couldn't create QEMU monitor")
+		return nil, errMonitorCreation
+	}
+
+	op := s.beginDelete(objectVirtioScsiController, in.Name, v, scsiCtrl)
+	return s.runDelete(ctx, op, mon)
+}
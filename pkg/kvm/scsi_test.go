@@ -0,0 +1,286 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2023 Intel Corporation
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/philippgille/gokv/gomap"
+
+	"github.com/opiproject/gospdk/spdk"
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var (
+	testVirtioScsiID            = "virtio-scsi-42"
+	testVirtioScsiName          = utils.ResourceIDToVolumeName(testVirtioScsiID)
+	testCreateVirtioScsiRequest = &pb.CreateVirtioScsiControllerRequest{
+		VirtioScsiControllerId: testVirtioScsiID,
+		VirtioScsiController: &pb.VirtioScsiController{
+			PcieId: &pb.PciEndpoint{
+				PhysicalFunction: wrapperspb.Int32(42),
+				VirtualFunction:  wrapperspb.Int32(0),
+				PortId:           wrapperspb.Int32(0),
+			},
+		},
+	}
+	testDeleteVirtioScsiRequest = &pb.DeleteVirtioScsiControllerRequest{Name: testVirtioScsiName}
+)
+
+func TestCreateVirtioScsiController(t *testing.T) {
+	expectNotNilOut := utils.ProtoClone(testCreateVirtioScsiRequest.VirtioScsiController)
+	expectNotNilOut.Name = testVirtioScsiName
+	t.Cleanup(utils.CheckTestProtoObjectsNotChanged(expectNotNilOut)(t, t.Name()))
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+
+	tests := map[string]struct {
+		jsonRPC              spdk.JSONRPC
+		errCode              codes.Code
+		errMsg               string
+		nonDefaultQmpAddress string
+		buses                []string
+
+		in  *pb.CreateVirtioScsiControllerRequest
+		out *pb.VirtioScsiController
+
+		mockQmpCalls *mockQmpCalls
+	}{
+		"valid virtio-scsi creation": {
+			in:      testCreateVirtioScsiRequest,
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			out:     expectNotNilOut,
+			mockQmpCalls: newMockQmpCalls().
+				ExpectAddChardev(testVirtioScsiID).
+				ExpectAddVirtioScsi(testVirtioScsiID, testVirtioScsiID).
+				ExpectQueryPci(testVirtioScsiID),
+		},
+		"spdk failed to create virtio-scsi": {
+			in:      testCreateVirtioScsiRequest,
+			jsonRPC: alwaysFailingJSONRPC,
+			errCode: status.Convert(errStub).Code(),
+			errMsg:  status.Convert(errStub).Message(),
+		},
+		"qemu chardev add failed": {
+			in:      testCreateVirtioScsiRequest,
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			errCode: status.Convert(errAddChardevFailed).Code(),
+			errMsg:  status.Convert(errAddChardevFailed).Message(),
+			mockQmpCalls: newMockQmpCalls().
+				ExpectAddChardev(testVirtioScsiID).WithErrorResponse().
+				ExpectQueryChardev(),
+		},
+		"qemu device add failed": {
+			in:      testCreateVirtioScsiRequest,
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			errCode: status.Convert(errAddDeviceFailed).Code(),
+			errMsg:  status.Convert(errAddDeviceFailed).Message(),
+			mockQmpCalls: newMockQmpCalls().
+				ExpectAddChardev(testVirtioScsiID).
+				ExpectAddVirtioScsi(testVirtioScsiID, testVirtioScsiID).WithErrorResponse().
+				ExpectNoDeviceQueryPci().
+				ExpectDeleteChardev(testVirtioScsiID),
+		},
+		"failed to create monitor": {
+			in:                   testCreateVirtioScsiRequest,
+			nonDefaultQmpAddress: "/dev/null",
+			jsonRPC:              alwaysSuccessfulJSONRPC,
+			errCode:              status.Convert(errMonitorCreation).Code(),
+			errMsg:               status.Convert(errMonitorCreation).Message(),
+		},
+		"valid virtio-scsi creation with on second bus location": {
+			in:      testCreateVirtioScsiRequest,
+			out:     expectNotNilOut,
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			buses:   []string{"pci.opi.0", "pci.opi.1"},
+			mockQmpCalls: newMockQmpCalls().
+				ExpectNoDeviceQueryPci().
+				ExpectAddChardev(testVirtioScsiID).
+				ExpectAddVirtioScsiWithAddress(testVirtioScsiID, testVirtioScsiID, "pci.opi.1", 10).
+				ExpectQueryPci(testVirtioScsiID),
+		},
+		"virtio-scsi creation with physical function goes out of buses": {
+			in:      testCreateVirtioScsiRequest,
+			out:     nil,
+			errCode: status.Convert(errDeviceEndpoint).Code(),
+			errMsg:  status.Convert(errDeviceEndpoint).Message(),
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			buses:   []string{"pci.opi.0"},
+		},
+		"nil pcie endpoint": {
+			in: &pb.CreateVirtioScsiControllerRequest{
+				VirtioScsiController:   &pb.VirtioScsiController{PcieId: nil},
+				VirtioScsiControllerId: testVirtioScsiID,
+			},
+			out:     nil,
+			errCode: status.Convert(errNoPcieEndpoint).Code(),
+			errMsg:  status.Convert(errNoPcieEndpoint).Message(),
+			jsonRPC: alwaysSuccessfulJSONRPC,
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			options := gomap.DefaultOptions
+			options.Codec = utils.ProtoCodec{}
+			store := gomap.NewStore(options)
+			opiSpdkServer := frontend.NewServer(tt.jsonRPC, store)
+			qmpServer := startMockQmpServer(t, tt.mockQmpCalls)
+			defer qmpServer.Stop()
+			qmpAddress := qmpServer.socketPath
+			if tt.nonDefaultQmpAddress != "" {
+				qmpAddress = tt.nonDefaultQmpAddress
+			}
+			kvmServer := NewServer(opiSpdkServer, qmpAddress, qmpServer.testDir, tt.buses)
+			kvmServer.timeout = qmplibTimeout
+			request := utils.ProtoClone(tt.in)
+
+			out, err := kvmServer.CreateVirtioScsiController(context.Background(), request)
+
+			if !proto.Equal(out, tt.out) {
+				t.Error("response: expected", tt.out, "received", out)
+			}
+
+			if er, ok := status.FromError(err); ok {
+				if er.Code() != tt.errCode {
+					t.Error("error code: expected", tt.errCode, "received", er.Code())
+				}
+				if er.Message() != tt.errMsg {
+					t.Error("error message: expected", tt.errMsg, "received", er.Message())
+				}
+			} else {
+				t.Errorf("expected grpc error status")
+			}
+
+			if !qmpServer.WereExpectedCallsPerformed() {
+				t.Errorf("Not all expected calls were performed")
+			}
+			if _, ok := opiSpdkServer.Virt.ScsiCtrls[testVirtioScsiName]; ok != (tt.out != nil) {
+				t.Error("controller stored: expected", tt.out != nil, "received", ok)
+			}
+		})
+	}
+}
+
+func TestDeleteVirtioScsiController(t *testing.T) {
+	t.Cleanup(checkGlobalTestProtoObjectsNotChanged(t, t.Name()))
+	tests := map[string]struct {
+		jsonRPC              spdk.JSONRPC
+		errCode              codes.Code
+		errMsg               string
+		nonDefaultQmpAddress string
+		lun                  bool
+
+		mockQmpCalls *mockQmpCalls
+	}{
+		"valid virtio-scsi deletion": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteVirtioScsiWithEvent(testVirtioScsiID).
+				ExpectDeleteChardev(testVirtioScsiID),
+		},
+		"qemu device delete failed": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			errCode: status.Convert(errDevicePartiallyDeleted).Code(),
+			errMsg:  status.Convert(errDevicePartiallyDeleted).Message(),
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteVirtioScsi(testVirtioScsiID).WithErrorResponse().
+				ExpectQueryPci(testVirtioScsiID).
+				ExpectDeleteChardev(testVirtioScsiID),
+		},
+		"qemu chardev delete failed": {
+			jsonRPC: alwaysSuccessfulJSONRPC,
+			errCode: status.Convert(errDevicePartiallyDeleted).Code(),
+			errMsg:  status.Convert(errDevicePartiallyDeleted).Message(),
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteVirtioScsiWithEvent(testVirtioScsiID).
+				ExpectDeleteChardev(testVirtioScsiID).WithErrorResponse().
+				ExpectQueryChardev(testVirtioScsiID),
+		},
+		"spdk failed to delete virtio-scsi": {
+			jsonRPC: alwaysFailingJSONRPC,
+			errCode: status.Convert(errDevicePartiallyDeleted).Code(),
+			errMsg:  status.Convert(errDevicePartiallyDeleted).Message(),
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteVirtioScsiWithEvent(testVirtioScsiID).
+				ExpectDeleteChardev(testVirtioScsiID),
+		},
+		"all qemu and spdk calls failed": {
+			jsonRPC: alwaysFailingJSONRPC,
+			errCode: status.Convert(errDeviceNotDeleted).Code(),
+			errMsg:  status.Convert(errDeviceNotDeleted).Message(),
+			mockQmpCalls: newMockQmpCalls().
+				ExpectDeleteVirtioScsi(testVirtioScsiID).WithErrorResponse().
+				ExpectQueryPci(testVirtioScsiID).
+				ExpectDeleteChardev(testVirtioScsiID).WithErrorResponse().
+				ExpectQueryChardev(testVirtioScsiID),
+		},
+		"controller with luns is not unplugged": {
+			jsonRPC:      alwaysSuccessfulJSONRPC,
+			errCode:      status.Convert(errScsiLunsExist).Code(),
+			errMsg:       status.Convert(errScsiLunsExist).Message(),
+			lun:          true,
+			mockQmpCalls: newMockQmpCalls(),
+		},
+		"failed to create monitor": {
+			nonDefaultQmpAddress: "/dev/null",
+			jsonRPC:              alwaysSuccessfulJSONRPC,
+			errCode:              status.Convert(errMonitorCreation).Code(),
+			errMsg:               status.Convert(errMonitorCreation).Message(),
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			options := gomap.DefaultOptions
+			options.Codec = utils.ProtoCodec{}
+			store := gomap.NewStore(options)
+			opiSpdkServer := frontend.NewServer(tt.jsonRPC, store)
+			opiSpdkServer.Virt.ScsiCtrls[testVirtioScsiName] =
+				utils.ProtoClone(testCreateVirtioScsiRequest.VirtioScsiController)
+			opiSpdkServer.Virt.ScsiCtrls[testVirtioScsiName].Name = testVirtioScsiName
+			if tt.lun {
+				lunName := utils.ResourceIDToVolumeName("virtio-scsi-lun-42")
+				opiSpdkServer.Virt.ScsiLuns[lunName] = &pb.VirtioScsiLun{
+					Name:          lunName,
+					TargetNameRef: testVirtioScsiName,
+					VolumeNameRef: "Malloc42",
+				}
+			}
+			qmpServer := startMockQmpServer(t, tt.mockQmpCalls)
+			defer qmpServer.Stop()
+			qmpAddress := qmpServer.socketPath
+			if tt.nonDefaultQmpAddress != "" {
+				qmpAddress = tt.nonDefaultQmpAddress
+			}
+			kvmServer := NewServer(opiSpdkServer, qmpAddress, qmpServer.testDir, nil)
+			kvmServer.timeout = qmplibTimeout
+			request := utils.ProtoClone(testDeleteVirtioScsiRequest)
+
+			_, err := kvmServer.DeleteVirtioScsiController(context.Background(), request)
+
+			if er, ok := status.FromError(err); ok {
+				if er.Code() != tt.errCode {
+					t.Error("error code: expected", tt.errCode, "received", er.Code())
+				}
+				if er.Message() != tt.errMsg {
+					t.Error("error message: expected", tt.errMsg, "received", er.Message())
+				}
+			} else {
+				t.Errorf("expected grpc error status")
+			}
+
+			if !qmpServer.WereExpectedCallsPerformed() {
+				t.Errorf("Not all expected calls were performed")
+			}
+		})
+	}
+}
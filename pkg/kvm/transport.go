@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
 
 	"github.com/opiproject/gospdk/spdk"
 	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
@@ -21,6 +22,8 @@ import (
 type nvmeVfiouserTransport struct {
 	ctrlrDir string
 	rpc      spdk.JSONRPC
+	// ready is set once VFIOUSER transport is known to exist in SPDK
+	ready bool
 }
 
 // build time check that struct implements interface
@@ -55,19 +58,18 @@ func (c *nvmeVfiouserTransport) CreateController(
 	ctrlr *pb.NvmeController,
 	subsys *pb.NvmeSubsystem,
 ) error {
-	pcieID := ctrlr.GetSpec().GetPcieId()
-	if pcieID.PortId.Value != 0 {
-		return status.Error(codes.InvalidArgument, "only port 0 is supported for vfiouser")
-	}
-
-	if pcieID.VirtualFunction.Value != 0 {
-		return status.Error(codes.InvalidArgument, "virtual functions are not supported for vfiouser")
-	}
-
 	if subsys.Spec.Hostnqn != "" {
 		return status.Error(codes.InvalidArgument, "hostnqn for subsystem is not supported for vfiouser")
 	}
 
+	if !c.ready {
+		err := frontend.EnsureNvmfTransport(ctx, c.rpc, "VFIOUSER", frontend.NvmfTransportOptions{})
+		if err != nil {
+			return err
+		}
+		c.ready = true
+	}
+
 	params := c.params(ctrlr, subsys)
 	var result spdk.NvmfSubsystemAddListenerResult
 	err := c.rpc.Call(ctx, "nvmf_subsystem_add_listener", &params, &result)
@@ -115,3 +117,97 @@ func (c *nvmeVfiouserTransport) params(
 
 	return params
 }
+
+type vfuVirtioCreateBlkEndpointParams struct {
+	Name      string `json:"name"`
+	BdevName  string `json:"bdev_name"`
+	Cpumask   string `json:"cpumask,omitempty"`
+	NumQueues int    `json:"num_queues,omitempty"`
+}
+
+type vfuVirtioDeleteEndpointParams struct {
+	Name string `json:"name"`
+}
+
+type virtioBlkVfiouserTransport struct {
+	ctrlrDir string
+}
+
+// build time check that struct implements interface
+var _ frontend.VirtioBlkTransport = (*virtioBlkVfiouserTransport)(nil)
+
+// NewVirtioBlkVfiouserTransport creates objects to handle vfio-user virtio-blk
+// transport specifics. SPDK places endpoint sockets into vfu_tgt base path,
+// which is expected to be set to ctrlrDir.
+func NewVirtioBlkVfiouserTransport(ctrlrDir string) frontend.VirtioBlkTransport {
+	if ctrlrDir == "" {
+		log.Panicf("ctrlrDir cannot be empty")
+	}
+
+	dir, err := os.Stat(ctrlrDir)
+	if err != nil {
+		log.Panicf("%v path cannot be evaluated", ctrlrDir)
+	}
+	if !dir.IsDir() {
+		log.Panicf("%v is not a directory", ctrlrDir)
+	}
+
+	return &virtioBlkVfiouserTransport{
+		ctrlrDir: ctrlrDir,
+	}
+}
+
+func (v *virtioBlkVfiouserTransport) CreateMethod() string {
+	return "vfu_virtio_create_blk_endpoint"
+}
+
+func (v *virtioBlkVfiouserTransport) CreateParams(virtioBlk *pb.VirtioBlk) (any, error) {
+	return vfuVirtioCreateBlkEndpointParams{
+		Name:      path.Base(virtioBlk.Name),
+		BdevName:  virtioBlk.VolumeNameRef,
+		NumQueues: int(virtioBlk.MaxIoQps),
+	}, nil
+}
+
+func (v *virtioBlkVfiouserTransport) DeleteMethod() string {
+	return "vfu_virtio_delete_endpoint"
+}
+
+func (v *virtioBlkVfiouserTransport) DeleteParams(virtioBlk *pb.VirtioBlk) (any, error) {
+	return vfuVirtioDeleteEndpointParams{
+		Name: path.Base(virtioBlk.Name),
+	}, nil
+}
+
+type virtioBlkVhostUserTransport struct{}
+
+// build time check that struct implements interface
+var _ frontend.VirtioBlkTransport = (*virtioBlkVhostUserTransport)(nil)
+
+// NewVirtioBlkVhostUserTransport creates objects to handle vhost-user
+// virtio-blk transport specifics for QEMU instances. Unlike the frontend
+// transport, any port is accepted since the port selects the VM.
+func NewVirtioBlkVhostUserTransport() frontend.VirtioBlkTransport {
+	return &virtioBlkVhostUserTransport{}
+}
+
+func (v *virtioBlkVhostUserTransport) CreateMethod() string {
+	return "vhost_create_blk_controller"
+}
+
+func (v *virtioBlkVhostUserTransport) CreateParams(virtioBlk *pb.VirtioBlk) (any, error) {
+	return spdk.VhostCreateBlkControllerParams{
+		Ctrlr:   path.Base(virtioBlk.Name),
+		DevName: virtioBlk.VolumeNameRef,
+	}, nil
+}
+
+func (v *virtioBlkVhostUserTransport) DeleteMethod() string {
+	return "vhost_delete_controller"
+}
+
+func (v *virtioBlkVhostUserTransport) DeleteParams(virtioBlk *pb.VirtioBlk) (any, error) {
+	return spdk.VhostDeleteControllerParams{
+		Ctrlr: path.Base(virtioBlk.Name),
+	}, nil
+}
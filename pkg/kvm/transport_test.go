@@ -82,22 +82,6 @@ func TestNvmeVfiouserTransportCreateController(t *testing.T) {
 		wantErr    bool
 		wantParams any
 	}{
-		"not allowed vf": {
-			pf:         0,
-			vf:         1,
-			port:       0,
-			hostnqn:    "",
-			wantErr:    true,
-			wantParams: nil,
-		},
-		"not allowed port": {
-			pf:         0,
-			vf:         0,
-			port:       2,
-			hostnqn:    "",
-			wantErr:    true,
-			wantParams: nil,
-		},
 		"not allowed hostnqn in subsystem": {
 			pf:         0,
 			vf:         0,
@@ -108,7 +92,7 @@ func TestNvmeVfiouserTransportCreateController(t *testing.T) {
 		},
 		"successful params": {
 			pf:      3,
-			vf:      0,
+			vf:      2,
 			port:    0,
 			hostnqn: "",
 			wantErr: false,
@@ -163,3 +147,207 @@ func TestNvmeVfiouserTransportCreateController(t *testing.T) {
 		})
 	}
 }
+
+func TestNewVirtioBlkVfiouserTransport(t *testing.T) {
+	tests := map[string]struct {
+		ctrlrDir  string
+		wantPanic bool
+	}{
+		"valid controller dir": {
+			ctrlrDir:  ".",
+			wantPanic: false,
+		},
+		"empty string for controller dir": {
+			ctrlrDir:  "",
+			wantPanic: true,
+		},
+		"non existing path": {
+			ctrlrDir:  "this/is/some/non/existing/path",
+			wantPanic: true,
+		},
+		"ctrlrDir points to non-directory": {
+			ctrlrDir:  "/dev/null",
+			wantPanic: true,
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if (r != nil) != tt.wantPanic {
+					t.Errorf("NewVirtioBlkVfiouserTransport() recover = %v, wantPanic = %v", r, tt.wantPanic)
+				}
+			}()
+
+			gotTransport := NewVirtioBlkVfiouserTransport(tt.ctrlrDir)
+			wantTransport := &virtioBlkVfiouserTransport{
+				ctrlrDir: tt.ctrlrDir,
+			}
+
+			if !reflect.DeepEqual(gotTransport, wantTransport) {
+				t.Errorf("Received transport %v not equal to expected one %v", gotTransport, wantTransport)
+			}
+		})
+	}
+}
+
+func TestVirtioBlkVfiouserTransportParams(t *testing.T) {
+	tests := map[string]struct {
+		vf           int32
+		port         int32
+		wantErr      bool
+		createParams any
+		deleteParams any
+	}{
+		"valid virtio-blk": {
+			vf:      0,
+			port:    0,
+			wantErr: false,
+			createParams: vfuVirtioCreateBlkEndpointParams{
+				Name:      testVirtioBlkID,
+				BdevName:  "Malloc42",
+				NumQueues: 2,
+			},
+			deleteParams: vfuVirtioDeleteEndpointParams{
+				Name: testVirtioBlkID,
+			},
+		},
+		"not zero virtual function": {
+			vf:      1,
+			port:    0,
+			wantErr: false,
+			createParams: vfuVirtioCreateBlkEndpointParams{
+				Name:      testVirtioBlkID,
+				BdevName:  "Malloc42",
+				NumQueues: 2,
+			},
+			deleteParams: vfuVirtioDeleteEndpointParams{
+				Name: testVirtioBlkID,
+			},
+		},
+		"not zero port": {
+			vf:      0,
+			port:    1,
+			wantErr: false,
+			createParams: vfuVirtioCreateBlkEndpointParams{
+				Name:      testVirtioBlkID,
+				BdevName:  "Malloc42",
+				NumQueues: 2,
+			},
+			deleteParams: vfuVirtioDeleteEndpointParams{
+				Name: testVirtioBlkID,
+			},
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			transport := NewVirtioBlkVfiouserTransport(".")
+			virtioBlk := &pb.VirtioBlk{
+				Name: testVirtioBlkName,
+				PcieId: &pb.PciEndpoint{
+					PhysicalFunction: wrapperspb.Int32(1),
+					VirtualFunction:  wrapperspb.Int32(tt.vf),
+					PortId:           wrapperspb.Int32(tt.port),
+				},
+				VolumeNameRef: "Malloc42",
+				MaxIoQps:      2,
+			}
+
+			createParams, err := transport.CreateParams(virtioBlk)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, received %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(createParams, tt.createParams) {
+				t.Errorf("Expected create params %v, received %v", tt.createParams, createParams)
+			}
+
+			deleteParams, err := transport.DeleteParams(virtioBlk)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, received %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(deleteParams, tt.deleteParams) {
+				t.Errorf("Expected delete params %v, received %v", tt.deleteParams, deleteParams)
+			}
+		})
+	}
+}
+
+func TestVirtioBlkVhostUserTransportParams(t *testing.T) {
+	tests := map[string]struct {
+		vf           int32
+		port         int32
+		wantErr      bool
+		createParams any
+		deleteParams any
+	}{
+		"valid virtio-blk": {
+			vf:      0,
+			port:    0,
+			wantErr: false,
+			createParams: spdk.VhostCreateBlkControllerParams{
+				Ctrlr:   testVirtioBlkID,
+				DevName: "Malloc42",
+			},
+			deleteParams: spdk.VhostDeleteControllerParams{
+				Ctrlr: testVirtioBlkID,
+			},
+		},
+		"not zero port": {
+			vf:      0,
+			port:    1,
+			wantErr: false,
+			createParams: spdk.VhostCreateBlkControllerParams{
+				Ctrlr:   testVirtioBlkID,
+				DevName: "Malloc42",
+			},
+			deleteParams: spdk.VhostDeleteControllerParams{
+				Ctrlr: testVirtioBlkID,
+			},
+		},
+		"not zero virtual function": {
+			vf:      1,
+			port:    0,
+			wantErr: false,
+			createParams: spdk.VhostCreateBlkControllerParams{
+				Ctrlr:   testVirtioBlkID,
+				DevName: "Malloc42",
+			},
+			deleteParams: spdk.VhostDeleteControllerParams{
+				Ctrlr: testVirtioBlkID,
+			},
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			transport := NewVirtioBlkVhostUserTransport()
+			virtioBlk := &pb.VirtioBlk{
+				Name: testVirtioBlkName,
+				PcieId: &pb.PciEndpoint{
+					PhysicalFunction: wrapperspb.Int32(1),
+					VirtualFunction:  wrapperspb.Int32(tt.vf),
+					PortId:           wrapperspb.Int32(tt.port),
+				},
+				VolumeNameRef: "Malloc42",
+			}
+
+			createParams, err := transport.CreateParams(virtioBlk)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, received %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(createParams, tt.createParams) {
+				t.Errorf("Expected create params %v, received %v", tt.createParams, createParams)
+			}
+
+			deleteParams, err := transport.DeleteParams(virtioBlk)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, received %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(deleteParams, tt.deleteParams) {
+				t.Errorf("Expected delete params %v, received %v", tt.deleteParams, deleteParams)
+			}
+		})
+	}
+}
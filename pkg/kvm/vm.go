@@ -0,0 +1,283 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultVMID is ID of the VM registered by NewServer
+const DefaultVMID = "default"
+
+// TODO: opi-api has no VM resource, so VMs are registered by the extension
+// API or configuration and selected by port_id of requested PciEndpoint
+// until it is added.
+
+// VMConfig describes VM to plug SPDK devices to
+type VMConfig struct {
+	// ID identifies the VM in the registry
+	ID string `json:"id"`
+	// PortID is port_id of PciEndpoint of devices plugged to the VM
+	PortID int32 `json:"portId"`
+	// Hypervisor selects hotplug backend. Empty means HypervisorQemu
+	Hypervisor Hypervisor `json:"hypervisor,omitempty"`
+	// QmpAddress points to QMP unix socket/tcp socket of QEMU VM
+	QmpAddress string `json:"qmpAddress,omitempty"`
+	// APISocket points to API unix socket of Cloud Hypervisor VM or of
+	// libvirt daemon managing the VM
+	APISocket string `json:"apiSocket,omitempty"`
+	// Domain is libvirt domain name of the VM
+	Domain string `json:"domain,omitempty"`
+	// CtrlrDir is directory with SPDK device sockets as seen by the VM.
+	// It can differ from SPDK one if the directory is mounted into a sandbox.
+	CtrlrDir string `json:"ctrlrDir"`
+	// Buses are QEMU PCI buses IDs to attach devices on. Empty means device
+	// location is assigned by the hypervisor
+	Buses []string `json:"buses,omitempty"`
+}
+
+type vm struct {
+	config   VMConfig
+	protocol string
+	locator  deviceLocator
+	// hv is created on first use to pick up timeouts configured after the
+	// server creation
+	hv hypervisor
+}
+
+func (c *VMConfig) validate() (string, error) {
+	if c.ID == "" {
+		return "", status.Error(codes.InvalidArgument, "missing required field: vm id")
+	}
+	if c.PortID < 0 {
+		msg := fmt.Sprintf("negative port is not allowed: %d", c.PortID)
+		return "", status.Errorf(codes.InvalidArgument, msg)
+	}
+	if c.CtrlrDir == "" {
+		return "", status.Error(codes.InvalidArgument, "missing required field: ctrlr dir")
+	}
+	if err := validateBuses(c.Buses); err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	switch c.Hypervisor {
+	case HypervisorQemu:
+		protocol, err := getProtocol(c.QmpAddress)
+		if err != nil {
+			return "", status.Error(codes.InvalidArgument, err.Error())
+		}
+		return protocol, nil
+	case HypervisorCloudHypervisor:
+		if c.APISocket == "" {
+			return "", status.Error(codes.InvalidArgument, "missing required field: api socket")
+		}
+		if len(c.Buses) != 0 {
+			return "", status.Error(codes.InvalidArgument, "buses are not supported for cloud-hypervisor")
+		}
+		return unixSocketProtocol, nil
+	case HypervisorLibvirt:
+		if c.APISocket == "" {
+			return "", status.Error(codes.InvalidArgument, "missing required field: api socket")
+		}
+		if c.Domain == "" {
+			return "", status.Error(codes.InvalidArgument, "missing required field: domain")
+		}
+		return unixSocketProtocol, nil
+	default:
+		msg := fmt.Sprintf("unknown hypervisor: %s", c.Hypervisor)
+		return "", status.Errorf(codes.InvalidArgument, msg)
+	}
+}
+
+// RegisterVM adds VM to plug devices requested on its port to. Pending
+// operations of the VM are resumed if it is registered after startup.
+func (s *Server) RegisterVM(config VMConfig) error {
+	if config.Hypervisor == "" {
+		config.Hypervisor = HypervisorQemu
+	}
+	protocol, err := config.validate()
+	if err != nil {
+		return err
+	}
+
+	s.vmsMu.Lock()
+	if _, ok := s.vms[config.ID]; ok {
+		s.vmsMu.Unlock()
+		msg := fmt.Sprintf("VM %s already exists", config.ID)
+		return status.Errorf(codes.AlreadyExists, msg)
+	}
+	for _, v := range s.vms {
+		if v.config.PortID == config.PortID {
+			s.vmsMu.Unlock()
+			msg := fmt.Sprintf("port %d is already used by VM %s", config.PortID, v.config.ID)
+			return status.Errorf(codes.AlreadyExists, msg)
+		}
+	}
+	config.Buses = append([]string{}, config.Buses...)
+	s.vms[config.ID] = &vm{
+		config:   config,
+		protocol: protocol,
+		locator:  newDeviceLocator(config.Buses),
+	}
+	resume := s.resumeOnRegister
+	s.vmsMu.Unlock()
+	log.Printf("Registered %v VM %v on port %v", config.Hypervisor, config.ID, config.PortID)
+
+	if resume {
+		s.resumePendingOperationsOfVM(config.ID)
+	}
+	return nil
+}
+
+// DeregisterVM removes VM without devices from the registry
+func (s *Server) DeregisterVM(id string) error {
+	s.vmsMu.Lock()
+	v, ok := s.vms[id]
+	if !ok {
+		s.vmsMu.Unlock()
+		return status.Errorf(codes.NotFound, "unable to find key %s", id)
+	}
+	if s.portInUse(v.config.PortID) {
+		s.vmsMu.Unlock()
+		msg := fmt.Sprintf("VM %s still has devices plugged", id)
+		return status.Errorf(codes.FailedPrecondition, msg)
+	}
+	delete(s.vms, id)
+	s.vmsMu.Unlock()
+
+	log.Printf("Deregistered VM %v", id)
+	if v.hv != nil {
+		_ = v.hv.Disconnect()
+	}
+	return nil
+}
+
+// ListVMs lists registered VMs sorted by ID
+func (s *Server) ListVMs() []VMConfig {
+	s.vmsMu.Lock()
+	defer s.vmsMu.Unlock()
+	configs := []VMConfig{}
+	for _, v := range s.vms {
+		config := v.config
+		config.Buses = append([]string{}, v.config.Buses...)
+		configs = append(configs, config)
+	}
+	sort.Slice(configs, func(i int, j int) bool {
+		return configs[i].ID < configs[j].ID
+	})
+	return configs
+}
+
+func (s *Server) portInUse(port int32) bool {
+	for _, ctrlr := range s.Nvme.Controllers {
+		if ctrlr.GetSpec().GetTrtype() == pb.NvmeTransportType_NVME_TRANSPORT_TYPE_PCIE &&
+			ctrlr.GetSpec().GetPcieId().GetPortId().GetValue() == port {
+			return true
+		}
+	}
+	for _, blk := range s.Virt.BlkCtrls {
+		if blk.GetPcieId().GetPortId().GetValue() == port {
+			return true
+		}
+	}
+	for _, scsi := range s.Virt.ScsiCtrls {
+		if scsi.GetPcieId().GetPortId().GetValue() == port {
+			return true
+		}
+	}
+	return false
+}
+
+// vmForEndpoint finds VM which devices are requested on the endpoint port
+func (s *Server) vmForEndpoint(endpoint *pb.PciEndpoint) (*vm, error) {
+	port := endpoint.GetPortId().GetValue()
+	s.vmsMu.Lock()
+	defer s.vmsMu.Unlock()
+	for _, v := range s.vms {
+		if v.config.PortID == port {
+			s.initHypervisorLocked(v)
+			return v, nil
+		}
+	}
+	log.Printf("No VM registered for port %v", port)
+	return nil, errNoVM
+}
+
+func (s *Server) vmByID(id string) (*vm, error) {
+	s.vmsMu.Lock()
+	defer s.vmsMu.Unlock()
+	v, ok := s.vms[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unable to find key %s", id)
+	}
+	s.initHypervisorLocked(v)
+	return v, nil
+}
+
+// CheckVMs checks that hypervisors of all registered VMs are reachable. It
+// does not wait for running hotplug operations, so VMs stay ready during them.
+func (s *Server) CheckVMs() error {
+	s.vmsMu.Lock()
+	vms := make([]*vm, 0, len(s.vms))
+	for _, v := range s.vms {
+		s.initHypervisorLocked(v)
+		vms = append(vms, v)
+	}
+	s.vmsMu.Unlock()
+
+	for _, v := range vms {
+		mon, err := v.connectMonitor()
+		if err != nil {
+			return fmt.Errorf("VM %v is not reachable: %w", v.config.ID, err)
+		}
+		if err := mon.Ping(); err != nil {
+			return fmt.Errorf("VM %v is not reachable: %w", v.config.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) initHypervisorLocked(v *vm) {
+	if v.hv != nil {
+		return
+	}
+	switch v.config.Hypervisor {
+	case HypervisorCloudHypervisor:
+		v.hv = newCloudHypervisor(v.config.APISocket, s.timeout, s.pollDevicePresenceStep)
+	case HypervisorLibvirt:
+		v.hv = newLibvirtHypervisor(newLibvirtConnection(v.config.APISocket, s.timeout),
+			v.config.Domain, s.timeout, s.pollDevicePresenceStep)
+	default:
+		v.hv = newMonitor(v.config.QmpAddress, v.protocol, s.timeout, s.pollDevicePresenceStep)
+	}
+}
+
+// reserveLocation reserves calculated location for device id checking
+// addresses already used in QEMU
+func (v *vm) reserveLocation(mon hypervisor, id string, location deviceLocation) (deviceLocation, error) {
+	location, err := v.locator.Reserve(id, location, mon.QueryPciAddresses)
+	if err != nil {
+		log.Println("Failed to reserve device location:", err)
+		if _, ok := status.FromError(err); ok {
+			return deviceLocation{}, err
+		}
+		return deviceLocation{}, errDeviceLocationNotReserved
+	}
+	return location, nil
+}
+
+func (v *vm) connectMonitor() (hypervisor, error) {
+	if err := v.hv.Connect(); err != nil {
+		return nil, err
+	}
+	return v.hv, nil
+}
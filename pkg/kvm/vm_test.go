@@ -0,0 +1,361 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package kvm automates plugging of SPDK devices to a QEMU instance
+package kvm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/philippgille/gokv/gomap"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"github.com/opiproject/opi-spdk-bridge/pkg/frontend"
+	"github.com/opiproject/opi-spdk-bridge/pkg/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRegisterVM(t *testing.T) {
+	tests := map[string]struct {
+		config  VMConfig
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid vm": {
+			config:  VMConfig{ID: "vm1", PortID: 1, QmpAddress: "localhost:4444", CtrlrDir: "/tmp"},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"duplicated id": {
+			config:  VMConfig{ID: DefaultVMID, PortID: 1, QmpAddress: "localhost:4444", CtrlrDir: "/tmp"},
+			errCode: codes.AlreadyExists,
+			errMsg:  "VM default already exists",
+		},
+		"duplicated port": {
+			config:  VMConfig{ID: "vm1", PortID: 0, QmpAddress: "localhost:4444", CtrlrDir: "/tmp"},
+			errCode: codes.AlreadyExists,
+			errMsg:  "port 0 is already used by VM default",
+		},
+		"empty id": {
+			config:  VMConfig{PortID: 1, QmpAddress: "localhost:4444", CtrlrDir: "/tmp"},
+			errCode: codes.InvalidArgument,
+			errMsg:  "missing required field: vm id",
+		},
+		"negative port": {
+			config:  VMConfig{ID: "vm1", PortID: -1, QmpAddress: "localhost:4444", CtrlrDir: "/tmp"},
+			errCode: codes.InvalidArgument,
+			errMsg:  "negative port is not allowed: -1",
+		},
+		"empty ctrlr dir": {
+			config:  VMConfig{ID: "vm1", PortID: 1, QmpAddress: "localhost:4444"},
+			errCode: codes.InvalidArgument,
+			errMsg:  "missing required field: ctrlr dir",
+		},
+		"invalid qmp address": {
+			config:  VMConfig{ID: "vm1", PortID: 1, QmpAddress: "", CtrlrDir: "/tmp"},
+			errCode: codes.InvalidArgument,
+			errMsg:  "unknown protocol for ",
+		},
+		"valid cloud-hypervisor vm": {
+			config: VMConfig{
+				ID: "vm1", PortID: 1, Hypervisor: HypervisorCloudHypervisor,
+				APISocket: "/tmp/ch.sock", CtrlrDir: "/tmp",
+			},
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"cloud-hypervisor vm without api socket": {
+			config: VMConfig{
+				ID: "vm1", PortID: 1, Hypervisor: HypervisorCloudHypervisor, CtrlrDir: "/tmp",
+			},
+			errCode: codes.InvalidArgument,
+			errMsg:  "missing required field: api socket",
+		},
+		"cloud-hypervisor vm with buses": {
+			config: VMConfig{
+				ID: "vm1", PortID: 1, Hypervisor: HypervisorCloudHypervisor,
+				APISocket: "/tmp/ch.sock", CtrlrDir: "/tmp", Buses: []string{"pci.opi.0"},
+			},
+			errCode: codes.InvalidArgument,
+			errMsg:  "buses are not supported for cloud-hypervisor",
+		},
+		"libvirt vm without domain": {
+			config: VMConfig{
+				ID: "vm1", PortID: 1, Hypervisor: HypervisorLibvirt,
+				APISocket: "/var/run/libvirt/libvirt-sock", CtrlrDir: "/tmp",
+			},
+			errCode: codes.InvalidArgument,
+			errMsg:  "missing required field: domain",
+		},
+		"unknown hypervisor": {
+			config: VMConfig{
+				ID: "vm1", PortID: 1, Hypervisor: "xen", QmpAddress: "localhost:4444", CtrlrDir: "/tmp",
+			},
+			errCode: codes.InvalidArgument,
+			errMsg:  "unknown hypervisor: xen",
+		},
+		"duplicated bus": {
+			config: VMConfig{
+				ID: "vm1", PortID: 1, QmpAddress: "localhost:4444", CtrlrDir: "/tmp",
+				Buses: []string{"pci.opi.0", "pci.opi.0"},
+			},
+			errCode: codes.InvalidArgument,
+			errMsg:  "duplicated bus pci.opi.0",
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qmpServer := startMockQmpServer(t, nil)
+			defer qmpServer.Stop()
+			kvmServer := newTestKvmServer(qmpServer)
+
+			err := kvmServer.RegisterVM(tt.config)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+
+			wantVMs := 1
+			if tt.errCode == codes.OK {
+				wantVMs = 2
+			}
+			if vms := kvmServer.ListVMs(); len(vms) != wantVMs {
+				t.Error("expected", wantVMs, "VMs, received", vms)
+			}
+		})
+	}
+}
+
+func TestDeregisterVM(t *testing.T) {
+	tests := map[string]struct {
+		id      string
+		devices bool
+		errCode codes.Code
+		errMsg  string
+	}{
+		"valid deregistration": {
+			id:      "vm1",
+			devices: false,
+			errCode: codes.OK,
+			errMsg:  "",
+		},
+		"unknown vm": {
+			id:      "unknown",
+			devices: false,
+			errCode: codes.NotFound,
+			errMsg:  "unable to find key unknown",
+		},
+		"vm with devices": {
+			id:      "vm1",
+			devices: true,
+			errCode: codes.FailedPrecondition,
+			errMsg:  "VM vm1 still has devices plugged",
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qmpServer := startMockQmpServer(t, nil)
+			defer qmpServer.Stop()
+			kvmServer := newTestKvmServer(qmpServer)
+			err := kvmServer.RegisterVM(VMConfig{
+				ID: "vm1", PortID: 1, QmpAddress: "localhost:4444", CtrlrDir: "/tmp",
+			})
+			if err != nil {
+				t.Fatal("expected VM to be registered, received", err)
+			}
+			if tt.devices {
+				kvmServer.Virt.BlkCtrls[testVirtioBlkName] = &pb.VirtioBlk{
+					Name: testVirtioBlkName,
+					PcieId: &pb.PciEndpoint{
+						PhysicalFunction: wrapperspb.Int32(1),
+						VirtualFunction:  wrapperspb.Int32(0),
+						PortId:           wrapperspb.Int32(1),
+					},
+				}
+			}
+
+			err = kvmServer.DeregisterVM(tt.id)
+
+			er := status.Convert(err)
+			if er.Code() != tt.errCode {
+				t.Error("error code: expected", tt.errCode, "received", er.Code())
+			}
+			if er.Message() != tt.errMsg {
+				t.Error("error message: expected", tt.errMsg, "received", er.Message())
+			}
+		})
+	}
+}
+
+func TestListVMs(t *testing.T) {
+	qmpServer := startMockQmpServer(t, nil)
+	defer qmpServer.Stop()
+	kvmServer := newTestKvmServer(qmpServer)
+	vm1 := VMConfig{
+		ID: "vm1", PortID: 1, QmpAddress: "localhost:4444", CtrlrDir: "/tmp",
+		Buses: []string{"pci.opi.0"},
+	}
+	if err := kvmServer.RegisterVM(vm1); err != nil {
+		t.Fatal("expected VM to be registered, received", err)
+	}
+
+	vm1.Hypervisor = HypervisorQemu
+	want := []VMConfig{
+		{
+			ID: DefaultVMID, PortID: 0, Hypervisor: HypervisorQemu,
+			QmpAddress: qmpServer.socketPath, CtrlrDir: qmpServer.testDir, Buses: []string{},
+		},
+		vm1,
+	}
+	if vms := kvmServer.ListVMs(); !reflect.DeepEqual(vms, want) {
+		t.Error("expected", want, "received", vms)
+	}
+}
+
+func TestCheckVMs(t *testing.T) {
+	tests := map[string]struct {
+		nonDefaultQmpAddress string
+		mockQmpCalls         *mockQmpCalls
+		wantErr              bool
+	}{
+		"reachable vm": {
+			mockQmpCalls: newMockQmpCalls().ExpectQueryStatus(),
+			wantErr:      false,
+		},
+		"query failed": {
+			mockQmpCalls: newMockQmpCalls().ExpectQueryStatus().WithErrorResponse(),
+			wantErr:      true,
+		},
+		"failed to create monitor": {
+			nonDefaultQmpAddress: "/dev/null",
+			wantErr:              true,
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qmpServer := startMockQmpServer(t, tt.mockQmpCalls)
+			defer qmpServer.Stop()
+			qmpAddress := qmpServer.socketPath
+			if tt.nonDefaultQmpAddress != "" {
+				qmpAddress = tt.nonDefaultQmpAddress
+			}
+			options := gomap.DefaultOptions
+			options.Codec = utils.ProtoCodec{}
+			opiSpdkServer := frontend.NewServer(alwaysSuccessfulJSONRPC, gomap.NewStore(options))
+			kvmServer := NewServer(opiSpdkServer, qmpAddress, qmpServer.testDir, nil)
+			kvmServer.timeout = qmplibTimeout
+
+			err := kvmServer.CheckVMs()
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, received %v", tt.wantErr, err)
+			}
+			if !qmpServer.WereExpectedCallsPerformed() {
+				t.Errorf("Not all expected calls were performed")
+			}
+		})
+	}
+}
+
+func TestCheckVMsDoesNotWaitForDeviceOperations(t *testing.T) {
+	qmpServer := startMockQmpServer(t, newMockQmpCalls().ExpectQueryStatus())
+	defer qmpServer.Stop()
+	options := gomap.DefaultOptions
+	options.Codec = utils.ProtoCodec{}
+	opiSpdkServer := frontend.NewServer(alwaysSuccessfulJSONRPC, gomap.NewStore(options))
+	kvmServer := NewServer(opiSpdkServer, qmpServer.socketPath, qmpServer.testDir, nil)
+	kvmServer.timeout = qmplibTimeout
+	defer func() { _ = kvmServer.Close() }()
+	v, err := kvmServer.vmByID(DefaultVMID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// emulate hotplug waiting for guest to release the device
+	mon := v.hv.(*monitor)
+	mon.opMu.Lock()
+	defer mon.opMu.Unlock()
+
+	checked := make(chan error, 1)
+	go func() { checked <- kvmServer.CheckVMs() }()
+	select {
+	case err := <-checked:
+		if err != nil {
+			t.Errorf("Expected VM to be reachable, received %v", err)
+		}
+	case <-time.After(qmplibTimeout):
+		t.Fatal("Expected VM check not to wait for running device operation")
+	}
+	if !qmpServer.WereExpectedCallsPerformed() {
+		t.Errorf("Not all expected calls were performed")
+	}
+}
+
+func TestVirtioBlkOnSecondVM(t *testing.T) {
+	qmpServer := startMockQmpServer(t, nil)
+	defer qmpServer.Stop()
+	secondQmpServer := startMockQmpServer(t, newMockQmpCalls().
+		ExpectAddChardev(testVirtioBlkID).
+		ExpectAddVirtioBlk(testVirtioBlkID, testVirtioBlkID).
+		ExpectQueryPci(testVirtioBlkID).
+		ExpectDeleteVirtioBlkWithEvent(testVirtioBlkID).
+		ExpectDeleteChardev(testVirtioBlkID))
+	defer secondQmpServer.Stop()
+
+	options := gomap.DefaultOptions
+	options.Codec = utils.ProtoCodec{}
+	store := gomap.NewStore(options)
+	opiSpdkServer := frontend.NewCustomizedServer(alwaysSuccessfulJSONRPC, store,
+		map[pb.NvmeTransportType]frontend.NvmeTransport{
+			pb.NvmeTransportType_NVME_TRANSPORT_TYPE_TCP: frontend.NewNvmeTCPTransport(alwaysSuccessfulJSONRPC),
+		},
+		NewVirtioBlkVhostUserTransport(),
+	)
+	kvmServer := NewServer(opiSpdkServer, qmpServer.socketPath, qmpServer.testDir, nil)
+	kvmServer.timeout = qmplibTimeout
+	defer func() { _ = kvmServer.Close() }()
+	err := kvmServer.RegisterVM(VMConfig{
+		ID:         "vm1",
+		PortID:     1,
+		QmpAddress: secondQmpServer.socketPath,
+		CtrlrDir:   secondQmpServer.testDir,
+	})
+	if err != nil {
+		t.Fatal("expected VM to be registered, received", err)
+	}
+
+	request := utils.ProtoClone(testCreateVirtioBlkRequest)
+	request.VirtioBlk.PcieId.PortId = wrapperspb.Int32(1)
+	if _, err := kvmServer.CreateVirtioBlk(context.Background(), request); err != nil {
+		t.Fatal("expected virtio-blk to be created, received", err)
+	}
+	if err := kvmServer.DeregisterVM("vm1"); status.Code(err) != codes.FailedPrecondition {
+		t.Error("expected", codes.FailedPrecondition, "received", err)
+	}
+	if _, err := kvmServer.DeleteVirtioBlk(context.Background(), testDeleteVirtioBlkRequest); err != nil {
+		t.Error("expected virtio-blk to be deleted, received", err)
+	}
+
+	request.VirtioBlk.PcieId.PortId = wrapperspb.Int32(2)
+	if _, err := kvmServer.CreateVirtioBlk(context.Background(), request); err != errNoVM {
+		t.Error("expected", errNoVM, "received", err)
+	}
+
+	if !qmpServer.WereExpectedCallsPerformed() {
+		t.Errorf("Not all expected calls were performed on default VM")
+	}
+	if !secondQmpServer.WereExpectedCallsPerformed() {
+		t.Errorf("Not all expected calls were performed on second VM")
+	}
+}
@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package utils contains useful helper functions
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/opiproject/gospdk/spdk"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const dhchapSecretPrefix = "DHHC-1:"
+
+var (
+	dhchapDigests  = []string{"sha256", "sha384", "sha512"}
+	dhchapDhGroups = []string{"null", "ffdhe2048", "ffdhe3072", "ffdhe4096", "ffdhe6144", "ffdhe8192"}
+)
+
+// Prefixes of DH-HMAC-CHAP key names in SPDK keyring. They keep names of
+// subsystems and remote controllers with the same resource ID apart.
+const (
+	DhchapSubsystemKeyPrefix        = "subsys-"
+	DhchapRemoteControllerKeyPrefix = "rctrl-"
+)
+
+// DhchapConfig holds DH-HMAC-CHAP in-band authentication secrets
+type DhchapConfig struct {
+	// HostKey is DHHC-1 secret the host authenticates with
+	HostKey []byte `json:"hostKey"`
+	// CtrlrKey is DHHC-1 secret the controller authenticates with. If set,
+	// authentication is bidirectional.
+	CtrlrKey []byte `json:"ctrlrKey,omitempty"`
+}
+
+// DhchapKeys holds names of DH-HMAC-CHAP secrets registered in SPDK keyring
+type DhchapKeys struct {
+	HostKey  string
+	CtrlrKey string
+	files    map[string]string
+}
+
+type keyringFileAddKeyParams struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type keyringFileRemoveKeyParams struct {
+	Name string `json:"name"`
+}
+
+type keyringFileKeyResult bool
+
+// Validate checks DH-HMAC-CHAP secrets format
+func (c *DhchapConfig) Validate() error {
+	if len(c.HostKey) == 0 {
+		return status.Error(codes.InvalidArgument, "missing DH-HMAC-CHAP host key")
+	}
+	for _, key := range [][]byte{c.HostKey, c.CtrlrKey} {
+		if len(key) > 0 && !strings.HasPrefix(string(key), dhchapSecretPrefix) {
+			return status.Error(codes.InvalidArgument, "DH-HMAC-CHAP secret has to be in DHHC-1 format")
+		}
+	}
+	return nil
+}
+
+// ValidateDhchapDigests checks that all digests are supported by DH-HMAC-CHAP
+func ValidateDhchapDigests(digests []string) error {
+	return validateDhchapChoices("digest", digests, dhchapDigests)
+}
+
+// ValidateDhchapDhGroups checks that all DH groups are supported by DH-HMAC-CHAP
+func ValidateDhchapDhGroups(dhGroups []string) error {
+	return validateDhchapChoices("DH group", dhGroups, dhchapDhGroups)
+}
+
+func validateDhchapChoices(kind string, choices []string, supported []string) error {
+	for _, choice := range choices {
+		found := false
+		for _, s := range supported {
+			if choice == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("not supported DH-HMAC-CHAP %s: %v", kind, choice)
+		}
+	}
+	return nil
+}
+
+// AddDhchapKeys writes DH-HMAC-CHAP secrets into files and registers them
+// in SPDK keyring with names starting with prefix, which has to be unique
+// among all objects, e.g. DhchapSubsystemKeyPrefix followed by resource ID. Files are kept until the
+// keys are removed by RemoveDhchapKeys since SPDK reads them on use.
+func AddDhchapKeys(ctx context.Context, rpc spdk.JSONRPC, prefix string, config *DhchapConfig,
+	keyToTemporaryFile func(key []byte) (string, error)) (*DhchapKeys, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	keys := &DhchapKeys{files: map[string]string{}}
+	add := func(name string, key []byte) error {
+		keyFile, err := keyToTemporaryFile(key)
+		if err != nil {
+			return err
+		}
+		keys.files[name] = keyFile
+		params := keyringFileAddKeyParams{
+			Name: name,
+			Path: keyFile,
+		}
+		var result keyringFileKeyResult
+		err = rpc.Call(ctx, "keyring_file_add_key", &params, &result)
+		if err != nil {
+			return err
+		}
+		log.Printf("Received from SPDK: %v", result)
+		if !result {
+			msg := fmt.Sprintf("Could not add key %s to keyring", name)
+			return status.Errorf(codes.InvalidArgument, msg)
+		}
+		return nil
+	}
+
+	if err := add(prefix+"-dhchap-host", config.HostKey); err != nil {
+		keys.cleanup(ctx, rpc)
+		return nil, err
+	}
+	keys.HostKey = prefix + "-dhchap-host"
+	if len(config.CtrlrKey) > 0 {
+		if err := add(prefix+"-dhchap-ctrlr", config.CtrlrKey); err != nil {
+			keys.cleanup(ctx, rpc)
+			return nil, err
+		}
+		keys.CtrlrKey = prefix + "-dhchap-ctrlr"
+	}
+	return keys, nil
+}
+
+// RemoveDhchapKeys removes DH-HMAC-CHAP secrets from SPDK keyring along with
+// their files. Removed keys are cleared in keys, so the call can be retried
+// after a failure.
+func RemoveDhchapKeys(ctx context.Context, rpc spdk.JSONRPC, keys *DhchapKeys) error {
+	for _, name := range []*string{&keys.CtrlrKey, &keys.HostKey} {
+		if *name == "" {
+			continue
+		}
+		params := keyringFileRemoveKeyParams{
+			Name: *name,
+		}
+		var result keyringFileKeyResult
+		err := rpc.Call(ctx, "keyring_file_remove_key", &params, &result)
+		if err != nil {
+			return err
+		}
+		log.Printf("Received from SPDK: %v", result)
+		if !result {
+			msg := fmt.Sprintf("Could not remove key %s from keyring", *name)
+			return status.Errorf(codes.InvalidArgument, msg)
+		}
+		removeKeyFile(keys.files[*name])
+		delete(keys.files, *name)
+		*name = ""
+	}
+	return nil
+}
+
+// cleanup rolls back partially registered keys
+func (k *DhchapKeys) cleanup(ctx context.Context, rpc spdk.JSONRPC) {
+	if k.HostKey != "" {
+		if err := RemoveDhchapKeys(ctx, rpc, k); err != nil {
+			log.Printf("error: failed to remove DH-HMAC-CHAP keys: %v", err)
+		}
+	}
+	for _, keyFile := range k.files {
+		removeKeyFile(keyFile)
+	}
+}
+
+func removeKeyFile(keyFile string) {
+	err := os.Remove(keyFile)
+	log.Printf("Cleanup key file %v: %v", keyFile, err)
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2024 Dell Inc, or its subsidiaries.
+
+// Package utils contains useful helper functions
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDhchapConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		config    DhchapConfig
+		wantError bool
+	}{
+		"unidirectional": {
+			config:    DhchapConfig{HostKey: []byte("DHHC-1:00:ia6zGodOr7SGyzRyCq9CqR9pq4W8a8tISgFqvvhv4Bs6hyMl:")},
+			wantError: false,
+		},
+		"bidirectional": {
+			config: DhchapConfig{
+				HostKey:  []byte("DHHC-1:00:ia6zGodOr7SGyzRyCq9CqR9pq4W8a8tISgFqvvhv4Bs6hyMl:"),
+				CtrlrKey: []byte("DHHC-1:01:cNbn1ma4Uu0qbcyYKqK+ahiyBIYFh8U3s6GOH8qWlxJ2qV3h:"),
+			},
+			wantError: false,
+		},
+		"no host key": {
+			config:    DhchapConfig{CtrlrKey: []byte("DHHC-1:01:cNbn1ma4Uu0qbcyYKqK+ahiyBIYFh8U3s6GOH8qWlxJ2qV3h:")},
+			wantError: true,
+		},
+		"not DHHC-1 controller key": {
+			config: DhchapConfig{
+				HostKey:  []byte("DHHC-1:00:ia6zGodOr7SGyzRyCq9CqR9pq4W8a8tISgFqvvhv4Bs6hyMl:"),
+				CtrlrKey: []byte("NVMeTLSkey-1:01:MDAxMTIyMzM0NDU1NjY3Nzg4OTlhYWJiY2NkZGVlZmZwJEiQ:"),
+			},
+			wantError: true,
+		},
+	}
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			err := tt.config.Validate()
+
+			if tt.wantError != (err != nil) {
+				t.Errorf("expected error: %v, received: %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestValidateDhchapChoices(t *testing.T) {
+	tests := map[string]struct {
+		digests   []string
+		dhGroups  []string
+		wantError bool
+	}{
+		"empty": {
+			digests:   nil,
+			dhGroups:  nil,
+			wantError: false,
+		},
+		"supported": {
+			digests:   []string{"sha256", "sha384", "sha512"},
+			dhGroups:  []string{"null", "ffdhe2048", "ffdhe8192"},
+			wantError: false,
+		},
+		"unknown digest": {
+			digests:   []string{"sha256", "sha1"},
+			dhGroups:  nil,
+			wantError: true,
+		},
+		"unknown DH group": {
+			digests:   nil,
+			dhGroups:  []string{"ecdh"},
+			wantError: true,
+		},
+	}
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			err := ValidateDhchapDigests(tt.digests)
+			if err == nil {
+				err = ValidateDhchapDhGroups(tt.dhGroups)
+			}
+
+			if tt.wantError != (err != nil) {
+				t.Errorf("expected error: %v, received: %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestRemoveDhchapKeysRetry(t *testing.T) {
+	dir := t.TempDir()
+	hostFile := filepath.Join(dir, "host")
+	ctrlrFile := filepath.Join(dir, "ctrlr")
+	for _, file := range []string{hostFile, ctrlrFile} {
+		if err := os.WriteFile(file, []byte("DHHC-1:00:secret:"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := &DhchapKeys{
+		HostKey:  "subsys-test-dhchap-host",
+		CtrlrKey: "subsys-test-dhchap-ctrlr",
+		files: map[string]string{
+			"subsys-test-dhchap-host":  hostFile,
+			"subsys-test-dhchap-ctrlr": ctrlrFile,
+		},
+	}
+	ln, rpc := CreateTestSpdkServer(GenerateSocketName("dhchap"), []string{
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+		`{"id":%d,"error":{"code":-19,"message":"No such device"},"result":false}`,
+		`{"id":%d,"error":{"code":0,"message":""},"result":true}`,
+	})
+	defer ln.Close()
+
+	if err := RemoveDhchapKeys(context.Background(), rpc, keys); err == nil {
+		t.Fatal("expected error on host key removal")
+	}
+	if keys.CtrlrKey != "" || keys.HostKey != "subsys-test-dhchap-host" {
+		t.Error("expected only controller key to be cleared, received", keys.HostKey, keys.CtrlrKey)
+	}
+	if _, err := os.Stat(ctrlrFile); !os.IsNotExist(err) {
+		t.Error("expected controller key file to be removed, received", err)
+	}
+
+	if err := RemoveDhchapKeys(context.Background(), rpc, keys); err != nil {
+		t.Fatal("expected no error on retry, received", err)
+	}
+	if keys.CtrlrKey != "" || keys.HostKey != "" {
+		t.Error("expected all keys to be cleared, received", keys.HostKey, keys.CtrlrKey)
+	}
+	if _, err := os.Stat(hostFile); !os.IsNotExist(err) {
+		t.Error("expected host key file to be removed, received", err)
+	}
+}
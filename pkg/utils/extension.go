@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package utils contails useful helper functions
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ExtensionPathPrefix is HTTP path prefix of bridge APIs which opi-api has
+// no messages for yet. They are served next to the gRPC gateway.
+const ExtensionPathPrefix = "/v1/extensions/"
+
+// ExtensionRoute is a bridge API served by POST requests with JSON body to
+// ExtensionPathPrefix + Path, e.g. /v1/extensions/backend/CreateUringVolume
+type ExtensionRoute struct {
+	Path    string
+	Handler http.Handler
+}
+
+// RegisterExtensionRoutes registers routes on mux under ExtensionPathPrefix
+func RegisterExtensionRoutes(mux *http.ServeMux, routes []ExtensionRoute) {
+	for _, route := range routes {
+		mux.Handle(ExtensionPathPrefix+route.Path, route.Handler)
+	}
+}
+
+// ExtensionHandler creates HTTP handler decoding JSON request body into Req,
+// calling call and encoding its result as JSON. Proto messages are encoded
+// by protojson like the gRPC gateway does. Errors are reported with HTTP
+// status matching their gRPC code.
+func ExtensionHandler[Req any, Resp any](call func(context.Context, *Req) (*Resp, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeExtensionError(w, status.Error(codes.InvalidArgument, err.Error()))
+			return
+		}
+		in := new(Req)
+		if len(body) != 0 {
+			if err := unmarshalExtensionJSON(body, in); err != nil {
+				writeExtensionError(w, status.Error(codes.InvalidArgument, err.Error()))
+				return
+			}
+		}
+		out, err := call(r.Context(), in)
+		if err != nil {
+			log.Printf("error: extension call %v failed: %v", r.URL.Path, err)
+			writeExtensionError(w, err)
+			return
+		}
+		data, err := marshalExtensionJSON(out)
+		if err != nil {
+			writeExtensionError(w, status.Error(codes.Internal, err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
+
+func unmarshalExtensionJSON(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return protojson.Unmarshal(data, m)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func marshalExtensionJSON(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return protojson.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+func writeExtensionError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	data, _ := protojson.Marshal(st.Proto())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(runtime.HTTPStatusFromCode(st.Code()))
+	_, _ = w.Write(data)
+}
+
+// ProtoJSON holds proto message inside Go types served by the extension API
+// to encode it by protojson like the gRPC gateway does
+type ProtoJSON[M proto.Message] struct {
+	Message M
+}
+
+// MarshalJSON encodes the message by protojson
+func (p ProtoJSON[M]) MarshalJSON() ([]byte, error) {
+	return protojson.Marshal(p.Message)
+}
+
+// UnmarshalJSON decodes the message by protojson
+func (p *ProtoJSON[M]) UnmarshalJSON(data []byte) error {
+	m, ok := p.Message.ProtoReflect().Type().New().Interface().(M)
+	if !ok {
+		return status.Errorf(codes.Internal, "unexpected message type %T", p.Message)
+	}
+	if err := protojson.Unmarshal(data, m); err != nil {
+		return err
+	}
+	p.Message = m
+	return nil
+}
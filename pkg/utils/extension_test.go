@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package utils contails useful helper functions
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testExtensionRequest struct {
+	Name string `json:"name"`
+}
+
+type testExtensionResponse struct {
+	Names []string `json:"names"`
+}
+
+func TestExtensionHandler(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		path       string
+		body       string
+		statusCode int
+		response   string
+	}{
+		"go types": {
+			method:     http.MethodPost,
+			path:       "test/List",
+			body:       `{"name":"volume-1"}`,
+			statusCode: http.StatusOK,
+			response:   `{"names":["volume-1"]}`,
+		},
+		"proto messages": {
+			method:     http.MethodPost,
+			path:       "test/Get",
+			body:       `{"name":"volume-1"}`,
+			statusCode: http.StatusOK,
+			response:   `{"name":"volume-1"}`,
+		},
+		"empty body": {
+			method:     http.MethodPost,
+			path:       "test/List",
+			body:       "",
+			statusCode: http.StatusOK,
+			response:   `{"names":[""]}`,
+		},
+		"invalid body": {
+			method:     http.MethodPost,
+			path:       "test/List",
+			body:       `{"name":`,
+			statusCode: http.StatusBadRequest,
+			response:   `{"code":3,"message":"unexpected end of JSON input"}`,
+		},
+		"call error": {
+			method:     http.MethodPost,
+			path:       "test/Get",
+			body:       `{"name":"missing"}`,
+			statusCode: http.StatusNotFound,
+			response:   `{"code":5,"message":"unable to find key missing"}`,
+		},
+		"not allowed method": {
+			method:     http.MethodGet,
+			path:       "test/Get",
+			statusCode: http.StatusMethodNotAllowed,
+			response:   "Method Not Allowed\n",
+		},
+	}
+
+	mux := http.NewServeMux()
+	RegisterExtensionRoutes(mux, []ExtensionRoute{
+		{
+			Path: "test/List",
+			Handler: ExtensionHandler(func(_ context.Context, in *testExtensionRequest) (*testExtensionResponse, error) {
+				return &testExtensionResponse{Names: []string{in.Name}}, nil
+			}),
+		},
+		{
+			Path: "test/Get",
+			Handler: ExtensionHandler(func(_ context.Context, in *pb.GetAioVolumeRequest) (*pb.AioVolume, error) {
+				if in.Name == "missing" {
+					return nil, status.Errorf(codes.NotFound, "unable to find key %s", in.Name)
+				}
+				return &pb.AioVolume{Name: in.Name}, nil
+			}),
+		},
+	})
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tt.method, ExtensionPathPrefix+tt.path, strings.NewReader(tt.body))
+
+			mux.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.statusCode {
+				t.Errorf("Expected status code %v, received %v", tt.statusCode, recorder.Code)
+			}
+			// protojson randomly adds spaces to discourage byte comparison
+			response := strings.ReplaceAll(recorder.Body.String(), " ", "")
+			if response != strings.ReplaceAll(tt.response, " ", "") {
+				t.Errorf("Expected response %v, received %v", tt.response, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestProtoJSON(t *testing.T) {
+	type wrapper struct {
+		Request ProtoJSON[*pb.GetNvmeNamespaceRequest] `json:"request"`
+		Force   bool                                   `json:"force"`
+	}
+	in := `{"request":{"name":"volume-1"},"force":true}`
+
+	var w wrapper
+	if err := json.Unmarshal([]byte(in), &w); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if w.Request.Message.GetName() != "volume-1" || !w.Force {
+		t.Error("unexpected decoded value:", w.Request.Message, w.Force)
+	}
+
+	out, err := json.Marshal(w)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if string(out) != in {
+		t.Error("expected", in, "received", string(out))
+	}
+
+	if err := json.Unmarshal([]byte(`{"request":{"unknown":1}}`), &w); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
@@ -23,18 +23,26 @@ import (
 	pb "github.com/opiproject/opi-api/storage/v1alpha1/gen/go"
 )
 
+var (
+	defaultPageSize = 50
+	maxPageSize     = 250
+)
+
+// SetPaginationLimits sets page size used if it is not specified in List
+// request and max page size returned by List calls
+func SetPaginationLimits(defaultSize, maxSize int) {
+	defaultPageSize = defaultSize
+	maxPageSize = maxSize
+}
+
 // ExtractPagination is a helper function for List pagination to fetch PageSize and PageToken
 func ExtractPagination(pageSize int32, pageToken string, pagination map[string]int) (size int, offset int, err error) {
-	const (
-		maxPageSize     = 250
-		defaultPageSize = 50
-	)
 	switch {
 	case pageSize < 0:
 		return -1, -1, status.Error(codes.InvalidArgument, "negative PageSize is not allowed")
 	case pageSize == 0:
 		size = defaultPageSize
-	case pageSize > maxPageSize:
+	case int(pageSize) > maxPageSize:
 		size = maxPageSize
 	default:
 		size = int(pageSize)
@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package utils contails useful helper functions
+package utils
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// StopGrpcServer stops accepting new connections and waits for in-flight
+// calls to complete. If ctx is done before, the remaining calls are cancelled
+// and ctx error is returned.
+func StopGrpcServer(ctx context.Context, s *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		<-stopped
+		return ctx.Err()
+	}
+}
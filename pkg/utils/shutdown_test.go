@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (C) 2024 Dell Inc, or its subsidiaries.
+
+// Package utils contails useful helper functions
+package utils
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestStopGrpcServer(t *testing.T) {
+	tests := map[string]struct {
+		inFlightCall bool
+		timeout      time.Duration
+		wantErr      error
+	}{
+		"no in-flight calls": {
+			inFlightCall: false,
+			timeout:      time.Second,
+			wantErr:      nil,
+		},
+		"in-flight call exceeds deadline": {
+			inFlightCall: true,
+			timeout:      50 * time.Millisecond,
+			wantErr:      context.DeadlineExceeded,
+		},
+	}
+
+	for testName, tt := range tests {
+		t.Run(testName, func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := grpc.NewServer()
+			grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+			go func() { _ = server.Serve(lis) }()
+
+			if tt.inFlightCall {
+				conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer CloseGrpcConnection(conn)
+				// Watch call is kept open until the server stops
+				stream, err := grpc_health_v1.NewHealthClient(conn).Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := stream.Recv(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			err = StopGrpcServer(ctx, server)
+
+			if err != tt.wantErr {
+				t.Errorf("Expected error %v, received %v", tt.wantErr, err)
+			}
+		})
+	}
+}
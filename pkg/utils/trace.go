@@ -17,20 +17,48 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
+// TracerOptions configures OTLP exporter and sampling of TracerProvider
+type TracerOptions struct {
+	// Endpoint is host:port of OTLP collector. If empty,
+	// OTEL_EXPORTER_OTLP_ENDPOINT url is used
+	Endpoint string
+	// Insecure disables client transport security of the exporter
+	Insecure bool
+	// SamplingRatio is a fraction of sampled traces in [0, 1] range
+	SamplingRatio float64
+}
+
 // InitTracerProvider returns an OpenTelemetry TracerProvider configured to use
 // the OTLP exporter that will send spans to OTEL_EXPORTER_OTLP_ENDPOINT url.
 // The returned // TracerProvider will also use a Resource configured with all
 // the information about the application.
 func InitTracerProvider(service string) *sdktrace.TracerProvider {
+	return InitTracerProviderWithOptions(service, TracerOptions{SamplingRatio: 1})
+}
+
+// InitTracerProviderWithOptions returns an OpenTelemetry TracerProvider like
+// InitTracerProvider with non default exporter endpoint and sampling
+func InitTracerProviderWithOptions(service string, options TracerOptions) *sdktrace.TracerProvider {
 	ctx := context.Background()
-	exporter, err := otlptracegrpc.New(ctx)
+	var exporterOptions []otlptracegrpc.Option
+	if options.Endpoint != "" {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithEndpoint(options.Endpoint))
+	}
+	if options.Insecure {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOptions...)
 	if err != nil {
 		log.Panicf("OTLP Trace gRPC Creation: %v", err)
 	}
+	sampler := sdktrace.AlwaysSample()
+	if options.SamplingRatio < 1 {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SamplingRatio))
+	}
 	tp := sdktrace.NewTracerProvider(
 		// Always be sure to batch in production.
 		// sdktrace.WithBatcher(exporter),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSampler(sampler),
 		sdktrace.WithSyncer(exporter),
 		// Record information about this application in an Resource.
 		sdktrace.WithResource(sdkresource.NewWithAttributes(